@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 
 	"github.com/paulmach/orb"
@@ -656,6 +658,57 @@ func BenchmarkSpatialQuery_FlatGeobuf_Points_50000(b *testing.B) {
 // Memory Efficiency Benchmarks
 // =============================================================================
 
+// Batched spatial query benchmarks: a 6x6 grid of overlapping tile queries
+func BenchmarkSpatialQuery_FlatGeobuf_Tiles_Search(b *testing.B) {
+	benchmarkTileQueries(b, false)
+}
+
+func BenchmarkSpatialQuery_FlatGeobuf_Tiles_SearchMany(b *testing.B) {
+	benchmarkTileQueries(b, true)
+}
+
+func benchmarkTileQueries(b *testing.B, batched bool) {
+	r := rand.New(rand.NewSource(42))
+	fc := generateFeatureCollection(r, 10000, "point", false)
+
+	var buf bytes.Buffer
+	if err := WriteFeatures(&buf, fc, &Options{IncludeIndex: true}); err != nil {
+		b.Fatal(err)
+	}
+	reader, err := NewReaderFromData(buf.Bytes())
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var tiles []orb.Bound
+	for x := 0; x < 6; x++ {
+		for y := 0; y < 6; y++ {
+			minX, minY := -30+float64(x)*10, -30+float64(y)*10
+			tiles = append(tiles, orb.Bound{
+				Min: orb.Point{minX - 1, minY - 1},
+				Max: orb.Point{minX + 11, minY + 11},
+			})
+		}
+	}
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if batched {
+			if _, err := reader.SearchMany(tiles); err != nil {
+				b.Fatal(err)
+			}
+			continue
+		}
+		for _, tile := range tiles {
+			if _, err := reader.Search(tile); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
 func BenchmarkMemory_GeoJSON_Points_10000(b *testing.B) {
 	r := rand.New(rand.NewSource(42))
 	fc := generateFeatureCollection(r, 10000, "point", true)
@@ -717,6 +770,175 @@ func BenchmarkMemory_FlatGeobuf_Points_10000(b *testing.B) {
 	}
 }
 
+// =============================================================================
+// Allocation Benchmarks (10K features, without index)
+// =============================================================================
+
+func BenchmarkAllocs_Write_Points(b *testing.B) {
+	benchmarkAllocsWrite(b, "point")
+}
+
+func BenchmarkAllocs_Write_Polygons(b *testing.B) {
+	benchmarkAllocsWrite(b, "complexpolygon")
+}
+
+func BenchmarkAllocs_Read_Points(b *testing.B) {
+	benchmarkAllocsRead(b, "point")
+}
+
+func BenchmarkAllocs_Read_Polygons(b *testing.B) {
+	benchmarkAllocsRead(b, "complexpolygon")
+}
+
+func benchmarkAllocsWrite(b *testing.B, geomType string) {
+	r := rand.New(rand.NewSource(42))
+	fc := generateFeatureCollection(r, 10000, geomType, true)
+	opts := &Options{IncludeIndex: false}
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if err := WriteFeatures(io.Discard, fc, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkAllocsRead(b *testing.B, geomType string) {
+	r := rand.New(rand.NewSource(42))
+	fc := generateFeatureCollection(r, 10000, geomType, true)
+	var buf bytes.Buffer
+	if err := WriteFeatures(&buf, fc, &Options{IncludeIndex: false}); err != nil {
+		b.Fatal(err)
+	}
+	reader, err := NewReaderFromData(buf.Bytes())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer reader.Close()
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		result, err := reader.ReadAll()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(result.Features) != 10000 {
+			b.Fatalf("expected 10000 features, got %d", len(result.Features))
+		}
+	}
+}
+
+// =============================================================================
+// Parallel Decoding Benchmarks (1M features)
+// =============================================================================
+
+var (
+	millionFeaturesOnce sync.Once
+	millionFeaturesData []byte
+	millionFeaturesErr  error
+)
+
+// millionFeatures encodes 1M points with properties once per test binary.
+func millionFeatures(b *testing.B) []byte {
+	if testing.Short() {
+		b.Skip("Skipping 1M-feature benchmark in short mode")
+	}
+
+	millionFeaturesOnce.Do(func() {
+		r := rand.New(rand.NewSource(42))
+		fc := geojson.NewFeatureCollection()
+		fc.Features = make([]*geojson.Feature, 0, 1_000_000)
+		for i, p := range generatePoints(r, 1_000_000, -180, 180, -90, 90) {
+			f := geojson.NewFeature(p)
+			f.Properties = geojson.Properties{
+				"id":       i,
+				"name":     fmt.Sprintf("Feature %d", i),
+				"value":    r.Float64() * 1000,
+				"category": fmt.Sprintf("cat_%d", r.Intn(10)),
+			}
+			fc.Append(f)
+		}
+
+		var buf bytes.Buffer
+		millionFeaturesErr = WriteFeatures(&buf, fc, &Options{IncludeIndex: true})
+		millionFeaturesData = buf.Bytes()
+	})
+
+	if millionFeaturesErr != nil {
+		b.Fatal(millionFeaturesErr)
+	}
+	return millionFeaturesData
+}
+
+func BenchmarkReadAll_1M_Sequential(b *testing.B) {
+	benchmarkReadAllConcurrency(b, 0)
+}
+
+func BenchmarkReadAll_1M_Concurrency4(b *testing.B) {
+	benchmarkReadAllConcurrency(b, 4)
+}
+
+func BenchmarkReadAll_1M_ConcurrencyMax(b *testing.B) {
+	benchmarkReadAllConcurrency(b, -1)
+}
+
+func benchmarkReadAllConcurrency(b *testing.B, concurrency int) {
+	data := millionFeatures(b)
+	reader, err := NewReaderFromDataWithOptions(data, &ReaderOptions{Concurrency: concurrency})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer reader.Close()
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		fc, err := reader.ReadAll()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(fc.Features) != 1_000_000 {
+			b.Fatalf("expected 1M features, got %d", len(fc.Features))
+		}
+	}
+}
+
+// =============================================================================
+// Parallel Encoding Benchmarks (100K polygons)
+// =============================================================================
+
+func BenchmarkWriteFeatures_100K_Sequential(b *testing.B) {
+	benchmarkWriteConcurrency(b, 0)
+}
+
+func BenchmarkWriteFeatures_100K_Concurrency4(b *testing.B) {
+	benchmarkWriteConcurrency(b, 4)
+}
+
+func BenchmarkWriteFeatures_100K_ConcurrencyMax(b *testing.B) {
+	benchmarkWriteConcurrency(b, -1)
+}
+
+func benchmarkWriteConcurrency(b *testing.B, concurrency int) {
+	r := rand.New(rand.NewSource(42))
+	fc := generateFeatureCollection(r, 100_000, "complexpolygon", true)
+	opts := &Options{IncludeIndex: true, Concurrency: concurrency}
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if err := WriteFeatures(io.Discard, fc, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 // =============================================================================
 // Summary Report Test
 // =============================================================================
@@ -0,0 +1,646 @@
+package flatgeobuf
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/flatgeobuf/flatgeobuf/src/go/flattypes"
+	"github.com/flatgeobuf/flatgeobuf/src/go/writer"
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/paulmach/orb"
+	"github.com/tingold/orb-flatgeobuf/packedrtree"
+)
+
+// BuildIndex reads a FlatGeobuf file from src and writes it to dst with a
+// packed Hilbert R-tree index, replacing any index src already has. Features
+// are rewritten in Hilbert order, unlike WriteFeatures, which keeps them in
+// input order and sorts only the index, and are otherwise copied unchanged;
+// the header keeps its schema, CRS and metadata, with the feature count,
+// envelope and index node size updated.
+//
+// Features are spooled to temporary files and their index entries sorted in
+// runs of at most opts.MaxMemory bytes, which are then merged, so memory use
+// does not grow with the size of src.
+func BuildIndex(src io.Reader, dst io.Writer, opts *IndexOptions) error {
+	if opts == nil {
+		opts = DefaultIndexOptions()
+	}
+
+	b := &indexBuilder{opts: opts, nodeSize: opts.NodeSize}
+	if b.nodeSize == 0 {
+		b.nodeSize = packedrtree.DefaultNodeSize
+	}
+	if b.nodeSize < 2 {
+		return fmt.Errorf("flatgeobuf: invalid index node size %d", b.nodeSize)
+	}
+	defer b.close()
+
+	in := bufio.NewReaderSize(src, 64<<10)
+	header, err := readSourceHeader(in)
+	if err != nil {
+		return err
+	}
+	if err := b.spool(in, header.FeaturesCount()); err != nil {
+		return err
+	}
+	if err := b.sortRuns(); err != nil {
+		return err
+	}
+	if err := b.buildTree(); err != nil {
+		return err
+	}
+
+	out := bufio.NewWriterSize(dst, 64<<10)
+	if err := b.write(out, header); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+// pipeToIndex streams the unindexed file that write produces through
+// BuildIndex into dst, so it is indexed without being held in memory.
+func pipeToIndex(dst io.Writer, tempDir string, write func(io.Writer) error) error {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		out := bufio.NewWriterSize(pw, 64<<10)
+		err := write(out)
+		if err == nil {
+			err = out.Flush()
+		}
+		pw.CloseWithError(err)
+		done <- err
+	}()
+
+	err := BuildIndex(pr, dst, &IndexOptions{TempDir: tempDir})
+	pr.CloseWithError(errIndexStopped)
+	// A failed write surfaces in BuildIndex as truncated input, so report
+	// the write error instead
+	if writeErr := <-done; writeErr != nil && writeErr != errIndexStopped {
+		return writeErr
+	}
+	return err
+}
+
+// errIndexStopped stops the writer of pipeToIndex once BuildIndex has
+// returned.
+var errIndexStopped = errors.New("flatgeobuf: index build stopped")
+
+// indexEntrySize is the size of a serialized indexEntry: the leaf node, then
+// the feature size and Hilbert value.
+const indexEntrySize = packedrtree.NodeItemSize + 8
+
+// indexEntry is the index leaf of one spooled feature.
+type indexEntry struct {
+	bound   orb.Bound
+	offset  uint64 // Offset of the size-prefixed feature in the spool file
+	size    uint32 // Size of the feature including its size prefix
+	hilbert uint32 // Hilbert value of the bound's center, set once the extent is known
+}
+
+func (e *indexEntry) encode(b []byte) {
+	packedrtree.EncodeItem(b, packedrtree.Item{Bound: e.bound, Offset: e.offset})
+	binary.LittleEndian.PutUint32(b[packedrtree.NodeItemSize:], e.size)
+	binary.LittleEndian.PutUint32(b[packedrtree.NodeItemSize+4:], e.hilbert)
+}
+
+func (e *indexEntry) decode(b []byte) {
+	item := packedrtree.DecodeItem(b)
+	e.bound, e.offset = item.Bound, item.Offset
+	e.size = binary.LittleEndian.Uint32(b[packedrtree.NodeItemSize:])
+	e.hilbert = binary.LittleEndian.Uint32(b[packedrtree.NodeItemSize+4:])
+}
+
+// entryLess orders entries by descending Hilbert value, keeping features with
+// equal values in their original order.
+func entryLess(a, b *indexEntry) bool {
+	if a.hilbert != b.hilbert {
+		return a.hilbert > b.hilbert
+	}
+	return a.offset < b.offset
+}
+
+// indexBuilder holds the temporary state of BuildIndex.
+type indexBuilder struct {
+	opts     *IndexOptions
+	nodeSize uint16
+
+	files   []*os.File // Temporary files, removed by close
+	spooled *os.File   // Size-prefixed features in source order
+	entries *os.File   // Unsorted index entries, one per spooled feature
+	sorted  *os.File   // Sorted runs of index entries
+	tree    *os.File   // Serialized index nodes
+
+	count  int       // Number of features
+	extent orb.Bound // Bound of all features
+	runs   [][2]int64
+}
+
+// maxMemory returns the memory budget for sorting, applying the default.
+func (b *indexBuilder) maxMemory() int {
+	if b.opts.MaxMemory <= 0 {
+		return DefaultIndexOptions().MaxMemory
+	}
+	return b.opts.MaxMemory
+}
+
+// tempFile creates a temporary file that is removed by close.
+func (b *indexBuilder) tempFile() (*os.File, error) {
+	f, err := os.CreateTemp(b.opts.TempDir, "flatgeobuf-index-*")
+	if err != nil {
+		return nil, err
+	}
+	b.files = append(b.files, f)
+	return f, nil
+}
+
+func (b *indexBuilder) close() {
+	for _, f := range b.files {
+		f.Close()
+		os.Remove(f.Name())
+	}
+}
+
+// readSourceHeader reads the magic bytes and header of a FlatGeobuf file and
+// skips its index, leaving r at the first feature.
+func readSourceHeader(r io.Reader) (*flattypes.Header, error) {
+	var prefix [12]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, fmt.Errorf("%w: reading header: %w", ErrInvalidData, err)
+	}
+	if !validMagic(prefix[:]) {
+		return nil, fmt.Errorf("%w: not a FlatGeobuf file", ErrInvalidData)
+	}
+
+	// Copy through a buffer so a corrupt size cannot force a huge allocation
+	var buf bytes.Buffer
+	size := int64(binary.LittleEndian.Uint32(prefix[8:]))
+	if _, err := io.CopyN(&buf, r, size); err != nil {
+		return nil, fmt.Errorf("%w: reading header: %w", ErrInvalidData, err)
+	}
+	if err := verifyHeader(buf.Bytes()); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidData, err)
+	}
+	header := flattypes.GetRootAsHeader(buf.Bytes(), 0)
+
+	if count := header.FeaturesCount(); header.IndexNodeSize() > 0 && count > 0 {
+		if count > math.MaxInt32 {
+			return nil, fmt.Errorf("%w: header declares %d features", ErrInvalidData, count)
+		}
+		size, err := packedrtree.Size(int(count), header.IndexNodeSize())
+		if err != nil {
+			return nil, indexError(err)
+		}
+		if _, err := io.CopyN(io.Discard, r, int64(size)); err != nil {
+			return nil, fmt.Errorf("%w: reading index: %w", ErrInvalidData, err)
+		}
+	}
+	return header, nil
+}
+
+// spool copies the features of r to a temporary file, writing an index entry
+// for each. A declared count of 0 means the number of features is unknown.
+func (b *indexBuilder) spool(r io.Reader, declared uint64) error {
+	var err error
+	if b.spooled, err = b.tempFile(); err != nil {
+		return err
+	}
+	if b.entries, err = b.tempFile(); err != nil {
+		return err
+	}
+	features := bufio.NewWriterSize(b.spooled, 64<<10)
+	entries := bufio.NewWriterSize(b.entries, 64<<10)
+
+	b.extent = emptyBound
+	var (
+		buf    bytes.Buffer
+		prefix [4]byte
+		record [indexEntrySize]byte
+		offset uint64
+	)
+	for {
+		if _, err := io.ReadFull(r, prefix[:]); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return fmt.Errorf("%w: truncated feature size after feature %d", ErrInvalidData, b.count)
+		}
+		size := binary.LittleEndian.Uint32(prefix[:])
+
+		buf.Reset()
+		if _, err := io.CopyN(&buf, r, int64(size)); err != nil {
+			return fmt.Errorf("%w: feature %d is truncated", ErrInvalidData, b.count)
+		}
+		if err := verifyFeature(buf.Bytes()); err != nil {
+			return fmt.Errorf("%w: feature %d: %v", ErrInvalidData, b.count, err)
+		}
+		bound := featureBound(flattypes.GetRootAsFeature(buf.Bytes(), 0))
+		b.extent = b.extent.Union(bound)
+
+		entry := indexEntry{bound: bound, offset: offset, size: 4 + size}
+		entry.encode(record[:])
+		if _, err := entries.Write(record[:]); err != nil {
+			return err
+		}
+		if _, err := features.Write(prefix[:]); err != nil {
+			return err
+		}
+		if _, err := features.Write(buf.Bytes()); err != nil {
+			return err
+		}
+
+		offset += uint64(entry.size)
+		b.count++
+	}
+
+	if declared > 0 && declared != uint64(b.count) {
+		return fmt.Errorf("%w: header declares %d features, found %d", ErrInvalidData, declared, b.count)
+	}
+	if err := features.Flush(); err != nil {
+		return err
+	}
+	return entries.Flush()
+}
+
+// sortRuns assigns Hilbert values to the spooled entries and sorts them in
+// runs that fit in opts.MaxMemory.
+func (b *indexBuilder) sortRuns() error {
+	var err error
+	if b.sorted, err = b.tempFile(); err != nil {
+		return err
+	}
+
+	runSize := b.maxMemory() / indexEntrySize
+	if runSize < 1 {
+		runSize = 1
+	}
+	if runSize > b.count {
+		runSize = b.count
+	}
+
+	in := bufio.NewReaderSize(io.NewSectionReader(b.entries, 0, int64(b.count)*indexEntrySize), 64<<10)
+	out := bufio.NewWriterSize(b.sorted, 64<<10)
+	run := make([]indexEntry, 0, runSize)
+	record := make([]byte, indexEntrySize)
+
+	flush := func() error {
+		sort.Slice(run, func(i, j int) bool { return entryLess(&run[i], &run[j]) })
+		start := int64(len(b.runs)) * int64(runSize)
+		b.runs = append(b.runs, [2]int64{start, start + int64(len(run))})
+		for i := range run {
+			run[i].encode(record)
+			if _, err := out.Write(record); err != nil {
+				return err
+			}
+		}
+		run = run[:0]
+		return nil
+	}
+
+	for i := 0; i < b.count; i++ {
+		if _, err := io.ReadFull(in, record); err != nil {
+			return err
+		}
+		var entry indexEntry
+		entry.decode(record)
+		if !entry.bound.IsEmpty() {
+			entry.hilbert = packedrtree.HilbertValue(entry.bound, b.extent)
+		}
+
+		run = append(run, entry)
+		if len(run) == runSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if len(run) > 0 {
+		if err := flush(); err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+// mergeRuns calls fn for every entry in sorted order, merging the runs.
+func (b *indexBuilder) mergeRuns(fn func(*indexEntry) error) error {
+	if len(b.runs) == 0 {
+		return nil
+	}
+
+	// Share the memory budget between the run readers
+	bufSize := b.maxMemory() / len(b.runs)
+	if bufSize < 4096 {
+		bufSize = 4096
+	} else if bufSize > 64<<10 {
+		bufSize = 64 << 10
+	}
+
+	queue := make(runQueue, 0, len(b.runs))
+	for _, run := range b.runs {
+		section := io.NewSectionReader(b.sorted, run[0]*indexEntrySize, (run[1]-run[0])*indexEntrySize)
+		cursor := &runCursor{in: bufio.NewReaderSize(section, bufSize), remaining: run[1] - run[0]}
+		if err := cursor.next(); err != nil {
+			return err
+		}
+		queue = append(queue, cursor)
+	}
+	heap.Init(&queue)
+
+	for len(queue) > 0 {
+		cursor := queue[0]
+		if err := fn(&cursor.entry); err != nil {
+			return err
+		}
+
+		if cursor.remaining == 0 {
+			heap.Pop(&queue)
+			continue
+		}
+		if err := cursor.next(); err != nil {
+			return err
+		}
+		heap.Fix(&queue, 0)
+	}
+	return nil
+}
+
+// buildTree writes the index nodes to a temporary file: the leaves in merged
+// order, then each level above them from the one below.
+func (b *indexBuilder) buildTree() error {
+	if b.count == 0 {
+		return nil
+	}
+
+	levels, err := packedrtree.Levels(b.count, b.nodeSize)
+	if err != nil {
+		return err
+	}
+	if b.tree, err = b.tempFile(); err != nil {
+		return err
+	}
+
+	// Leaves point at the features as they will be written, in merged order
+	node := make([]byte, packedrtree.NodeItemSize)
+	out := bufio.NewWriterSize(io.NewOffsetWriter(b.tree, int64(levels[0].Start)*packedrtree.NodeItemSize), 64<<10)
+	var offset uint64
+	err = b.mergeRuns(func(e *indexEntry) error {
+		packedrtree.EncodeItem(node, packedrtree.Item{Bound: e.bound, Offset: offset})
+		offset += uint64(e.size)
+		_, err := out.Write(node)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+
+	for i := 0; i < len(levels)-1; i++ {
+		below, parent := levels[i], levels[i+1]
+		in := bufio.NewReaderSize(io.NewSectionReader(b.tree,
+			int64(below.Start)*packedrtree.NodeItemSize,
+			int64(below.End-below.Start)*packedrtree.NodeItemSize), 64<<10)
+		out := bufio.NewWriterSize(io.NewOffsetWriter(b.tree, int64(parent.Start)*packedrtree.NodeItemSize), 64<<10)
+
+		// Each parent covers up to nodeSize consecutive nodes of the level below
+		for pos := below.Start; pos < below.End; pos += int(b.nodeSize) {
+			end := pos + int(b.nodeSize)
+			if end > below.End {
+				end = below.End
+			}
+			bound := emptyBound
+			for child := pos; child < end; child++ {
+				if _, err := io.ReadFull(in, node); err != nil {
+					return err
+				}
+				bound = bound.Union(packedrtree.DecodeItem(node).Bound)
+			}
+			packedrtree.EncodeItem(node, packedrtree.Item{Bound: bound, Offset: uint64(pos)})
+			if _, err := out.Write(node); err != nil {
+				return err
+			}
+		}
+		if err := out.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write writes the indexed file: magic bytes, the updated header, the index
+// and the features in merged order.
+func (b *indexBuilder) write(w io.Writer, header *flattypes.Header) error {
+	if _, err := w.Write(writer.MagicBytes); err != nil {
+		return err
+	}
+	if _, err := w.Write(indexedHeader(header, b.count, b.nodeSize, b.extent)); err != nil {
+		return err
+	}
+	if b.count == 0 {
+		return nil
+	}
+
+	size, err := packedrtree.Size(b.count, b.nodeSize)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, io.NewSectionReader(b.tree, 0, int64(size))); err != nil {
+		return err
+	}
+
+	var buf []byte
+	return b.mergeRuns(func(e *indexEntry) error {
+		if cap(buf) < int(e.size) {
+			buf = make([]byte, e.size)
+		}
+		feature := buf[:e.size]
+		if _, err := b.spooled.ReadAt(feature, int64(e.offset)); err != nil {
+			return err
+		}
+		_, err := w.Write(feature)
+		return err
+	})
+}
+
+// indexedHeader copies header with the given feature count, index node size
+// and envelope, returning it size-prefixed. Files without features get no
+// index.
+func indexedHeader(header *flattypes.Header, count int, nodeSize uint16, extent orb.Bound) []byte {
+	builder := flatbuffers.NewBuilder(1024)
+
+	createString := func(b []byte) flatbuffers.UOffsetT {
+		if b == nil {
+			return 0
+		}
+		return builder.CreateByteString(b)
+	}
+
+	name := createString(header.Name())
+	title := createString(header.Title())
+	description := createString(header.Description())
+	metadata := createString(header.Metadata())
+
+	var columns flatbuffers.UOffsetT
+	if n := header.ColumnsLength(); n > 0 {
+		offsets := make([]flatbuffers.UOffsetT, n)
+		var col flattypes.Column
+		for i := range offsets {
+			header.Columns(&col, i)
+			colName := createString(col.Name())
+			colTitle := createString(col.Title())
+			colDescription := createString(col.Description())
+			colMetadata := createString(col.Metadata())
+
+			flattypes.ColumnStart(builder)
+			if colName != 0 {
+				flattypes.ColumnAddName(builder, colName)
+			}
+			flattypes.ColumnAddType(builder, col.Type())
+			if colTitle != 0 {
+				flattypes.ColumnAddTitle(builder, colTitle)
+			}
+			if colDescription != 0 {
+				flattypes.ColumnAddDescription(builder, colDescription)
+			}
+			flattypes.ColumnAddWidth(builder, col.Width())
+			flattypes.ColumnAddPrecision(builder, col.Precision())
+			flattypes.ColumnAddScale(builder, col.Scale())
+			flattypes.ColumnAddNullable(builder, col.Nullable())
+			flattypes.ColumnAddUnique(builder, col.Unique())
+			flattypes.ColumnAddPrimaryKey(builder, col.PrimaryKey())
+			if colMetadata != 0 {
+				flattypes.ColumnAddMetadata(builder, colMetadata)
+			}
+			offsets[i] = flattypes.ColumnEnd(builder)
+		}
+
+		flattypes.HeaderStartColumnsVector(builder, n)
+		for i := n - 1; i >= 0; i-- {
+			builder.PrependUOffsetT(offsets[i])
+		}
+		columns = builder.EndVector(n)
+	}
+
+	var crsOffset flatbuffers.UOffsetT
+	var crs flattypes.Crs
+	if header.Crs(&crs) != nil {
+		org := createString(crs.Org())
+		crsName := createString(crs.Name())
+		crsDescription := createString(crs.Description())
+		wkt := createString(crs.Wkt())
+		codeString := createString(crs.CodeString())
+
+		flattypes.CrsStart(builder)
+		if org != 0 {
+			flattypes.CrsAddOrg(builder, org)
+		}
+		flattypes.CrsAddCode(builder, crs.Code())
+		if crsName != 0 {
+			flattypes.CrsAddName(builder, crsName)
+		}
+		if crsDescription != 0 {
+			flattypes.CrsAddDescription(builder, crsDescription)
+		}
+		if wkt != 0 {
+			flattypes.CrsAddWkt(builder, wkt)
+		}
+		if codeString != 0 {
+			flattypes.CrsAddCodeString(builder, codeString)
+		}
+		crsOffset = flattypes.CrsEnd(builder)
+	}
+
+	var envelope flatbuffers.UOffsetT
+	if !extent.IsEmpty() {
+		flattypes.HeaderStartEnvelopeVector(builder, 4)
+		builder.PrependFloat64(extent.Max[1])
+		builder.PrependFloat64(extent.Max[0])
+		builder.PrependFloat64(extent.Min[1])
+		builder.PrependFloat64(extent.Min[0])
+		envelope = builder.EndVector(4)
+	}
+
+	if count == 0 {
+		nodeSize = 0
+	}
+
+	flattypes.HeaderStart(builder)
+	if name != 0 {
+		flattypes.HeaderAddName(builder, name)
+	}
+	if envelope != 0 {
+		flattypes.HeaderAddEnvelope(builder, envelope)
+	}
+	flattypes.HeaderAddGeometryType(builder, header.GeometryType())
+	flattypes.HeaderAddHasZ(builder, header.HasZ())
+	flattypes.HeaderAddHasM(builder, header.HasM())
+	flattypes.HeaderAddHasT(builder, header.HasT())
+	flattypes.HeaderAddHasTm(builder, header.HasTm())
+	if columns != 0 {
+		flattypes.HeaderAddColumns(builder, columns)
+	}
+	flattypes.HeaderAddFeaturesCount(builder, uint64(count))
+	flattypes.HeaderAddIndexNodeSize(builder, nodeSize)
+	if crsOffset != 0 {
+		flattypes.HeaderAddCrs(builder, crsOffset)
+	}
+	if title != 0 {
+		flattypes.HeaderAddTitle(builder, title)
+	}
+	if description != 0 {
+		flattypes.HeaderAddDescription(builder, description)
+	}
+	if metadata != 0 {
+		flattypes.HeaderAddMetadata(builder, metadata)
+	}
+	builder.FinishSizePrefixed(flattypes.HeaderEnd(builder))
+	return builder.FinishedBytes()
+}
+
+// runCursor reads the entries of one sorted run.
+type runCursor struct {
+	in        io.Reader
+	entry     indexEntry
+	remaining int64
+	record    [indexEntrySize]byte
+}
+
+func (c *runCursor) next() error {
+	if _, err := io.ReadFull(c.in, c.record[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	c.entry.decode(c.record[:])
+	c.remaining--
+	return nil
+}
+
+// runQueue is a min-heap of run cursors ordered by their current entry.
+type runQueue []*runCursor
+
+func (q runQueue) Len() int { return len(q) }
+
+func (q runQueue) Less(i, j int) bool { return entryLess(&q[i].entry, &q[j].entry) }
+
+func (q runQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *runQueue) Push(x interface{}) { *q = append(*q, x.(*runCursor)) }
+
+func (q *runQueue) Pop() interface{} {
+	old := *q
+	cursor := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return cursor
+}
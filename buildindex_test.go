@@ -0,0 +1,251 @@
+package flatgeobuf
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// newUnindexedFile writes n random points and polygons with properties,
+// without an index.
+func newUnindexedFile(t *testing.T, n int) ([]byte, *geojson.FeatureCollection) {
+	t.Helper()
+
+	rng := rand.New(rand.NewSource(1))
+	fc := geojson.NewFeatureCollection()
+	for i := 0; i < n; i++ {
+		x, y := rng.Float64()*360-180, rng.Float64()*180-90
+		var g orb.Geometry = orb.Point{x, y}
+		if i%3 == 0 {
+			g = orb.Polygon{{{x, y}, {x + 1, y}, {x + 1, y + 1}, {x, y + 1}, {x, y}}}
+		}
+		f := geojson.NewFeature(g)
+		f.Properties = geojson.Properties{"id": i, "name": string(rune('a' + i%26))}
+		fc.Append(f)
+	}
+
+	var buf bytes.Buffer
+	opts := &Options{Name: "places", Description: "random places", CRS: WGS84()}
+	if err := WriteFeatures(&buf, fc, opts); err != nil {
+		t.Fatalf("WriteFeatures failed: %v", err)
+	}
+	return buf.Bytes(), fc
+}
+
+func buildIndex(t *testing.T, data []byte, opts *IndexOptions) []byte {
+	t.Helper()
+
+	var out bytes.Buffer
+	if err := BuildIndex(bytes.NewReader(data), &out, opts); err != nil {
+		t.Fatalf("BuildIndex failed: %v", err)
+	}
+	return out.Bytes()
+}
+
+// featuresByID returns the JSON encoding of each feature keyed by its id.
+func featuresByID(t *testing.T, fc *geojson.FeatureCollection) map[string]string {
+	t.Helper()
+
+	features := make(map[string]string, len(fc.Features))
+	for _, f := range fc.Features {
+		b, err := json.Marshal(f)
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		features[fmt.Sprint(f.Properties["id"])] = string(b)
+	}
+	return features
+}
+
+func TestBuildIndex(t *testing.T) {
+	data, fc := newUnindexedFile(t, 500)
+	indexed := buildIndex(t, data, nil)
+
+	src, err := NewReaderFromData(data)
+	if err != nil {
+		t.Fatalf("NewReaderFromData failed: %v", err)
+	}
+	defer src.Close()
+	reader, err := NewReaderFromData(indexed)
+	if err != nil {
+		t.Fatalf("NewReaderFromData failed: %v", err)
+	}
+	defer reader.Close()
+
+	header := reader.Header()
+	if !header.HasIndex || header.FeaturesCount != 500 {
+		t.Fatalf("expected an index over 500 features, got %+v", header)
+	}
+	expectedHeader := src.Header()
+	expectedHeader.HasIndex = true
+	expectedHeader.FeaturesCount = 500
+	expectedHeader.Envelope = header.Envelope
+	if !reflect.DeepEqual(header, expectedHeader) {
+		t.Errorf("header not preserved:\n got %+v\nwant %+v", header, expectedHeader)
+	}
+
+	var extent orb.Bound
+	for i, f := range fc.Features {
+		if i == 0 {
+			extent = f.Geometry.Bound()
+		}
+		extent = extent.Union(f.Geometry.Bound())
+	}
+	if header.Envelope != [4]float64{extent.Min[0], extent.Min[1], extent.Max[0], extent.Max[1]} {
+		t.Errorf("expected envelope %v, got %v", extent, header.Envelope)
+	}
+
+	// Features are stored in index order
+	for i := 1; i < reader.index.NumItems(); i++ {
+		if reader.index.Leaf(i).Offset <= reader.index.Leaf(i-1).Offset {
+			t.Fatalf("leaf %d is not stored after leaf %d", i, i-1)
+		}
+	}
+
+	all, err := reader.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	want := featuresByID(t, fc)
+	if got := featuresByID(t, all); !reflect.DeepEqual(got, want) {
+		t.Errorf("features changed by BuildIndex")
+	}
+
+	query := orb.Bound{Min: orb.Point{-60, -30}, Max: orb.Point{20, 45}}
+	found, err := reader.Search(query)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	expected := make(map[string]string)
+	for _, f := range fc.Features {
+		if f.Geometry.Bound().Intersects(query) {
+			id := fmt.Sprint(f.Properties["id"])
+			expected[id] = want[id]
+		}
+	}
+	if got := featuresByID(t, found); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %d search results, got %d", len(expected), len(got))
+	}
+}
+
+func TestBuildIndex_ExternalSort(t *testing.T) {
+	data, _ := newUnindexedFile(t, 1000)
+	inMemory := buildIndex(t, data, nil)
+
+	// Runs of 7 entries force a many-way merge
+	external := buildIndex(t, data, &IndexOptions{MaxMemory: 7 * indexEntrySize, TempDir: t.TempDir()})
+	if !bytes.Equal(inMemory, external) {
+		t.Error("external sort produced a different file")
+	}
+}
+
+func TestBuildIndex_Rebuild(t *testing.T) {
+	data, fc := newUnindexedFile(t, 300)
+	indexed := buildIndex(t, data, nil)
+
+	// Rebuilding an indexed file replaces its index. Unset fields use their
+	// defaults.
+	rebuilt := buildIndex(t, indexed, &IndexOptions{NodeSize: 4})
+	reader, err := NewReaderFromData(rebuilt)
+	if err != nil {
+		t.Fatalf("NewReaderFromData failed: %v", err)
+	}
+	defer reader.Close()
+	if reader.index.NodeSize() != 4 {
+		t.Errorf("expected node size 4, got %d", reader.index.NodeSize())
+	}
+	all, err := reader.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if !reflect.DeepEqual(featuresByID(t, all), featuresByID(t, fc)) {
+		t.Errorf("features changed by rebuilding")
+	}
+
+	// The Hilbert order is stable, so rebuilding is idempotent
+	if again := buildIndex(t, indexed, nil); !bytes.Equal(again, indexed) {
+		t.Error("rebuilding with the same options changed the file")
+	}
+}
+
+func TestBuildIndex_Reference(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "poly_landmarks.fgb"))
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	original, err := NewReaderFromData(data)
+	if err != nil {
+		t.Fatalf("NewReaderFromData failed: %v", err)
+	}
+	defer original.Close()
+	reader, err := NewReaderFromData(buildIndex(t, data, &IndexOptions{NodeSize: 8}))
+	if err != nil {
+		t.Fatalf("NewReaderFromData failed: %v", err)
+	}
+	defer reader.Close()
+
+	query := orb.Bound{Min: orb.Point{-73.99, 40.75}, Max: orb.Point{-73.95, 40.8}}
+	expected, err := original.Search(query)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	got, err := reader.Search(query)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(expected.Features) == 0 || len(got.Features) != len(expected.Features) {
+		t.Fatalf("expected %d results, got %d", len(expected.Features), len(got.Features))
+	}
+
+	geometries := make(map[string]int)
+	for _, f := range expected.Features {
+		b, _ := json.Marshal(f.Geometry)
+		geometries[string(b)]++
+	}
+	for _, f := range got.Features {
+		b, _ := json.Marshal(f.Geometry)
+		geometries[string(b)]--
+	}
+	for g, n := range geometries {
+		if n != 0 {
+			t.Errorf("result counts differ for %s", g)
+		}
+	}
+}
+
+func TestBuildIndex_Invalid(t *testing.T) {
+	data, _ := newUnindexedFile(t, 10)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not flatgeobuf", []byte("not a flatgeobuf file")},
+		{"truncated header", data[:20]},
+		{"truncated feature", data[:len(data)-5]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := BuildIndex(bytes.NewReader(tt.data), &out, nil)
+			if !errors.Is(err, ErrInvalidData) {
+				t.Errorf("expected ErrInvalidData, got %v", err)
+			}
+		})
+	}
+
+	var out bytes.Buffer
+	if err := BuildIndex(bytes.NewReader(data), &out, &IndexOptions{NodeSize: 1}); err == nil {
+		t.Error("expected error for node size 1")
+	}
+}
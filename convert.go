@@ -0,0 +1,536 @@
+package flatgeobuf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/flatgeobuf/flatgeobuf/src/go/flattypes"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// GeoJSONFormat selects how a stream of GeoJSON features is framed.
+type GeoJSONFormat int
+
+const (
+	// GeoJSONCollection is a single FeatureCollection object.
+	GeoJSONCollection GeoJSONFormat = iota
+	// GeoJSONSeq is a GeoJSON text sequence (RFC 8142): each feature is
+	// preceded by a record separator (0x1E) and followed by a newline.
+	GeoJSONSeq
+	// GeoJSONLines is newline-delimited GeoJSON: one feature per line.
+	GeoJSONLines
+)
+
+// recordSeparator starts each feature of a GeoJSON text sequence.
+const recordSeparator = 0x1e
+
+// ConvertOptions configures GeoJSONToFlatGeobuf.
+type ConvertOptions struct {
+	Write   *Options      // Options for the FlatGeobuf output (default: DefaultOptions())
+	Schema  *SchemaPolicy // Policy for inferring the schema when Write.Columns is nil (default: DefaultSchemaPolicy())
+	TempDir string        // Directory for temporary files (default: os.TempDir())
+}
+
+// GeoJSONToFlatGeobuf converts GeoJSON read from src into a FlatGeobuf file
+// written to dst. The input is either a FeatureCollection or a sequence of
+// Feature objects, with or without RFC 8142 record separators, as in
+// GeoJSONSeq and GeoJSONLines input.
+//
+// The input is tokenized rather than decoded whole, so only one feature is
+// held in memory at a time. Features are spooled to a temporary file while
+// their count, extent and geometry type are gathered and, unless
+// opts.Write.Columns is set, their schema is inferred with opts.Schema; they
+// are then encoded from the spool. With Write.IncludeIndex the result is
+// indexed with BuildIndex, so features are written in Hilbert order.
+// Write.Concurrency is ignored.
+//
+// Every feature is checked against the schema, including those past
+// Schema.SampleSize: a value that does not fit its column fails with
+// ErrPropertyMismatch, naming the column and feature index. Malformed input
+// returns an error wrapping ErrInvalidGeoJSON.
+func GeoJSONToFlatGeobuf(src io.Reader, dst io.Writer, opts *ConvertOptions) error {
+	if opts == nil {
+		opts = &ConvertOptions{}
+	}
+	writeOpts := opts.Write
+	if writeOpts == nil {
+		writeOpts = DefaultOptions()
+	}
+	writeOpts, proj, err := writeOpts.reprojected()
+	if err != nil {
+		return err
+	}
+	policy := opts.Schema
+	if policy == nil {
+		policy = DefaultSchemaPolicy()
+	}
+
+	spool, err := os.CreateTemp(opts.TempDir, "flatgeobuf-geojson-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	c := &geoJSONConverter{opts: writeOpts, project: proj, envelope: emptyBound}
+	if writeOpts.Columns == nil {
+		c.inferrer = newSchemaInferrer(policy)
+		c.sampleSize = policy.SampleSize
+	}
+	if err := c.spool(src, spool); err != nil {
+		return err
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if !writeOpts.IncludeIndex {
+		out := bufio.NewWriterSize(dst, 64<<10)
+		if err := c.write(spool, out); err != nil {
+			return err
+		}
+		return out.Flush()
+	}
+	return pipeToIndex(dst, opts.TempDir, func(w io.Writer) error {
+		return c.write(spool, w)
+	})
+}
+
+// geoJSONConverter holds the state of GeoJSONToFlatGeobuf.
+type geoJSONConverter struct {
+	opts       *Options
+	project    orb.Projection  // Nil unless the output is reprojected
+	inferrer   *schemaInferrer // Nil when the schema is given
+	sampleSize int
+
+	count    int // Number of features read, written or not
+	written  int // Number of features that will be written
+	envelope orb.Bound
+	geomType flattypes.GeometryType
+}
+
+// spool copies the raw JSON of the features of src to w, each preceded by its
+// size, and gathers what the header needs.
+func (c *geoJSONConverter) spool(src io.Reader, w io.Writer) error {
+	out := bufio.NewWriterSize(w, 64<<10)
+	scanner := newGeoJSONScanner(src)
+	var prefix [4]byte
+	for {
+		raw, err := scanner.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		f, err := c.feature(raw, c.count)
+		if err != nil {
+			return err
+		}
+		if err := c.add(f); err != nil {
+			return err
+		}
+
+		binary.LittleEndian.PutUint32(prefix[:], uint32(len(raw)))
+		if _, err := out.Write(prefix[:]); err != nil {
+			return err
+		}
+		if _, err := out.Write(raw); err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+// add records a feature read from the input. The geometry type follows
+// WriteFeatures: that of the first feature, or Unknown if another differs.
+func (c *geoJSONConverter) add(f *geojson.Feature) error {
+	if c.count == 0 && f.Geometry != nil {
+		c.geomType = orbToFGBGeometryType(f.Geometry)
+	} else if c.count > 0 && f.Geometry != nil && orbToFGBGeometryType(f.Geometry) != c.geomType {
+		c.geomType = flattypes.GeometryTypeUnknown
+	}
+	c.count++
+
+	if writable(f.Geometry) {
+		c.envelope = extendEnvelope(c.envelope, f.Geometry)
+		c.written++
+	}
+	if c.inferrer != nil && (c.sampleSize <= 0 || c.count <= c.sampleSize) {
+		return c.inferrer.add(f)
+	}
+	return nil
+}
+
+// write encodes the spooled features as a FlatGeobuf file without an index.
+func (c *geoJSONConverter) write(spool io.Reader, w io.Writer) error {
+	var infos []ColumnInfo
+	if c.inferrer != nil {
+		infos = c.inferrer.columns()
+	} else {
+		infos = append(infos, c.opts.Columns...)
+	}
+
+	header, types, err := newHeader(c.geomType, infos, c.opts)
+	if err != nil {
+		return err
+	}
+	header.SetEnvelope(envelopeSlice(c.envelope))
+	header.SetFeaturesCount(uint64(c.written))
+	if err := writeHeader(w, header); err != nil {
+		return err
+	}
+	names := columnInfoNames(infos)
+
+	enc := encoderPool.Get().(*featureEncoder)
+	defer encoderPool.Put(enc)
+
+	in := bufio.NewReaderSize(spool, 64<<10)
+	var (
+		prefix  [4]byte
+		raw     []byte
+		scratch bytes.Buffer
+	)
+	for i := 0; i < c.count; i++ {
+		if _, err := io.ReadFull(in, prefix[:]); err != nil {
+			return err
+		}
+		size := binary.LittleEndian.Uint32(prefix[:])
+		if cap(raw) < int(size) {
+			raw = make([]byte, size)
+		}
+		raw = raw[:size]
+		if _, err := io.ReadFull(in, raw); err != nil {
+			return err
+		}
+
+		f, err := c.feature(raw, i)
+		if err != nil {
+			return err
+		}
+		// Features past the sample may not fit the inferred schema
+		if f.Geometry != nil {
+			for j, col := range infos {
+				if err := checkColumnValue(f, i, col, types[j], c.opts.BinaryEncoding, &scratch); err != nil {
+					return err
+				}
+			}
+		}
+
+		enc.reset()
+		feature, err := encodeFeature(f, enc, names, types, c.opts.BinaryEncoding)
+		if err != nil {
+			return fmt.Errorf("feature %d: %w", i, err)
+		}
+		if feature == nil {
+			continue
+		}
+		enc.builder.FinishSizePrefixed(feature.Build())
+		if _, err := w.Write(enc.builder.FinishedBytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// feature decodes the raw JSON of the i-th input feature, reprojecting its
+// geometry if the output is reprojected.
+func (c *geoJSONConverter) feature(raw []byte, i int) (*geojson.Feature, error) {
+	f, err := unmarshalFeature(raw, i)
+	if err != nil || c.project == nil {
+		return f, err
+	}
+	f.Geometry = reprojectGeometry(f.Geometry, c.project)
+	return f, nil
+}
+
+// unmarshalFeature decodes the raw JSON of the i-th input feature.
+func unmarshalFeature(raw []byte, i int) (*geojson.Feature, error) {
+	f, err := geojson.UnmarshalFeature(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: feature %d: %v", ErrInvalidGeoJSON, i, err)
+	}
+	return f, nil
+}
+
+// geoJSONScanner splits a FeatureCollection, or a sequence of features, into
+// the raw JSON of each feature.
+type geoJSONScanner struct {
+	dec   *json.Decoder
+	state scanState
+}
+
+type scanState int
+
+const (
+	scanStart    scanState = iota // Before the first value
+	scanFeatures                  // Inside the features array of a collection
+	scanSequence                  // Between the features of a sequence
+	scanDone
+)
+
+func newGeoJSONScanner(r io.Reader) *geoJSONScanner {
+	return &geoJSONScanner{dec: json.NewDecoder(separatorReader{r})}
+}
+
+// next returns the raw JSON of the next feature, or io.EOF after the last.
+func (s *geoJSONScanner) next() (json.RawMessage, error) {
+	switch s.state {
+	case scanStart:
+		return s.start()
+
+	case scanFeatures:
+		if s.dec.More() {
+			var raw json.RawMessage
+			if err := s.dec.Decode(&raw); err != nil {
+				return nil, geoJSONError(err)
+			}
+			return raw, nil
+		}
+		if _, err := s.dec.Token(); err != nil { // ']'
+			return nil, geoJSONError(err)
+		}
+		if _, err := s.members(nil); err != nil {
+			return nil, err
+		}
+		return nil, s.end()
+
+	case scanSequence:
+		var raw json.RawMessage
+		if err := s.dec.Decode(&raw); err != nil {
+			if err == io.EOF {
+				s.state = scanDone
+				return nil, io.EOF
+			}
+			return nil, geoJSONError(err)
+		}
+		return raw, nil
+	}
+	return nil, io.EOF
+}
+
+// start reads the first value up to the features of a collection. A first
+// value without features is a feature, and starts a sequence.
+func (s *geoJSONScanner) start() (json.RawMessage, error) {
+	tok, err := s.dec.Token()
+	if err == io.EOF {
+		s.state = scanDone
+		return nil, io.EOF // Empty sequence
+	}
+	if err != nil {
+		return nil, geoJSONError(err)
+	}
+	if tok != json.Delim('{') {
+		return nil, fmt.Errorf("%w: expected an object, found %v", ErrInvalidGeoJSON, tok)
+	}
+
+	members := make(map[string]json.RawMessage)
+	features, err := s.members(members)
+	if err != nil {
+		return nil, err
+	}
+	if features {
+		s.state = scanFeatures
+		return s.next()
+	}
+
+	if string(members["type"]) == `"FeatureCollection"` {
+		return nil, s.end() // Without features
+	}
+	s.state = scanSequence
+	raw, err := json.Marshal(members)
+	if err != nil {
+		return nil, geoJSONError(err)
+	}
+	return raw, nil
+}
+
+// end checks that nothing follows a FeatureCollection, returning io.EOF.
+func (s *geoJSONScanner) end() error {
+	if _, err := s.dec.Token(); err != io.EOF {
+		return fmt.Errorf("%w: data after the FeatureCollection", ErrInvalidGeoJSON)
+	}
+	s.state = scanDone
+	return io.EOF
+}
+
+// members reads the members of an object up to the start of a features array,
+// returning true, or its end, returning false. Other members are stored in
+// into, if not nil, and checked to be of a FeatureCollection or Feature.
+func (s *geoJSONScanner) members(into map[string]json.RawMessage) (bool, error) {
+	for s.dec.More() {
+		tok, err := s.dec.Token()
+		if err != nil {
+			return false, geoJSONError(err)
+		}
+		key, _ := tok.(string)
+
+		if key == "features" && into != nil {
+			tok, err := s.dec.Token()
+			if err != nil {
+				return false, geoJSONError(err)
+			}
+			if tok != json.Delim('[') {
+				return false, fmt.Errorf("%w: features is not an array", ErrInvalidGeoJSON)
+			}
+			if err := checkCollectionType(into["type"]); err != nil {
+				return false, err
+			}
+			return true, nil
+		}
+
+		var value json.RawMessage
+		if err := s.dec.Decode(&value); err != nil {
+			return false, geoJSONError(err)
+		}
+		if into != nil {
+			into[key] = value
+		} else if key == "type" {
+			if err := checkCollectionType(value); err != nil {
+				return false, err
+			}
+		}
+	}
+	if _, err := s.dec.Token(); err != nil { // '}'
+		return false, geoJSONError(err)
+	}
+	return false, nil
+}
+
+// checkCollectionType checks the type member of an object with features.
+func checkCollectionType(value json.RawMessage) error {
+	if value != nil && string(value) != `"FeatureCollection"` {
+		return fmt.Errorf("%w: object with features has type %s", ErrInvalidGeoJSON, value)
+	}
+	return nil
+}
+
+// geoJSONError wraps a JSON decoding error.
+func geoJSONError(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("%w: %v", ErrInvalidGeoJSON, err)
+}
+
+// separatorReader replaces the record separators of a GeoJSON text sequence
+// with newlines, which the JSON decoder skips. Separators cannot appear
+// unescaped inside JSON strings.
+type separatorReader struct {
+	r io.Reader
+}
+
+func (s separatorReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	for i, c := range p[:n] {
+		if c == recordSeparator {
+			p[i] = '\n'
+		}
+	}
+	return n, err
+}
+
+// FlatGeobufToGeoJSON converts a FlatGeobuf file read from src into GeoJSON
+// written to dst in the given format. Features are read, converted and
+// written one at a time in file order, so the file is never held in memory;
+// any index is skipped. Features without a usable geometry are omitted, as
+// by Reader.ReadAll, and opts.TargetCRS reprojects them as it does.
+// opts.Validate and opts.Concurrency are ignored.
+func FlatGeobufToGeoJSON(src io.Reader, dst io.Writer, format GeoJSONFormat, opts *ReaderOptions) error {
+	if opts == nil {
+		opts = DefaultReaderOptions()
+	}
+	if format < GeoJSONCollection || format > GeoJSONLines {
+		return fmt.Errorf("flatgeobuf: unknown GeoJSON format %d", format)
+	}
+
+	in := bufio.NewReaderSize(src, 64<<10)
+	header, err := readSourceHeader(in)
+	if err != nil {
+		return err
+	}
+	decoder := newPropertyDecoder(header, opts)
+	reproject, err := newReprojection(headerCRSCode(header), opts.TargetCRS)
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriterSize(dst, 64<<10)
+	if format == GeoJSONCollection {
+		if _, err := out.WriteString(`{"type":"FeatureCollection","features":[`); err != nil {
+			return err
+		}
+	}
+
+	var (
+		buf     bytes.Buffer
+		prefix  [4]byte
+		count   int
+		written int
+		offset  int64 // Of the feature from the start of the feature data
+	)
+	for ; ; count++ {
+		if _, err := io.ReadFull(in, prefix[:]); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return fmt.Errorf("%w: truncated feature size after feature %d", ErrInvalidData, count)
+		}
+		size := binary.LittleEndian.Uint32(prefix[:])
+
+		buf.Reset()
+		if _, err := io.CopyN(&buf, in, int64(size)); err != nil {
+			return fmt.Errorf("%w: feature %d is truncated", ErrInvalidData, count)
+		}
+		if err := verifyFeature(buf.Bytes()); err != nil {
+			return fmt.Errorf("%w: feature %d: %v", ErrInvalidData, count, err)
+		}
+
+		feature, err := convertFeature(flattypes.GetRootAsFeature(buf.Bytes(), 0), offset, header, decoder)
+		if err != nil {
+			return fmt.Errorf("feature %d: %w", count, err)
+		}
+		offset += 4 + int64(size)
+		if feature == nil {
+			continue
+		}
+		if reproject != nil {
+			reproject.apply(feature)
+		}
+		data, err := json.Marshal(feature)
+		if err != nil {
+			return fmt.Errorf("feature %d: %w", count, err)
+		}
+
+		switch format {
+		case GeoJSONCollection:
+			if written > 0 {
+				out.WriteByte(',')
+			}
+		case GeoJSONSeq:
+			out.WriteByte(recordSeparator)
+		}
+		if _, err := out.Write(data); err != nil {
+			return err
+		}
+		if format != GeoJSONCollection {
+			out.WriteByte('\n')
+		}
+		written++
+	}
+
+	if declared := header.FeaturesCount(); declared > 0 && declared != uint64(count) {
+		return fmt.Errorf("%w: header declares %d features, found %d", ErrInvalidData, declared, count)
+	}
+	if format == GeoJSONCollection {
+		out.WriteString("]}\n")
+	}
+	return out.Flush()
+}
@@ -0,0 +1,363 @@
+package flatgeobuf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// geoJSONInputs encodes a collection in each input framing.
+func geoJSONInputs(t *testing.T, fc *geojson.FeatureCollection) map[string][]byte {
+	t.Helper()
+
+	collection, err := json.Marshal(fc)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var seq, lines bytes.Buffer
+	for _, f := range fc.Features {
+		data, err := json.Marshal(f)
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		seq.WriteByte(recordSeparator)
+		seq.Write(data)
+		seq.WriteByte('\n')
+		lines.Write(data)
+		lines.WriteByte('\n')
+	}
+
+	// Members around the features are skipped
+	members := bytes.Replace(collection, []byte(`{"type":"FeatureCollection",`),
+		[]byte(`{"name":"layer","bbox":[0,0,1,1],"type":"FeatureCollection",`), 1)
+	members = append(members[:len(members)-1], []byte(`,"crs":{"type":"name"}}`)...)
+
+	return map[string][]byte{
+		"collection": collection,
+		"members":    members,
+		"seq":        seq.Bytes(),
+		"lines":      lines.Bytes(),
+	}
+}
+
+func TestGeoJSONToFlatGeobuf_MatchesWriteFeatures(t *testing.T) {
+	inputs := geoJSONInputs(t, concurrentFeatures(300))
+
+	// Written from the decoded collection, so numbers are float64 alike
+	fc, err := geojson.UnmarshalFeatureCollection(inputs["collection"])
+	if err != nil {
+		t.Fatalf("UnmarshalFeatureCollection failed: %v", err)
+	}
+	opts := &Options{Name: "converted", CRS: WGS84()}
+	var want bytes.Buffer
+	if err := WriteFeatures(&want, fc, opts); err != nil {
+		t.Fatalf("WriteFeatures failed: %v", err)
+	}
+
+	for name, input := range inputs {
+		var got bytes.Buffer
+		if err := GeoJSONToFlatGeobuf(bytes.NewReader(input), &got, &ConvertOptions{Write: opts}); err != nil {
+			t.Fatalf("%s: GeoJSONToFlatGeobuf failed: %v", name, err)
+		}
+		if !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Errorf("%s: output differs from WriteFeatures", name)
+		}
+	}
+}
+
+func TestGeoJSONToFlatGeobuf_Index(t *testing.T) {
+	input := geoJSONInputs(t, concurrentFeatures(300))["seq"]
+
+	var buf bytes.Buffer
+	if err := GeoJSONToFlatGeobuf(bytes.NewReader(input), &buf, &ConvertOptions{TempDir: t.TempDir()}); err != nil {
+		t.Fatalf("GeoJSONToFlatGeobuf failed: %v", err)
+	}
+	if report := Validate(buf.Bytes()); !report.Valid() {
+		t.Fatalf("invalid output: %v", report.Issues)
+	}
+
+	reader, err := NewReaderFromData(buf.Bytes())
+	if err != nil {
+		t.Fatalf("NewReaderFromData failed: %v", err)
+	}
+	defer reader.Close()
+	if !reader.Header().HasIndex {
+		t.Error("expected an index")
+	}
+	fc, err := reader.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if len(fc.Features) != 296 { // Four features have no geometry
+		t.Errorf("got %d features, want 296", len(fc.Features))
+	}
+}
+
+func TestGeoJSONToFlatGeobuf_Schema(t *testing.T) {
+	input := `{"type":"Feature","geometry":{"type":"Point","coordinates":[1,2]},"properties":{"a":1}}
+{"type":"Feature","geometry":{"type":"Point","coordinates":[3,4]},"properties":{"a":"x"}}
+`
+	// The default policy promotes mixed columns to String
+	var buf bytes.Buffer
+	if err := GeoJSONToFlatGeobuf(strings.NewReader(input), &buf, nil); err != nil {
+		t.Fatalf("GeoJSONToFlatGeobuf failed: %v", err)
+	}
+	reader, err := NewReaderFromData(buf.Bytes())
+	if err != nil {
+		t.Fatalf("NewReaderFromData failed: %v", err)
+	}
+	if got := reader.Header().Columns[0].Type; got != "String" {
+		t.Errorf("column type = %s, want String", got)
+	}
+	reader.Close()
+
+	strict := &ConvertOptions{Schema: &SchemaPolicy{MixedTypes: MixedAsError}}
+	err = GeoJSONToFlatGeobuf(strings.NewReader(input), &bytes.Buffer{}, strict)
+	if !errors.Is(err, ErrPropertyMismatch) {
+		t.Errorf("expected ErrPropertyMismatch, got %v", err)
+	}
+
+	// Only the sampled feature has the column, so it is inferred non-nullable
+	sampled := `{"type":"Feature","geometry":{"type":"Point","coordinates":[1,2]},"properties":{"a":1}}
+{"type":"Feature","geometry":{"type":"Point","coordinates":[3,4]},"properties":{}}
+`
+	err = GeoJSONToFlatGeobuf(strings.NewReader(sampled), &bytes.Buffer{}, &ConvertOptions{Schema: &SchemaPolicy{SampleSize: 1}})
+	if !errors.Is(err, ErrNullValue) {
+		t.Errorf("expected ErrNullValue, got %v", err)
+	}
+
+	// Every feature is checked against a schema inferred from a sample, and
+	// the first that does not fit is named
+	var changed strings.Builder
+	for i := 0; i < 5; i++ {
+		changed.WriteString(`{"type":"Feature","geometry":{"type":"Point","coordinates":[1,2]},"properties":{"a":1}}` + "\n")
+	}
+	changed.WriteString(`{"type":"Feature","geometry":{"type":"Point","coordinates":[3,4]},"properties":{"a":"x"}}` + "\n")
+	err = GeoJSONToFlatGeobuf(strings.NewReader(changed.String()), &bytes.Buffer{}, &ConvertOptions{Schema: &SchemaPolicy{SampleSize: 5, AllNullable: true}})
+	if !errors.Is(err, ErrPropertyMismatch) || !strings.Contains(err.Error(), "feature 5") {
+		t.Errorf("expected ErrPropertyMismatch in feature 5, got %v", err)
+	}
+
+	// A given schema is used as is, and checked for every feature
+	columns := []ColumnInfo{{Name: "a", Type: "Long"}}
+	err = GeoJSONToFlatGeobuf(strings.NewReader(input), &bytes.Buffer{}, &ConvertOptions{Write: &Options{Columns: columns}})
+	if !errors.Is(err, ErrPropertyMismatch) {
+		t.Errorf("expected ErrPropertyMismatch for a string in a Long column, got %v", err)
+	}
+
+	// A value that does not fit is an error in a nullable column too, not a null
+	columns = []ColumnInfo{{Name: "a", Type: "Double", Nullable: true}}
+	err = GeoJSONToFlatGeobuf(strings.NewReader(input), &bytes.Buffer{}, &ConvertOptions{Write: &Options{Columns: columns}})
+	if !errors.Is(err, ErrPropertyMismatch) {
+		t.Errorf("expected ErrPropertyMismatch for a string in a nullable Double column, got %v", err)
+	}
+}
+
+func TestGeoJSONToFlatGeobuf_SchemaIntegers(t *testing.T) {
+	input := `{"type":"Feature","geometry":{"type":"Point","coordinates":[1,2]},"properties":{"b":5,"s":300,"w":5e9,"d":1}}
+{"type":"Feature","geometry":{"type":"Point","coordinates":[3,4]},"properties":{"b":-5,"s":2,"w":1,"d":2.5}}
+`
+	tests := []struct {
+		name   string
+		policy *SchemaPolicy
+		want   map[string]string
+	}{
+		{"default", DefaultSchemaPolicy(),
+			map[string]string{"b": "Double", "s": "Double", "w": "Double", "d": "Double"}},
+		{"narrow", &SchemaPolicy{NarrowIntegers: true},
+			map[string]string{"b": "Byte", "s": "Short", "w": "Long", "d": "Double"}},
+		{"narrow to double", &SchemaPolicy{NarrowIntegers: true, IntegerWidening: WidenToDouble},
+			map[string]string{"b": "Byte", "s": "Short", "w": "Double", "d": "Double"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := GeoJSONToFlatGeobuf(strings.NewReader(input), &buf, &ConvertOptions{Schema: tt.policy}); err != nil {
+				t.Fatalf("GeoJSONToFlatGeobuf failed: %v", err)
+			}
+			reader, err := NewReaderFromData(buf.Bytes())
+			if err != nil {
+				t.Fatalf("NewReaderFromData failed: %v", err)
+			}
+			defer reader.Close()
+
+			if got := schemaTypes(reader.Header().Columns); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("column types = %v, want %v", got, tt.want)
+			}
+			fc, err := reader.ReadAll()
+			if err != nil {
+				t.Fatalf("ReadAll failed: %v", err)
+			}
+			// The index may reorder the features
+			for _, f := range fc.Features {
+				want := map[float64]float64{1: 5e9, 3: 1}[f.Geometry.(orb.Point).X()]
+				if got, _ := toFloat64(f.Properties["w"]); got != want {
+					t.Errorf("%v: w = %v, want %v", f.Geometry, f.Properties["w"], want)
+				}
+			}
+		})
+	}
+}
+
+func TestGeoJSONToFlatGeobuf_Empty(t *testing.T) {
+	inputs := []string{
+		"",
+		"\n\x1e\n",
+		`{"type":"FeatureCollection","features":[]}`,
+		`{"type":"FeatureCollection"}`,
+	}
+	for _, input := range inputs {
+		for _, index := range []bool{false, true} {
+			var buf bytes.Buffer
+			opts := &ConvertOptions{Write: &Options{IncludeIndex: index}}
+			if err := GeoJSONToFlatGeobuf(strings.NewReader(input), &buf, opts); err != nil {
+				t.Fatalf("%q index=%v: GeoJSONToFlatGeobuf failed: %v", input, index, err)
+			}
+			if report := Validate(buf.Bytes()); !report.Valid() {
+				t.Errorf("%q index=%v: invalid output: %v", input, index, report.Issues)
+			}
+		}
+	}
+}
+
+func TestGeoJSONToFlatGeobuf_Invalid(t *testing.T) {
+	point := `{"type":"Feature","geometry":{"type":"Point","coordinates":[1,2]},"properties":null}`
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"not an object", `[1,2]`},
+		{"syntax", `{"type":"FeatureCollection","features":[` + point + `,}`},
+		{"truncated", `{"type":"FeatureCollection","features":[` + point},
+		{"features not an array", `{"type":"FeatureCollection","features":{}}`},
+		{"wrong collection type", `{"type":"Feature","features":[]}`},
+		{"wrong trailing type", `{"features":[],"type":"Topology"}`},
+		{"trailing data", `{"type":"FeatureCollection","features":[]} {}`},
+		{"not a feature", point + "\n" + `{"type":"Point","coordinates":[1,2]}`},
+		{"bad geometry", `{"type":"Feature","geometry":{"type":"Point","coordinates":"x"}}`},
+	}
+	for _, tt := range tests {
+		for _, index := range []bool{false, true} {
+			opts := &ConvertOptions{Write: &Options{IncludeIndex: index}}
+			err := GeoJSONToFlatGeobuf(strings.NewReader(tt.input), &bytes.Buffer{}, opts)
+			if !errors.Is(err, ErrInvalidGeoJSON) {
+				t.Errorf("%s index=%v: expected ErrInvalidGeoJSON, got %v", tt.name, index, err)
+			}
+		}
+	}
+}
+
+func TestFlatGeobufToGeoJSON(t *testing.T) {
+	data := validFile(t, true)
+	reader, err := NewReaderFromData(data)
+	if err != nil {
+		t.Fatalf("NewReaderFromData failed: %v", err)
+	}
+	want, err := reader.ReadAll()
+	reader.Close()
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	wantJSON, _ := json.Marshal(want.Features)
+
+	formats := map[string]GeoJSONFormat{
+		"collection": GeoJSONCollection,
+		"seq":        GeoJSONSeq,
+		"lines":      GeoJSONLines,
+	}
+	for name, format := range formats {
+		var buf bytes.Buffer
+		if err := FlatGeobufToGeoJSON(bytes.NewReader(data), &buf, format, nil); err != nil {
+			t.Fatalf("%s: FlatGeobufToGeoJSON failed: %v", name, err)
+		}
+
+		var features []*geojson.Feature
+		switch format {
+		case GeoJSONCollection:
+			fc, err := geojson.UnmarshalFeatureCollection(buf.Bytes())
+			if err != nil {
+				t.Fatalf("%s: UnmarshalFeatureCollection failed: %v", name, err)
+			}
+			features = fc.Features
+		default:
+			scanner := bufio.NewScanner(&buf)
+			for scanner.Scan() {
+				line := scanner.Bytes()
+				if format == GeoJSONSeq {
+					if len(line) == 0 || line[0] != recordSeparator {
+						t.Fatalf("%s: line %q lacks a record separator", name, line)
+					}
+					line = line[1:]
+				}
+				f, err := geojson.UnmarshalFeature(line)
+				if err != nil {
+					t.Fatalf("%s: UnmarshalFeature failed: %v", name, err)
+				}
+				features = append(features, f)
+			}
+		}
+
+		gotJSON, _ := json.Marshal(features)
+		if !reflect.DeepEqual(gotJSON, wantJSON) {
+			t.Errorf("%s: features differ from ReadAll", name)
+		}
+	}
+}
+
+func TestFlatGeobufToGeoJSON_RoundTrip(t *testing.T) {
+	input := geoJSONInputs(t, concurrentFeatures(100))["lines"]
+
+	var fgb bytes.Buffer
+	opts := &ConvertOptions{Write: &Options{}}
+	if err := GeoJSONToFlatGeobuf(bytes.NewReader(input), &fgb, opts); err != nil {
+		t.Fatalf("GeoJSONToFlatGeobuf failed: %v", err)
+	}
+	var out bytes.Buffer
+	if err := FlatGeobufToGeoJSON(&fgb, &out, GeoJSONLines, nil); err != nil {
+		t.Fatalf("FlatGeobufToGeoJSON failed: %v", err)
+	}
+
+	// The features without a geometry are dropped
+	var want []string
+	for _, line := range strings.Split(strings.TrimSpace(string(input)), "\n") {
+		if !strings.Contains(line, `"geometry":null`) {
+			want = append(want, line)
+		}
+	}
+	got := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(got) != len(want) {
+		t.Fatalf("got %d features, want %d", len(got), len(want))
+	}
+	for i := range got {
+		var g, w interface{}
+		json.Unmarshal([]byte(got[i]), &g)
+		json.Unmarshal([]byte(want[i]), &w)
+		if !reflect.DeepEqual(g, w) {
+			t.Errorf("feature %d: got %s, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestFlatGeobufToGeoJSON_Invalid(t *testing.T) {
+	data := validFile(t, false)
+	layout := Validate(data)
+
+	for _, n := range []int{0, 10, layout.FeaturesOffset + 2, layout.FeaturesOffset + 10, len(data) - 1} {
+		err := FlatGeobufToGeoJSON(bytes.NewReader(data[:n]), &bytes.Buffer{}, GeoJSONSeq, nil)
+		if !errors.Is(err, ErrInvalidData) {
+			t.Errorf("truncated to %d bytes: expected ErrInvalidData, got %v", n, err)
+		}
+	}
+
+	if err := FlatGeobufToGeoJSON(bytes.NewReader(data), &bytes.Buffer{}, GeoJSONFormat(7), nil); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
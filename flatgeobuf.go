@@ -5,6 +5,7 @@ package flatgeobuf
 
 import (
 	"errors"
+	"fmt"
 )
 
 // Common errors returned by this package.
@@ -15,8 +16,31 @@ var (
 	ErrNoIndex          = errors.New("flatgeobuf: file has no spatial index")
 	ErrInvalidColumn    = errors.New("flatgeobuf: invalid column type")
 	ErrPropertyMismatch = errors.New("flatgeobuf: property type mismatch")
+	ErrNullValue        = errors.New("flatgeobuf: null value in non-nullable column")
+	ErrOutOfRange       = errors.New("flatgeobuf: feature index out of range")
+	ErrClosed           = errors.New("flatgeobuf: reader is closed")
+	ErrInvalidGeoJSON   = errors.New("flatgeobuf: invalid GeoJSON")
+	ErrUnsupportedCRS   = errors.New("flatgeobuf: unsupported CRS")
 )
 
+// PropertyError reports a feature whose property buffer could not be decoded.
+// It wraps ErrInvalidData.
+type PropertyError struct {
+	FeatureOffset int64  // Byte offset of the feature from the start of the feature data, as in IndexHit (-1 if unknown)
+	Column        int    // Column index being decoded (-1 if unknown)
+	Reason        string // Description of the problem
+}
+
+func (e *PropertyError) Error() string {
+	return fmt.Sprintf("%v: properties of feature at offset %d, column %d: %s",
+		ErrInvalidData, e.FeatureOffset, e.Column, e.Reason)
+}
+
+// Unwrap returns ErrInvalidData.
+func (e *PropertyError) Unwrap() error {
+	return ErrInvalidData
+}
+
 // CRS represents a coordinate reference system.
 type CRS struct {
 	Code        int    // EPSG code (e.g., 4326 for WGS84)
@@ -33,12 +57,31 @@ func WGS84() *CRS {
 	}
 }
 
+// BinaryEncoding selects how Binary column values are represented in
+// geojson.Properties.
+type BinaryEncoding int
+
+const (
+	// BinaryRaw keeps values as []byte. encoding/json marshals these as
+	// base64 strings.
+	BinaryRaw BinaryEncoding = iota
+	// BinaryBase64 represents values as standard base64 strings.
+	BinaryBase64
+	// BinaryHex represents values as lowercase hexadecimal strings.
+	BinaryHex
+)
+
 // Options configures FlatGeobuf writing.
 type Options struct {
-	Name         string // Layer name
-	Description  string // Layer description
-	IncludeIndex bool   // Include spatial index (default: true)
-	CRS          *CRS   // Coordinate reference system (optional)
+	Name           string         // Layer name
+	Description    string         // Layer description
+	IncludeIndex   bool           // Include spatial index (default: true)
+	CRS            *CRS           // Coordinate reference system (optional)
+	BinaryEncoding BinaryEncoding // Decoding of string values written to Binary columns given in Columns
+	SortColumns    bool           // Order columns by name instead of first occurrence
+	Columns        []ColumnInfo   // Explicit column schema (default: inferred)
+	Concurrency    int            // Goroutines encoding features (0 or 1: sequential, negative: GOMAXPROCS)
+	TargetCRS      *CRS           // Reproject coordinates from CRS to this CRS, written as the file's CRS (default: none)
 }
 
 // DefaultOptions returns default options for writing FlatGeobuf files.
@@ -48,6 +91,36 @@ func DefaultOptions() *Options {
 	}
 }
 
+// ReaderOptions configures FlatGeobuf reading.
+type ReaderOptions struct {
+	BinaryEncoding     BinaryEncoding // Representation of Binary column values
+	IncludeNullColumns bool           // Add absent nullable columns as nil properties
+	LegacyStrings      bool           // Read NUL-terminated strings from files written by older versions
+	Concurrency        int            // Goroutines decoding features in bulk reads (0 or 1: sequential, negative: GOMAXPROCS)
+	Validate           bool           // Check the whole file with Validate when opening it
+	TargetCRS          *CRS           // Reproject coordinates from the file's CRS to this CRS (default: none)
+}
+
+// DefaultReaderOptions returns default options for reading FlatGeobuf files.
+func DefaultReaderOptions() *ReaderOptions {
+	return &ReaderOptions{}
+}
+
+// IndexOptions configures BuildIndex.
+type IndexOptions struct {
+	NodeSize  uint16 // Children per index node (default: 16)
+	MaxMemory int    // Approximate bytes of index entries sorted in memory at once (default: 64 MiB)
+	TempDir   string // Directory for temporary files (default: os.TempDir())
+}
+
+// DefaultIndexOptions returns default options for BuildIndex.
+func DefaultIndexOptions() *IndexOptions {
+	return &IndexOptions{
+		NodeSize:  16,
+		MaxMemory: 64 << 20,
+	}
+}
+
 // ColumnInfo describes a property column in a FlatGeobuf file.
 type ColumnInfo struct {
 	Name        string // Column name
@@ -55,6 +128,8 @@ type ColumnInfo struct {
 	Title       string // Column title (human-readable)
 	Description string // Column description
 	Nullable    bool   // Whether the column can contain null values
+	Width       int    // Maximum width in characters (0 or -1: unspecified)
+	Precision   int    // Digits after the decimal point (0 or -1: unspecified)
 }
 
 // Header contains metadata about a FlatGeobuf file.
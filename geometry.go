@@ -1,6 +1,10 @@
 package flatgeobuf
 
 import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
 	"github.com/flatgeobuf/flatgeobuf/src/go/flattypes"
 	"github.com/flatgeobuf/flatgeobuf/src/go/writer"
 	flatbuffers "github.com/google/flatbuffers/go"
@@ -34,7 +38,9 @@ func orbToFGBGeometryType(geom orb.Geometry) flattypes.GeometryType {
 }
 
 // geometryToFGB converts an orb.Geometry to a FlatGeobuf writer.Geometry.
-func geometryToFGB(geom orb.Geometry, builder *flatbuffers.Builder) *writer.Geometry {
+// Coordinates are carved from coords and must not be reset before the
+// geometry is built.
+func geometryToFGB(geom orb.Geometry, builder *flatbuffers.Builder, coords *coordBuffer) *writer.Geometry {
 	if geom == nil {
 		return nil
 	}
@@ -44,36 +50,30 @@ func geometryToFGB(geom orb.Geometry, builder *flatbuffers.Builder) *writer.Geom
 	switch v := geom.(type) {
 	case orb.Point:
 		g.SetType(flattypes.GeometryTypePoint)
-		g.SetXY([]float64{v[0], v[1]})
+		g.SetXY(append(coords.floats(2), v[0], v[1]))
 
 	case orb.MultiPoint:
 		g.SetType(flattypes.GeometryTypeMultiPoint)
-		xy := make([]float64, 0, len(v)*2)
-		for _, p := range v {
-			xy = append(xy, p[0], p[1])
-		}
-		g.SetXY(xy)
+		g.SetXY(coords.points(v))
 
 	case orb.LineString:
 		g.SetType(flattypes.GeometryTypeLineString)
-		xy := lineStringToXY(v)
-		g.SetXY(xy)
+		g.SetXY(coords.points(v))
 
 	case orb.MultiLineString:
 		g.SetType(flattypes.GeometryTypeMultiLineString)
-		xy, ends := multiLineStringToXYEnds(v)
+		xy, ends := coords.multiLineString(v)
 		g.SetXY(xy)
 		g.SetEnds(ends)
 
 	case orb.Ring:
 		g.SetType(flattypes.GeometryTypePolygon)
-		xy := ringToXY(v)
-		g.SetXY(xy)
-		g.SetEnds([]uint32{uint32(len(v))})
+		g.SetXY(coords.points(v))
+		g.SetEnds(append(coords.uints(1), uint32(len(v))))
 
 	case orb.Polygon:
 		g.SetType(flattypes.GeometryTypePolygon)
-		xy, ends := polygonToXYEnds(v)
+		xy, ends := coords.polygon(v)
 		g.SetXY(xy)
 		g.SetEnds(ends)
 
@@ -83,7 +83,7 @@ func geometryToFGB(geom orb.Geometry, builder *flatbuffers.Builder) *writer.Geom
 		for _, poly := range v {
 			pg := writer.NewGeometry(builder)
 			pg.SetType(flattypes.GeometryTypePolygon)
-			xy, ends := polygonToXYEnds(poly)
+			xy, ends := coords.polygon(poly)
 			pg.SetXY(xy)
 			pg.SetEnds(ends)
 			parts = append(parts, *pg)
@@ -94,7 +94,7 @@ func geometryToFGB(geom orb.Geometry, builder *flatbuffers.Builder) *writer.Geom
 		g.SetType(flattypes.GeometryTypeGeometryCollection)
 		parts := make([]writer.Geometry, 0, len(v))
 		for _, child := range v {
-			childGeom := geometryToFGB(child, builder)
+			childGeom := geometryToFGB(child, builder, coords)
 			if childGeom != nil {
 				parts = append(parts, *childGeom)
 			}
@@ -104,8 +104,7 @@ func geometryToFGB(geom orb.Geometry, builder *flatbuffers.Builder) *writer.Geom
 	case orb.Bound:
 		// Convert bound to a polygon (rectangle)
 		g.SetType(flattypes.GeometryTypePolygon)
-		poly := boundToPolygon(v)
-		xy, ends := polygonToXYEnds(poly)
+		xy, ends := coords.polygon(boundToPolygon(v))
 		g.SetXY(xy)
 		g.SetEnds(ends)
 
@@ -117,22 +116,31 @@ func geometryToFGB(geom orb.Geometry, builder *flatbuffers.Builder) *writer.Geom
 }
 
 // geometryFromFGB converts a FlatGeobuf flattypes.Geometry to an orb.Geometry.
-func geometryFromFGB(fgbGeom *flattypes.Geometry) orb.Geometry {
+// The geometry table must have been verified; inconsistent coordinate data
+// is reported as ErrInvalidData.
+func geometryFromFGB(fgbGeom *flattypes.Geometry) (orb.Geometry, error) {
 	if fgbGeom == nil {
-		return nil
+		return nil, nil
 	}
 
-	geomType := fgbGeom.Type()
+	return geometryFromFGBType(fgbGeom, fgbGeom.Type())
+}
+
+// geometryFromFGBType converts a FlatGeobuf geometry, interpreting it as geomType.
+func geometryFromFGBType(fgbGeom *flattypes.Geometry, geomType flattypes.GeometryType) (orb.Geometry, error) {
+	if fgbGeom == nil {
+		return nil, nil
+	}
 
 	switch geomType {
 	case flattypes.GeometryTypePoint:
-		return pointFromXY(fgbGeom)
+		return pointFromXY(fgbGeom), nil
 
 	case flattypes.GeometryTypeMultiPoint:
-		return multiPointFromXY(fgbGeom)
+		return multiPointFromXY(fgbGeom), nil
 
 	case flattypes.GeometryTypeLineString:
-		return lineStringFromXY(fgbGeom)
+		return lineStringFromXY(fgbGeom), nil
 
 	case flattypes.GeometryTypeMultiLineString:
 		return multiLineStringFromXYEnds(fgbGeom)
@@ -147,36 +155,66 @@ func geometryFromFGB(fgbGeom *flattypes.Geometry) orb.Geometry {
 		return collectionFromParts(fgbGeom)
 
 	default:
-		return nil
+		return nil, nil
 	}
 }
 
 // Helper functions for writing
 
-func lineStringToXY(ls orb.LineString) []float64 {
-	xy := make([]float64, 0, len(ls)*2)
-	for _, p := range ls {
-		xy = append(xy, p[0], p[1])
+// coordBuffer carves the coordinate and ends vectors of geometries being
+// encoded out of backing arrays that are reused across features. Slices
+// handed out stay valid until reset.
+type coordBuffer struct {
+	xy   []float64
+	ends []uint32
+}
+
+// reset makes the backing arrays available for the next feature.
+func (c *coordBuffer) reset() {
+	c.xy = c.xy[:0]
+	c.ends = c.ends[:0]
+}
+
+// floats returns an empty slice with room for n values.
+func (c *coordBuffer) floats(n int) []float64 {
+	if cap(c.xy)-len(c.xy) < n {
+		// Slices already handed out keep the old array alive
+		c.xy = make([]float64, 0, 2*cap(c.xy)+n)
 	}
-	return xy
+	start := len(c.xy)
+	c.xy = c.xy[:start+n]
+	return c.xy[start : start : start+n]
+}
+
+// uints returns an empty slice with room for n values.
+func (c *coordBuffer) uints(n int) []uint32 {
+	if cap(c.ends)-len(c.ends) < n {
+		c.ends = make([]uint32, 0, 2*cap(c.ends)+n)
+	}
+	start := len(c.ends)
+	c.ends = c.ends[:start+n]
+	return c.ends[start : start : start+n]
 }
 
-func ringToXY(r orb.Ring) []float64 {
-	xy := make([]float64, 0, len(r)*2)
-	for _, p := range r {
+// points returns the interleaved coordinates of points.
+func (c *coordBuffer) points(points []orb.Point) []float64 {
+	xy := c.floats(2 * len(points))
+	for _, p := range points {
 		xy = append(xy, p[0], p[1])
 	}
 	return xy
 }
 
-func multiLineStringToXYEnds(mls orb.MultiLineString) ([]float64, []uint32) {
+// multiLineString returns the interleaved coordinates of mls and the end of
+// each line string.
+func (c *coordBuffer) multiLineString(mls orb.MultiLineString) ([]float64, []uint32) {
 	totalPoints := 0
 	for _, ls := range mls {
 		totalPoints += len(ls)
 	}
 
-	xy := make([]float64, 0, totalPoints*2)
-	ends := make([]uint32, 0, len(mls))
+	xy := c.floats(totalPoints * 2)
+	ends := c.uints(len(mls))
 
 	cumulative := uint32(0)
 	for _, ls := range mls {
@@ -190,14 +228,16 @@ func multiLineStringToXYEnds(mls orb.MultiLineString) ([]float64, []uint32) {
 	return xy, ends
 }
 
-func polygonToXYEnds(poly orb.Polygon) ([]float64, []uint32) {
+// polygon returns the interleaved coordinates of poly and the end of each
+// ring.
+func (c *coordBuffer) polygon(poly orb.Polygon) ([]float64, []uint32) {
 	totalPoints := 0
 	for _, ring := range poly {
 		totalPoints += len(ring)
 	}
 
-	xy := make([]float64, 0, totalPoints*2)
-	ends := make([]uint32, 0, len(poly))
+	xy := c.floats(totalPoints * 2)
+	ends := c.uints(len(poly))
 
 	cumulative := uint32(0)
 	for _, ring := range poly {
@@ -225,188 +265,289 @@ func boundToPolygon(b orb.Bound) orb.Polygon {
 
 // Helper functions for reading
 
-func pointFromXY(fgbGeom *flattypes.Geometry) orb.Point {
-	if fgbGeom.XyLength() < 2 {
-		return orb.Point{}
+// Vtable offsets of the Geometry vectors that are read directly.
+const (
+	geometryEndsField flatbuffers.VOffsetT = 4
+	geometryXYField   flatbuffers.VOffsetT = 6
+)
+
+// vectorBytes returns the raw little-endian contents of the vector at field
+// of t, whose elements are size bytes each. It returns nil if the vector is
+// absent or does not fit in the buffer.
+func vectorBytes(t flatbuffers.Table, field flatbuffers.VOffsetT, size int) []byte {
+	o := flatbuffers.UOffsetT(t.Offset(field))
+	if o == 0 {
+		return nil
+	}
+	start := int(t.Vector(o))
+	n := t.VectorLen(o)
+	if n < 0 || start > len(t.Bytes) || n > (len(t.Bytes)-start)/size {
+		return nil
 	}
-	return orb.Point{fgbGeom.Xy(0), fgbGeom.Xy(1)}
+	return t.Bytes[start : start+n*size]
 }
 
-func multiPointFromXY(fgbGeom *flattypes.Geometry) orb.MultiPoint {
-	xyLen := fgbGeom.XyLength()
-	if xyLen < 2 {
-		return orb.MultiPoint{}
-	}
+// geometryXY returns the raw xy vector of g, trimmed to whole points.
+func geometryXY(g *flattypes.Geometry) []byte {
+	xy := vectorBytes(g.Table(), geometryXYField, 8)
+	return xy[:len(xy)/16*16]
+}
 
-	numPoints := xyLen / 2
-	mp := make(orb.MultiPoint, 0, numPoints)
-	for i := 0; i < xyLen; i += 2 {
-		mp = append(mp, orb.Point{fgbGeom.Xy(i), fgbGeom.Xy(i + 1)})
-	}
-	return mp
+// geometryEnds returns the raw ends vector of g.
+func geometryEnds(g *flattypes.Geometry) []byte {
+	return vectorBytes(g.Table(), geometryEndsField, 4)
 }
 
-func lineStringFromXY(fgbGeom *flattypes.Geometry) orb.LineString {
-	xyLen := fgbGeom.XyLength()
-	if xyLen < 2 {
-		return orb.LineString{}
+// xyPoint decodes point i of a raw xy vector.
+func xyPoint(xy []byte, i int) orb.Point {
+	return orb.Point{
+		math.Float64frombits(binary.LittleEndian.Uint64(xy[16*i:])),
+		math.Float64frombits(binary.LittleEndian.Uint64(xy[16*i+8:])),
 	}
+}
 
-	numPoints := xyLen / 2
-	ls := make(orb.LineString, 0, numPoints)
-	for i := 0; i < xyLen; i += 2 {
-		ls = append(ls, orb.Point{fgbGeom.Xy(i), fgbGeom.Xy(i + 1)})
+// xyPoints decodes every point of a raw xy vector into a single allocation.
+func xyPoints(xy []byte) []orb.Point {
+	points := make([]orb.Point, len(xy)/16)
+	for i := range points {
+		points[i] = xyPoint(xy, i)
 	}
-	return ls
+	return points
 }
 
-func multiLineStringFromXYEnds(fgbGeom *flattypes.Geometry) orb.MultiLineString {
-	xyLen := fgbGeom.XyLength()
-	endsLen := fgbGeom.EndsLength()
-
-	if xyLen < 2 || endsLen == 0 {
-		// If no ends, treat as single linestring
-		if xyLen >= 2 {
-			return orb.MultiLineString{lineStringFromXY(fgbGeom)}
+// splitEnds slices points into parts, one per entry of a raw ends vector.
+// Parts share the backing array but are capped, so appending to one does not
+// overwrite the next. Ends beyond the points or before the previous end are
+// reported as ErrInvalidData.
+func splitEnds[S ~[]orb.Point](points []orb.Point, ends []byte, parts []S) error {
+	start := 0
+	for i := range parts {
+		end := binary.LittleEndian.Uint32(ends[4*i:])
+		if uint64(end) > uint64(len(points)) {
+			return fmt.Errorf("%w: geometry end %d exceeds %d points", ErrInvalidData, end, len(points))
 		}
-		return orb.MultiLineString{}
-	}
-
-	mls := make(orb.MultiLineString, 0, endsLen)
-	start := uint32(0)
-
-	for i := 0; i < endsLen; i++ {
-		end := fgbGeom.Ends(i)
-		ls := make(orb.LineString, 0, end-start)
-
-		for j := start; j < end; j++ {
-			idx := int(j) * 2
-			if idx+1 < xyLen {
-				ls = append(ls, orb.Point{fgbGeom.Xy(idx), fgbGeom.Xy(idx + 1)})
-			}
+		if int(end) < start {
+			return fmt.Errorf("%w: geometry end %d precedes the previous end %d", ErrInvalidData, end, start)
 		}
+		parts[i] = S(points[start:end:end])
+		start = int(end)
+	}
+	return nil
+}
 
-		mls = append(mls, ls)
-		start = end
+func pointFromXY(fgbGeom *flattypes.Geometry) orb.Point {
+	xy := geometryXY(fgbGeom)
+	if len(xy) == 0 {
+		return orb.Point{}
 	}
+	return xyPoint(xy, 0)
+}
 
-	return mls
+func multiPointFromXY(fgbGeom *flattypes.Geometry) orb.MultiPoint {
+	return orb.MultiPoint(xyPoints(geometryXY(fgbGeom)))
 }
 
-func polygonFromXYEnds(fgbGeom *flattypes.Geometry) orb.Polygon {
-	xyLen := fgbGeom.XyLength()
-	endsLen := fgbGeom.EndsLength()
+func lineStringFromXY(fgbGeom *flattypes.Geometry) orb.LineString {
+	return orb.LineString(xyPoints(geometryXY(fgbGeom)))
+}
 
-	if xyLen < 2 {
-		return orb.Polygon{}
-	}
+func multiLineStringFromXYEnds(fgbGeom *flattypes.Geometry) (orb.MultiLineString, error) {
+	xy := geometryXY(fgbGeom)
+	ends := geometryEnds(fgbGeom)
 
-	// If no ends array, treat all points as a single ring
-	if endsLen == 0 {
-		numPoints := xyLen / 2
-		ring := make(orb.Ring, 0, numPoints)
-		for i := 0; i < xyLen; i += 2 {
-			ring = append(ring, orb.Point{fgbGeom.Xy(i), fgbGeom.Xy(i + 1)})
+	if len(xy) == 0 || len(ends) == 0 {
+		// If no ends, treat as single linestring
+		if len(xy) > 0 {
+			return orb.MultiLineString{xyPoints(xy)}, nil
 		}
-		return orb.Polygon{ring}
+		return orb.MultiLineString{}, nil
 	}
 
-	poly := make(orb.Polygon, 0, endsLen)
-	start := uint32(0)
+	mls := make(orb.MultiLineString, len(ends)/4)
+	if err := splitEnds(xyPoints(xy), ends, mls); err != nil {
+		return nil, err
+	}
+	return mls, nil
+}
 
-	for i := 0; i < endsLen; i++ {
-		end := fgbGeom.Ends(i)
-		ring := make(orb.Ring, 0, end-start)
+func polygonFromXYEnds(fgbGeom *flattypes.Geometry) (orb.Polygon, error) {
+	xy := geometryXY(fgbGeom)
+	ends := geometryEnds(fgbGeom)
 
-		for j := start; j < end; j++ {
-			idx := int(j) * 2
-			if idx+1 < xyLen {
-				ring = append(ring, orb.Point{fgbGeom.Xy(idx), fgbGeom.Xy(idx + 1)})
-			}
-		}
+	if len(xy) == 0 {
+		return orb.Polygon{}, nil
+	}
 
-		poly = append(poly, ring)
-		start = end
+	// If no ends array, treat all points as a single ring
+	if len(ends) == 0 {
+		return orb.Polygon{xyPoints(xy)}, nil
 	}
 
-	return poly
+	poly := make(orb.Polygon, len(ends)/4)
+	if err := splitEnds(xyPoints(xy), ends, poly); err != nil {
+		return nil, err
+	}
+	return poly, nil
 }
 
-func multiPolygonFromParts(fgbGeom *flattypes.Geometry) orb.MultiPolygon {
+func multiPolygonFromParts(fgbGeom *flattypes.Geometry) (orb.MultiPolygon, error) {
 	partsLen := fgbGeom.PartsLength()
 	if partsLen == 0 {
 		// Fallback: treat as single polygon
-		poly := polygonFromXYEnds(fgbGeom)
+		poly, err := polygonFromXYEnds(fgbGeom)
+		if err != nil {
+			return nil, err
+		}
 		if len(poly) > 0 {
-			return orb.MultiPolygon{poly}
+			return orb.MultiPolygon{poly}, nil
 		}
-		return orb.MultiPolygon{}
+		return orb.MultiPolygon{}, nil
 	}
 
 	mp := make(orb.MultiPolygon, 0, partsLen)
 	for i := 0; i < partsLen; i++ {
 		var part flattypes.Geometry
 		if fgbGeom.Parts(&part, i) {
-			poly := polygonFromXYEnds(&part)
+			poly, err := polygonFromXYEnds(&part)
+			if err != nil {
+				return nil, err
+			}
 			if len(poly) > 0 {
 				mp = append(mp, poly)
 			}
 		}
 	}
 
-	return mp
+	return mp, nil
 }
 
-func collectionFromParts(fgbGeom *flattypes.Geometry) orb.Collection {
+func collectionFromParts(fgbGeom *flattypes.Geometry) (orb.Collection, error) {
 	partsLen := fgbGeom.PartsLength()
 	if partsLen == 0 {
-		return orb.Collection{}
+		return orb.Collection{}, nil
 	}
 
 	coll := make(orb.Collection, 0, partsLen)
 	for i := 0; i < partsLen; i++ {
 		var part flattypes.Geometry
 		if fgbGeom.Parts(&part, i) {
-			geom := geometryFromFGB(&part)
+			geom, err := geometryFromFGB(&part)
+			if err != nil {
+				return nil, err
+			}
 			if geom != nil {
 				coll = append(coll, geom)
 			}
 		}
 	}
 
-	return coll
-}
-
-// computeBoundingBox computes the bounding box of an orb.Geometry.
-func computeBoundingBox(geom orb.Geometry) [4]float64 {
-	bound := geom.Bound()
-	return [4]float64{bound.Min[0], bound.Min[1], bound.Max[0], bound.Max[1]}
+	return coll, nil
 }
 
-// computeCollectionBoundingBox computes the combined bounding box of multiple geometries.
-func computeCollectionBoundingBox(geometries []orb.Geometry) [4]float64 {
-	if len(geometries) == 0 {
-		return [4]float64{0, 0, 0, 0}
+// Envelope returns the bound of the coordinates of geometries. NaN
+// coordinates are ignored, and when there are no other coordinates, for
+// example for nil or empty geometries, the result is an empty bound for which
+// IsEmpty reports true.
+func Envelope(geometries ...orb.Geometry) orb.Bound {
+	bound := emptyBound
+	for _, g := range geometries {
+		bound = extendEnvelope(bound, g)
 	}
+	return bound
+}
 
-	minX, minY := geometries[0].Bound().Min[0], geometries[0].Bound().Min[1]
-	maxX, maxY := geometries[0].Bound().Max[0], geometries[0].Bound().Max[1]
+// emptyBound is the bound of no coordinates. It is inverted, so it
+// intersects nothing and extending it by a point gives that point's bound.
+var emptyBound = orb.Bound{
+	Min: orb.Point{math.Inf(1), math.Inf(1)},
+	Max: orb.Point{math.Inf(-1), math.Inf(-1)},
+}
 
-	for _, geom := range geometries[1:] {
-		bound := geom.Bound()
-		if bound.Min[0] < minX {
-			minX = bound.Min[0]
+// extendEnvelope returns bound grown to cover the coordinates of g.
+func extendEnvelope(bound orb.Bound, g orb.Geometry) orb.Bound {
+	switch v := g.(type) {
+	case orb.Point:
+		bound = extendPoint(bound, v)
+	case orb.MultiPoint:
+		bound = extendPoints(bound, v)
+	case orb.LineString:
+		bound = extendPoints(bound, v)
+	case orb.Ring:
+		bound = extendPoints(bound, v)
+	case orb.MultiLineString:
+		for _, ls := range v {
+			bound = extendPoints(bound, ls)
+		}
+	case orb.Polygon:
+		for _, ring := range v {
+			bound = extendPoints(bound, ring)
 		}
-		if bound.Min[1] < minY {
-			minY = bound.Min[1]
+	case orb.MultiPolygon:
+		for _, poly := range v {
+			for _, ring := range poly {
+				bound = extendPoints(bound, ring)
+			}
+		}
+	case orb.Collection:
+		for _, child := range v {
+			bound = extendEnvelope(bound, child)
 		}
-		if bound.Max[0] > maxX {
-			maxX = bound.Max[0]
+	case orb.Bound:
+		if !v.IsEmpty() {
+			bound = extendPoint(extendPoint(bound, v.Min), v.Max)
 		}
-		if bound.Max[1] > maxY {
-			maxY = bound.Max[1]
+	}
+	return bound
+}
+
+func extendPoints(bound orb.Bound, points []orb.Point) orb.Bound {
+	for _, p := range points {
+		bound = extendPoint(bound, p)
+	}
+	return bound
+}
+
+// extendPoint returns bound grown to cover p, or bound itself if p has a NaN
+// coordinate.
+func extendPoint(bound orb.Bound, p orb.Point) orb.Bound {
+	if math.IsNaN(p[0]) || math.IsNaN(p[1]) {
+		return bound
+	}
+	return bound.Extend(p)
+}
+
+// featureBound returns the bound of a feature's coordinates, ignoring NaN
+// values, or emptyBound if it has none.
+func featureBound(f *flattypes.Feature) orb.Bound {
+	var geom flattypes.Geometry
+	if f.Geometry(&geom) == nil {
+		return emptyBound
+	}
+	return extendGeometryBound(emptyBound, &geom)
+}
+
+// extendGeometryBound returns bound grown to cover the coordinates of g and
+// its parts.
+func extendGeometryBound(bound orb.Bound, g *flattypes.Geometry) orb.Bound {
+	xy := geometryXY(g)
+	for i := 0; i < len(xy)/16; i++ {
+		bound = extendPoint(bound, xyPoint(xy, i))
+	}
+
+	var part flattypes.Geometry
+	for i := 0; i < g.PartsLength(); i++ {
+		if g.Parts(&part, i) {
+			bound = extendGeometryBound(bound, &part)
 		}
 	}
+	return bound
+}
 
-	return [4]float64{minX, minY, maxX, maxY}
+// envelopeSlice returns bound as a header envelope, [minX, minY, maxX, maxY],
+// or nil if it is empty.
+func envelopeSlice(bound orb.Bound) []float64 {
+	if bound.IsEmpty() {
+		return nil
+	}
+	return []float64{bound.Min[0], bound.Min[1], bound.Max[0], bound.Max[1]}
 }
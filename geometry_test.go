@@ -1,9 +1,12 @@
 package flatgeobuf
 
 import (
+	"errors"
+	"math"
 	"testing"
 
 	"github.com/flatgeobuf/flatgeobuf/src/go/flattypes"
+	"github.com/flatgeobuf/flatgeobuf/src/go/writer"
 	flatbuffers "github.com/google/flatbuffers/go"
 	"github.com/paulmach/orb"
 )
@@ -39,7 +42,7 @@ func TestGeometryToFGB_Point(t *testing.T) {
 	builder := flatbuffers.NewBuilder(256)
 	point := orb.Point{1.5, 2.5}
 
-	geom := geometryToFGB(point, builder)
+	geom := geometryToFGB(point, builder, &coordBuffer{})
 	if geom == nil {
 		t.Fatal("expected non-nil geometry")
 	}
@@ -49,7 +52,7 @@ func TestGeometryToFGB_LineString(t *testing.T) {
 	builder := flatbuffers.NewBuilder(256)
 	ls := orb.LineString{{0, 0}, {1, 1}, {2, 2}}
 
-	geom := geometryToFGB(ls, builder)
+	geom := geometryToFGB(ls, builder, &coordBuffer{})
 	if geom == nil {
 		t.Fatal("expected non-nil geometry")
 	}
@@ -62,7 +65,7 @@ func TestGeometryToFGB_Polygon(t *testing.T) {
 		{{2, 2}, {8, 2}, {8, 8}, {2, 8}, {2, 2}}, // hole
 	}
 
-	geom := geometryToFGB(poly, builder)
+	geom := geometryToFGB(poly, builder, &coordBuffer{})
 	if geom == nil {
 		t.Fatal("expected non-nil geometry")
 	}
@@ -75,7 +78,7 @@ func TestGeometryToFGB_MultiPolygon(t *testing.T) {
 		{{{10, 10}, {15, 10}, {15, 15}, {10, 15}, {10, 10}}},
 	}
 
-	geom := geometryToFGB(mp, builder)
+	geom := geometryToFGB(mp, builder, &coordBuffer{})
 	if geom == nil {
 		t.Fatal("expected non-nil geometry")
 	}
@@ -88,7 +91,7 @@ func TestGeometryToFGB_Collection(t *testing.T) {
 		orb.LineString{{0, 0}, {1, 1}},
 	}
 
-	geom := geometryToFGB(coll, builder)
+	geom := geometryToFGB(coll, builder, &coordBuffer{})
 	if geom == nil {
 		t.Fatal("expected non-nil geometry")
 	}
@@ -98,7 +101,7 @@ func TestGeometryToFGB_Bound(t *testing.T) {
 	builder := flatbuffers.NewBuilder(256)
 	bound := orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{10, 10}}
 
-	geom := geometryToFGB(bound, builder)
+	geom := geometryToFGB(bound, builder, &coordBuffer{})
 	if geom == nil {
 		t.Fatal("expected non-nil geometry")
 	}
@@ -107,15 +110,16 @@ func TestGeometryToFGB_Bound(t *testing.T) {
 func TestGeometryToFGB_Nil(t *testing.T) {
 	builder := flatbuffers.NewBuilder(256)
 
-	geom := geometryToFGB(nil, builder)
+	geom := geometryToFGB(nil, builder, &coordBuffer{})
 	if geom != nil {
 		t.Error("expected nil geometry for nil input")
 	}
 }
 
-func TestLineStringToXY(t *testing.T) {
+func TestCoordBuffer_Points(t *testing.T) {
 	ls := orb.LineString{{1, 2}, {3, 4}, {5, 6}}
-	xy := lineStringToXY(ls)
+	var coords coordBuffer
+	xy := coords.points(ls)
 
 	expected := []float64{1, 2, 3, 4, 5, 6}
 	if len(xy) != len(expected) {
@@ -129,13 +133,14 @@ func TestLineStringToXY(t *testing.T) {
 	}
 }
 
-func TestPolygonToXYEnds(t *testing.T) {
+func TestCoordBuffer_Polygon(t *testing.T) {
 	poly := orb.Polygon{
 		{{0, 0}, {10, 0}, {10, 10}, {0, 10}, {0, 0}}, // 5 points
 		{{2, 2}, {8, 2}, {8, 8}, {2, 8}, {2, 2}},     // 5 points
 	}
 
-	xy, ends := polygonToXYEnds(poly)
+	var coords coordBuffer
+	xy, ends := coords.polygon(poly)
 
 	if len(xy) != 20 { // 10 points * 2 coordinates
 		t.Errorf("expected 20 coordinates, got %d", len(xy))
@@ -154,6 +159,110 @@ func TestPolygonToXYEnds(t *testing.T) {
 	}
 }
 
+func TestCoordBuffer_Grow(t *testing.T) {
+	var coords coordBuffer
+	first := coords.points(orb.LineString{{1, 2}, {3, 4}})
+
+	// Growing the buffer leaves slices already handed out intact
+	for i := 0; i < 100; i++ {
+		coords.points(make(orb.LineString, 10))
+	}
+	if len(first) != 4 || first[0] != 1 || first[3] != 4 {
+		t.Errorf("expected [1 2 3 4], got %v", first)
+	}
+	if cap(first) != 4 {
+		t.Errorf("expected the slice to be capped at 4, got %d", cap(first))
+	}
+
+	coords.reset()
+	if len(coords.xy) != 0 || cap(coords.xy) < 1000 {
+		t.Errorf("expected reset to keep the grown buffer, got len %d cap %d", len(coords.xy), cap(coords.xy))
+	}
+}
+
+// buildGeometry serializes a geometry with the given coordinates and ends.
+func buildGeometry(xy []float64, ends []uint32) *flattypes.Geometry {
+	builder := flatbuffers.NewBuilder(256)
+	g := writer.NewGeometry(builder)
+	g.SetType(flattypes.GeometryTypePolygon)
+	g.SetXY(xy)
+	g.SetEnds(ends)
+	builder.Finish(g.Build())
+	return flattypes.GetRootAsGeometry(builder.FinishedBytes(), 0)
+}
+
+func TestPolygonFromXYEnds_InconsistentEnds(t *testing.T) {
+	xy := []float64{0, 0, 1, 0, 1, 1}
+
+	tests := []struct {
+		name    string
+		ends    []uint32
+		lengths []int
+		wantErr bool
+	}{
+		{"consistent", []uint32{2, 3}, []int{2, 1}, false},
+		{"empty ring", []uint32{3, 3}, []int{3, 0}, false},
+		{"past the points", []uint32{2, 10}, nil, true},
+		{"decreasing", []uint32{3, 1}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			poly, err := polygonFromXYEnds(buildGeometry(xy, tt.ends))
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidData) {
+					t.Fatalf("expected ErrInvalidData, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("polygonFromXYEnds failed: %v", err)
+			}
+			if len(poly) != len(tt.lengths) {
+				t.Fatalf("expected %d rings, got %d", len(tt.lengths), len(poly))
+			}
+			for i, ring := range poly {
+				if len(ring) != tt.lengths[i] || cap(ring) != len(ring) {
+					t.Errorf("ring %d: expected %d points, got len %d cap %d", i, tt.lengths[i], len(ring), cap(ring))
+				}
+			}
+		})
+	}
+}
+
+func TestConvertFeature_InconsistentEnds(t *testing.T) {
+	builder := flatbuffers.NewBuilder(256)
+	g := writer.NewGeometry(builder)
+	g.SetType(flattypes.GeometryTypeMultiPolygon)
+	part := writer.NewGeometry(builder)
+	part.SetType(flattypes.GeometryTypePolygon)
+	part.SetXY([]float64{0, 0, 1, 0, 1, 1})
+	part.SetEnds([]uint32{2, 10})
+	g.SetParts([]writer.Geometry{*part})
+	builder.Finish(writer.NewFeature(builder).SetGeometry(g).Build())
+
+	data := builder.FinishedBytes()
+	if err := verifyFeature(data); err != nil {
+		t.Fatalf("verifyFeature failed: %v", err)
+	}
+	header := newTestHeader()
+	_, err := convertFeature(flattypes.GetRootAsFeature(data, 0), 0, header, newPropertyDecoder(header, nil))
+	if !errors.Is(err, ErrInvalidData) {
+		t.Errorf("expected ErrInvalidData, got %v", err)
+	}
+}
+
+func TestGeometryFromFGB_Allocs(t *testing.T) {
+	// All points of a geometry share one allocation
+	g := buildGeometry([]float64{0, 0, 4, 0, 4, 4, 0, 0, 1, 1, 2, 1, 2, 2, 1, 1}, []uint32{4, 8})
+	if n := testing.AllocsPerRun(100, func() { polygonFromXYEnds(g) }); n > 3 {
+		t.Errorf("decoding a polygon with two rings made %v allocations, want at most 3", n)
+	}
+	if n := testing.AllocsPerRun(100, func() { lineStringFromXY(g) }); n > 1 {
+		t.Errorf("decoding a line string made %v allocations, want at most 1", n)
+	}
+}
+
 func TestBoundToPolygon(t *testing.T) {
 	bound := orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{10, 10}}
 	poly := boundToPolygon(bound)
@@ -179,59 +288,119 @@ func TestBoundToPolygon(t *testing.T) {
 	}
 }
 
-func TestComputeBoundingBox(t *testing.T) {
+func TestEnvelope(t *testing.T) {
+	nan := math.NaN()
 	tests := []struct {
 		name     string
 		geom     orb.Geometry
-		expected [4]float64
+		expected orb.Bound
 	}{
 		{
 			"Point",
 			orb.Point{5, 10},
-			[4]float64{5, 10, 5, 10},
+			orb.Bound{Min: orb.Point{5, 10}, Max: orb.Point{5, 10}},
 		},
 		{
 			"LineString",
 			orb.LineString{{0, 0}, {10, 10}},
-			[4]float64{0, 0, 10, 10},
+			orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{10, 10}},
 		},
 		{
 			"Polygon",
 			orb.Polygon{{{0, 0}, {20, 0}, {20, 30}, {0, 30}, {0, 0}}},
-			[4]float64{0, 0, 20, 30},
+			orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{20, 30}},
+		},
+		{
+			"Nested collection",
+			orb.Collection{orb.Point{-5, 1}, orb.Collection{orb.MultiPolygon{{{{1, 2}, {3, 4}, {1, 2}}}}}},
+			orb.Bound{Min: orb.Point{-5, 1}, Max: orb.Point{3, 4}},
+		},
+		{
+			"NaN coordinates",
+			orb.LineString{{nan, 100}, {1, 2}, {3, nan}, {4, 5}},
+			orb.Bound{Min: orb.Point{1, 2}, Max: orb.Point{4, 5}},
+		},
+		{
+			"Empty in collection",
+			orb.Collection{orb.LineString{}, orb.Point{7, 8}, orb.Polygon{}},
+			orb.Bound{Min: orb.Point{7, 8}, Max: orb.Point{7, 8}},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			bbox := computeBoundingBox(tt.geom)
-			if bbox != tt.expected {
-				t.Errorf("expected %v, got %v", tt.expected, bbox)
+			if got := Envelope(tt.geom); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
 			}
 		})
 	}
 }
 
-func TestComputeCollectionBoundingBox(t *testing.T) {
+func TestEnvelope_Collection(t *testing.T) {
 	geometries := []orb.Geometry{
 		orb.Point{5, 5},
 		orb.Point{15, 20},
 		orb.LineString{{0, 0}, {10, 10}},
 	}
 
-	bbox := computeCollectionBoundingBox(geometries)
-	expected := [4]float64{0, 0, 15, 20}
-
-	if bbox != expected {
-		t.Errorf("expected %v, got %v", expected, bbox)
+	expected := orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{15, 20}}
+	if got := Envelope(geometries...); got != expected {
+		t.Errorf("expected %v, got %v", expected, got)
 	}
 }
 
-func TestComputeCollectionBoundingBox_Empty(t *testing.T) {
-	bbox := computeCollectionBoundingBox([]orb.Geometry{})
-	expected := [4]float64{0, 0, 0, 0}
+func TestEnvelope_Empty(t *testing.T) {
+	nan := math.NaN()
+	for _, geometries := range [][]orb.Geometry{
+		nil,
+		{nil},
+		{orb.MultiPoint{}, orb.Collection{}},
+		{orb.Point{nan, nan}},
+	} {
+		if got := Envelope(geometries...); !got.IsEmpty() {
+			t.Errorf("Envelope(%v): expected an empty bound, got %v", geometries, got)
+		}
+		if envelopeSlice(Envelope(geometries...)) != nil {
+			t.Errorf("Envelope(%v): expected no header envelope", geometries)
+		}
+	}
+}
 
-	if bbox != expected {
-		t.Errorf("expected %v, got %v", expected, bbox)
+func FuzzGeometryFromFGB(f *testing.F) {
+	add := func(g orb.Geometry) {
+		builder := flatbuffers.NewBuilder(256)
+		builder.Finish(geometryToFGB(g, builder, &coordBuffer{}).Build())
+		f.Add(builder.FinishedBytes(), uint8(orbToFGBGeometryType(g)))
 	}
+	for _, feature := range fixtureFeatures(f) {
+		var geom flattypes.Geometry
+		if g, err := geometryFromFGB(feature.Geometry(&geom)); err == nil && g != nil {
+			add(g)
+		}
+	}
+	add(orb.Point{1, 2})
+	add(orb.MultiLineString{{{0, 0}, {1, 1}}, {{2, 2}, {3, 3}, {4, 4}}})
+	add(orb.Polygon{{{0, 0}, {4, 0}, {4, 4}, {0, 0}}, {{1, 1}, {2, 1}, {2, 2}, {1, 1}}})
+	add(orb.MultiPolygon{{{{0, 0}, {1, 0}, {1, 1}, {0, 0}}}, {{{5, 5}, {6, 5}, {6, 6}, {5, 5}}}})
+	add(orb.Collection{orb.Point{1, 2}, orb.LineString{{0, 0}, {1, 1}}})
+
+	f.Fuzz(func(t *testing.T, data []byte, typ uint8) {
+		// Readers verify tables before decoding them
+		budget := tableBudget(data)
+		root, err := verifyRoot(data, &budget)
+		if err != nil || verifyGeometry(root) != nil {
+			return
+		}
+		g := flattypes.GetRootAsGeometry(data, 0)
+
+		_ = extendGeometryBound(emptyBound, g)
+		if _, err := geometryFromFGBType(g, flattypes.GeometryType(typ)); err != nil {
+			if !errors.Is(err, ErrInvalidData) {
+				t.Fatalf("error does not wrap ErrInvalidData: %v", err)
+			}
+			if checkGeometry(g, 0) == nil {
+				t.Fatalf("geometry passing checkGeometry failed to decode: %v", err)
+			}
+		}
+	})
 }
@@ -8,4 +8,8 @@ require (
 	github.com/paulmach/orb v0.12.0
 )
 
-require go.mongodb.org/mongo-driver v1.11.4 // indirect
+require (
+	github.com/gogo/protobuf v1.3.2 // indirect
+	github.com/paulmach/protoscan v0.2.1 // indirect
+	go.mongodb.org/mongo-driver v1.11.4 // indirect
+)
@@ -0,0 +1,23 @@
+//go:build !unix
+
+package flatgeobuf
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile reads the first size bytes of f. Platforms without mmap support
+// load the file into memory, so it is not held open after reading.
+func mapFile(f *os.File, size int) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(f, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// unmapFile releases data read by mapFile, which needs no cleanup.
+func unmapFile([]byte) error {
+	return nil
+}
@@ -0,0 +1,19 @@
+//go:build unix
+
+package flatgeobuf
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile memory-maps the first size bytes of f read-only. The mapping stays
+// valid after f is closed, until it is released with unmapFile.
+func mapFile(f *os.File, size int) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_PRIVATE)
+}
+
+// unmapFile releases a mapping made by mapFile.
+func unmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,266 @@
+package flatgeobuf
+
+import (
+	"math"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geo"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/planar"
+	"github.com/tingold/orb-flatgeobuf/packedrtree"
+)
+
+// DistanceMetric selects how distances are measured by nearest-neighbour queries.
+type DistanceMetric int
+
+const (
+	// Planar measures euclidean distance in the units of the coordinates.
+	Planar DistanceMetric = iota
+	// Haversine measures great-circle distance in meters, treating coordinates
+	// as WGS84 longitude/latitude.
+	Haversine
+)
+
+// Neighbor is a feature returned by a nearest-neighbour query.
+type Neighbor struct {
+	Feature  *geojson.Feature
+	Distance float64 // Distance from the query point to the feature's geometry
+}
+
+// Nearest returns up to k features nearest to pt using planar distance,
+// ordered by increasing distance. Features farther than maxDist are not
+// returned. A k of 0 or less returns every feature within maxDist, and a
+// maxDist of 0 or less means no distance limit.
+//
+// Distances are measured to the decoded geometry, so points inside a polygon
+// are at distance 0. Ties are ordered by their leaf position in the index,
+// which need not be their order in the file.
+func (r *Reader) Nearest(pt orb.Point, k int, maxDist float64) ([]Neighbor, error) {
+	return r.NearestWithMetric(pt, k, maxDist, Planar)
+}
+
+// NearestWithMetric is like Nearest but measures distances with the given
+// metric. With Haversine, maxDist and the returned distances are in meters,
+// and line and polygon edges are treated as great-circle arcs. Edges long
+// enough to bulge well beyond their bounding box may then be ranked slightly
+// out of order.
+func (r *Reader) NearestWithMetric(pt orb.Point, k int, maxDist float64, metric DistanceMetric) ([]Neighbor, error) {
+	if err := r.acquire(); err != nil {
+		return nil, err
+	}
+	defer r.release()
+
+	if r.index == nil {
+		return nil, ErrNoIndex
+	}
+	if maxDist <= 0 {
+		maxDist = math.Inf(1)
+	}
+
+	boundDistance := packedrtree.BoundDistance
+	geometryDistance := planarGeometryDistance
+	if metric == Haversine {
+		boundDistance = haversineBoundDistance
+		geometryDistance = haversineGeometryDistance
+	}
+
+	// Leaves are measured against their decoded geometry; keep the features
+	// so the results need not be decoded again.
+	decoded := make(map[int]*geojson.Feature)
+	leafDistance := func(hit packedrtree.Hit) (float64, error) {
+		feature, err := r.readFeature(hit.Offset)
+		if err != nil || feature == nil {
+			return math.Inf(1), err
+		}
+		decoded[hit.Index] = feature
+		return geometryDistance(feature.Geometry, pt), nil
+	}
+
+	hits, err := r.index.NearestFunc(k, maxDist,
+		func(b orb.Bound) float64 { return boundDistance(r.targetBound(b), pt) }, leafDistance)
+	if err != nil {
+		return nil, indexError(err)
+	}
+
+	neighbors := make([]Neighbor, len(hits))
+	for i, hit := range hits {
+		neighbors[i] = Neighbor{Feature: decoded[hit.Index], Distance: hit.Distance}
+	}
+	return neighbors, nil
+}
+
+// planarGeometryDistance returns the euclidean distance from pt to g, or 0 if
+// pt lies inside a polygon of g.
+func planarGeometryDistance(g orb.Geometry, pt orb.Point) float64 {
+	if geometryContains(g, pt) {
+		return 0
+	}
+	return planar.DistanceFrom(g, pt)
+}
+
+// haversineBoundDistance returns the great-circle distance in meters from pt
+// to the nearest point of the longitude/latitude box b.
+func haversineBoundDistance(b orb.Bound, pt orb.Point) float64 {
+	if b.Contains(pt) {
+		return 0
+	}
+
+	lat := math.Max(b.Min[1], math.Min(pt[1], b.Max[1]))
+	if pt[0] >= b.Min[0] && pt[0] <= b.Max[0] {
+		// The nearest point lies on the same meridian
+		return geo.DistanceHaversine(pt, orb.Point{pt[0], lat})
+	}
+
+	// At any latitude distance grows with the longitude difference, so the
+	// nearest point lies on the edge meridian closest in longitude.
+	edge := b.Min[0]
+	dLon := longitudeDelta(pt[0], b.Min[0])
+	if d := longitudeDelta(pt[0], b.Max[0]); d < dLon {
+		edge, dLon = b.Max[0], d
+	}
+
+	if dLon >= 90 {
+		// The nearest point of the meridian lies beyond a pole, so the
+		// nearest point of the edge is one of its ends.
+		return math.Min(
+			geo.DistanceHaversine(pt, orb.Point{edge, b.Min[1]}),
+			geo.DistanceHaversine(pt, orb.Point{edge, b.Max[1]}),
+		)
+	}
+
+	// Foot of the perpendicular from pt to the edge meridian
+	foot := math.Atan(math.Tan(pt[1]*math.Pi/180)/math.Cos(dLon*math.Pi/180)) * 180 / math.Pi
+	foot = math.Max(b.Min[1], math.Min(foot, b.Max[1]))
+	return geo.DistanceHaversine(pt, orb.Point{edge, foot})
+}
+
+// longitudeDelta returns the absolute difference between two longitudes in
+// degrees, in the range [0, 180].
+func longitudeDelta(a, b float64) float64 {
+	d := math.Mod(math.Abs(a-b), 360)
+	if d > 180 {
+		d = 360 - d
+	}
+	return d
+}
+
+// haversineGeometryDistance returns the great-circle distance in meters from
+// pt to g, or 0 if pt lies inside a polygon of g.
+func haversineGeometryDistance(g orb.Geometry, pt orb.Point) float64 {
+	if geometryContains(g, pt) {
+		return 0
+	}
+
+	switch g := g.(type) {
+	case orb.Point:
+		return geo.DistanceHaversine(pt, g)
+	case orb.MultiPoint:
+		d := math.Inf(1)
+		for _, p := range g {
+			d = math.Min(d, geo.DistanceHaversine(pt, p))
+		}
+		return d
+	case orb.LineString:
+		return haversinePathDistance(g, pt)
+	case orb.Ring:
+		return haversinePathDistance(g, pt)
+	case orb.MultiLineString:
+		d := math.Inf(1)
+		for _, ls := range g {
+			d = math.Min(d, haversinePathDistance(ls, pt))
+		}
+		return d
+	case orb.Polygon:
+		d := math.Inf(1)
+		for _, ring := range g {
+			d = math.Min(d, haversinePathDistance(ring, pt))
+		}
+		return d
+	case orb.MultiPolygon:
+		d := math.Inf(1)
+		for _, poly := range g {
+			d = math.Min(d, haversineGeometryDistance(poly, pt))
+		}
+		return d
+	case orb.Collection:
+		d := math.Inf(1)
+		for _, part := range g {
+			d = math.Min(d, haversineGeometryDistance(part, pt))
+		}
+		return d
+	case orb.Bound:
+		return haversineBoundDistance(g, pt)
+	}
+	return math.Inf(1)
+}
+
+// haversinePathDistance returns the great-circle distance in meters from pt
+// to the nearest point of the path through points.
+func haversinePathDistance(points []orb.Point, pt orb.Point) float64 {
+	switch len(points) {
+	case 0:
+		return math.Inf(1)
+	case 1:
+		return geo.DistanceHaversine(pt, points[0])
+	}
+
+	d := math.Inf(1)
+	for i := 1; i < len(points); i++ {
+		d = math.Min(d, haversineSegmentDistance(points[i-1], points[i], pt))
+	}
+	return d
+}
+
+// haversineSegmentDistance returns the great-circle distance in meters from
+// pt to the arc from a to b.
+func haversineSegmentDistance(a, b, pt orb.Point) float64 {
+	da := geo.DistanceHaversine(pt, a)
+	db := geo.DistanceHaversine(pt, b)
+	length := geo.DistanceHaversine(a, b)
+	if length == 0 {
+		return da
+	}
+
+	// Cross-track and along-track distances of pt relative to the great
+	// circle through a and b, as angles.
+	angA := da / orb.EarthRadius
+	bearingAB := geo.Bearing(a, b) * math.Pi / 180
+	bearingAP := geo.Bearing(a, pt) * math.Pi / 180
+	crossTrack := math.Asin(math.Sin(angA) * math.Sin(bearingAP-bearingAB))
+
+	cosAlong := math.Cos(angA) / math.Cos(crossTrack)
+	alongTrack := math.Acos(math.Max(-1, math.Min(1, cosAlong)))
+	if math.Cos(bearingAP-bearingAB) < 0 {
+		alongTrack = -alongTrack
+	}
+
+	// The foot of the perpendicular only counts if it falls on the arc
+	if alongTrack <= 0 || alongTrack*orb.EarthRadius >= length {
+		return math.Min(da, db)
+	}
+	return math.Abs(crossTrack) * orb.EarthRadius
+}
+
+// geometryContains reports whether pt lies inside a polygon of g, using
+// planar tests on the coordinates.
+func geometryContains(g orb.Geometry, pt orb.Point) bool {
+	switch g := g.(type) {
+	case orb.Polygon:
+		return pointInPolygon(g, pt)
+	case orb.MultiPolygon:
+		for _, poly := range g {
+			if pointInPolygon(poly, pt) {
+				return true
+			}
+		}
+	case orb.Bound:
+		return g.Contains(pt)
+	case orb.Collection:
+		for _, part := range g {
+			if geometryContains(part, pt) {
+				return true
+			}
+		}
+	}
+	return false
+}
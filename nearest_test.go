@@ -0,0 +1,240 @@
+package flatgeobuf
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geo"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/planar"
+)
+
+func newGridReader(t *testing.T, n int, includeIndex bool) *Reader {
+	t.Helper()
+
+	fc := geojson.NewFeatureCollection()
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			f := geojson.NewFeature(orb.Point{float64(i), float64(j)})
+			f.Properties = geojson.Properties{"id": i*n + j}
+			fc.Append(f)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteFeatures(&buf, fc, &Options{IncludeIndex: includeIndex}); err != nil {
+		t.Fatalf("WriteFeatures failed: %v", err)
+	}
+
+	reader, err := NewReaderFromData(buf.Bytes())
+	if err != nil {
+		t.Fatalf("NewReaderFromData failed: %v", err)
+	}
+	return reader
+}
+
+func TestNearest_Points(t *testing.T) {
+	reader := newGridReader(t, 20, true)
+	defer reader.Close()
+
+	pt := orb.Point{7.2, 3.3}
+	neighbors, err := reader.Nearest(pt, 5, 0)
+	if err != nil {
+		t.Fatalf("Nearest failed: %v", err)
+	}
+	if len(neighbors) != 5 {
+		t.Fatalf("expected 5 neighbors, got %d", len(neighbors))
+	}
+
+	expected := []orb.Point{{7, 3}, {7, 4}, {8, 3}, {8, 4}, {6, 3}}
+	for i, n := range neighbors {
+		got := n.Feature.Geometry.(orb.Point)
+		if got != expected[i] {
+			t.Errorf("neighbor %d: expected %v, got %v", i, expected[i], got)
+		}
+		if d := planar.Distance(pt, got); math.Abs(d-n.Distance) > 1e-12 {
+			t.Errorf("neighbor %d: expected distance %v, got %v", i, d, n.Distance)
+		}
+	}
+}
+
+func TestNearest_MaxDist(t *testing.T) {
+	reader := newGridReader(t, 20, true)
+	defer reader.Close()
+
+	// All points within 1.5 of a grid point: itself, 4 edge and 4 diagonal neighbours
+	neighbors, err := reader.Nearest(orb.Point{10, 10}, 0, 1.5)
+	if err != nil {
+		t.Fatalf("Nearest failed: %v", err)
+	}
+	if len(neighbors) != 9 {
+		t.Fatalf("expected 9 neighbors, got %d", len(neighbors))
+	}
+	for i := 1; i < len(neighbors); i++ {
+		if neighbors[i].Distance < neighbors[i-1].Distance {
+			t.Errorf("neighbors not ordered by distance: %v after %v",
+				neighbors[i].Distance, neighbors[i-1].Distance)
+		}
+	}
+
+	neighbors, err = reader.Nearest(orb.Point{-100, -100}, 3, 10)
+	if err != nil {
+		t.Fatalf("Nearest failed: %v", err)
+	}
+	if len(neighbors) != 0 {
+		t.Errorf("expected no neighbors beyond maxDist, got %d", len(neighbors))
+	}
+}
+
+func TestNearest_NoIndex(t *testing.T) {
+	reader := newGridReader(t, 3, false)
+	defer reader.Close()
+
+	if _, err := reader.Nearest(orb.Point{0, 0}, 1, 0); !errors.Is(err, ErrNoIndex) {
+		t.Errorf("expected ErrNoIndex, got %v", err)
+	}
+}
+
+func TestNearest_SingleFeature(t *testing.T) {
+	// The index of a single feature is a root node above one leaf
+	reader := newGridReader(t, 1, true)
+	defer reader.Close()
+
+	neighbors, err := reader.Nearest(orb.Point{3, 4}, 1, 0)
+	if err != nil {
+		t.Fatalf("Nearest failed: %v", err)
+	}
+	if len(neighbors) != 1 || neighbors[0].Feature.Geometry.(orb.Point) != (orb.Point{0, 0}) {
+		t.Fatalf("expected the only feature, got %v", neighbors)
+	}
+	if neighbors[0].Distance != 5 {
+		t.Errorf("expected distance 5, got %v", neighbors[0].Distance)
+	}
+}
+
+func TestNearest_Polygons(t *testing.T) {
+	reader, err := NewReader(filepath.Join("testdata", "poly_landmarks.fgb"))
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	all, err := reader.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+
+	for _, pt := range []orb.Point{{-73.975, 40.72}, {-74.2, 40.5}, {-73.95, 40.78}} {
+		// Brute-force distances to every feature
+		var want []float64
+		for _, f := range all.Features {
+			want = append(want, planarGeometryDistance(f.Geometry, pt))
+		}
+		sort.Float64s(want)
+
+		neighbors, err := reader.Nearest(pt, 10, 0)
+		if err != nil {
+			t.Fatalf("Nearest failed: %v", err)
+		}
+		if len(neighbors) != 10 {
+			t.Fatalf("expected 10 neighbors, got %d", len(neighbors))
+		}
+		for i, n := range neighbors {
+			if math.Abs(n.Distance-want[i]) > 1e-12 {
+				t.Errorf("%v neighbor %d: expected distance %v, got %v", pt, i, want[i], n.Distance)
+			}
+		}
+	}
+}
+
+func TestNearest_Haversine(t *testing.T) {
+	fc := geojson.NewFeatureCollection()
+	for _, p := range []orb.Point{{0, 60}, {0.01, 60}, {0.02, 60.01}, {1, 61}, {-179.99, 0}} {
+		fc.Append(geojson.NewFeature(p))
+	}
+	line := geojson.NewFeature(orb.LineString{{0, 59.99}, {0.03, 59.99}})
+	fc.Append(line)
+
+	var buf bytes.Buffer
+	if err := WriteFeatures(&buf, fc, &Options{IncludeIndex: true}); err != nil {
+		t.Fatalf("WriteFeatures failed: %v", err)
+	}
+	reader, err := NewReaderFromData(buf.Bytes())
+	if err != nil {
+		t.Fatalf("NewReaderFromData failed: %v", err)
+	}
+	defer reader.Close()
+
+	pt := orb.Point{0.015, 60}
+	neighbors, err := reader.NearestWithMetric(pt, 0, 2000, Haversine)
+	if err != nil {
+		t.Fatalf("NearestWithMetric failed: %v", err)
+	}
+
+	// The points on pt's parallel are ~280 m and ~830 m away, the line runs
+	// 0.01° of latitude (~1.1 km) south of pt and the third point is ~1.15 km
+	// away.
+	if len(neighbors) != 4 {
+		t.Fatalf("expected 4 neighbors within 2 km, got %d", len(neighbors))
+	}
+	if _, ok := neighbors[2].Feature.Geometry.(orb.LineString); !ok {
+		t.Errorf("expected the line third, got %v", neighbors[2].Feature.Geometry)
+	}
+	if d := geo.DistanceHaversine(pt, orb.Point{0.01, 60}); math.Abs(neighbors[0].Distance-d) > 1e-6 {
+		t.Errorf("expected distance %v, got %v", d, neighbors[0].Distance)
+	}
+	lineDist := geo.DistanceHaversine(pt, orb.Point{0.015, 59.99})
+	if math.Abs(neighbors[2].Distance-lineDist) > 1 {
+		t.Errorf("expected line distance near %v, got %v", lineDist, neighbors[2].Distance)
+	}
+
+	// Across the antimeridian
+	neighbors, err = reader.NearestWithMetric(orb.Point{179.99, 0}, 1, 0, Haversine)
+	if err != nil {
+		t.Fatalf("NearestWithMetric failed: %v", err)
+	}
+	if len(neighbors) != 1 || neighbors[0].Feature.Geometry != (orb.Point{-179.99, 0}) {
+		t.Errorf("expected the point across the antimeridian, got %+v", neighbors)
+	}
+}
+
+func TestHaversineBoundDistance(t *testing.T) {
+	b := orb.Bound{Min: orb.Point{10, 40}, Max: orb.Point{20, 50}}
+
+	tests := []struct {
+		name string
+		pt   orb.Point
+	}{
+		{"inside", orb.Point{15, 45}},
+		{"south", orb.Point{15, 30}},
+		{"west", orb.Point{0, 45}},
+		{"east high latitude", orb.Point{40, 70}},
+		{"far side", orb.Point{-150, 45}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := haversineBoundDistance(b, tt.pt)
+
+			// Sample the box densely; the bound must not exceed any sample
+			// and should be close to the smallest one.
+			min := math.Inf(1)
+			for x := 10.0; x <= 20; x += 0.05 {
+				for y := 40.0; y <= 50; y += 0.05 {
+					min = math.Min(min, geo.DistanceHaversine(tt.pt, orb.Point{x, y}))
+				}
+			}
+			if got > min+1e-6 {
+				t.Errorf("bound distance %v exceeds sampled minimum %v", got, min)
+			}
+			if min-got > 10000 {
+				t.Errorf("bound distance %v far below sampled minimum %v", got, min)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package packedrtree_test
+
+import (
+	"fmt"
+
+	"github.com/paulmach/orb"
+	"github.com/tingold/orb-flatgeobuf/packedrtree"
+)
+
+func ExampleFromBounds() {
+	geometries := []orb.Geometry{
+		orb.Point{1, 1},
+		orb.LineString{{2, 2}, {4, 3}},
+		orb.Point{10, 10},
+	}
+
+	bounds := make([]orb.Bound, len(geometries))
+	for i, g := range geometries {
+		bounds[i] = g.Bound()
+	}
+
+	tree, err := packedrtree.FromBounds(bounds, packedrtree.DefaultNodeSize)
+	if err != nil {
+		panic(err)
+	}
+
+	hits, err := tree.Search(orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{3, 3}})
+	if err != nil {
+		panic(err)
+	}
+	for _, hit := range hits {
+		fmt.Println(geometries[hit.Offset])
+	}
+	// Output:
+	// [1 1]
+	// [[2 2] [4 3]]
+}
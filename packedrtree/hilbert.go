@@ -0,0 +1,135 @@
+package packedrtree
+
+import (
+	"math"
+	"sort"
+
+	"github.com/paulmach/orb"
+)
+
+// HilbertMax is the largest coordinate on the Hilbert curve grid that item
+// centers are mapped to before sorting.
+const HilbertMax = (1 << 16) - 1
+
+// Hilbert returns the position of (x, y) along a Hilbert curve filling the
+// 2^16 x 2^16 grid. It is based on the public domain implementation at
+// https://github.com/rawrunprotected/hilbert_curves, as used by the reference
+// FlatGeobuf implementations.
+func Hilbert(x, y uint32) uint32 {
+	a := x ^ y
+	b := 0xFFFF ^ a
+	c := 0xFFFF ^ (x | y)
+	d := x & (y ^ 0xFFFF)
+
+	A := a | (b >> 1)
+	B := (a >> 1) ^ a
+	C := ((c >> 1) ^ (b & (d >> 1))) ^ c
+	D := ((a & (c >> 1)) ^ (d >> 1)) ^ d
+
+	a, b, c, d = A, B, C, D
+	A = (a & (a >> 2)) ^ (b & (b >> 2))
+	B = (a & (b >> 2)) ^ (b & ((a ^ b) >> 2))
+	C ^= (a & (c >> 2)) ^ (b & (d >> 2))
+	D ^= (b & (c >> 2)) ^ ((a ^ b) & (d >> 2))
+
+	a, b, c, d = A, B, C, D
+	A = (a & (a >> 4)) ^ (b & (b >> 4))
+	B = (a & (b >> 4)) ^ (b & ((a ^ b) >> 4))
+	C ^= (a & (c >> 4)) ^ (b & (d >> 4))
+	D ^= (b & (c >> 4)) ^ ((a ^ b) & (d >> 4))
+
+	a, b, c, d = A, B, C, D
+	C ^= (a & (c >> 8)) ^ (b & (d >> 8))
+	D ^= (b & (c >> 8)) ^ ((a ^ b) & (d >> 8))
+
+	a = C ^ (C >> 1)
+	b = D ^ (D >> 1)
+
+	i0 := x ^ y
+	i1 := b | (0xFFFF ^ (i0 | a))
+
+	i0 = (i0 | (i0 << 8)) & 0x00FF00FF
+	i0 = (i0 | (i0 << 4)) & 0x0F0F0F0F
+	i0 = (i0 | (i0 << 2)) & 0x33333333
+	i0 = (i0 | (i0 << 1)) & 0x55555555
+
+	i1 = (i1 | (i1 << 8)) & 0x00FF00FF
+	i1 = (i1 | (i1 << 4)) & 0x0F0F0F0F
+	i1 = (i1 | (i1 << 2)) & 0x33333333
+	i1 = (i1 | (i1 << 1)) & 0x55555555
+
+	return (i1 << 1) | i0
+}
+
+// HilbertValue returns the Hilbert curve position of the center of b, with
+// extent mapped onto the curve's grid.
+func HilbertValue(b, extent orb.Bound) uint32 {
+	var x, y uint32
+	if width := extent.Max[0] - extent.Min[0]; width != 0 {
+		x = uint32(math.Floor(HilbertMax * ((b.Min[0]+b.Max[0])/2 - extent.Min[0]) / width))
+	}
+	if height := extent.Max[1] - extent.Min[1]; height != 0 {
+		y = uint32(math.Floor(HilbertMax * ((b.Min[1]+b.Max[1])/2 - extent.Min[1]) / height))
+	}
+	return Hilbert(x, y)
+}
+
+// HilbertSort sorts items by the Hilbert curve position of their centers
+// within their combined extent, in the descending order the reference
+// FlatGeobuf implementations use. The sort is stable.
+func HilbertSort(items []Item) {
+	extent := Extent(items)
+	values := make([]uint32, len(items))
+	for i, item := range items {
+		values[i] = HilbertValue(item.Bound, extent)
+	}
+
+	sort.Stable(hilbertItems{items: items, values: values})
+}
+
+// hilbertItems sorts items together with their precomputed Hilbert values.
+type hilbertItems struct {
+	items  []Item
+	values []uint32
+}
+
+func (h hilbertItems) Len() int { return len(h.items) }
+
+func (h hilbertItems) Less(i, j int) bool { return h.values[i] > h.values[j] }
+
+func (h hilbertItems) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.values[i], h.values[j] = h.values[j], h.values[i]
+}
+
+// Extent returns the bound covering all items. Coordinates that are NaN are
+// ignored, and no items give an empty bound with infinite, inverted corners.
+func Extent(items []Item) orb.Bound {
+	extent := emptyBound()
+	for _, item := range items {
+		extent = expand(extent, item.Bound)
+	}
+	return extent
+}
+
+// emptyBound returns the identity for expand.
+func emptyBound() orb.Bound {
+	return orb.Bound{
+		Min: orb.Point{math.Inf(1), math.Inf(1)},
+		Max: orb.Point{math.Inf(-1), math.Inf(-1)},
+	}
+}
+
+// expand returns a grown to cover b. Comparisons with NaN are false, so NaN
+// coordinates leave a unchanged.
+func expand(a, b orb.Bound) orb.Bound {
+	for i := 0; i < 2; i++ {
+		if b.Min[i] < a.Min[i] {
+			a.Min[i] = b.Min[i]
+		}
+		if b.Max[i] > a.Max[i] {
+			a.Max[i] = b.Max[i]
+		}
+	}
+	return a
+}
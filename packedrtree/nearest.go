@@ -0,0 +1,131 @@
+package packedrtree
+
+import (
+	"container/heap"
+	"math"
+
+	"github.com/paulmach/orb"
+)
+
+// Neighbor is a leaf returned by a nearest-neighbour query.
+type Neighbor struct {
+	Hit
+	Distance float64
+}
+
+// Nearest returns up to k leaves nearest to pt by planar distance to their
+// bounds, ordered by increasing distance. Leaves farther than maxDist are not
+// returned. A k of 0 or less returns every leaf within maxDist, and a maxDist
+// of 0 or less means no distance limit.
+func (t *Tree) Nearest(pt orb.Point, k int, maxDist float64) ([]Neighbor, error) {
+	boundDistance := func(b orb.Bound) float64 { return BoundDistance(b, pt) }
+	leafDistance := func(hit Hit) (float64, error) { return BoundDistance(hit.Bound, pt), nil }
+	return t.NearestFunc(k, maxDist, boundDistance, leafDistance)
+}
+
+// NearestFunc is a best-first nearest-neighbour query with caller-defined
+// distances. boundDistance must never exceed the distance to anything inside
+// the bound; leafDistance gives the exact distance to a leaf's item, and may
+// return +Inf to exclude it. Leaves are only measured when they could still
+// be among the results, so leafDistance may be expensive. Results are ordered
+// by distance, ties by leaf position.
+func (t *Tree) NearestFunc(k int, maxDist float64, boundDistance func(orb.Bound) float64,
+	leafDistance func(Hit) (float64, error)) ([]Neighbor, error) {
+	if maxDist <= 0 {
+		maxDist = math.Inf(1)
+	}
+
+	// Nodes are queued by the distance to their bounds and measured leaves by
+	// their exact distance, so a measured leaf popped from the queue is no
+	// farther than everything not yet returned.
+	queue := &nearestQueue{}
+	root := t.Node(0)
+	heap.Push(queue, nearestItem{distance: boundDistance(root.Bound), pos: 0, level: len(t.levels) - 1})
+
+	leafStart := t.levels[0].Start
+	var neighbors []Neighbor
+	for queue.Len() > 0 && (k <= 0 || len(neighbors) < k) {
+		item := heap.Pop(queue).(nearestItem)
+		if item.distance > maxDist {
+			break
+		}
+
+		if item.measured {
+			node := t.Node(item.pos)
+			neighbors = append(neighbors, Neighbor{
+				Hit:      Hit{Bound: node.Bound, Offset: node.Offset, Index: item.pos - leafStart},
+				Distance: item.distance,
+			})
+			continue
+		}
+
+		if item.level == 0 {
+			node := t.Node(item.pos)
+			d, err := leafDistance(Hit{Bound: node.Bound, Offset: node.Offset, Index: item.pos - leafStart})
+			if err != nil {
+				return nil, err
+			}
+			if d <= maxDist && !math.IsInf(d, 1) {
+				heap.Push(queue, nearestItem{distance: d, pos: item.pos, measured: true})
+			}
+			continue
+		}
+
+		start, end, err := t.children(item.pos, item.level)
+		if err != nil {
+			return nil, err
+		}
+		for pos := start; pos < end; pos++ {
+			if d := boundDistance(t.Node(pos).Bound); d <= maxDist {
+				heap.Push(queue, nearestItem{distance: d, pos: pos, level: item.level - 1})
+			}
+		}
+	}
+
+	return neighbors, nil
+}
+
+// BoundDistance returns the planar distance from pt to the nearest point of
+// b, or 0 if b contains pt.
+func BoundDistance(b orb.Bound, pt orb.Point) float64 {
+	dx := math.Max(0, math.Max(b.Min[0]-pt[0], pt[0]-b.Max[0]))
+	dy := math.Max(0, math.Max(b.Min[1]-pt[1], pt[1]-b.Max[1]))
+	return math.Hypot(dx, dy)
+}
+
+// nearestItem is a queued node or measured leaf.
+type nearestItem struct {
+	distance float64
+	pos      int  // Node position in the tree
+	level    int  // Tree level of the node, 0 for leaves
+	measured bool // Leaf whose exact distance is known
+}
+
+// nearestQueue is a min-heap of nearestItems ordered by distance. At equal
+// distances nodes and unmeasured leaves come before measured leaves, so every
+// leaf that ties is measured before any is returned, then lower positions
+// come first.
+type nearestQueue []nearestItem
+
+func (q nearestQueue) Len() int { return len(q) }
+
+func (q nearestQueue) Less(i, j int) bool {
+	if q[i].distance != q[j].distance {
+		return q[i].distance < q[j].distance
+	}
+	if q[i].measured != q[j].measured {
+		return !q[i].measured
+	}
+	return q[i].pos < q[j].pos
+}
+
+func (q nearestQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *nearestQueue) Push(x interface{}) { *q = append(*q, x.(nearestItem)) }
+
+func (q *nearestQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,397 @@
+// Package packedrtree implements a packed Hilbert R-tree, the static spatial
+// index stored in FlatGeobuf files.
+//
+// A tree is built once from a list of bounding boxes, which are normally
+// sorted along a Hilbert curve first so that nearby items share nodes. Nodes
+// are packed into levels of up to nodeSize children and serialized root first
+// as 40-byte records (minX, minY, maxX, maxY as float64 and a uint64 offset,
+// little-endian), the layout FlatGeobuf uses. A serialized tree can be read
+// back without copying, for example from a memory-mapped file.
+//
+// The package does not depend on the FlatGeobuf format and can be used to
+// index orb geometries in memory:
+//
+//	tree, err := packedrtree.FromBounds(bounds, packedrtree.DefaultNodeSize)
+//	hits, err := tree.Search(query)
+//	for _, hit := range hits {
+//		g := geometries[hit.Offset]
+//	}
+package packedrtree
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/paulmach/orb"
+)
+
+// ErrInvalidTree is returned for trees that cannot be built or whose
+// serialized form is inconsistent.
+var ErrInvalidTree = errors.New("packedrtree: invalid tree")
+
+const (
+	// NodeItemSize is the size in bytes of a serialized node.
+	NodeItemSize = 40
+	// DefaultNodeSize is the number of children per node used by FlatGeobuf
+	// writers.
+	DefaultNodeSize = 16
+)
+
+// Item is an entry of the tree. For leaves Offset is a caller-defined
+// reference, such as the byte offset of a feature in a FlatGeobuf file; for
+// other nodes it is the position of the node's first child.
+type Item struct {
+	Bound  orb.Bound
+	Offset uint64
+}
+
+// Hit is a leaf returned by a query.
+type Hit struct {
+	Bound  orb.Bound
+	Offset uint64 // The leaf item's offset
+	Index  int    // Position of the leaf among all leaves
+}
+
+// Tree is a packed Hilbert R-tree. It is immutable and safe for concurrent use.
+type Tree struct {
+	data     []byte  // Serialized nodes, root first
+	numItems int     // Number of leaves
+	nodeSize int     // Maximum children per node
+	levels   []Level // Levels from the leaves (0) up to the root
+}
+
+// Level is the half-open range of node positions making up one tree level.
+type Level struct {
+	Start, End int
+}
+
+// levelBounds computes the node ranges of each level of a tree, leaves first.
+// Nodes are stored root first, so the leaves occupy the end of the node array.
+func levelBounds(numItems, nodeSize int) []Level {
+	// There is always at least one level above the leaves, so a single item
+	// still gets a root node.
+	levelNumNodes := []int{numItems}
+	numNodes := numItems
+	for n := numItems; ; {
+		n = (n + nodeSize - 1) / nodeSize
+		numNodes += n
+		levelNumNodes = append(levelNumNodes, n)
+		if n == 1 {
+			break
+		}
+	}
+
+	levels := make([]Level, len(levelNumNodes))
+	end := numNodes
+	for i, n := range levelNumNodes {
+		levels[i] = Level{Start: end - n, End: end}
+		end -= n
+	}
+	return levels
+}
+
+// Levels returns the node ranges of each level of a tree over numItems items,
+// from the leaves (index 0) up to the root. Node positions count from the
+// root, so it can be used to lay out a tree without building it in memory.
+func Levels(numItems int, nodeSize uint16) ([]Level, error) {
+	if err := checkShape(numItems, nodeSize); err != nil {
+		return nil, err
+	}
+	return levelBounds(numItems, int(nodeSize)), nil
+}
+
+// checkShape validates the tree parameters shared by Build and Read.
+func checkShape(numItems int, nodeSize uint16) error {
+	if nodeSize < 2 {
+		return fmt.Errorf("%w: node size %d", ErrInvalidTree, nodeSize)
+	}
+	if numItems <= 0 {
+		return fmt.Errorf("%w: %d items", ErrInvalidTree, numItems)
+	}
+	return nil
+}
+
+// Size returns the size in bytes of a serialized tree over numItems items.
+func Size(numItems int, nodeSize uint16) (int, error) {
+	if err := checkShape(numItems, nodeSize); err != nil {
+		return 0, err
+	}
+
+	numNodes := levelBounds(numItems, int(nodeSize))[0].End
+	if numNodes > math.MaxInt/NodeItemSize {
+		return 0, fmt.Errorf("%w: %d items overflow the tree size", ErrInvalidTree, numItems)
+	}
+	return numNodes * NodeItemSize, nil
+}
+
+// Build packs items, in the order given, into a tree. Items are normally
+// sorted with HilbertSort first; their offsets are stored unchanged in the
+// leaves.
+func Build(items []Item, nodeSize uint16) (*Tree, error) {
+	size, err := Size(len(items), nodeSize)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Tree{
+		data:     make([]byte, size),
+		numItems: len(items),
+		nodeSize: int(nodeSize),
+		levels:   levelBounds(len(items), int(nodeSize)),
+	}
+
+	leaves := t.levels[0]
+	for i, item := range items {
+		t.setNode(leaves.Start+i, item)
+	}
+
+	// Each parent covers up to nodeSize consecutive nodes of the level below
+	for i := 0; i < len(t.levels)-1; i++ {
+		below, parent := t.levels[i], t.levels[i+1].Start
+		for pos := below.Start; pos < below.End; pos += t.nodeSize {
+			bound := emptyBound()
+			end := pos + t.nodeSize
+			if end > below.End {
+				end = below.End
+			}
+			for child := pos; child < end; child++ {
+				bound = expand(bound, t.Node(child).Bound)
+			}
+			t.setNode(parent, Item{Bound: bound, Offset: uint64(pos)})
+			parent++
+		}
+	}
+
+	return t, nil
+}
+
+// FromBounds builds a tree over bounds, sorted along a Hilbert curve. The
+// offset of each leaf is the index of its bound in bounds.
+func FromBounds(bounds []orb.Bound, nodeSize uint16) (*Tree, error) {
+	items := make([]Item, len(bounds))
+	for i, b := range bounds {
+		items[i] = Item{Bound: b, Offset: uint64(i)}
+	}
+	HilbertSort(items)
+	return Build(items, nodeSize)
+}
+
+// Read returns the tree over numItems items serialized at the start of data.
+// The tree refers to data rather than copying it, so data must not be
+// modified while the tree is in use.
+func Read(data []byte, numItems int, nodeSize uint16) (*Tree, error) {
+	size, err := Size(numItems, nodeSize)
+	if err != nil {
+		return nil, err
+	}
+	if size > len(data) {
+		return nil, fmt.Errorf("%w: tree of %d items needs %d bytes, have %d",
+			ErrInvalidTree, numItems, size, len(data))
+	}
+
+	return &Tree{
+		data:     data[:size:size],
+		numItems: numItems,
+		nodeSize: int(nodeSize),
+		levels:   levelBounds(numItems, int(nodeSize)),
+	}, nil
+}
+
+// Bytes returns the serialized tree. The slice must not be modified.
+func (t *Tree) Bytes() []byte {
+	return t.data
+}
+
+// WriteTo writes the serialized tree to w.
+func (t *Tree) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(t.data)
+	return int64(n), err
+}
+
+// NumItems returns the number of leaves.
+func (t *Tree) NumItems() int {
+	return t.numItems
+}
+
+// NumNodes returns the total number of nodes, leaves included.
+func (t *Tree) NumNodes() int {
+	return t.levels[0].End
+}
+
+// NodeSize returns the maximum number of children per node.
+func (t *Tree) NodeSize() uint16 {
+	return uint16(t.nodeSize)
+}
+
+// Extent returns the bound of the root node, covering every item.
+func (t *Tree) Extent() orb.Bound {
+	return t.Node(0).Bound
+}
+
+// Node returns the node at position pos, counting from the root.
+func (t *Tree) Node(pos int) Item {
+	return DecodeItem(t.data[pos*NodeItemSize : (pos+1)*NodeItemSize])
+}
+
+// Leaf returns the i-th leaf, in stored order.
+func (t *Tree) Leaf(i int) Hit {
+	item := t.Node(t.levels[0].Start + i)
+	return Hit{Bound: item.Bound, Offset: item.Offset, Index: i}
+}
+
+func (t *Tree) setNode(pos int, item Item) {
+	EncodeItem(t.data[pos*NodeItemSize:(pos+1)*NodeItemSize], item)
+}
+
+// EncodeItem writes item to the first NodeItemSize bytes of b in the
+// serialized node layout.
+func EncodeItem(b []byte, item Item) {
+	_ = b[NodeItemSize-1]
+	binary.LittleEndian.PutUint64(b[0:], math.Float64bits(item.Bound.Min[0]))
+	binary.LittleEndian.PutUint64(b[8:], math.Float64bits(item.Bound.Min[1]))
+	binary.LittleEndian.PutUint64(b[16:], math.Float64bits(item.Bound.Max[0]))
+	binary.LittleEndian.PutUint64(b[24:], math.Float64bits(item.Bound.Max[1]))
+	binary.LittleEndian.PutUint64(b[32:], item.Offset)
+}
+
+// DecodeItem reads a serialized node from the first NodeItemSize bytes of b.
+func DecodeItem(b []byte) Item {
+	_ = b[NodeItemSize-1]
+	return Item{
+		Bound: orb.Bound{
+			Min: orb.Point{
+				math.Float64frombits(binary.LittleEndian.Uint64(b[0:])),
+				math.Float64frombits(binary.LittleEndian.Uint64(b[8:])),
+			},
+			Max: orb.Point{
+				math.Float64frombits(binary.LittleEndian.Uint64(b[16:])),
+				math.Float64frombits(binary.LittleEndian.Uint64(b[24:])),
+			},
+		},
+		Offset: binary.LittleEndian.Uint64(b[32:]),
+	}
+}
+
+// offset returns the offset stored in the node at pos.
+func (t *Tree) offset(pos int) uint64 {
+	return binary.LittleEndian.Uint64(t.data[pos*NodeItemSize+32:])
+}
+
+// children returns the half-open range of child positions of the node at pos
+// on level lvl. It fails with ErrInvalidTree if the stored child offset does
+// not point into the level below.
+func (t *Tree) children(pos, lvl int) (int, int, error) {
+	offset := t.offset(pos)
+	below := t.levels[lvl-1]
+	if offset < uint64(below.Start) || offset >= uint64(below.End) {
+		return 0, 0, fmt.Errorf("%w: node %d points to %d outside level %d",
+			ErrInvalidTree, pos, offset, lvl-1)
+	}
+
+	start := int(offset)
+	end := start + t.nodeSize
+	if end > below.End {
+		end = below.End
+	}
+	return start, end, nil
+}
+
+// Search returns the leaves whose bounds intersect b, ordered by offset.
+func (t *Tree) Search(b orb.Bound) ([]Hit, error) {
+	hits, err := t.SearchMany([]orb.Bound{b})
+	if err != nil {
+		return nil, err
+	}
+	return hits[0], nil
+}
+
+// SearchMany returns, for each query, the leaves whose bounds intersect it,
+// ordered by offset. The tree is walked once for all queries.
+func (t *Tree) SearchMany(queries []orb.Bound) ([][]Hit, error) {
+	hits := make([][]Hit, len(queries))
+	err := t.Visit(queries, func(q int, hit Hit) {
+		hits[q] = append(hits[q], hit)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, h := range hits {
+		sort.Slice(h, func(i, j int) bool { return h[i].Offset < h[j].Offset })
+	}
+	return hits, nil
+}
+
+// Visit calls fn for every query and leaf whose bounds intersect, in tree
+// order. Each node carries the queries that intersect it, so a subtree is
+// only visited for the queries that can match within it.
+func (t *Tree) Visit(queries []orb.Bound, fn func(query int, hit Hit)) error {
+	if len(queries) == 0 {
+		return nil
+	}
+
+	all := make([]int, len(queries))
+	for i := range all {
+		all[i] = i
+	}
+
+	type visitItem struct {
+		pos, level int
+		active     []int // Queries intersecting the parent node
+	}
+
+	leafStart := t.levels[0].Start
+	stack := []visitItem{{pos: 0, level: len(t.levels) - 1, active: all}}
+	for len(stack) > 0 {
+		item := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		node := t.Node(item.pos)
+		active := filterQueries(item.active, queries, node.Bound)
+		if len(active) == 0 {
+			continue
+		}
+
+		if item.level == 0 {
+			hit := Hit{Bound: node.Bound, Offset: node.Offset, Index: item.pos - leafStart}
+			for _, q := range active {
+				fn(q, hit)
+			}
+			continue
+		}
+
+		start, end, err := t.children(item.pos, item.level)
+		if err != nil {
+			return err
+		}
+		for pos := end - 1; pos >= start; pos-- {
+			stack = append(stack, visitItem{pos: pos, level: item.level - 1, active: active})
+		}
+	}
+	return nil
+}
+
+// filterQueries returns the queries in active that intersect b. It returns
+// active itself when every query does, avoiding an allocation per node.
+func filterQueries(active []int, queries []orb.Bound, b orb.Bound) []int {
+	for i, q := range active {
+		if b.Intersects(queries[q]) {
+			continue
+		}
+
+		// First miss: copy the hits so far and filter the rest
+		filtered := make([]int, i, len(active)-1)
+		copy(filtered, active[:i])
+		for _, q := range active[i+1:] {
+			if b.Intersects(queries[q]) {
+				filtered = append(filtered, q)
+			}
+		}
+		return filtered
+	}
+	return active
+}
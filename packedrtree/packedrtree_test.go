@@ -0,0 +1,352 @@
+package packedrtree
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/flatgeobuf/flatgeobuf/src/go/index"
+	"github.com/paulmach/orb"
+)
+
+func randomBounds(n int, seed int64) []orb.Bound {
+	rng := rand.New(rand.NewSource(seed))
+	bounds := make([]orb.Bound, n)
+	for i := range bounds {
+		x, y := rng.Float64()*1000, rng.Float64()*1000
+		bounds[i] = orb.Bound{
+			Min: orb.Point{x, y},
+			Max: orb.Point{x + rng.Float64()*10, y + rng.Float64()*10},
+		}
+	}
+	return bounds
+}
+
+func TestLevelBounds(t *testing.T) {
+	tests := []struct {
+		numItems, nodeSize int
+		expected           []Level
+	}{
+		{1, 16, []Level{{1, 2}, {0, 1}}},
+		{2, 16, []Level{{1, 3}, {0, 1}}},
+		{16, 16, []Level{{1, 17}, {0, 1}}},
+		{17, 16, []Level{{3, 20}, {1, 3}, {0, 1}}},
+		{256, 16, []Level{{17, 273}, {1, 17}, {0, 1}}},
+		{5, 2, []Level{{6, 11}, {3, 6}, {1, 3}, {0, 1}}},
+	}
+
+	for _, tt := range tests {
+		got := levelBounds(tt.numItems, tt.nodeSize)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("levelBounds(%d, %d) = %v, want %v", tt.numItems, tt.nodeSize, got, tt.expected)
+		}
+	}
+}
+
+func TestRead_Invalid(t *testing.T) {
+	tree, err := FromBounds(randomBounds(100, 1), DefaultNodeSize)
+	if err != nil {
+		t.Fatalf("FromBounds failed: %v", err)
+	}
+	data := tree.Bytes()
+
+	tests := []struct {
+		name     string
+		data     []byte
+		numItems int
+		nodeSize uint16
+	}{
+		{"truncated", data[:len(data)-1], 100, DefaultNodeSize},
+		{"node size 1", data, 100, 1},
+		{"no items", data, 0, DefaultNodeSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Read(tt.data, tt.numItems, tt.nodeSize); !errors.Is(err, ErrInvalidTree) {
+				t.Errorf("expected ErrInvalidTree, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRead_CorruptChildOffset(t *testing.T) {
+	tree, err := FromBounds(randomBounds(100, 1), DefaultNodeSize)
+	if err != nil {
+		t.Fatalf("FromBounds failed: %v", err)
+	}
+
+	data := bytes.Clone(tree.Bytes())
+	corrupt, err := Read(data, tree.NumItems(), tree.NodeSize())
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	corrupt.setNode(0, Item{Bound: tree.Extent(), Offset: math.MaxUint64})
+
+	if _, err := corrupt.Search(tree.Extent()); !errors.Is(err, ErrInvalidTree) {
+		t.Errorf("Search: expected ErrInvalidTree, got %v", err)
+	}
+	if _, err := corrupt.Nearest(orb.Point{0, 0}, 1, 0); !errors.Is(err, ErrInvalidTree) {
+		t.Errorf("Nearest: expected ErrInvalidTree, got %v", err)
+	}
+}
+
+func TestBuild_RoundTrip(t *testing.T) {
+	bounds := randomBounds(1000, 2)
+	tree, err := FromBounds(bounds, DefaultNodeSize)
+	if err != nil {
+		t.Fatalf("FromBounds failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := tree.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	size, _ := Size(len(bounds), DefaultNodeSize)
+	if buf.Len() != size || tree.NumNodes()*NodeItemSize != size {
+		t.Fatalf("expected %d bytes, wrote %d", size, buf.Len())
+	}
+
+	read, err := Read(buf.Bytes(), len(bounds), DefaultNodeSize)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if read.Extent() != tree.Extent() {
+		t.Errorf("extent mismatch: %v vs %v", read.Extent(), tree.Extent())
+	}
+
+	seen := make(map[uint64]bool)
+	for i := 0; i < read.NumItems(); i++ {
+		leaf := read.Leaf(i)
+		if leaf.Bound != bounds[leaf.Offset] {
+			t.Fatalf("leaf %d: bound %v does not match item %d", i, leaf.Bound, leaf.Offset)
+		}
+		seen[leaf.Offset] = true
+	}
+	if len(seen) != len(bounds) {
+		t.Errorf("expected %d distinct leaves, got %d", len(bounds), len(seen))
+	}
+}
+
+// TestBuild_ReferenceLayout checks that trees serialize byte for byte like
+// the reference implementation.
+func TestBuild_ReferenceLayout(t *testing.T) {
+	for _, n := range []int{1, 2, 16, 17, 1000} {
+		bounds := randomBounds(n, int64(n))
+		tree, err := FromBounds(bounds, DefaultNodeSize)
+		if err != nil {
+			t.Fatalf("FromBounds failed: %v", err)
+		}
+
+		nodeItems := make([]index.NodeItem, n)
+		for i := range nodeItems {
+			leaf := tree.Leaf(i)
+			nodeItems[i] = index.NewNodeItemWithCoordinates(leaf.Offset,
+				leaf.Bound.Min[0], leaf.Bound.Min[1], leaf.Bound.Max[0], leaf.Bound.Max[1])
+		}
+		extent := index.CalcExtentForNodeItems(nodeItems)
+		ref := index.NewPackedRTreeWithNodeItems(nodeItems, extent, DefaultNodeSize)
+
+		var buf bytes.Buffer
+		if _, err := ref.Write(&buf); err != nil {
+			t.Fatalf("reference Write failed: %v", err)
+		}
+		if !bytes.Equal(buf.Bytes(), tree.Bytes()) {
+			t.Errorf("%d items: serialized tree differs from the reference", n)
+		}
+	}
+}
+
+func TestHilbertSort(t *testing.T) {
+	bounds := randomBounds(500, 3)
+	items := make([]Item, len(bounds))
+	for i, b := range bounds {
+		items[i] = Item{Bound: b, Offset: uint64(i)}
+	}
+	extent := Extent(items)
+	HilbertSort(items)
+
+	for i := 1; i < len(items); i++ {
+		prev := HilbertValue(items[i-1].Bound, extent)
+		cur := HilbertValue(items[i].Bound, extent)
+		if prev < cur {
+			t.Fatalf("items %d and %d out of order: %d < %d", i-1, i, prev, cur)
+		}
+		if prev == cur && items[i-1].Offset > items[i].Offset {
+			t.Fatalf("equal items %d and %d not in input order", i-1, i)
+		}
+	}
+
+	for _, p := range [][2]uint32{{0, 0}, {1, 0}, {HilbertMax, HilbertMax}, {12345, 54321}} {
+		if got, want := Hilbert(p[0], p[1]), index.Hilbert(p[0], p[1]); got != want {
+			t.Errorf("Hilbert(%d, %d) = %d, want %d", p[0], p[1], got, want)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	bounds := randomBounds(2000, 4)
+	tree, err := FromBounds(bounds, 8)
+	if err != nil {
+		t.Fatalf("FromBounds failed: %v", err)
+	}
+
+	queries := []orb.Bound{
+		{Min: orb.Point{100, 100}, Max: orb.Point{200, 150}},
+		{Min: orb.Point{500, 500}, Max: orb.Point{500, 500}},
+		{Min: orb.Point{-10, -10}, Max: orb.Point{-5, -5}},
+		{Min: orb.Point{0, 0}, Max: orb.Point{1000, 1000}},
+	}
+
+	many, err := tree.SearchMany(queries)
+	if err != nil {
+		t.Fatalf("SearchMany failed: %v", err)
+	}
+
+	for i, q := range queries {
+		var expected []uint64
+		for j, b := range bounds {
+			if b.Intersects(q) {
+				expected = append(expected, uint64(j))
+			}
+		}
+
+		hits, err := tree.Search(q)
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		var got []uint64
+		for _, hit := range hits {
+			got = append(got, hit.Offset)
+			if tree.Leaf(hit.Index) != hit {
+				t.Errorf("hit %v does not match leaf %d", hit, hit.Index)
+			}
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("query %d: expected %d hits, got %d", i, len(expected), len(got))
+		}
+		if !reflect.DeepEqual(many[i], hits) {
+			t.Errorf("query %d: SearchMany differs from Search", i)
+		}
+	}
+}
+
+func TestNearest(t *testing.T) {
+	bounds := randomBounds(2000, 5)
+	tree, err := FromBounds(bounds, DefaultNodeSize)
+	if err != nil {
+		t.Fatalf("FromBounds failed: %v", err)
+	}
+
+	pt := orb.Point{412.5, 77.25}
+	distances := make([]float64, len(bounds))
+	for i, b := range bounds {
+		distances[i] = BoundDistance(b, pt)
+	}
+	sort.Float64s(distances)
+
+	neighbors, err := tree.Nearest(pt, 10, 0)
+	if err != nil {
+		t.Fatalf("Nearest failed: %v", err)
+	}
+	if len(neighbors) != 10 {
+		t.Fatalf("expected 10 neighbors, got %d", len(neighbors))
+	}
+	for i, n := range neighbors {
+		if n.Distance != distances[i] {
+			t.Errorf("neighbor %d: expected distance %v, got %v", i, distances[i], n.Distance)
+		}
+		if d := BoundDistance(bounds[n.Offset], pt); d != n.Distance {
+			t.Errorf("neighbor %d: distance %v does not match its bound (%v)", i, n.Distance, d)
+		}
+	}
+
+	maxDist := distances[25]
+	within, err := tree.Nearest(pt, 0, maxDist)
+	if err != nil {
+		t.Fatalf("Nearest failed: %v", err)
+	}
+	count := sort.Search(len(distances), func(i int) bool { return distances[i] > maxDist })
+	if len(within) != count {
+		t.Errorf("expected %d neighbors within %v, got %d", count, maxDist, len(within))
+	}
+}
+
+func TestNearestFunc_Ties(t *testing.T) {
+	// Leaf distances are rounded up, as for a geometry lying farther than its
+	// bound, so many leaves tie and a node can be as near as a measured leaf
+	rng := rand.New(rand.NewSource(8))
+	for run := 0; run < 50; run++ {
+		bounds := make([]orb.Bound, 10+rng.Intn(200))
+		for i := range bounds {
+			x, y := float64(rng.Intn(12)), float64(rng.Intn(12))
+			bounds[i] = orb.Bound{Min: orb.Point{x, y}, Max: orb.Point{x + float64(rng.Intn(3)), y + float64(rng.Intn(3))}}
+		}
+		tree, err := FromBounds(bounds, uint16(2+rng.Intn(4)))
+		if err != nil {
+			t.Fatalf("FromBounds failed: %v", err)
+		}
+		pt := orb.Point{float64(rng.Intn(14) - 1), float64(rng.Intn(14) - 1)}
+		leafDistance := func(hit Hit) (float64, error) { return math.Ceil(BoundDistance(hit.Bound, pt)), nil }
+
+		// Every leaf ordered by distance, then by position
+		want := make([]Neighbor, len(bounds))
+		for i := range want {
+			node := tree.Node(tree.levels[0].Start + i)
+			want[i].Hit = Hit{Bound: node.Bound, Offset: node.Offset, Index: i}
+			want[i].Distance, _ = leafDistance(want[i].Hit)
+		}
+		sort.SliceStable(want, func(i, j int) bool { return want[i].Distance < want[j].Distance })
+
+		got, err := tree.NearestFunc(0, 0, func(b orb.Bound) float64 { return BoundDistance(b, pt) }, leafDistance)
+		if err != nil {
+			t.Fatalf("NearestFunc failed: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("run %d: neighbors not ordered by distance, then position", run)
+		}
+	}
+}
+
+func TestNearestFunc_Exclude(t *testing.T) {
+	bounds := randomBounds(200, 6)
+	tree, err := FromBounds(bounds, DefaultNodeSize)
+	if err != nil {
+		t.Fatalf("FromBounds failed: %v", err)
+	}
+
+	pt := orb.Point{500, 500}
+	boundDistance := func(b orb.Bound) float64 { return BoundDistance(b, pt) }
+	evenOnly := func(hit Hit) (float64, error) {
+		if hit.Offset%2 == 1 {
+			return math.Inf(1), nil
+		}
+		return BoundDistance(hit.Bound, pt), nil
+	}
+
+	neighbors, err := tree.NearestFunc(0, 0, boundDistance, evenOnly)
+	if err != nil {
+		t.Fatalf("NearestFunc failed: %v", err)
+	}
+	if len(neighbors) != 100 {
+		t.Fatalf("expected 100 neighbors, got %d", len(neighbors))
+	}
+	for i, n := range neighbors {
+		if n.Offset%2 == 1 {
+			t.Errorf("excluded leaf %d returned", n.Offset)
+		}
+		if i > 0 && n.Distance < neighbors[i-1].Distance {
+			t.Errorf("neighbors %d and %d out of order", i-1, i)
+		}
+	}
+
+	failure := errors.New("failure")
+	_, err = tree.NearestFunc(1, 0, boundDistance, func(Hit) (float64, error) { return 0, failure })
+	if !errors.Is(err, failure) {
+		t.Errorf("expected leaf distance error, got %v", err)
+	}
+}
@@ -0,0 +1,484 @@
+package flatgeobuf
+
+import (
+	"math"
+	"sort"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/planar"
+)
+
+// Predicate selects the spatial relationship tested by SearchGeometry.
+// Points on a boundary count as inside, so a polygon contains its own edges.
+type Predicate int
+
+const (
+	// Intersects matches features sharing at least one point with the query.
+	Intersects Predicate = iota
+	// Contains matches features that contain the whole query geometry.
+	Contains
+	// Within matches features lying entirely within the query geometry.
+	Within
+)
+
+// String returns the name of the predicate.
+func (p Predicate) String() string {
+	switch p {
+	case Intersects:
+		return "Intersects"
+	case Contains:
+		return "Contains"
+	case Within:
+		return "Within"
+	default:
+		return "Unknown"
+	}
+}
+
+// withinSamples is the number of points per distance tested along feature
+// edges by buffered Within searches.
+const withinSamples = 16
+
+// SearchGeometry returns the features related to g by predicate. The spatial
+// index selects candidates by bounding box, which are then tested exactly
+// against their decoded geometry using planar coordinates.
+func (r *Reader) SearchGeometry(g orb.Geometry, predicate Predicate) (*geojson.FeatureCollection, error) {
+	return r.SearchGeometryBuffered(g, predicate, 0)
+}
+
+// SearchGeometryBuffered is like SearchGeometry but tests against g buffered
+// by distance, in the units of the coordinates:
+//   - Intersects matches features within distance of g.
+//   - Contains matches features containing g whose boundary is at least
+//     distance away from g.
+//   - Within matches features whose vertices, and points sampled along their
+//     edges at intervals of distance/16, all lie within distance of g.
+func (r *Reader) SearchGeometryBuffered(g orb.Geometry, predicate Predicate, distance float64) (*geojson.FeatureCollection, error) {
+	if g == nil {
+		return nil, ErrNilGeometry
+	}
+
+	query := newShapeParts(g)
+	fc := geojson.NewFeatureCollection()
+	if query.isEmpty() {
+		return fc, nil
+	}
+
+	bound := g.Bound()
+	if distance > 0 {
+		bound = bound.Pad(distance)
+	}
+
+	candidates, err := r.Search(bound)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range candidates.Features {
+		if matchesPredicate(newShapeParts(f.Geometry), query, predicate, distance) {
+			fc.Append(f)
+		}
+	}
+
+	return fc, nil
+}
+
+// matchesPredicate reports whether feature is related to query by predicate,
+// with query buffered by distance.
+func matchesPredicate(feature, query *shapeParts, predicate Predicate, distance float64) bool {
+	if feature.isEmpty() {
+		return false
+	}
+
+	if distance <= 0 {
+		switch predicate {
+		case Intersects:
+			return partsIntersect(feature, query)
+		case Contains:
+			return partsCover(feature, query)
+		case Within:
+			return partsCover(query, feature)
+		}
+		return false
+	}
+
+	switch predicate {
+	case Intersects:
+		return partsDistance(feature, query) <= distance
+	case Contains:
+		if !partsCover(feature, query) {
+			return false
+		}
+		boundary := &shapeParts{points: feature.points, segments: feature.segments}
+		return partsDistance(boundary, query) >= distance
+	case Within:
+		for _, pt := range feature.points {
+			if pointPartsDistance(pt, query) > distance {
+				return false
+			}
+		}
+		step := distance / withinSamples
+		for _, s := range feature.segments {
+			length := planar.Distance(s[0], s[1])
+			n := int(math.Ceil(length / step))
+			for i := 0; i <= n; i++ {
+				t := 1.0
+				if n > 0 {
+					t = float64(i) / float64(n)
+				}
+				if pointPartsDistance(interpolate(s[0], s[1], t), query) > distance {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// shapeParts breaks a geometry into isolated points, line segments (including
+// polygon edges) and polygons, the primitives the exact predicates work on.
+type shapeParts struct {
+	points   []orb.Point    // Isolated points
+	segments [][2]orb.Point // Line segments and polygon edges
+	polygons []orb.Polygon  // Areal parts
+	reps     []orb.Point    // One vertex of each line and polygon
+}
+
+// newShapeParts decomposes g into its primitives.
+func newShapeParts(g orb.Geometry) *shapeParts {
+	p := &shapeParts{}
+	p.add(g)
+	return p
+}
+
+func (p *shapeParts) add(g orb.Geometry) {
+	switch g := g.(type) {
+	case orb.Point:
+		p.points = append(p.points, g)
+	case orb.MultiPoint:
+		p.points = append(p.points, g...)
+	case orb.LineString:
+		p.addPath(g)
+	case orb.MultiLineString:
+		for _, ls := range g {
+			p.addPath(ls)
+		}
+	case orb.Ring:
+		p.add(orb.Polygon{g})
+	case orb.Polygon:
+		if len(g) == 0 || len(g[0]) == 0 {
+			return
+		}
+		for _, ring := range g {
+			p.addPath(ring)
+		}
+		p.polygons = append(p.polygons, g)
+	case orb.MultiPolygon:
+		for _, poly := range g {
+			p.add(poly)
+		}
+	case orb.Collection:
+		for _, part := range g {
+			p.add(part)
+		}
+	case orb.Bound:
+		p.add(g.ToPolygon())
+	}
+}
+
+func (p *shapeParts) addPath(points []orb.Point) {
+	if len(points) == 0 {
+		return
+	}
+	if len(points) == 1 {
+		p.points = append(p.points, points[0])
+		return
+	}
+
+	p.reps = append(p.reps, points[0])
+	for i := 1; i < len(points); i++ {
+		p.segments = append(p.segments, [2]orb.Point{points[i-1], points[i]})
+	}
+}
+
+func (p *shapeParts) isEmpty() bool {
+	return len(p.points) == 0 && len(p.segments) == 0
+}
+
+// partsIntersect reports whether a and b share at least one point.
+func partsIntersect(a, b *shapeParts) bool {
+	for _, pt := range a.points {
+		if pointCovered(pt, b) {
+			return true
+		}
+	}
+	for _, pt := range b.points {
+		if pointCovered(pt, a) {
+			return true
+		}
+	}
+
+	for _, sa := range a.segments {
+		for _, sb := range b.segments {
+			if segmentsIntersect(sa[0], sa[1], sb[0], sb[1]) {
+				return true
+			}
+		}
+	}
+
+	// With no crossing edges, a line or polygon is either wholly inside or
+	// wholly outside each polygon of the other geometry.
+	for _, pt := range a.reps {
+		if inPolygons(pt, b.polygons) {
+			return true
+		}
+	}
+	for _, pt := range b.reps {
+		if inPolygons(pt, a.polygons) {
+			return true
+		}
+	}
+	return false
+}
+
+// partsCover reports whether every point of b lies in a.
+func partsCover(a, b *shapeParts) bool {
+	if b.isEmpty() {
+		return false
+	}
+
+	for _, pt := range b.points {
+		if !pointCovered(pt, a) {
+			return false
+		}
+	}
+	for _, s := range b.segments {
+		if !segmentCovered(s, a) {
+			return false
+		}
+	}
+
+	// A polygon of b whose boundary lies in a may still enclose a hole of a
+	for _, poly := range b.polygons {
+		for _, outer := range a.polygons {
+			for _, hole := range outer[1:] {
+				for i := 1; i < len(hole); i++ {
+					mid := interpolate(hole[i-1], hole[i], 0.5)
+					if pointInPolygon(poly, mid) && !onPolygonBoundary(poly, mid) {
+						return false
+					}
+				}
+			}
+		}
+	}
+	return true
+}
+
+// segmentCovered reports whether every point of s lies in a. The segment is
+// split wherever it meets an edge of a; each piece then lies either wholly
+// inside or wholly outside a, which its midpoint decides.
+func segmentCovered(s [2]orb.Point, a *shapeParts) bool {
+	ts := []float64{0, 1}
+	for _, e := range a.segments {
+		ts = append(ts, segmentSplits(s[0], s[1], e[0], e[1])...)
+	}
+	sort.Float64s(ts)
+
+	if !pointCovered(s[0], a) || !pointCovered(s[1], a) {
+		return false
+	}
+	for i := 1; i < len(ts); i++ {
+		if ts[i] <= ts[i-1] {
+			continue
+		}
+		if !pointCovered(interpolate(s[0], s[1], (ts[i-1]+ts[i])/2), a) {
+			return false
+		}
+	}
+	return true
+}
+
+// segmentSplits returns the positions along p-q, as fractions of its length,
+// where segment c-d meets it.
+func segmentSplits(p, q, c, d orb.Point) []float64 {
+	r := orb.Point{q[0] - p[0], q[1] - p[1]}
+	s := orb.Point{d[0] - c[0], d[1] - c[1]}
+	denom := cross(r, s)
+	lengthSq := r[0]*r[0] + r[1]*r[1]
+	if lengthSq == 0 {
+		return nil
+	}
+
+	if denom == 0 {
+		// Parallel: only collinear segments meet, at the ends of their overlap
+		if !onLine(c, p, q) {
+			return nil
+		}
+		var ts []float64
+		for _, e := range [2]orb.Point{c, d} {
+			t := ((e[0]-p[0])*r[0] + (e[1]-p[1])*r[1]) / lengthSq
+			if t > 0 && t < 1 {
+				ts = append(ts, t)
+			}
+		}
+		return ts
+	}
+
+	cp := orb.Point{c[0] - p[0], c[1] - p[1]}
+	t := cross(cp, s) / denom
+	u := cross(cp, r) / denom
+	if t > 0 && t < 1 && u >= 0 && u <= 1 {
+		return []float64{t}
+	}
+	return nil
+}
+
+// pointCovered reports whether pt lies in a: on one of its points or
+// segments, or inside one of its polygons.
+func pointCovered(pt orb.Point, a *shapeParts) bool {
+	for _, p := range a.points {
+		if p == pt {
+			return true
+		}
+	}
+	for _, s := range a.segments {
+		if onSegment(pt, s[0], s[1]) {
+			return true
+		}
+	}
+	return inPolygons(pt, a.polygons)
+}
+
+// inPolygons reports whether pt lies inside or on the boundary of any polygon.
+func inPolygons(pt orb.Point, polygons []orb.Polygon) bool {
+	for _, poly := range polygons {
+		if pointInPolygon(poly, pt) {
+			return true
+		}
+	}
+	return false
+}
+
+// pointInPolygon reports whether pt lies inside poly or on its boundary,
+// including the boundaries of its holes.
+func pointInPolygon(poly orb.Polygon, pt orb.Point) bool {
+	if len(poly) == 0 || len(poly[0]) == 0 {
+		return false
+	}
+	return planar.PolygonContains(poly, pt) || onPolygonBoundary(poly, pt)
+}
+
+// onPolygonBoundary reports whether pt lies on an edge of any ring of poly.
+func onPolygonBoundary(poly orb.Polygon, pt orb.Point) bool {
+	for _, ring := range poly {
+		for i := 1; i < len(ring); i++ {
+			if onSegment(pt, ring[i-1], ring[i]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// partsDistance returns the smallest distance between a and b, 0 if they
+// intersect.
+func partsDistance(a, b *shapeParts) float64 {
+	if a.isEmpty() || b.isEmpty() {
+		return math.Inf(1)
+	}
+	if partsIntersect(a, b) {
+		return 0
+	}
+
+	// Without intersections the nearest points include a vertex of a or b
+	d := math.Inf(1)
+	for _, pt := range a.points {
+		d = math.Min(d, pointPartsDistance(pt, b))
+	}
+	for _, s := range a.segments {
+		d = math.Min(d, pointPartsDistance(s[0], b))
+		d = math.Min(d, pointPartsDistance(s[1], b))
+	}
+	for _, pt := range b.points {
+		d = math.Min(d, pointPartsDistance(pt, a))
+	}
+	for _, s := range b.segments {
+		d = math.Min(d, pointPartsDistance(s[0], a))
+		d = math.Min(d, pointPartsDistance(s[1], a))
+	}
+	return d
+}
+
+// pointPartsDistance returns the distance from pt to a, 0 if pt lies in a.
+func pointPartsDistance(pt orb.Point, a *shapeParts) float64 {
+	if inPolygons(pt, a.polygons) {
+		return 0
+	}
+
+	d := math.Inf(1)
+	for _, p := range a.points {
+		d = math.Min(d, planar.Distance(pt, p))
+	}
+	for _, s := range a.segments {
+		d = math.Min(d, planar.DistanceFromSegment(s[0], s[1], pt))
+	}
+	return d
+}
+
+// segmentsIntersect reports whether segments a-b and c-d share a point.
+func segmentsIntersect(a, b, c, d orb.Point) bool {
+	if math.Max(a[0], b[0]) < math.Min(c[0], d[0]) || math.Max(c[0], d[0]) < math.Min(a[0], b[0]) ||
+		math.Max(a[1], b[1]) < math.Min(c[1], d[1]) || math.Max(c[1], d[1]) < math.Min(a[1], b[1]) {
+		return false
+	}
+
+	d1 := orientation(c, d, a)
+	d2 := orientation(c, d, b)
+	d3 := orientation(a, b, c)
+	d4 := orientation(a, b, d)
+	if ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0)) {
+		return true
+	}
+
+	return onSegment(a, c, d) || onSegment(b, c, d) || onSegment(c, a, b) || onSegment(d, a, b)
+}
+
+// onSegment reports whether pt lies on segment a-b, allowing for rounding in
+// computed points.
+func onSegment(pt, a, b orb.Point) bool {
+	if pt == a || pt == b {
+		return true
+	}
+	if !onLine(pt, a, b) {
+		return false
+	}
+	ab := orb.Point{b[0] - a[0], b[1] - a[1]}
+	ap := orb.Point{pt[0] - a[0], pt[1] - a[1]}
+	dot := ab[0]*ap[0] + ab[1]*ap[1]
+	return dot >= 0 && dot <= ab[0]*ab[0]+ab[1]*ab[1]
+}
+
+// onLine reports whether pt lies on the infinite line through a and b, to
+// within a relative tolerance.
+func onLine(pt, a, b orb.Point) bool {
+	ab := orb.Point{b[0] - a[0], b[1] - a[1]}
+	ap := orb.Point{pt[0] - a[0], pt[1] - a[1]}
+	scale := math.Hypot(ab[0], ab[1]) * math.Hypot(ap[0], ap[1])
+	return math.Abs(cross(ab, ap)) <= 1e-12*scale
+}
+
+// orientation returns the signed area of the triangle a, b, c: positive if
+// counter-clockwise, negative if clockwise and 0 if collinear.
+func orientation(a, b, c orb.Point) float64 {
+	return cross(orb.Point{b[0] - a[0], b[1] - a[1]}, orb.Point{c[0] - a[0], c[1] - a[1]})
+}
+
+func cross(a, b orb.Point) float64 {
+	return a[0]*b[1] - a[1]*b[0]
+}
+
+func interpolate(a, b orb.Point, t float64) orb.Point {
+	return orb.Point{a[0] + (b[0]-a[0])*t, a[1] + (b[1]-a[1])*t}
+}
@@ -0,0 +1,248 @@
+package flatgeobuf
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+var (
+	// An L-shaped polygon whose bounding box covers the empty corner around (8, 8)
+	lShape = orb.Polygon{{{0, 0}, {10, 0}, {10, 4}, {4, 4}, {4, 10}, {0, 10}, {0, 0}}}
+	// A square with a square hole
+	donut = orb.Polygon{
+		{{0, 0}, {10, 0}, {10, 10}, {0, 10}, {0, 0}},
+		{{3, 3}, {7, 3}, {7, 7}, {3, 7}, {3, 3}},
+	}
+)
+
+func TestPartsIntersect(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     orb.Geometry
+		expected bool
+	}{
+		{"point in polygon", orb.Point{1, 1}, lShape, true},
+		{"point in bbox corner", orb.Point{8, 8}, lShape, false},
+		{"point on edge", orb.Point{10, 2}, lShape, true},
+		{"point in hole", orb.Point{5, 5}, donut, false},
+		{"point on hole edge", orb.Point{3, 5}, donut, true},
+		{"crossing lines", orb.LineString{{0, 0}, {2, 2}}, orb.LineString{{0, 2}, {2, 0}}, true},
+		{"parallel lines", orb.LineString{{0, 0}, {2, 0}}, orb.LineString{{0, 1}, {2, 1}}, false},
+		{"touching lines", orb.LineString{{0, 0}, {2, 0}}, orb.LineString{{2, 0}, {2, 2}}, true},
+		{"line inside polygon", orb.LineString{{1, 1}, {2, 2}}, lShape, true},
+		{"line across corner", orb.LineString{{6, 9}, {9, 6}}, lShape, false},
+		{"polygon inside polygon", orb.Bound{Min: orb.Point{1, 1}, Max: orb.Point{2, 2}}, lShape, true},
+		{"polygon in hole", orb.Bound{Min: orb.Point{4, 4}, Max: orb.Point{6, 6}}, donut, false},
+		{"polygon around hole", orb.Bound{Min: orb.Point{2, 2}, Max: orb.Point{8, 8}}, donut, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := newShapeParts(tt.a), newShapeParts(tt.b)
+			if got := partsIntersect(a, b); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+			if got := partsIntersect(b, a); got != tt.expected {
+				t.Errorf("reversed: expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestPartsCover(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     orb.Geometry
+		expected bool
+	}{
+		{"polygon covers point", lShape, orb.Point{1, 1}, true},
+		{"polygon covers own edge", lShape, orb.LineString{{0, 0}, {10, 0}}, true},
+		{"polygon covers itself", lShape, lShape, true},
+		{"line leaves concave polygon", lShape, orb.LineString{{2, 8}, {8, 2}}, false},
+		{"line along reflex edges", lShape, orb.LineString{{10, 4}, {4, 4}, {4, 10}}, true},
+		{"polygon inside", lShape, orb.Bound{Min: orb.Point{1, 1}, Max: orb.Point{3, 3}}, true},
+		{"polygon over hole", donut, orb.Bound{Min: orb.Point{2, 2}, Max: orb.Point{8, 8}}, false},
+		{"polygon beside hole", donut, orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{3, 10}}, true},
+		{"line covers sub-line", orb.LineString{{0, 0}, {5, 0}, {10, 0}}, orb.LineString{{1, 0}, {9, 0}}, true},
+		{"line does not cover longer line", orb.LineString{{0, 0}, {5, 0}}, orb.LineString{{1, 0}, {9, 0}}, false},
+		{"point does not cover polygon", orb.Point{1, 1}, lShape, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := partsCover(newShapeParts(tt.a), newShapeParts(tt.b)); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func newPredicateReader(t *testing.T) *Reader {
+	t.Helper()
+
+	fc := geojson.NewFeatureCollection()
+	for _, g := range []orb.Geometry{
+		lShape,
+		orb.Point{8, 8},
+		orb.Point{2, 2},
+		orb.LineString{{6, 9}, {9, 6}},
+		orb.Polygon{{{20, 20}, {30, 20}, {30, 30}, {20, 30}, {20, 20}}},
+	} {
+		f := geojson.NewFeature(g)
+		f.Properties = geojson.Properties{"kind": g.GeoJSONType()}
+		fc.Append(f)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteFeatures(&buf, fc, &Options{IncludeIndex: true}); err != nil {
+		t.Fatalf("WriteFeatures failed: %v", err)
+	}
+	reader, err := NewReaderFromData(buf.Bytes())
+	if err != nil {
+		t.Fatalf("NewReaderFromData failed: %v", err)
+	}
+	return reader
+}
+
+func featureKinds(fc *geojson.FeatureCollection) map[string]int {
+	kinds := make(map[string]int)
+	for _, f := range fc.Features {
+		kinds[f.Properties["kind"].(string)]++
+	}
+	return kinds
+}
+
+func TestSearchGeometry(t *testing.T) {
+	reader := newPredicateReader(t)
+	defer reader.Close()
+
+	// The corner square lies in the L-shape's bounding box but not in the shape
+	corner := orb.Bound{Min: orb.Point{7, 7}, Max: orb.Point{9, 9}}.ToPolygon()
+
+	bboxHits, err := reader.Search(corner.Bound())
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if kinds := featureKinds(bboxHits); kinds["Polygon"] != 1 {
+		t.Fatalf("expected the bbox search to return the L-shape, got %v", kinds)
+	}
+
+	fc, err := reader.SearchGeometry(corner, Intersects)
+	if err != nil {
+		t.Fatalf("SearchGeometry failed: %v", err)
+	}
+	kinds := featureKinds(fc)
+	if kinds["Polygon"] != 0 || kinds["Point"] != 1 || kinds["LineString"] != 1 {
+		t.Errorf("unexpected intersecting features: %v", kinds)
+	}
+
+	fc, err = reader.SearchGeometry(corner, Within)
+	if err != nil {
+		t.Fatalf("SearchGeometry failed: %v", err)
+	}
+	// The line crosses the square but its ends lie outside
+	if kinds := featureKinds(fc); len(fc.Features) != 1 || kinds["Point"] != 1 {
+		t.Errorf("unexpected features within: %v", kinds)
+	}
+
+	fc, err = reader.SearchGeometry(orb.Point{2, 2}, Contains)
+	if err != nil {
+		t.Fatalf("SearchGeometry failed: %v", err)
+	}
+	if kinds := featureKinds(fc); len(fc.Features) != 2 || kinds["Polygon"] != 1 || kinds["Point"] != 1 {
+		t.Errorf("unexpected containing features: %v", kinds)
+	}
+
+	if _, err := reader.SearchGeometry(nil, Intersects); !errors.Is(err, ErrNilGeometry) {
+		t.Errorf("expected ErrNilGeometry, got %v", err)
+	}
+}
+
+func TestSearchGeometryBuffered(t *testing.T) {
+	reader := newPredicateReader(t)
+	defer reader.Close()
+
+	// (7, 7) is ~0.71 from the line, ~1.41 from (8, 8) and 3 from the L-shape
+	fc, err := reader.SearchGeometryBuffered(orb.Point{7, 7}, Intersects, 1)
+	if err != nil {
+		t.Fatalf("SearchGeometryBuffered failed: %v", err)
+	}
+	if kinds := featureKinds(fc); len(fc.Features) != 1 || kinds["LineString"] != 1 {
+		t.Errorf("unexpected features within 1: %v", kinds)
+	}
+
+	fc, err = reader.SearchGeometryBuffered(orb.Point{7, 7}, Intersects, 3)
+	if err != nil {
+		t.Fatalf("SearchGeometryBuffered failed: %v", err)
+	}
+	if kinds := featureKinds(fc); kinds["Polygon"] != 1 || kinds["LineString"] != 1 || kinds["Point"] != 1 {
+		t.Errorf("unexpected features within 3: %v", kinds)
+	}
+
+	// The far square contains (25, 25) buffered by 4 but not by 6
+	fc, err = reader.SearchGeometryBuffered(orb.Point{25, 25}, Contains, 4)
+	if err != nil {
+		t.Fatalf("SearchGeometryBuffered failed: %v", err)
+	}
+	if len(fc.Features) != 1 {
+		t.Errorf("expected 1 feature containing the buffer, got %d", len(fc.Features))
+	}
+	fc, err = reader.SearchGeometryBuffered(orb.Point{25, 25}, Contains, 6)
+	if err != nil {
+		t.Fatalf("SearchGeometryBuffered failed: %v", err)
+	}
+	if len(fc.Features) != 0 {
+		t.Errorf("expected no features containing the larger buffer, got %d", len(fc.Features))
+	}
+
+	// The line and (8, 8) lie within 3 of (7.5, 7.5); the L-shape does not
+	fc, err = reader.SearchGeometryBuffered(orb.Point{7.5, 7.5}, Within, 3)
+	if err != nil {
+		t.Fatalf("SearchGeometryBuffered failed: %v", err)
+	}
+	if kinds := featureKinds(fc); len(fc.Features) != 2 || kinds["Point"] != 1 || kinds["LineString"] != 1 {
+		t.Errorf("unexpected features within the buffer: %v", kinds)
+	}
+}
+
+func TestSearchGeometry_Reference(t *testing.T) {
+	reader, err := NewReader(filepath.Join("testdata", "poly_landmarks.fgb"))
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	all, err := reader.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+
+	queries := []orb.Geometry{
+		orb.Bound{Min: orb.Point{-73.976523, 40.715091}, Max: orb.Point{-73.971893, 40.727318}},
+		orb.Polygon{{{-74.0, 40.70}, {-73.95, 40.75}, {-74.0, 40.80}, {-74.0, 40.70}}},
+		orb.LineString{{-74.05, 40.68}, {-73.90, 40.88}},
+	}
+
+	// The index prefilter must not lose any match found by a full scan
+	for i, query := range queries {
+		want := 0
+		for _, f := range all.Features {
+			if partsIntersect(newShapeParts(f.Geometry), newShapeParts(query)) {
+				want++
+			}
+		}
+
+		fc, err := reader.SearchGeometry(query, Intersects)
+		if err != nil {
+			t.Fatalf("SearchGeometry failed: %v", err)
+		}
+		if want == 0 || len(fc.Features) != want {
+			t.Errorf("query %d: expected %d features, got %d", i, want, len(fc.Features))
+		}
+	}
+}
@@ -2,9 +2,15 @@ package flatgeobuf
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"math"
+	"sort"
+	"strconv"
 
 	"github.com/flatgeobuf/flatgeobuf/src/go/flattypes"
 	"github.com/flatgeobuf/flatgeobuf/src/go/writer"
@@ -13,51 +19,58 @@ import (
 )
 
 // inferColumns analyzes features and infers the column schema.
-// It examines all properties across all features to determine
-// the appropriate column types.
-func inferColumns(features []*geojson.Feature, builder *flatbuffers.Builder) []*writer.Column {
+// It examines all properties across all features using the default
+// schema policy.
+func inferColumns(features []*geojson.Feature) []ColumnInfo {
 	if len(features) == 0 {
 		return nil
 	}
 
-	// Collect all unique property names and their types
-	columnTypes := make(map[string]flattypes.ColumnType)
-	columnOrder := make([]string, 0)
+	// The default policy never rejects mixed types
+	columns, _ := InferSchema(features, DefaultSchemaPolicy())
+	return columns
+}
 
-	for _, f := range features {
-		if f.Properties == nil {
-			continue
-		}
-		for name, value := range f.Properties {
-			// Track column order (first occurrence)
-			if _, exists := columnTypes[name]; !exists {
-				columnOrder = append(columnOrder, name)
-			}
+// buildColumns converts column descriptions into writer columns. The resolved
+// column types are returned alongside, as writer.Column does not expose them.
+func buildColumns(infos []ColumnInfo, builder *flatbuffers.Builder) ([]*writer.Column, []flattypes.ColumnType, error) {
+	if len(infos) > math.MaxUint16+1 {
+		return nil, nil, fmt.Errorf("%w: too many columns (%d)", ErrInvalidColumn, len(infos))
+	}
 
-			// Infer type from value
-			inferredType := inferColumnType(value)
+	columns := make([]*writer.Column, 0, len(infos))
+	types := make([]flattypes.ColumnType, 0, len(infos))
+	seen := make(map[string]bool, len(infos))
 
-			// If we already have a type, prefer the more general one
-			if existingType, exists := columnTypes[name]; exists {
-				columnTypes[name] = promoteColumnType(existingType, inferredType)
-			} else {
-				columnTypes[name] = inferredType
-			}
+	for _, info := range infos {
+		if info.Name == "" || seen[info.Name] {
+			return nil, nil, fmt.Errorf("%w: empty or duplicate column name %q", ErrInvalidColumn, info.Name)
+		}
+		seen[info.Name] = true
+
+		colType, ok := flattypes.EnumValuesColumnType[info.Type]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: %q for column %q", ErrInvalidColumn, info.Type, info.Name)
 		}
-	}
 
-	// Create columns in order
-	columns := make([]*writer.Column, 0, len(columnOrder))
-	for _, name := range columnOrder {
 		col := writer.NewColumn(builder)
-		col.SetName(name)
-		col.SetTitle(name) // Set title to match name for JS library compatibility
-		col.SetType(columnTypes[name])
-		col.SetNullable(true) // Allow null values
+		col.SetName(info.Name)
+		col.SetType(colType)
+		if info.Title != "" {
+			col.SetTitle(info.Title)
+		}
+		if info.Description != "" {
+			col.SetDescription(info.Description)
+		}
+		col.SetNullable(info.Nullable)
+		col.SetWidth(info.Width)
+		col.SetPrecision(info.Precision)
+
 		columns = append(columns, col)
+		types = append(types, colType)
 	}
 
-	return columns
+	return columns, types, nil
 }
 
 // inferColumnType determines the FlatGeobuf column type for a Go value.
@@ -88,6 +101,8 @@ func inferColumnType(value interface{}) flattypes.ColumnType {
 		return flattypes.ColumnTypeDouble
 	case string:
 		return flattypes.ColumnTypeString
+	case []byte:
+		return flattypes.ColumnTypeBinary
 	case json.Number:
 		// Try to parse as int first, then float
 		if _, err := v.Int64(); err == nil {
@@ -147,43 +162,88 @@ func promoteColumnType(a, b flattypes.ColumnType) flattypes.ColumnType {
 }
 
 // encodeProperties encodes geojson.Properties to FlatGeobuf binary format.
-// The format is: [2-byte column index][value bytes]... repeated for each property.
-func encodeProperties(props geojson.Properties, columns []*writer.Column, columnMap map[string]int) []byte {
-	if props == nil || len(columns) == 0 {
-		return nil
-	}
-
+// The format is: [2-byte column index][value bytes]... repeated for each property,
+// written in column order so the output is deterministic.
+// A value that cannot be represented in its column's type fails with
+// ErrPropertyMismatch.
+func encodeProperties(props geojson.Properties, names []string, types []flattypes.ColumnType, enc BinaryEncoding) ([]byte, error) {
 	var buf bytes.Buffer
+	if err := appendProperties(&buf, props, names, types, enc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
 
-	for name, value := range props {
-		if value == nil {
-			continue // Skip null values
-		}
+// appendProperties is encodeProperties writing to buf, so the buffer can be
+// reused across features.
+func appendProperties(buf *bytes.Buffer, props geojson.Properties, names []string, types []flattypes.ColumnType, enc BinaryEncoding) error {
+	if props == nil || len(types) == 0 {
+		return nil
+	}
 
-		colIndex, ok := columnMap[name]
-		if !ok {
-			continue // Column not in schema
+	var indexBytes [2]byte
+	for colIndex, name := range names {
+		value, ok := props[name]
+		if !ok || value == nil {
+			continue // Skip missing and null values
 		}
 
 		// Write column index (uint16, little-endian)
-		indexBytes := make([]byte, 2)
-		binary.LittleEndian.PutUint16(indexBytes, uint16(colIndex))
-		buf.Write(indexBytes)
+		binary.LittleEndian.PutUint16(indexBytes[:], uint16(colIndex))
+		buf.Write(indexBytes[:])
 
 		// Write value based on column type
-		col := columns[colIndex]
-		writePropertyValue(&buf, value, col)
+		if !writePropertyValue(buf, value, types[colIndex], enc) {
+			return fmt.Errorf("%w: column %q cannot hold %T %v as %s",
+				ErrPropertyMismatch, name, value, value, types[colIndex])
+		}
+	}
+	return nil
+}
+
+// checkColumns verifies that every feature that will be written has a value
+// for each non-nullable column, and that each value can be stored in its
+// column's type.
+func checkColumns(features []*geojson.Feature, columns []ColumnInfo, types []flattypes.ColumnType, enc BinaryEncoding) error {
+	var scratch bytes.Buffer
+
+	for i, col := range columns {
+		for j, f := range features {
+			if f == nil || f.Geometry == nil {
+				continue // Not written
+			}
+			if err := checkColumnValue(f, j, col, types[i], enc, &scratch); err != nil {
+				return err
+			}
+		}
 	}
 
-	return buf.Bytes()
+	return nil
 }
 
-// writePropertyValue writes a single property value to the buffer.
-func writePropertyValue(buf *bytes.Buffer, value interface{}, col *writer.Column) {
-	// Get column type - we need to access it via reflection since Column
-	// doesn't expose Type() directly. For now, infer from value.
-	colType := inferColumnType(value)
+// checkColumnValue verifies that the value of feature j for col can be stored
+// in the column's type, and that it is present if the column is not nullable.
+// The scratch buffer is overwritten.
+func checkColumnValue(f *geojson.Feature, j int, col ColumnInfo, typ flattypes.ColumnType, enc BinaryEncoding, scratch *bytes.Buffer) error {
+	value := f.Properties[col.Name]
+	if value == nil {
+		if col.Nullable {
+			return nil
+		}
+		return fmt.Errorf("%w: column %q in feature %d", ErrNullValue, col.Name, j)
+	}
 
+	scratch.Reset()
+	if !writePropertyValue(scratch, value, typ, enc) {
+		return fmt.Errorf("%w: column %q in feature %d cannot hold %T %v as %s",
+			ErrPropertyMismatch, col.Name, j, value, value, typ)
+	}
+	return nil
+}
+
+// writePropertyValue writes a single property value to the buffer using the
+// encoding of colType. It reports whether a value was written.
+func writePropertyValue(buf *bytes.Buffer, value interface{}, colType flattypes.ColumnType, enc BinaryEncoding) bool {
 	switch colType {
 	case flattypes.ColumnTypeBool:
 		if v, ok := value.(bool); ok {
@@ -192,44 +252,51 @@ func writePropertyValue(buf *bytes.Buffer, value interface{}, col *writer.Column
 			} else {
 				buf.WriteByte(0)
 			}
+			return true
 		}
 
 	case flattypes.ColumnTypeByte:
-		if v, ok := toInt64(value); ok {
+		if v, ok := toIntInRange(value, math.MinInt8, math.MaxInt8); ok {
 			buf.WriteByte(byte(v))
+			return true
 		}
 
 	case flattypes.ColumnTypeUByte:
-		if v, ok := toInt64(value); ok {
+		if v, ok := toIntInRange(value, 0, math.MaxUint8); ok {
 			buf.WriteByte(byte(v))
+			return true
 		}
 
 	case flattypes.ColumnTypeShort:
-		if v, ok := toInt64(value); ok {
+		if v, ok := toIntInRange(value, math.MinInt16, math.MaxInt16); ok {
 			b := make([]byte, 2)
 			binary.LittleEndian.PutUint16(b, uint16(int16(v)))
 			buf.Write(b)
+			return true
 		}
 
 	case flattypes.ColumnTypeUShort:
-		if v, ok := toInt64(value); ok {
+		if v, ok := toIntInRange(value, 0, math.MaxUint16); ok {
 			b := make([]byte, 2)
 			binary.LittleEndian.PutUint16(b, uint16(v))
 			buf.Write(b)
+			return true
 		}
 
 	case flattypes.ColumnTypeInt:
-		if v, ok := toInt64(value); ok {
+		if v, ok := toIntInRange(value, math.MinInt32, math.MaxInt32); ok {
 			b := make([]byte, 4)
 			binary.LittleEndian.PutUint32(b, uint32(int32(v)))
 			buf.Write(b)
+			return true
 		}
 
 	case flattypes.ColumnTypeUInt:
-		if v, ok := toInt64(value); ok {
+		if v, ok := toIntInRange(value, 0, math.MaxUint32); ok {
 			b := make([]byte, 4)
 			binary.LittleEndian.PutUint32(b, uint32(v))
 			buf.Write(b)
+			return true
 		}
 
 	case flattypes.ColumnTypeLong:
@@ -237,6 +304,7 @@ func writePropertyValue(buf *bytes.Buffer, value interface{}, col *writer.Column
 			b := make([]byte, 8)
 			binary.LittleEndian.PutUint64(b, uint64(v))
 			buf.Write(b)
+			return true
 		}
 
 	case flattypes.ColumnTypeULong:
@@ -244,13 +312,16 @@ func writePropertyValue(buf *bytes.Buffer, value interface{}, col *writer.Column
 			b := make([]byte, 8)
 			binary.LittleEndian.PutUint64(b, v)
 			buf.Write(b)
+			return true
 		}
 
 	case flattypes.ColumnTypeFloat:
-		if v, ok := toFloat64(value); ok {
+		// Finite values beyond the float32 range would become infinite
+		if v, ok := toFloat64(value); ok && !(math.Abs(v) > math.MaxFloat32 && !math.IsInf(v, 0)) {
 			b := make([]byte, 4)
 			binary.LittleEndian.PutUint32(b, math.Float32bits(float32(v)))
 			buf.Write(b)
+			return true
 		}
 
 	case flattypes.ColumnTypeDouble:
@@ -258,196 +329,311 @@ func writePropertyValue(buf *bytes.Buffer, value interface{}, col *writer.Column
 			b := make([]byte, 8)
 			binary.LittleEndian.PutUint64(b, math.Float64bits(v))
 			buf.Write(b)
+			return true
 		}
 
-	case flattypes.ColumnTypeString:
-		s := toString(value)
-		buf.WriteString(s)
-		buf.WriteByte(0) // Null terminator
+	case flattypes.ColumnTypeString, flattypes.ColumnTypeDateTime:
+		writeLengthPrefixed(buf, []byte(toString(value)))
+		return true
 
 	case flattypes.ColumnTypeJson:
 		jsonBytes, err := json.Marshal(value)
 		if err != nil {
 			jsonBytes = []byte("{}")
 		}
-		buf.Write(jsonBytes)
-		buf.WriteByte(0) // Null terminator
-
-	case flattypes.ColumnTypeDateTime:
-		s := toString(value)
-		buf.WriteString(s)
-		buf.WriteByte(0) // Null terminator
+		writeLengthPrefixed(buf, jsonBytes)
+		return true
 
 	case flattypes.ColumnTypeBinary:
-		if b, ok := value.([]byte); ok {
-			// Write length followed by bytes
-			lenBytes := make([]byte, 4)
-			binary.LittleEndian.PutUint32(lenBytes, uint32(len(b)))
-			buf.Write(lenBytes)
-			buf.Write(b)
+		if b, ok := toBytes(value, enc); ok {
+			writeLengthPrefixed(buf, b)
+			return true
 		}
 	}
+
+	return false
 }
 
+// toIntInRange converts an integral value to int64, reporting false if it is
+// outside [min, max].
+func toIntInRange(value interface{}, min, max int64) (int64, bool) {
+	v, ok := toInt64(value)
+	return v, ok && v >= min && v <= max
+}
+
+// writeLengthPrefixed writes a uint32 length followed by the bytes, the
+// encoding the FlatGeobuf spec uses for String, Json, DateTime and Binary.
+func writeLengthPrefixed(buf *bytes.Buffer, b []byte) {
+	lenBytes := make([]byte, 4)
+	binary.LittleEndian.PutUint32(lenBytes, uint32(len(b)))
+	buf.Write(lenBytes)
+	buf.Write(b)
+}
+
+// Reasons reported by readPropertyValue.
+var (
+	errTruncatedValue     = errors.New("truncated value")
+	errUnterminatedString = errors.New("unterminated string")
+	errUnsupportedColumn  = errors.New("unsupported column type")
+)
+
 // decodeProperties decodes FlatGeobuf binary properties to geojson.Properties.
-func decodeProperties(data []byte, header *flattypes.Header) geojson.Properties {
-	if len(data) == 0 || header == nil {
-		return nil
+// Corrupt buffers are reported as a *PropertyError with an unknown feature
+// offset, which callers fill in.
+//
+// Versions of this package before the switch to the spec encoding wrote
+// String, Json and DateTime values NUL-terminated rather than length-prefixed.
+// Such buffers are decoded only when opts.LegacyStrings is set: otherwise they
+// are reported as corrupt, since guessing the encoding would mask corruption.
+func decodeProperties(data []byte, header *flattypes.Header, opts *ReaderOptions) (geojson.Properties, error) {
+	return newPropertyDecoder(header, opts).decode(data)
+}
+
+// propertyDecoder decodes property buffers against the columns of a header.
+// Column names are converted once rather than for every value. It is
+// read-only after construction and safe for concurrent use.
+type propertyDecoder struct {
+	columns []columnDef
+	opts    *ReaderOptions
+}
+
+// columnDef is the part of a column definition needed for decoding.
+type columnDef struct {
+	name     string
+	typ      flattypes.ColumnType
+	nullable bool
+	defined  bool // False if the header has no definition at this index
+}
+
+func newPropertyDecoder(header *flattypes.Header, opts *ReaderOptions) *propertyDecoder {
+	d := &propertyDecoder{opts: opts}
+	if header == nil {
+		return d
+	}
+
+	d.columns = make([]columnDef, header.ColumnsLength())
+	var col flattypes.Column
+	for i := range d.columns {
+		if header.Columns(&col, i) {
+			d.columns[i] = columnDef{name: string(col.Name()), typ: col.Type(), nullable: col.Nullable(), defined: true}
+		}
+	}
+	return d
+}
+
+// decode implements decodeProperties.
+func (d *propertyDecoder) decode(data []byte) (geojson.Properties, error) {
+	return d.decodeEncoding(data, d.opts != nil && d.opts.LegacyStrings)
+}
+
+// decodeEncoding decodes properties with either the spec or the legacy
+// NUL-terminated string encoding.
+func (d *propertyDecoder) decodeEncoding(data []byte, legacy bool) (geojson.Properties, error) {
+	if len(data) == 0 || d.columns == nil {
+		return nil, nil
 	}
 
-	props := make(geojson.Properties)
+	props := make(geojson.Properties, len(d.columns))
 	offset := 0
+	numColumns := len(d.columns)
 
 	for offset < len(data) {
 		// Need at least 2 bytes for column index
 		if offset+2 > len(data) {
-			break
+			return nil, &PropertyError{FeatureOffset: -1, Column: -1, Reason: "truncated column index"}
 		}
 
 		// Read column index
-		colIndex := binary.LittleEndian.Uint16(data[offset : offset+2])
+		colIndex := int(binary.LittleEndian.Uint16(data[offset : offset+2]))
 		offset += 2
 
 		// Validate column index
-		if int(colIndex) >= header.ColumnsLength() {
-			break
+		if colIndex >= numColumns {
+			return nil, &PropertyError{
+				FeatureOffset: -1,
+				Column:        colIndex,
+				Reason:        fmt.Sprintf("column index out of range (%d columns)", numColumns),
+			}
 		}
 
 		// Get column info
-		var col flattypes.Column
-		if !header.Columns(&col, int(colIndex)) {
-			break
+		col := &d.columns[colIndex]
+		if !col.defined {
+			return nil, &PropertyError{FeatureOffset: -1, Column: colIndex, Reason: "missing column definition"}
 		}
 
-		colName := string(col.Name())
-		colType := col.Type()
-
 		// Read value based on type
-		value, bytesRead := readPropertyValue(data[offset:], colType)
-		if bytesRead == 0 && colType != flattypes.ColumnTypeBool {
-			break
+		value, bytesRead, err := readPropertyValue(data[offset:], col.typ, legacy)
+		if err != nil {
+			return nil, &PropertyError{
+				FeatureOffset: -1,
+				Column:        colIndex,
+				Reason:        fmt.Sprintf("%s column %q at byte %d: %v", col.typ, col.name, offset, err),
+			}
 		}
 		offset += bytesRead
 
-		props[colName] = value
+		if b, ok := value.([]byte); ok && d.opts != nil {
+			value = formatBinary(b, d.opts.BinaryEncoding)
+		}
+
+		props[col.name] = value
 	}
 
-	return props
+	return props, nil
+}
+
+// fillNull adds a nil property for every nullable column missing from props.
+func (d *propertyDecoder) fillNull(props geojson.Properties) {
+	for _, col := range d.columns {
+		if !col.defined || !col.nullable {
+			continue
+		}
+		if _, ok := props[col.name]; !ok {
+			props[col.name] = nil
+		}
+	}
 }
 
 // readPropertyValue reads a property value from the buffer.
-// Returns the value and number of bytes read.
-func readPropertyValue(data []byte, colType flattypes.ColumnType) (interface{}, int) {
+// Returns the value and number of bytes read, or an error describing why the
+// buffer does not hold a valid value of colType. With legacy set, String, Json
+// and DateTime values are read NUL-terminated instead of length-prefixed.
+func readPropertyValue(data []byte, colType flattypes.ColumnType, legacy bool) (interface{}, int, error) {
 	switch colType {
 	case flattypes.ColumnTypeBool:
 		if len(data) < 1 {
-			return nil, 0
+			return nil, 0, errTruncatedValue
 		}
-		return data[0] != 0, 1
+		return data[0] != 0, 1, nil
 
 	case flattypes.ColumnTypeByte:
 		if len(data) < 1 {
-			return nil, 0
+			return nil, 0, errTruncatedValue
 		}
-		return int8(data[0]), 1
+		return int8(data[0]), 1, nil
 
 	case flattypes.ColumnTypeUByte:
 		if len(data) < 1 {
-			return nil, 0
+			return nil, 0, errTruncatedValue
 		}
-		return data[0], 1
+		return data[0], 1, nil
 
 	case flattypes.ColumnTypeShort:
 		if len(data) < 2 {
-			return nil, 0
+			return nil, 0, errTruncatedValue
 		}
-		return int16(binary.LittleEndian.Uint16(data[:2])), 2
+		return int16(binary.LittleEndian.Uint16(data[:2])), 2, nil
 
 	case flattypes.ColumnTypeUShort:
 		if len(data) < 2 {
-			return nil, 0
+			return nil, 0, errTruncatedValue
 		}
-		return binary.LittleEndian.Uint16(data[:2]), 2
+		return binary.LittleEndian.Uint16(data[:2]), 2, nil
 
 	case flattypes.ColumnTypeInt:
 		if len(data) < 4 {
-			return nil, 0
+			return nil, 0, errTruncatedValue
 		}
-		return int32(binary.LittleEndian.Uint32(data[:4])), 4
+		return int32(binary.LittleEndian.Uint32(data[:4])), 4, nil
 
 	case flattypes.ColumnTypeUInt:
 		if len(data) < 4 {
-			return nil, 0
+			return nil, 0, errTruncatedValue
 		}
-		return binary.LittleEndian.Uint32(data[:4]), 4
+		return binary.LittleEndian.Uint32(data[:4]), 4, nil
 
 	case flattypes.ColumnTypeLong:
 		if len(data) < 8 {
-			return nil, 0
+			return nil, 0, errTruncatedValue
 		}
-		return int64(binary.LittleEndian.Uint64(data[:8])), 8
+		return int64(binary.LittleEndian.Uint64(data[:8])), 8, nil
 
 	case flattypes.ColumnTypeULong:
 		if len(data) < 8 {
-			return nil, 0
+			return nil, 0, errTruncatedValue
 		}
-		return binary.LittleEndian.Uint64(data[:8]), 8
+		return binary.LittleEndian.Uint64(data[:8]), 8, nil
 
 	case flattypes.ColumnTypeFloat:
 		if len(data) < 4 {
-			return nil, 0
+			return nil, 0, errTruncatedValue
 		}
 		bits := binary.LittleEndian.Uint32(data[:4])
-		return math.Float32frombits(bits), 4
+		return math.Float32frombits(bits), 4, nil
 
 	case flattypes.ColumnTypeDouble:
 		if len(data) < 8 {
-			return nil, 0
+			return nil, 0, errTruncatedValue
 		}
 		bits := binary.LittleEndian.Uint64(data[:8])
-		return math.Float64frombits(bits), 8
+		return math.Float64frombits(bits), 8, nil
 
 	case flattypes.ColumnTypeString, flattypes.ColumnTypeDateTime:
-		// Find null terminator
-		nullIdx := bytes.IndexByte(data, 0)
-		if nullIdx == -1 {
-			// No null terminator, read to end
-			return string(data), len(data)
+		b, n, err := readStringBytes(data, legacy)
+		if err != nil {
+			return nil, 0, err
 		}
-		return string(data[:nullIdx]), nullIdx + 1
+		return string(b), n, nil
 
 	case flattypes.ColumnTypeJson:
-		// Find null terminator
-		nullIdx := bytes.IndexByte(data, 0)
-		if nullIdx == -1 {
-			nullIdx = len(data)
+		b, n, err := readStringBytes(data, legacy)
+		if err != nil {
+			return nil, 0, err
 		}
 		var jsonValue interface{}
-		if err := json.Unmarshal(data[:nullIdx], &jsonValue); err != nil {
-			return string(data[:nullIdx]), nullIdx + 1
-		}
-		if nullIdx < len(data) {
-			return jsonValue, nullIdx + 1
+		if err := json.Unmarshal(b, &jsonValue); err != nil {
+			// Keep malformed JSON as its raw text
+			return string(b), n, nil
 		}
-		return jsonValue, nullIdx
+		return jsonValue, n, nil
 
 	case flattypes.ColumnTypeBinary:
-		if len(data) < 4 {
-			return nil, 0
-		}
-		length := binary.LittleEndian.Uint32(data[:4])
-		if len(data) < int(4+length) {
-			return nil, 0
+		b, n, err := readLengthPrefixed(data)
+		if err != nil {
+			return nil, 0, err
 		}
-		return data[4 : 4+length], int(4 + length)
+		// Copy so the value does not alias the (possibly memory-mapped) buffer
+		value := make([]byte, len(b))
+		copy(value, b)
+		return value, n, nil
 
 	default:
-		return nil, 0
+		return nil, 0, errUnsupportedColumn
+	}
+}
+
+// readLengthPrefixed reads a uint32 length followed by that many bytes.
+// The returned slice aliases data.
+func readLengthPrefixed(data []byte) ([]byte, int, error) {
+	if len(data) < 4 {
+		return nil, 0, errTruncatedValue
+	}
+	length := int(binary.LittleEndian.Uint32(data[:4]))
+	if length > len(data)-4 {
+		return nil, 0, errTruncatedValue
+	}
+	return data[4 : 4+length], 4 + length, nil
+}
+
+// readStringBytes reads the bytes of a String, Json or DateTime value, either
+// length-prefixed or, for legacy buffers, NUL-terminated.
+func readStringBytes(data []byte, legacy bool) ([]byte, int, error) {
+	if !legacy {
+		return readLengthPrefixed(data)
+	}
+
+	nullIdx := bytes.IndexByte(data, 0)
+	if nullIdx == -1 {
+		return nil, 0, errUnterminatedString
 	}
+	return data[:nullIdx], nullIdx + 1, nil
 }
 
 // Type conversion helpers
 
+// toInt64 converts an integral value to int64. Floats with a fractional part
+// and values outside the int64 range are rejected rather than truncated.
 func toInt64(v interface{}) (int64, bool) {
 	switch val := v.(type) {
 	case int:
@@ -461,7 +647,9 @@ func toInt64(v interface{}) (int64, bool) {
 	case int64:
 		return val, true
 	case uint:
-		return int64(val), true
+		if uint64(val) <= math.MaxInt64 {
+			return int64(val), true
+		}
 	case uint8:
 		return int64(val), true
 	case uint16:
@@ -469,22 +657,25 @@ func toInt64(v interface{}) (int64, bool) {
 	case uint32:
 		return int64(val), true
 	case uint64:
-		return int64(val), true
+		if val <= math.MaxInt64 {
+			return int64(val), true
+		}
 	case float32:
-		return int64(val), true
+		return floatToInt64(float64(val))
 	case float64:
-		return int64(val), true
+		return floatToInt64(val)
 	case json.Number:
 		if i, err := val.Int64(); err == nil {
 			return i, true
 		}
 		if f, err := val.Float64(); err == nil {
-			return int64(f), true
+			return floatToInt64(f)
 		}
 	}
 	return 0, false
 }
 
+// toUint64 is toInt64 for unsigned values.
 func toUint64(v interface{}) (uint64, bool) {
 	switch val := v.(type) {
 	case uint:
@@ -497,26 +688,42 @@ func toUint64(v interface{}) (uint64, bool) {
 		return uint64(val), true
 	case uint64:
 		return val, true
-	case int:
-		if val >= 0 {
-			return uint64(val), true
-		}
-	case int64:
-		if val >= 0 {
-			return uint64(val), true
-		}
+	case float32:
+		return floatToUint64(float64(val))
 	case float64:
-		if val >= 0 {
-			return uint64(val), true
-		}
+		return floatToUint64(val)
 	case json.Number:
-		if i, err := val.Int64(); err == nil && i >= 0 {
+		if u, err := strconv.ParseUint(string(val), 10, 64); err == nil {
+			return u, true
+		}
+		if f, err := val.Float64(); err == nil {
+			return floatToUint64(f)
+		}
+	default:
+		if i, ok := toInt64(v); ok && i >= 0 {
 			return uint64(i), true
 		}
 	}
 	return 0, false
 }
 
+// floatToInt64 converts f to int64 if it is integral and in range. The
+// bounds are powers of two, so they are exact as float64.
+func floatToInt64(f float64) (int64, bool) {
+	if f != math.Trunc(f) || f < -(1<<63) || f >= 1<<63 {
+		return 0, false // Fractional, NaN, infinite or out of range
+	}
+	return int64(f), true
+}
+
+// floatToUint64 is floatToInt64 for uint64.
+func floatToUint64(f float64) (uint64, bool) {
+	if f != math.Trunc(f) || f < 0 || f >= 1<<64 {
+		return 0, false
+	}
+	return uint64(f), true
+}
+
 func toFloat64(v interface{}) (float64, bool) {
 	switch val := v.(type) {
 	case float32:
@@ -555,16 +762,68 @@ func toString(v interface{}) string {
 	}
 }
 
-// buildColumnMap creates a map from column name to index.
-func buildColumnMap(columns []*writer.Column, columnNames []string) map[string]int {
-	m := make(map[string]int, len(columnNames))
-	for i, name := range columnNames {
-		m[name] = i
+// toBytes converts a value for a Binary column. Strings are decoded according
+// to enc, so values exported with formatBinary can be written back unchanged.
+func toBytes(v interface{}, enc BinaryEncoding) ([]byte, bool) {
+	switch val := v.(type) {
+	case []byte:
+		return val, true
+	case string:
+		switch enc {
+		case BinaryBase64:
+			b, err := base64.StdEncoding.DecodeString(val)
+			return b, err == nil
+		case BinaryHex:
+			b, err := hex.DecodeString(val)
+			return b, err == nil
+		default:
+			return []byte(val), true
+		}
+	}
+	return nil, false
+}
+
+// formatBinary converts a decoded Binary value to its configured representation.
+func formatBinary(b []byte, enc BinaryEncoding) interface{} {
+	switch enc {
+	case BinaryBase64:
+		return base64.StdEncoding.EncodeToString(b)
+	case BinaryHex:
+		return hex.EncodeToString(b)
+	default:
+		return b
+	}
+}
+
+// sortColumns orders columns by name.
+func sortColumns(columns []ColumnInfo) {
+	sort.SliceStable(columns, func(i, j int) bool {
+		return columns[i].Name < columns[j].Name
+	})
+}
+
+// columnInfoNames returns the names of the given columns in order.
+func columnInfoNames(columns []ColumnInfo) []string {
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.Name
+	}
+	return names
+}
+
+// sortedKeys returns the property names in sorted order, giving map
+// iteration a stable order.
+func sortedKeys(props geojson.Properties) []string {
+	keys := make([]string, 0, len(props))
+	for name := range props {
+		keys = append(keys, name)
 	}
-	return m
+	sort.Strings(keys)
+	return keys
 }
 
-// getColumnNames extracts names from the columns slice.
+// getColumnNames extracts the property names of all features in order of
+// first occurrence, with names new to a feature taken in sorted order.
 func getColumnNames(features []*geojson.Feature) []string {
 	if len(features) == 0 {
 		return nil
@@ -577,7 +836,7 @@ func getColumnNames(features []*geojson.Feature) []string {
 		if f.Properties == nil {
 			continue
 		}
-		for name := range f.Properties {
+		for _, name := range sortedKeys(f.Properties) {
 			if !seen[name] {
 				seen[name] = true
 				names = append(names, name)
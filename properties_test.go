@@ -1,15 +1,32 @@
 package flatgeobuf
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
 	"testing"
 
 	"github.com/flatgeobuf/flatgeobuf/src/go/flattypes"
+	"github.com/flatgeobuf/flatgeobuf/src/go/writer"
 	flatbuffers "github.com/google/flatbuffers/go"
 	"github.com/paulmach/orb"
 	"github.com/paulmach/orb/geojson"
 )
 
+// mustEncodeProperties encodes props with raw binary values, failing tb if a
+// value does not fit its column.
+func mustEncodeProperties(tb testing.TB, props geojson.Properties, names []string, types []flattypes.ColumnType) []byte {
+	tb.Helper()
+	data, err := encodeProperties(props, names, types, BinaryRaw)
+	if err != nil {
+		tb.Fatalf("encodeProperties failed: %v", err)
+	}
+	return data
+}
+
 func TestInferColumnType(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -24,6 +41,7 @@ func TestInferColumnType(t *testing.T) {
 		{"float32", float32(3.14), flattypes.ColumnTypeFloat},
 		{"float64", 3.14159, flattypes.ColumnTypeDouble},
 		{"string", "hello", flattypes.ColumnTypeString},
+		{"bytes", []byte{0xde, 0xad}, flattypes.ColumnTypeBinary},
 		{"map", map[string]interface{}{"key": "value"}, flattypes.ColumnTypeJson},
 		{"slice", []interface{}{1, 2, 3}, flattypes.ColumnTypeJson},
 	}
@@ -76,7 +94,6 @@ func TestPromoteColumnType(t *testing.T) {
 }
 
 func TestInferColumns(t *testing.T) {
-	builder := flatbuffers.NewBuilder(256)
 	features := []*geojson.Feature{
 		{
 			Geometry: orb.Point{1, 2},
@@ -96,7 +113,7 @@ func TestInferColumns(t *testing.T) {
 		},
 	}
 
-	columns := inferColumns(features, builder)
+	columns := inferColumns(features)
 
 	if len(columns) != 4 { // name, value, active, score
 		t.Errorf("expected 4 columns, got %d", len(columns))
@@ -104,8 +121,7 @@ func TestInferColumns(t *testing.T) {
 }
 
 func TestInferColumns_EmptyFeatures(t *testing.T) {
-	builder := flatbuffers.NewBuilder(256)
-	columns := inferColumns([]*geojson.Feature{}, builder)
+	columns := inferColumns([]*geojson.Feature{})
 
 	if columns != nil {
 		t.Error("expected nil columns for empty features")
@@ -144,6 +160,42 @@ func TestGetColumnNames(t *testing.T) {
 	}
 }
 
+func TestGetColumnNames_Order(t *testing.T) {
+	features := []*geojson.Feature{
+		{
+			Geometry:   orb.Point{1, 2},
+			Properties: geojson.Properties{"c": 1, "a": 2},
+		},
+		{
+			Geometry:   orb.Point{3, 4},
+			Properties: geojson.Properties{"b": 3, "a": 4},
+		},
+	}
+
+	expected := []string{"a", "c", "b"}
+	for run := 0; run < 10; run++ {
+		names := getColumnNames(features)
+		columns := columnInfoNames(inferColumns(features))
+		for i, name := range expected {
+			if names[i] != name || columns[i] != name {
+				t.Fatalf("expected order %v, got %v and %v", expected, names, columns)
+			}
+		}
+	}
+}
+
+func TestEncodeProperties_ColumnOrder(t *testing.T) {
+	names := []string{"a", "b"}
+	types := []flattypes.ColumnType{flattypes.ColumnTypeByte, flattypes.ColumnTypeByte}
+	props := geojson.Properties{"b": 2, "a": 1, "unknown": 3}
+
+	got := mustEncodeProperties(t, props, names, types)
+	expected := []byte{0, 0, 1, 1, 0, 2}
+	if string(got) != string(expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
 func TestToInt64(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -153,7 +205,12 @@ func TestToInt64(t *testing.T) {
 	}{
 		{"int", 42, 42, true},
 		{"int64", int64(100), 100, true},
-		{"float64", 3.9, 3, true},
+		{"integral float64", 3.0, 3, true},
+		{"json.Number", json.Number("1e3"), 1000, true},
+		{"fractional float64", 3.9, 0, false},
+		{"float64 beyond int64", 1e19, 0, false},
+		{"uint64 beyond int64", uint64(math.MaxUint64), 0, false},
+		{"NaN", math.NaN(), 0, false},
 		{"string", "hello", 0, false},
 	}
 
@@ -170,6 +227,56 @@ func TestToInt64(t *testing.T) {
 	}
 }
 
+func TestEncodeProperties_Mismatch(t *testing.T) {
+	names := []string{"name", "value"}
+	types := []flattypes.ColumnType{flattypes.ColumnTypeString, flattypes.ColumnTypeDouble}
+
+	// A value that does not fit fails rather than being dropped as a null
+	_, err := encodeProperties(geojson.Properties{"name": "a", "value": "x"}, names, types, BinaryRaw)
+	if !errors.Is(err, ErrPropertyMismatch) {
+		t.Fatalf("expected ErrPropertyMismatch, got %v", err)
+	}
+	if !strings.Contains(err.Error(), `column "value"`) {
+		t.Errorf("expected the error to name the column, got %v", err)
+	}
+}
+
+func TestWritePropertyValue_Range(t *testing.T) {
+	tests := []struct {
+		typ   flattypes.ColumnType
+		value interface{}
+		ok    bool
+	}{
+		{flattypes.ColumnTypeByte, -128, true},
+		{flattypes.ColumnTypeByte, 128, false},
+		{flattypes.ColumnTypeUByte, 255, true},
+		{flattypes.ColumnTypeUByte, -1, false},
+		{flattypes.ColumnTypeShort, 300.0, true},
+		{flattypes.ColumnTypeShort, 40000, false},
+		{flattypes.ColumnTypeUShort, 65535, true},
+		{flattypes.ColumnTypeInt, 5e9, false},
+		{flattypes.ColumnTypeInt, 2.75, false},
+		{flattypes.ColumnTypeUInt, uint32(math.MaxUint32), true},
+		{flattypes.ColumnTypeUInt, int64(math.MaxUint32 + 1), false},
+		{flattypes.ColumnTypeLong, uint64(math.MaxInt64 + 1), false},
+		{flattypes.ColumnTypeULong, uint64(math.MaxUint64), true},
+		{flattypes.ColumnTypeULong, json.Number("18446744073709551615"), true},
+		{flattypes.ColumnTypeULong, -1, false},
+		{flattypes.ColumnTypeFloat, 1e39, false},
+		{flattypes.ColumnTypeFloat, math.Inf(1), true},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if ok := writePropertyValue(&buf, tt.value, tt.typ, BinaryRaw); ok != tt.ok {
+			t.Errorf("%s %T %v: expected ok=%v, got ok=%v", tt.typ, tt.value, tt.value, tt.ok, ok)
+		}
+		if !tt.ok && buf.Len() != 0 {
+			t.Errorf("%s %v: wrote %d bytes for a rejected value", tt.typ, tt.value, buf.Len())
+		}
+	}
+}
+
 func TestToFloat64(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -217,3 +324,242 @@ func TestToString(t *testing.T) {
 		})
 	}
 }
+
+func TestToBytes(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    interface{}
+		enc      BinaryEncoding
+		expected []byte
+		ok       bool
+	}{
+		{"bytes", []byte{1, 2, 3}, BinaryRaw, []byte{1, 2, 3}, true},
+		{"raw string", "abc", BinaryRaw, []byte("abc"), true},
+		{"base64 string", "AQID", BinaryBase64, []byte{1, 2, 3}, true},
+		{"hex string", "010203", BinaryHex, []byte{1, 2, 3}, true},
+		{"invalid hex", "zz", BinaryHex, nil, false},
+		{"int", 42, BinaryRaw, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, ok := toBytes(tt.value, tt.enc)
+			if ok != tt.ok {
+				t.Errorf("expected ok=%v, got ok=%v", tt.ok, ok)
+			}
+			if ok && string(result) != string(tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestFormatBinary(t *testing.T) {
+	data := []byte{0xde, 0xad, 0xbe, 0xef}
+
+	if v, ok := formatBinary(data, BinaryRaw).([]byte); !ok || string(v) != string(data) {
+		t.Errorf("expected raw bytes, got %v", formatBinary(data, BinaryRaw))
+	}
+	if v := formatBinary(data, BinaryBase64); v != "3q2+7w==" {
+		t.Errorf("expected base64 string, got %v", v)
+	}
+	if v := formatBinary(data, BinaryHex); v != "deadbeef" {
+		t.Errorf("expected hex string, got %v", v)
+	}
+}
+
+// allColumnTypes lists every FlatGeobuf column type in enum order.
+var allColumnTypes = []flattypes.ColumnType{
+	flattypes.ColumnTypeByte, flattypes.ColumnTypeUByte, flattypes.ColumnTypeBool,
+	flattypes.ColumnTypeShort, flattypes.ColumnTypeUShort, flattypes.ColumnTypeInt,
+	flattypes.ColumnTypeUInt, flattypes.ColumnTypeLong, flattypes.ColumnTypeULong,
+	flattypes.ColumnTypeFloat, flattypes.ColumnTypeDouble, flattypes.ColumnTypeString,
+	flattypes.ColumnTypeJson, flattypes.ColumnTypeDateTime, flattypes.ColumnTypeBinary,
+}
+
+// newTestHeader builds a header with one column per type, named c0, c1, ...
+func newTestHeader(types ...flattypes.ColumnType) *flattypes.Header {
+	builder := flatbuffers.NewBuilder(256)
+	columns := make([]*writer.Column, len(types))
+	for i, typ := range types {
+		columns[i] = writer.NewColumn(builder).
+			SetName(fmt.Sprintf("c%d", i)).
+			SetType(typ).
+			SetNullable(true)
+	}
+
+	header := writer.NewHeader(builder).SetColumns(columns)
+	builder.Finish(header.Build())
+	return flattypes.GetRootAsHeader(builder.FinishedBytes(), 0)
+}
+
+func TestDecodeProperties_RoundTrip(t *testing.T) {
+	header := newTestHeader(allColumnTypes...)
+	names := make([]string, len(allColumnTypes))
+	for i := range names {
+		names[i] = fmt.Sprintf("c%d", i)
+	}
+
+	props := geojson.Properties{
+		"c0": -3, "c1": 200, "c2": true, "c3": -300, "c4": 60000,
+		"c5": -70000, "c6": 70000, "c7": int64(-1) << 40, "c8": uint64(1) << 63,
+		"c9": float32(1.5), "c10": 2.25, "c11": "text", "c12": map[string]interface{}{"k": "v"},
+		"c13": "2024-01-02T03:04:05Z", "c14": []byte{1, 2, 3},
+	}
+
+	data := mustEncodeProperties(t, props, names, allColumnTypes)
+	decoded, err := decodeProperties(data, header, nil)
+	if err != nil {
+		t.Fatalf("decodeProperties failed: %v", err)
+	}
+
+	if len(decoded) != len(props) {
+		t.Fatalf("expected %d properties, got %d: %v", len(props), len(decoded), decoded)
+	}
+	if decoded["c7"] != int64(-1)<<40 || decoded["c8"] != uint64(1)<<63 {
+		t.Errorf("unexpected integer values: %v, %v", decoded["c7"], decoded["c8"])
+	}
+	if decoded["c11"] != "text" || decoded["c13"] != "2024-01-02T03:04:05Z" {
+		t.Errorf("unexpected string values: %v, %v", decoded["c11"], decoded["c13"])
+	}
+}
+
+func TestDecodeProperties_Corrupt(t *testing.T) {
+	header := newTestHeader(flattypes.ColumnTypeInt, flattypes.ColumnTypeString, flattypes.ColumnTypeBinary)
+
+	tests := []struct {
+		name   string
+		data   []byte
+		column int
+	}{
+		{"truncated index", []byte{0}, -1},
+		{"index out of range", []byte{9, 0, 1, 2, 3, 4}, 9},
+		{"truncated int", []byte{0, 0, 1, 2}, 0},
+		{"truncated string", []byte{1, 0, 'a', 'b'}, 1},
+		{"string length overflow", []byte{1, 0, 0xff, 0xff, 0xff, 0xff, 'a'}, 1},
+		{"binary length overflow", []byte{2, 0, 0xff, 0xff, 0xff, 0xff, 1}, 2},
+		{"corrupt after valid value", []byte{0, 0, 1, 0, 0, 0, 1}, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			props, err := decodeProperties(tt.data, header, nil)
+			if props != nil {
+				t.Errorf("expected no partial properties, got %v", props)
+			}
+			if !errors.Is(err, ErrInvalidData) {
+				t.Fatalf("expected ErrInvalidData, got %v", err)
+			}
+			var propErr *PropertyError
+			if !errors.As(err, &propErr) {
+				t.Fatalf("expected *PropertyError, got %T", err)
+			}
+			if propErr.Column != tt.column {
+				t.Errorf("expected column %d, got %d", tt.column, propErr.Column)
+			}
+			if propErr.Reason == "" {
+				t.Error("expected a reason")
+			}
+		})
+	}
+}
+
+// specProperties is a property buffer laid out as the reference FlatGeobuf
+// implementations (GDAL, flatgeobuf-js) write it for columns Int, String and
+// Json: a uint16 column index followed by the value, with strings prefixed by
+// their uint32 byte length and no terminator.
+var specProperties = []byte{
+	0, 0, 7, 0, 0, 0,
+	1, 0, 6, 0, 0, 0, 'h', 0xc3, 0xa9, 'l', 'l', 'o',
+	2, 0, 7, 0, 0, 0, '{', '"', 'a', '"', ':', '1', '}',
+}
+
+func TestEncodeProperties_SpecLayout(t *testing.T) {
+	names := []string{"c0", "c1", "c2"}
+	types := []flattypes.ColumnType{flattypes.ColumnTypeInt, flattypes.ColumnTypeString, flattypes.ColumnTypeJson}
+	props := geojson.Properties{"c0": 7, "c1": "héllo", "c2": map[string]interface{}{"a": 1}}
+
+	data := mustEncodeProperties(t, props, names, types)
+	if !bytes.Equal(data, specProperties) {
+		t.Errorf("expected spec layout\n%v\ngot\n%v", specProperties, data)
+	}
+}
+
+func TestDecodeProperties_SpecLayout(t *testing.T) {
+	header := newTestHeader(flattypes.ColumnTypeInt, flattypes.ColumnTypeString, flattypes.ColumnTypeJson)
+
+	props, err := decodeProperties(specProperties, header, nil)
+	if err != nil {
+		t.Fatalf("decodeProperties failed: %v", err)
+	}
+	if props["c0"] != int32(7) || props["c1"] != "héllo" {
+		t.Errorf("unexpected values: %v", props)
+	}
+	if m, ok := props["c2"].(map[string]interface{}); !ok || m["a"] != 1.0 {
+		t.Errorf("unexpected json value: %v", props["c2"])
+	}
+}
+
+func TestDecodeProperties_Legacy(t *testing.T) {
+	header := newTestHeader(flattypes.ColumnTypeInt, flattypes.ColumnTypeString, flattypes.ColumnTypeJson)
+
+	// NUL-terminated strings as written by older versions of this package
+	legacy := []byte{
+		0, 0, 7, 0, 0, 0,
+		1, 0, 'a', 'b', 'c', 0,
+		2, 0, '[', '1', ']', 0,
+	}
+
+	props, err := decodeProperties(legacy, header, &ReaderOptions{LegacyStrings: true})
+	if err != nil {
+		t.Fatalf("decodeProperties failed: %v", err)
+	}
+	if props["c0"] != int32(7) || props["c1"] != "abc" {
+		t.Errorf("unexpected values: %v", props)
+	}
+	if arr, ok := props["c2"].([]interface{}); !ok || len(arr) != 1 {
+		t.Errorf("unexpected json value: %v", props["c2"])
+	}
+
+	// Without the option they are corrupt rather than guessed at
+	for _, opts := range []*ReaderOptions{nil, DefaultReaderOptions()} {
+		if _, err := decodeProperties(legacy, header, opts); !errors.Is(err, ErrInvalidData) {
+			t.Errorf("expected ErrInvalidData, got %v", err)
+		}
+	}
+
+	// Forcing the legacy encoding rejects spec buffers
+	if _, err := decodeProperties(specProperties, header, &ReaderOptions{LegacyStrings: true}); !errors.Is(err, ErrInvalidData) {
+		t.Errorf("expected ErrInvalidData, got %v", err)
+	}
+}
+
+func FuzzDecodeProperties(f *testing.F) {
+	header := newTestHeader(allColumnTypes...)
+	names := make([]string, len(allColumnTypes))
+	for i := range names {
+		names[i] = fmt.Sprintf("c%d", i)
+	}
+
+	f.Add(mustEncodeProperties(f, geojson.Properties{"c0": 1, "c11": "abc"}, names, allColumnTypes))
+	f.Add(mustEncodeProperties(f, geojson.Properties{"c12": []interface{}{1, "x"}, "c14": []byte{9}}, names, allColumnTypes))
+	f.Add(mustEncodeProperties(f, geojson.Properties{"c7": 1, "c8": 2, "c9": 3.0, "c10": 4.0}, names, allColumnTypes))
+	f.Add([]byte{})
+	f.Add([]byte{0xff, 0xff})
+	f.Add([]byte{14, 0, 0xff, 0xff, 0xff, 0x7f})
+	for _, feature := range fixtureFeatures(f) {
+		f.Add(feature.PropertiesBytes())
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		props, err := decodeProperties(data, header, nil)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidData) {
+				t.Fatalf("error does not wrap ErrInvalidData: %v", err)
+			}
+			if props != nil {
+				t.Fatalf("partial properties returned with error: %v", props)
+			}
+		}
+	})
+}
@@ -1,44 +1,186 @@
 package flatgeobuf
 
 import (
-	flatgeobuf "github.com/flatgeobuf/flatgeobuf/src/go"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
 	"github.com/flatgeobuf/flatgeobuf/src/go/flattypes"
+	"github.com/flatgeobuf/flatgeobuf/src/go/writer"
+	flatbuffers "github.com/google/flatbuffers/go"
 	"github.com/paulmach/orb"
 	"github.com/paulmach/orb/geojson"
+	"github.com/tingold/orb-flatgeobuf/packedrtree"
 )
 
-// Reader provides read access to a FlatGeobuf file.
+// Reader provides read access to a FlatGeobuf file. Its methods are safe for
+// concurrent use, and Close waits for calls in progress to finish.
 type Reader struct {
-	fgb *flatgeobuf.FlatGeoBuf
+	header *flattypes.Header
+	opts   *ReaderOptions
+
+	data           []byte            // Whole file contents
+	mapped         bool              // Whether data is a mapping owned by the reader
+	props          *propertyDecoder  // Column definitions for decoding properties
+	reproject      *reprojection     // Transforms to ReaderOptions.TargetCRS, nil without one
+	index          *packedrtree.Tree // Spatial index, nil if the file has none
+	featuresOffset int               // Byte offset of the first feature
+
+	mu     sync.RWMutex // Held for reading by operations and for writing by Close
+	closed bool
+
+	scanOnce    sync.Once // Guards the sequential scan below
+	scanOffsets []uint64  // Feature offsets in file order
+	scanErr     error
 }
 
 // NewReader creates a reader from a file path.
-// The file is memory-mapped for efficient access.
+// The file is memory-mapped for efficient access until the reader is closed.
 func NewReader(path string) (*Reader, error) {
-	fgb, err := flatgeobuf.New(path)
+	return NewReaderWithOptions(path, nil)
+}
+
+// NewReaderWithOptions creates a reader from a file path using the given options.
+func NewReaderWithOptions(path string, opts *ReaderOptions) (*Reader, error) {
+	if opts == nil {
+		opts = DefaultReaderOptions()
+	}
+
+	data, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := newReader(data, opts)
+	if err != nil {
+		_ = unmapFile(data)
+		return nil, err
+	}
+	r.mapped = true
+
+	// Release the mapping of readers that are never closed
+	runtime.SetFinalizer(r, (*Reader).Close)
+	return r, nil
+}
+
+// openFile maps the file at path. The file itself is closed straight away;
+// only the mapping is held until it is released with unmapFile.
+func openFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
 
-	return &Reader{fgb: fgb}, nil
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("flatgeobuf: %s is a directory", path)
+	}
+	size := info.Size()
+	if size < int64(len(writer.MagicBytes)) {
+		return nil, fmt.Errorf("%w: file too short", ErrInvalidData)
+	}
+	if size != int64(int(size)) {
+		return nil, fmt.Errorf("flatgeobuf: %s is too large to map", path)
+	}
+
+	data, err := mapFile(f, int(size))
+	if err != nil {
+		return nil, fmt.Errorf("flatgeobuf: mapping %s: %w", path, err)
+	}
+	return data, nil
 }
 
 // NewReaderFromData creates a reader from byte data.
 func NewReaderFromData(data []byte) (*Reader, error) {
-	fgb, err := flatgeobuf.NewWithData(data)
+	return NewReaderFromDataWithOptions(data, nil)
+}
+
+// NewReaderFromDataWithOptions creates a reader from byte data using the given options.
+func NewReaderFromDataWithOptions(data []byte, opts *ReaderOptions) (*Reader, error) {
+	if opts == nil {
+		opts = DefaultReaderOptions()
+	}
+
+	return newReader(data, opts)
+}
+
+// validMagic reports whether prefix starts with the FlatGeobuf magic bytes.
+// The version bytes are not checked, so files from other minor and patch
+// versions are accepted.
+func validMagic(prefix []byte) bool {
+	magic := writer.MagicBytes
+	return len(prefix) >= len(magic) &&
+		bytes.Equal(prefix[:3], magic[:3]) && bytes.Equal(prefix[4:7], magic[4:7])
+}
+
+// newReader parses the header of a file, locating its index and feature data.
+func newReader(data []byte, opts *ReaderOptions) (*Reader, error) {
+	if opts.Validate {
+		if err := validate(data, opts).Err(); err != nil {
+			return nil, err
+		}
+	}
+	if !validMagic(data) {
+		return nil, fmt.Errorf("%w: not a FlatGeobuf file", ErrInvalidData)
+	}
+
+	// Magic bytes and the size-prefixed header precede the index
+	offset := len(writer.MagicBytes)
+	if len(data) < offset+4 {
+		return nil, fmt.Errorf("%w: file too short for header", ErrInvalidData)
+	}
+	headerSize := int(binary.LittleEndian.Uint32(data[offset:]))
+	if headerSize > len(data)-offset-4 {
+		return nil, fmt.Errorf("%w: header size %d exceeds file size", ErrInvalidData, headerSize)
+	}
+	if err := verifyHeader(data[offset+4 : offset+4+headerSize]); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidData, err)
+	}
+	h := flattypes.GetSizePrefixedRootAsHeader(data, flatbuffers.UOffsetT(offset))
+	offset += 4 + headerSize
+
+	r := &Reader{header: h, opts: opts, data: data, props: newPropertyDecoder(h, opts)}
+	reproject, err := newReprojection(headerCRSCode(h), opts.TargetCRS)
 	if err != nil {
 		return nil, err
 	}
+	r.reproject = reproject
 
-	return &Reader{fgb: fgb}, nil
+	if h.IndexNodeSize() > 0 && h.FeaturesCount() > 0 {
+		count := h.FeaturesCount()
+		if count > uint64(len(data)) {
+			return nil, fmt.Errorf("%w: header declares %d features", ErrInvalidData, count)
+		}
+		idx, err := packedrtree.Read(data[offset:], int(count), h.IndexNodeSize())
+		if err != nil {
+			return nil, indexError(err)
+		}
+		r.index = idx
+		offset += len(idx.Bytes())
+	}
+
+	r.featuresOffset = offset
+	return r, nil
 }
 
-// Header returns metadata about the FlatGeobuf file.
+// Header returns metadata about the FlatGeobuf file, or nil if the reader is
+// closed.
 func (r *Reader) Header() *Header {
-	h := r.fgb.Header()
-	if h == nil {
+	if r.acquire() != nil {
 		return nil
 	}
+	defer r.release()
+
+	h := r.header
 
 	header := &Header{
 		Name:          string(h.Name()),
@@ -68,6 +210,19 @@ func (r *Reader) Header() *Header {
 			Code:        int(crs.Code()),
 			Name:        string(crs.Name()),
 			Description: string(crs.Description()),
+			WKT:         string(crs.Wkt()),
+		}
+	}
+
+	// Reprojected files report the target CRS and the envelope in it
+	if r.reproject != nil {
+		header.CRS = r.reproject.crs
+		if envLen >= 4 {
+			b := reprojectBound(orb.Bound{
+				Min: orb.Point{header.Envelope[0], header.Envelope[1]},
+				Max: orb.Point{header.Envelope[2], header.Envelope[3]},
+			}, r.reproject.forward)
+			header.Envelope = [4]float64{b.Min[0], b.Min[1], b.Max[0], b.Max[1]}
 		}
 	}
 
@@ -84,6 +239,8 @@ func (r *Reader) Header() *Header {
 					Title:       string(col.Title()),
 					Description: string(col.Description()),
 					Nullable:    col.Nullable(),
+					Width:       int(col.Width()),
+					Precision:   int(col.Precision()),
 				})
 			}
 		}
@@ -92,45 +249,290 @@ func (r *Reader) Header() *Header {
 	return header
 }
 
-// ReadAll reads all features as a FeatureCollection.
+// ReadAll reads all features as a FeatureCollection, in file order.
+// Files without a spatial index are read by scanning the feature data.
 func (r *Reader) ReadAll() (*geojson.FeatureCollection, error) {
+	if err := r.acquire(); err != nil {
+		return nil, err
+	}
+	defer r.release()
+
+	offsets, err := r.fileOffsets()
+	if err != nil {
+		return nil, err
+	}
+	return r.readFeatures(offsets)
+}
+
+// FeatureAt returns the feature with ordinal i. With a spatial index,
+// ordinals follow the index leaves (Hilbert order); without one they follow
+// the order of features in the file. It returns ErrOutOfRange if there is no
+// such feature, and a nil feature if the feature has no usable geometry.
+func (r *Reader) FeatureAt(i int) (*geojson.Feature, error) {
+	if err := r.acquire(); err != nil {
+		return nil, err
+	}
+	defer r.release()
+
+	offsets, err := r.ordinalOffsets(i, i+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(offsets) == 0 {
+		return nil, fmt.Errorf("%w: %d", ErrOutOfRange, i)
+	}
+	return r.readFeature(offsets[0])
+}
+
+// FeaturesRange returns the features with ordinals in [start, end), in ordinal
+// order as for FeatureAt. An end past the last feature is clamped, so paging
+// past the end yields an empty collection. Features without a usable geometry
+// are skipped.
+func (r *Reader) FeaturesRange(start, end int) (*geojson.FeatureCollection, error) {
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("%w: range [%d, %d)", ErrOutOfRange, start, end)
+	}
+	if err := r.acquire(); err != nil {
+		return nil, err
+	}
+	defer r.release()
+
+	offsets, err := r.ordinalOffsets(start, end)
+	if err != nil {
+		return nil, err
+	}
+	return r.readFeatures(offsets)
+}
+
+// ordinalOffsets returns the offsets of the features with ordinals in
+// [start, end), clamped to the number of features.
+func (r *Reader) ordinalOffsets(start, end int) ([]uint64, error) {
+	if start < 0 {
+		return nil, fmt.Errorf("%w: %d", ErrOutOfRange, start)
+	}
+
+	if r.index != nil {
+		if end > r.index.NumItems() {
+			end = r.index.NumItems()
+		}
+		if start >= end {
+			return nil, nil
+		}
+
+		offsets := make([]uint64, 0, end-start)
+		for i := start; i < end; i++ {
+			offsets = append(offsets, r.index.Leaf(i).Offset)
+		}
+		return offsets, nil
+	}
+
+	offsets, err := r.fileOffsets()
+	if err != nil {
+		return nil, err
+	}
+	if end > len(offsets) {
+		end = len(offsets)
+	}
+	if start >= end {
+		return nil, nil
+	}
+	return offsets[start:end], nil
+}
+
+// fileOffsets returns the offsets of all features in file order, scanning the
+// size prefixes of the feature data once and caching the result.
+func (r *Reader) fileOffsets() ([]uint64, error) {
+	r.scanOnce.Do(func() {
+		r.scanOffsets, r.scanErr = scanFeatureOffsets(r.data[r.featuresOffset:], r.header.FeaturesCount())
+	})
+	return r.scanOffsets, r.scanErr
+}
+
+// scanFeatureOffsets walks size-prefixed features in data, returning the
+// offset of each. A count of 0 means the number of features is unknown and
+// the scan runs to the end of data.
+func scanFeatureOffsets(data []byte, count uint64) ([]uint64, error) {
+	var offsets []uint64
+	if count > 0 && count <= uint64(len(data)/4) {
+		offsets = make([]uint64, 0, count)
+	}
+
+	offset := 0
+	for offset < len(data) && (count == 0 || uint64(len(offsets)) < count) {
+		if len(data)-offset < 4 {
+			return nil, fmt.Errorf("%w: truncated feature size at offset %d", ErrInvalidData, offset)
+		}
+		size := int(binary.LittleEndian.Uint32(data[offset:]))
+		if size > len(data)-offset-4 {
+			return nil, fmt.Errorf("%w: feature at offset %d exceeds file size", ErrInvalidData, offset)
+		}
+		offsets = append(offsets, uint64(offset))
+		offset += 4 + size
+	}
+
+	if count > 0 && uint64(len(offsets)) < count {
+		return nil, fmt.Errorf("%w: header declares %d features, found %d", ErrInvalidData, count, len(offsets))
+	}
+	return offsets, nil
+}
+
+// decodeBatchSize is the number of features a decoding goroutine takes at a
+// time, large enough to amortize the coordination.
+const decodeBatchSize = 256
+
+// readFeatures decodes the features at offsets, skipping those without a
+// usable geometry. With ReaderOptions.Concurrency set, batches of features
+// are decoded in parallel; the result keeps the order of offsets either way.
+func (r *Reader) readFeatures(offsets []uint64) (*geojson.FeatureCollection, error) {
+	var features []*geojson.Feature
+	var err error
+	if workers := r.concurrency(); workers > 1 && len(offsets) > decodeBatchSize {
+		features, err = r.decodeParallel(offsets, workers)
+	} else {
+		features, err = r.decodeSequential(offsets)
+	}
+	if err != nil {
+		return nil, err
+	}
+
 	fc := geojson.NewFeatureCollection()
-	h := r.fgb.Header()
+	fc.Features = make([]*geojson.Feature, 0, len(features))
+	for _, feature := range features {
+		if feature != nil {
+			fc.Append(feature)
+		}
+	}
+	return fc, nil
+}
 
-	featuresCount := h.FeaturesCount()
-	if featuresCount == 0 {
-		return fc, nil
+// concurrency returns the number of decoding goroutines to use.
+func (r *Reader) concurrency() int {
+	if r.opts == nil {
+		return 1
+	}
+	if r.opts.Concurrency < 0 {
+		return runtime.GOMAXPROCS(0)
 	}
+	return r.opts.Concurrency
+}
 
-	// If we have an index, we can use Search with full bounds
-	if h.IndexNodeSize() > 0 {
-		// Get the envelope from header
-		envLen := h.EnvelopeLength()
-		if envLen >= 4 {
-			minX := h.Envelope(0)
-			minY := h.Envelope(1)
-			maxX := h.Envelope(2)
-			maxY := h.Envelope(3)
-
-			features, err := r.fgb.Search(minX, minY, maxX, maxY)
-			if err != nil {
-				return nil, err
-			}
+// decodeSequential decodes the features at offsets in order. Features
+// without a usable geometry are nil.
+func (r *Reader) decodeSequential(offsets []uint64) ([]*geojson.Feature, error) {
+	features := make([]*geojson.Feature, len(offsets))
+	for i, offset := range offsets {
+		feature, err := r.readFeature(offset)
+		if err != nil {
+			return nil, err
+		}
+		features[i] = feature
+	}
+	return features, nil
+}
+
+// decodeParallel decodes the features at offsets using workers goroutines
+// that take batches in order. After an error, later batches are skipped but
+// earlier ones still finish, so the error returned is the one a sequential
+// read would have met first.
+func (r *Reader) decodeParallel(offsets []uint64, workers int) ([]*geojson.Feature, error) {
+	features := make([]*geojson.Feature, len(offsets))
+	batches := (len(offsets) + decodeBatchSize - 1) / decodeBatchSize
+	if workers > batches {
+		workers = batches
+	}
+
+	errs := make([]error, batches)
+	var next atomic.Int64
+	var failed atomic.Int64 // Lowest failed batch, or batches if none
+	failed.Store(int64(batches))
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				batch := next.Add(1) - 1
+				if batch >= failed.Load() {
+					return
+				}
 
-			for _, fgbFeature := range features {
-				feature := convertFeature(fgbFeature, h)
-				if feature != nil {
-					fc.Append(feature)
+				start := int(batch) * decodeBatchSize
+				end := start + decodeBatchSize
+				if end > len(offsets) {
+					end = len(offsets)
+				}
+				for i := start; i < end; i++ {
+					feature, err := r.readFeature(offsets[i])
+					if err != nil {
+						errs[batch] = err
+						for f := failed.Load(); batch < f && !failed.CompareAndSwap(f, batch); f = failed.Load() {
+						}
+						break
+					}
+					features[i] = feature
 				}
 			}
+		}()
+	}
+	wg.Wait()
 
-			return fc, nil
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
 		}
 	}
+	return features, nil
+}
 
-	// Without index or envelope, we can't iterate features
-	// This is a limitation of the official Go implementation
-	return fc, nil
+// Bounds returns the bound of all features. It comes from the header
+// envelope, or for files without one from the spatial index or, failing that,
+// a scan of the features' coordinates. Files without coordinates, or whose
+// features cannot be scanned, give an empty bound for which IsEmpty reports
+// true. A closed reader also gives an empty bound.
+func (r *Reader) Bounds() orb.Bound {
+	if r.acquire() != nil {
+		return emptyBound
+	}
+	defer r.release()
+
+	if r.reproject != nil {
+		return reprojectBound(r.storedBounds(), r.reproject.forward)
+	}
+	return r.storedBounds()
+}
+
+// storedBounds returns the bound of all features in the file's coordinates.
+func (r *Reader) storedBounds() orb.Bound {
+	h := r.header
+	if h.EnvelopeLength() >= 4 {
+		b := orb.Bound{
+			Min: orb.Point{h.Envelope(0), h.Envelope(1)},
+			Max: orb.Point{h.Envelope(2), h.Envelope(3)},
+		}
+		// Comparisons with NaN are false, so this also rejects NaN envelopes
+		if b.Min[0] <= b.Max[0] && b.Min[1] <= b.Max[1] {
+			return b
+		}
+	}
+
+	if r.index != nil {
+		return r.index.Extent()
+	}
+
+	offsets, err := r.fileOffsets()
+	if err != nil {
+		return emptyBound
+	}
+	bound := emptyBound
+	for _, offset := range offsets {
+		f, err := r.rawFeature(offset)
+		if err != nil {
+			return emptyBound
+		}
+		bound = bound.Union(featureBound(f))
+	}
+	return bound
 }
 
 // ReadGeometries reads all geometries without properties.
@@ -153,26 +555,28 @@ func (r *Reader) ReadGeometries() ([]orb.Geometry, error) {
 // Search performs a spatial query using the built-in index.
 // Returns features whose bounding boxes intersect the query bounds.
 func (r *Reader) Search(bounds orb.Bound) (*geojson.FeatureCollection, error) {
-	h := r.fgb.Header()
+	if err := r.acquire(); err != nil {
+		return nil, err
+	}
+	defer r.release()
 
-	if h.IndexNodeSize() == 0 {
+	if r.header.IndexNodeSize() == 0 {
 		return nil, ErrNoIndex
 	}
+	if r.index == nil {
+		return geojson.NewFeatureCollection(), nil
+	}
 
-	features, err := r.fgb.Search(bounds.Min[0], bounds.Min[1], bounds.Max[0], bounds.Max[1])
+	hits, err := r.index.Search(r.fileBound(bounds))
 	if err != nil {
-		return nil, err
+		return nil, indexError(err)
 	}
 
-	fc := geojson.NewFeatureCollection()
-	for _, fgbFeature := range features {
-		feature := convertFeature(fgbFeature, h)
-		if feature != nil {
-			fc.Append(feature)
-		}
+	offsets := make([]uint64, len(hits))
+	for i, hit := range hits {
+		offsets[i] = hit.Offset
 	}
-
-	return fc, nil
+	return r.readFeatures(offsets)
 }
 
 // SearchGeometries performs a spatial query returning only geometries.
@@ -192,45 +596,256 @@ func (r *Reader) SearchGeometries(bounds orb.Bound) ([]orb.Geometry, error) {
 	return geometries, nil
 }
 
-// Close releases resources associated with the reader.
-// This is important for memory-mapped files.
+// SearchMany performs several spatial queries in one pass over the index.
+// The result holds one FeatureCollection per query, in the order of bounds,
+// with the features whose bounding boxes intersect that query. Each matching
+// feature is decoded once: a feature matching several queries appears in each
+// of their collections as the same *geojson.Feature.
+func (r *Reader) SearchMany(bounds []orb.Bound) ([]*geojson.FeatureCollection, error) {
+	if err := r.acquire(); err != nil {
+		return nil, err
+	}
+	defer r.release()
+
+	if r.index == nil {
+		return nil, ErrNoIndex
+	}
+
+	if r.reproject != nil {
+		fileBounds := make([]orb.Bound, len(bounds))
+		for i, b := range bounds {
+			fileBounds[i] = r.fileBound(b)
+		}
+		bounds = fileBounds
+	}
+	hits, err := r.index.SearchMany(bounds)
+	if err != nil {
+		return nil, indexError(err)
+	}
+
+	decoded := make(map[int]*geojson.Feature)
+	results := make([]*geojson.FeatureCollection, len(bounds))
+	for i, group := range hits {
+		fc := geojson.NewFeatureCollection()
+		for _, hit := range group {
+			feature, ok := decoded[hit.Index]
+			if !ok {
+				feature, err = r.readFeature(hit.Offset)
+				if err != nil {
+					return nil, err
+				}
+				decoded[hit.Index] = feature
+			}
+			if feature != nil {
+				fc.Append(feature)
+			}
+		}
+		results[i] = fc
+	}
+
+	return results, nil
+}
+
+// IndexHit is a feature matched by an index-only query.
+type IndexHit struct {
+	Offset       uint64    // Byte offset of the feature from the start of the feature data
+	Bound        orb.Bound // Bounding box of the feature as stored in the index (reprojected with TargetCRS)
+	FeatureIndex int       // Position of the feature among the index leaves
+}
+
+// SearchIndex returns the index entries of the features whose bounding boxes
+// intersect bounds, ordered by offset, without decoding any features.
+func (r *Reader) SearchIndex(bounds orb.Bound) ([]IndexHit, error) {
+	if err := r.acquire(); err != nil {
+		return nil, err
+	}
+	defer r.release()
+
+	if r.index == nil {
+		return nil, ErrNoIndex
+	}
+
+	hits, err := r.index.Search(r.fileBound(bounds))
+	if err != nil {
+		return nil, indexError(err)
+	}
+
+	result := make([]IndexHit, len(hits))
+	for i, hit := range hits {
+		result[i] = IndexHit{Offset: hit.Offset, Bound: r.targetBound(hit.Bound), FeatureIndex: hit.Index}
+	}
+	return result, nil
+}
+
+// Count returns the number of features whose bounding boxes intersect bounds,
+// using only the index.
+func (r *Reader) Count(bounds orb.Bound) (int, error) {
+	if err := r.acquire(); err != nil {
+		return 0, err
+	}
+	defer r.release()
+
+	if r.index == nil {
+		return 0, ErrNoIndex
+	}
+
+	count := 0
+	err := r.index.Visit([]orb.Bound{r.fileBound(bounds)}, func(int, packedrtree.Hit) { count++ })
+	if err != nil {
+		return 0, indexError(err)
+	}
+	return count, nil
+}
+
+// Close releases the reader's resources, unmapping files opened with
+// NewReader, once calls in progress have finished. Later calls return
+// ErrClosed. Closing a reader more than once is a no-op.
 func (r *Reader) Close() error {
-	// The FlatGeoBuf type doesn't expose a public Close method,
-	// but the finalizer will clean up when garbage collected.
-	// Setting to nil allows GC to collect it.
-	r.fgb = nil
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+
+	// The index and header alias data
+	data := r.data
+	r.header = nil
+	r.data = nil
+	r.index = nil
+	r.scanOffsets = nil
+	if !r.mapped {
+		return nil
+	}
+	runtime.SetFinalizer(r, nil)
+	return unmapFile(data)
+}
+
+// acquire holds off Close until the matching release, or returns ErrClosed
+// if the reader is already closed. Exported methods acquire the reader
+// unless they only call other exported methods, so acquisitions never nest.
+func (r *Reader) acquire() error {
+	r.mu.RLock()
+	if r.closed {
+		r.mu.RUnlock()
+		return ErrClosed
+	}
 	return nil
 }
 
-// convertFeature converts a FlatGeobuf feature to a geojson.Feature.
-func convertFeature(fgbFeature *flattypes.Feature, header *flattypes.Header) *geojson.Feature {
+// release ends an operation started with acquire.
+func (r *Reader) release() {
+	r.mu.RUnlock()
+}
+
+// indexError reports a corrupt spatial index as ErrInvalidData.
+func indexError(err error) error {
+	if errors.Is(err, packedrtree.ErrInvalidTree) {
+		return fmt.Errorf("%w: %w", ErrInvalidData, err)
+	}
+	return err
+}
+
+// rawFeature returns the feature stored at offset bytes into the feature data.
+func (r *Reader) rawFeature(offset uint64) (*flattypes.Feature, error) {
+	start := uint64(r.featuresOffset) + offset
+	if start > uint64(len(r.data)) || uint64(len(r.data))-start < 4 {
+		return nil, fmt.Errorf("%w: feature offset %d out of range", ErrInvalidData, offset)
+	}
+	size := binary.LittleEndian.Uint32(r.data[start:])
+	if uint64(size) > uint64(len(r.data))-start-4 {
+		return nil, fmt.Errorf("%w: feature at offset %d exceeds file size", ErrInvalidData, offset)
+	}
+	if err := verifyFeature(r.data[start+4 : start+4+uint64(size)]); err != nil {
+		return nil, fmt.Errorf("%w: feature at offset %d: %v", ErrInvalidData, offset, err)
+	}
+	return flattypes.GetSizePrefixedRootAsFeature(r.data, flatbuffers.UOffsetT(start)), nil
+}
+
+// readFeature decodes the feature stored at offset bytes into the feature data.
+func (r *Reader) readFeature(offset uint64) (*geojson.Feature, error) {
+	fgbFeature, err := r.rawFeature(offset)
+	if err != nil {
+		return nil, err
+	}
+	feature, err := convertFeature(fgbFeature, int64(offset), r.header, r.props)
+	if err == nil && r.reproject != nil {
+		r.reproject.apply(feature)
+	}
+	return feature, err
+}
+
+// fileBound returns a query bound given in the reader's coordinates, which
+// are those of ReaderOptions.TargetCRS if set, in the file's coordinates.
+func (r *Reader) fileBound(b orb.Bound) orb.Bound {
+	if r.reproject == nil {
+		return b
+	}
+	return reprojectBound(b, r.reproject.inverse)
+}
+
+// targetBound returns a bound in the file's coordinates in the reader's.
+func (r *Reader) targetBound(b orb.Bound) orb.Bound {
+	if r.reproject == nil {
+		return b
+	}
+	return reprojectBound(b, r.reproject.forward)
+}
+
+// convertFeature converts a FlatGeobuf feature to a geojson.Feature. Offset is
+// that of the feature from the start of the feature data, for errors. It
+// returns a nil feature for features without a usable geometry.
+func convertFeature(fgbFeature *flattypes.Feature, offset int64, header *flattypes.Header, decoder *propertyDecoder) (*geojson.Feature, error) {
 	if fgbFeature == nil {
-		return nil
+		return nil, nil
 	}
 
 	// Convert geometry
 	var geomObj flattypes.Geometry
 	geom := fgbFeature.Geometry(&geomObj)
 	if geom == nil {
-		return nil
+		return nil, nil
 	}
 
-	orbGeom := geometryFromFGB(geom)
-	if orbGeom == nil {
-		return nil
+	// Geometries may omit their type when the header declares one
+	geomType := geom.Type()
+	if geomType == flattypes.GeometryTypeUnknown {
+		geomType = header.GeometryType()
 	}
 
-	feature := geojson.NewFeature(orbGeom)
+	orbGeom, err := geometryFromFGBType(geom, geomType)
+	if err != nil {
+		return nil, fmt.Errorf("geometry of feature at offset %d: %w", offset, err)
+	}
+	if orbGeom == nil {
+		return nil, nil
+	}
 
-	// Convert properties
-	propsLen := fgbFeature.PropertiesLength()
-	if propsLen > 0 && header.ColumnsLength() > 0 {
-		propsBytes := make([]byte, propsLen)
-		for i := 0; i < propsLen; i++ {
-			propsBytes[i] = byte(fgbFeature.Properties(i))
+	// Convert properties. Decoded values never alias the buffer, so it is
+	// read in place.
+	var props geojson.Properties
+	propsBytes := fgbFeature.PropertiesBytes()
+	if len(propsBytes) > 0 && header.ColumnsLength() > 0 {
+		props, err = decoder.decode(propsBytes)
+		if err != nil {
+			var propErr *PropertyError
+			if errors.As(err, &propErr) {
+				propErr.FeatureOffset = offset
+			}
+			return nil, err
 		}
-		feature.Properties = decodeProperties(propsBytes, header)
 	}
+	if props == nil {
+		props = make(geojson.Properties)
+	}
+
+	if decoder.opts != nil && decoder.opts.IncludeNullColumns {
+		decoder.fillNull(props)
+	}
+
+	// Built directly rather than with geojson.NewFeature, whose empty
+	// properties map would be replaced straight away
+	feature := &geojson.Feature{Type: "Feature", Geometry: orbGeom, Properties: props}
 
-	return feature
+	return feature, nil
 }
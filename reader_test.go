@@ -1,10 +1,22 @@
 package flatgeobuf
 
 import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/flatgeobuf/flatgeobuf/src/go/flattypes"
+	"github.com/flatgeobuf/flatgeobuf/src/go/writer"
+	flatbuffers "github.com/google/flatbuffers/go"
 	"github.com/paulmach/orb"
 	"github.com/paulmach/orb/geojson"
 )
@@ -329,6 +341,182 @@ func TestReader_Close(t *testing.T) {
 	}
 }
 
+// writeTempFile writes fc with an index to a file in a temporary directory.
+func writeTempFile(t *testing.T, fc *geojson.FeatureCollection) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := WriteFeatures(&buf, fc, &Options{IncludeIndex: true}); err != nil {
+		t.Fatalf("WriteFeatures failed: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "data.fgb")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	return path
+}
+
+func TestReader_UseAfterClose(t *testing.T) {
+	fc := geojson.NewFeatureCollection()
+	fc.Append(geojson.NewFeature(orb.Point{1, 2}))
+	path := writeTempFile(t, fc)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	open := map[string]func() (*Reader, error){
+		"file": func() (*Reader, error) { return NewReader(path) },
+		"data": func() (*Reader, error) { return NewReaderFromData(data) },
+	}
+	for name, open := range open {
+		t.Run(name, func(t *testing.T) {
+			reader, err := open()
+			if err != nil {
+				t.Fatalf("open failed: %v", err)
+			}
+			if err := reader.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+			if err := reader.Close(); err != nil {
+				t.Errorf("second Close failed: %v", err)
+			}
+
+			query := orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{2, 2}}
+			calls := map[string]func() error{
+				"ReadAll":          func() error { _, err := reader.ReadAll(); return err },
+				"ReadGeometries":   func() error { _, err := reader.ReadGeometries(); return err },
+				"FeatureAt":        func() error { _, err := reader.FeatureAt(0); return err },
+				"FeaturesRange":    func() error { _, err := reader.FeaturesRange(0, 1); return err },
+				"Search":           func() error { _, err := reader.Search(query); return err },
+				"SearchGeometries": func() error { _, err := reader.SearchGeometries(query); return err },
+				"SearchMany":       func() error { _, err := reader.SearchMany([]orb.Bound{query}); return err },
+				"SearchIndex":      func() error { _, err := reader.SearchIndex(query); return err },
+				"SearchGeometry":   func() error { _, err := reader.SearchGeometry(query, Intersects); return err },
+				"Count":            func() error { _, err := reader.Count(query); return err },
+				"Nearest":          func() error { _, err := reader.Nearest(orb.Point{1, 2}, 1, 0); return err },
+			}
+			for call, fn := range calls {
+				if err := fn(); !errors.Is(err, ErrClosed) {
+					t.Errorf("%s: expected ErrClosed, got %v", call, err)
+				}
+			}
+			if h := reader.Header(); h != nil {
+				t.Errorf("expected nil header, got %+v", h)
+			}
+			if b := reader.Bounds(); !b.IsEmpty() {
+				t.Errorf("expected empty bounds, got %v", b)
+			}
+		})
+	}
+}
+
+// mappings returns the number of memory mappings of path in this process,
+// skipping the test where /proc is unavailable.
+func mappings(t *testing.T, path string) int {
+	t.Helper()
+
+	maps, err := os.ReadFile("/proc/self/maps")
+	if err != nil {
+		t.Skip("/proc/self/maps not available")
+	}
+	return bytes.Count(maps, []byte(path))
+}
+
+// openFiles returns the number of open file descriptors of this process.
+func openFiles(t *testing.T) int {
+	t.Helper()
+
+	fds, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skip("/proc/self/fd not available")
+	}
+	return len(fds)
+}
+
+func TestReader_CloseReleasesFiles(t *testing.T) {
+	fc := geojson.NewFeatureCollection()
+	for i := 0; i < 100; i++ {
+		fc.Append(geojson.NewFeature(orb.Point{float64(i), float64(i)}))
+	}
+	path := writeTempFile(t, fc)
+
+	mapped, fds := mappings(t, path), openFiles(t)
+
+	reader, err := NewReader(path)
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	if n := mappings(t, path); n <= mapped {
+		t.Fatalf("expected the file to be mapped while open")
+	}
+	if n := openFiles(t); n != fds {
+		t.Errorf("expected no file descriptor to be held, got %d more", n-fds)
+	}
+	_ = reader.Close()
+
+	for i := 0; i < 5000; i++ {
+		reader, err := NewReader(path)
+		if err != nil {
+			t.Fatalf("NewReader %d failed: %v", i, err)
+		}
+		if _, err := reader.FeatureAt(i % 100); err != nil {
+			t.Fatalf("FeatureAt failed: %v", err)
+		}
+		if err := reader.Close(); err != nil {
+			t.Fatalf("Close %d failed: %v", i, err)
+		}
+	}
+
+	if n := mappings(t, path); n != mapped {
+		t.Errorf("expected %d mappings after closing, got %d", mapped, n)
+	}
+	if n := openFiles(t); n != fds {
+		t.Errorf("expected %d open files after closing, got %d", fds, n)
+	}
+
+	// The file can be replaced once its readers are closed
+	if err := os.Rename(path, path+".old"); err != nil {
+		t.Errorf("Rename failed: %v", err)
+	}
+}
+
+func TestReader_CloseDuringReads(t *testing.T) {
+	path := writeTempFile(t, concurrentFeatures(1000))
+	reader, err := NewReaderWithOptions(path, &ReaderOptions{Concurrency: 2})
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+
+	// Calls racing with Close either complete or report ErrClosed; none
+	// reads the mapping after it is released
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if _, err := reader.ReadAll(); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := reader.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if !errors.Is(err, ErrClosed) {
+			t.Errorf("expected ErrClosed, got %v", err)
+		}
+	}
+}
+
 func TestHeader_ColumnInfo(t *testing.T) {
 	tmpDir := t.TempDir()
 	tmpFile := filepath.Join(tmpDir, "test_columns.fgb")
@@ -388,3 +576,889 @@ func TestNewReader_NonExistent(t *testing.T) {
 		t.Error("expected error for non-existent file")
 	}
 }
+
+func TestRoundTrip_BinaryProperty(t *testing.T) {
+	thumbnail := []byte{0x89, 0x50, 0x4e, 0x47, 0x00, 0x01}
+
+	fc := geojson.NewFeatureCollection()
+	f := geojson.NewFeature(orb.Point{1, 2})
+	f.Properties = geojson.Properties{"thumbnail": thumbnail}
+	fc.Append(f)
+
+	var buf bytes.Buffer
+	if err := WriteFeatures(&buf, fc, &Options{IncludeIndex: true}); err != nil {
+		t.Fatalf("WriteFeatures failed: %v", err)
+	}
+	data := buf.Bytes()
+
+	reader, err := NewReaderFromData(data)
+	if err != nil {
+		t.Fatalf("NewReaderFromData failed: %v", err)
+	}
+
+	header := reader.Header()
+	if len(header.Columns) != 1 || header.Columns[0].Type != "Binary" {
+		t.Fatalf("expected a single Binary column, got %+v", header.Columns)
+	}
+
+	result, err := reader.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if len(result.Features) != 1 {
+		t.Fatalf("expected 1 feature, got %d", len(result.Features))
+	}
+
+	got, ok := result.Features[0].Properties["thumbnail"].([]byte)
+	if !ok || !bytes.Equal(got, thumbnail) {
+		t.Fatalf("expected %v, got %v", thumbnail, result.Features[0].Properties["thumbnail"])
+	}
+
+	// The decoded value must not alias the source buffer
+	for i := range data {
+		data[i] = 0
+	}
+	if !bytes.Equal(got, thumbnail) {
+		t.Error("decoded binary value aliases the input buffer")
+	}
+}
+
+func TestRoundTrip_BinaryPropertyEncoding(t *testing.T) {
+	fc := geojson.NewFeatureCollection()
+	f := geojson.NewFeature(orb.Point{1, 2})
+	f.Properties = geojson.Properties{"blob": []byte{0xca, 0xfe}}
+	fc.Append(f)
+
+	var buf bytes.Buffer
+	if err := WriteFeatures(&buf, fc, &Options{IncludeIndex: true}); err != nil {
+		t.Fatalf("WriteFeatures failed: %v", err)
+	}
+
+	tests := []struct {
+		enc      BinaryEncoding
+		expected string
+	}{
+		{BinaryBase64, "yv4="},
+		{BinaryHex, "cafe"},
+	}
+
+	for _, tt := range tests {
+		reader, err := NewReaderFromDataWithOptions(buf.Bytes(), &ReaderOptions{BinaryEncoding: tt.enc})
+		if err != nil {
+			t.Fatalf("NewReaderFromDataWithOptions failed: %v", err)
+		}
+
+		result, err := reader.ReadAll()
+		if err != nil {
+			t.Fatalf("ReadAll failed: %v", err)
+		}
+
+		got := result.Features[0].Properties["blob"]
+		if got != tt.expected {
+			t.Errorf("encoding %d: expected %q, got %v", tt.enc, tt.expected, got)
+		}
+
+		out, err := json.Marshal(result.Features[0])
+		if err != nil {
+			t.Fatalf("json.Marshal failed: %v", err)
+		}
+		if !bytes.Contains(out, []byte(`"blob":"`+tt.expected+`"`)) {
+			t.Errorf("expected GeoJSON to contain %q, got %s", tt.expected, out)
+		}
+	}
+}
+
+func TestRoundTrip_BinaryThroughStrings(t *testing.T) {
+	fc := geojson.NewFeatureCollection()
+	f := geojson.NewFeature(orb.Point{1, 2})
+	f.Properties = geojson.Properties{"blob": []byte{0xca, 0xfe, 0x00}}
+	fc.Append(f)
+
+	var src bytes.Buffer
+	if err := WriteFeatures(&src, fc, &Options{IncludeIndex: true}); err != nil {
+		t.Fatalf("WriteFeatures failed: %v", err)
+	}
+	reader, err := NewReaderFromDataWithOptions(src.Bytes(), &ReaderOptions{BinaryEncoding: BinaryBase64})
+	if err != nil {
+		t.Fatalf("NewReaderFromDataWithOptions failed: %v", err)
+	}
+	defer reader.Close()
+	exported, err := reader.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	var geoJSON bytes.Buffer
+	if err := FlatGeobufToGeoJSON(bytes.NewReader(src.Bytes()), &geoJSON, GeoJSONCollection, &ReaderOptions{BinaryEncoding: BinaryBase64}); err != nil {
+		t.Fatalf("FlatGeobufToGeoJSON failed: %v", err)
+	}
+
+	blob := func(t *testing.T, data []byte) interface{} {
+		t.Helper()
+		r, err := NewReaderFromData(data)
+		if err != nil {
+			t.Fatalf("NewReaderFromData failed: %v", err)
+		}
+		defer r.Close()
+		result, err := r.ReadAll()
+		if err != nil {
+			t.Fatalf("ReadAll failed: %v", err)
+		}
+		return result.Features[0].Properties["blob"]
+	}
+
+	// The exported strings are only decoded back into a Binary column given
+	// explicitly; inferred, it is a String column
+	restore := &Options{Columns: reader.Header().Columns, BinaryEncoding: BinaryBase64}
+	for _, opts := range []*Options{restore, {BinaryEncoding: BinaryBase64}} {
+		var viaFeatures, viaConvert bytes.Buffer
+		if err := WriteFeatures(&viaFeatures, exported, opts); err != nil {
+			t.Fatalf("WriteFeatures failed: %v", err)
+		}
+		if err := GeoJSONToFlatGeobuf(bytes.NewReader(geoJSON.Bytes()), &viaConvert, &ConvertOptions{Write: opts}); err != nil {
+			t.Fatalf("GeoJSONToFlatGeobuf failed: %v", err)
+		}
+		var want interface{} = "yv4A"
+		if opts.Columns != nil {
+			want = []byte{0xca, 0xfe, 0x00}
+		}
+		for name, data := range map[string][]byte{"WriteFeatures": viaFeatures.Bytes(), "GeoJSONToFlatGeobuf": viaConvert.Bytes()} {
+			if got := blob(t, data); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s with columns %v: got %#v, want %#v", name, opts.Columns != nil, got, want)
+			}
+		}
+	}
+}
+
+func TestReadAll_IncludeNullColumns(t *testing.T) {
+	fc := geojson.NewFeatureCollection()
+	f1 := geojson.NewFeature(orb.Point{1, 2})
+	f1.Properties = geojson.Properties{"name": "a", "height": 12.5}
+	fc.Append(f1)
+	f2 := geojson.NewFeature(orb.Point{3, 4})
+	f2.Properties = geojson.Properties{"name": "b"}
+	fc.Append(f2)
+	fc.Append(geojson.NewFeature(orb.Point{5, 6}))
+
+	var buf bytes.Buffer
+	if err := WriteFeatures(&buf, fc, &Options{IncludeIndex: true}); err != nil {
+		t.Fatalf("WriteFeatures failed: %v", err)
+	}
+
+	reader, err := NewReaderFromData(buf.Bytes())
+	if err != nil {
+		t.Fatalf("NewReaderFromData failed: %v", err)
+	}
+	result, err := reader.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	absent := 0
+	for _, f := range result.Features {
+		if _, ok := f.Properties["height"]; !ok {
+			absent++
+		}
+	}
+	if absent != 2 {
+		t.Errorf("expected height to be absent from 2 features by default, got %d", absent)
+	}
+
+	reader, err = NewReaderFromDataWithOptions(buf.Bytes(), &ReaderOptions{IncludeNullColumns: true})
+	if err != nil {
+		t.Fatalf("NewReaderFromDataWithOptions failed: %v", err)
+	}
+	result, err = reader.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	for _, f := range result.Features {
+		for _, name := range []string{"name", "height"} {
+			if _, ok := f.Properties[name]; !ok {
+				t.Errorf("expected %q key on every feature, got %v", name, f.Properties)
+			}
+		}
+	}
+}
+
+func TestReadAll_CorruptProperties(t *testing.T) {
+	fc := geojson.NewFeatureCollection()
+	f := geojson.NewFeature(orb.Point{0, 0})
+	f.Properties = geojson.Properties{"name": "intact"}
+	fc.Append(f)
+	f = geojson.NewFeature(orb.Point{1, 2})
+	f.Properties = geojson.Properties{"name": "corrupt-me"}
+	fc.Append(f)
+
+	var buf bytes.Buffer
+	if err := WriteFeatures(&buf, fc, &Options{IncludeIndex: true}); err != nil {
+		t.Fatalf("WriteFeatures failed: %v", err)
+	}
+
+	// Inflate the string length so the value runs off the buffer
+	data := buf.Bytes()
+	idx := bytes.Index(data, []byte("\x0a\x00\x00\x00corrupt-me"))
+	if idx < 0 {
+		t.Fatal("property value not found in output")
+	}
+	binary.LittleEndian.PutUint32(data[idx:], 0xffffff00)
+
+	reader, err := NewReaderFromData(data)
+	if err != nil {
+		t.Fatalf("NewReaderFromData failed: %v", err)
+	}
+
+	_, err = reader.ReadAll()
+	if !errors.Is(err, ErrInvalidData) {
+		t.Fatalf("expected ErrInvalidData, got %v", err)
+	}
+
+	// The offset is the one the index gives for the corrupt feature
+	hits, indexErr := reader.SearchIndex(orb.Bound{Min: orb.Point{1, 2}, Max: orb.Point{1, 2}})
+	if indexErr != nil || len(hits) != 1 || hits[0].Offset == 0 {
+		t.Fatalf("SearchIndex = %v, %v, want the second feature", hits, indexErr)
+	}
+	var propErr *PropertyError
+	if !errors.As(err, &propErr) {
+		t.Fatalf("expected *PropertyError, got %T", err)
+	}
+	if propErr.FeatureOffset != int64(hits[0].Offset) || propErr.Column != 0 {
+		t.Errorf("unexpected error details: %+v, want offset %d", propErr, hits[0].Offset)
+	}
+
+	// Streaming conversion reports the same offset
+	err = FlatGeobufToGeoJSON(bytes.NewReader(data), io.Discard, GeoJSONCollection, nil)
+	if !errors.As(err, &propErr) || propErr.FeatureOffset != int64(hits[0].Offset) {
+		t.Errorf("FlatGeobufToGeoJSON: got %v, want offset %d", err, hits[0].Offset)
+	}
+}
+
+func TestReadAll_Concurrent(t *testing.T) {
+	fc := geojson.NewFeatureCollection()
+	for i := 0; i < 3000; i++ {
+		f := geojson.NewFeature(orb.Point{float64(i % 100), float64(i / 100)})
+		f.Properties = geojson.Properties{"id": i, "name": fmt.Sprintf("feature-%04d", i)}
+		fc.Append(f)
+	}
+	var buf bytes.Buffer
+	if err := WriteFeatures(&buf, fc, &Options{IncludeIndex: true}); err != nil {
+		t.Fatalf("WriteFeatures failed: %v", err)
+	}
+
+	read := func(concurrency int) (*geojson.FeatureCollection, *geojson.FeatureCollection) {
+		reader, err := NewReaderFromDataWithOptions(buf.Bytes(), &ReaderOptions{Concurrency: concurrency})
+		if err != nil {
+			t.Fatalf("NewReaderFromData failed: %v", err)
+		}
+		defer reader.Close()
+
+		all, err := reader.ReadAll()
+		if err != nil {
+			t.Fatalf("ReadAll failed: %v", err)
+		}
+		found, err := reader.Search(orb.Bound{Min: orb.Point{10, 5}, Max: orb.Point{60, 25}})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		return all, found
+	}
+
+	expectedAll, expectedFound := read(0)
+	if len(expectedAll.Features) != 3000 || len(expectedFound.Features) != 51*21 {
+		t.Fatalf("unexpected counts %d and %d", len(expectedAll.Features), len(expectedFound.Features))
+	}
+	for _, concurrency := range []int{2, 7, -1} {
+		all, found := read(concurrency)
+		if !reflect.DeepEqual(all, expectedAll) {
+			t.Errorf("concurrency %d: ReadAll differs from a sequential read", concurrency)
+		}
+		if !reflect.DeepEqual(found, expectedFound) {
+			t.Errorf("concurrency %d: Search differs from a sequential read", concurrency)
+		}
+	}
+}
+
+func TestReadAll_ConcurrentError(t *testing.T) {
+	fc := geojson.NewFeatureCollection()
+	for i := 0; i < 2000; i++ {
+		f := geojson.NewFeature(orb.Point{float64(i), 0})
+		f.Properties = geojson.Properties{"name": fmt.Sprintf("value-%04d", i)}
+		fc.Append(f)
+	}
+	var buf bytes.Buffer
+	if err := WriteFeatures(&buf, fc, &Options{IncludeIndex: false}); err != nil {
+		t.Fatalf("WriteFeatures failed: %v", err)
+	}
+
+	// Corrupt two features in different batches
+	data := buf.Bytes()
+	for _, name := range []string{"value-1900", "value-0700"} {
+		idx := bytes.Index(data, append([]byte("\x0a\x00\x00\x00"), name...))
+		if idx < 0 {
+			t.Fatalf("property value %q not found in output", name)
+		}
+		binary.LittleEndian.PutUint32(data[idx:], 0xffffff00)
+	}
+
+	var expected string
+	for _, concurrency := range []int{0, 4} {
+		reader, err := NewReaderFromDataWithOptions(data, &ReaderOptions{Concurrency: concurrency})
+		if err != nil {
+			t.Fatalf("NewReaderFromData failed: %v", err)
+		}
+		_, err = reader.ReadAll()
+		reader.Close()
+		if !errors.Is(err, ErrInvalidData) {
+			t.Fatalf("concurrency %d: expected ErrInvalidData, got %v", concurrency, err)
+		}
+
+		// The first corrupt feature in file order is reported
+		if concurrency == 0 {
+			expected = err.Error()
+		} else if err.Error() != expected {
+			t.Errorf("concurrency %d: expected %q, got %q", concurrency, expected, err)
+		}
+	}
+}
+
+func TestReadFixture_LegacyStrings(t *testing.T) {
+	// Written by a version of this package that NUL-terminated string values
+	path := filepath.Join("testdata", "legacy_strings.fgb")
+	strict, err := NewReader(path)
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	defer strict.Close()
+	if _, err := strict.ReadAll(); !errors.Is(err, ErrInvalidData) {
+		t.Errorf("without LegacyStrings: expected ErrInvalidData, got %v", err)
+	}
+
+	reader, err := NewReaderWithOptions(path, &ReaderOptions{LegacyStrings: true})
+	if err != nil {
+		t.Fatalf("NewReaderWithOptions failed: %v", err)
+	}
+	defer reader.Close()
+
+	result, err := reader.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if len(result.Features) != 3 {
+		t.Fatalf("expected 3 features, got %d", len(result.Features))
+	}
+
+	names := make(map[string]bool)
+	for _, f := range result.Features {
+		name, ok := f.Properties["name"].(string)
+		if !ok {
+			t.Fatalf("expected string name, got %T", f.Properties["name"])
+		}
+		names[name] = true
+		if _, ok := f.Properties["meta"].(map[string]interface{}); !ok {
+			t.Errorf("expected json meta, got %T", f.Properties["meta"])
+		}
+	}
+	for _, name := range []string{"Alpha", "Beta", ""} {
+		if !names[name] {
+			t.Errorf("missing feature named %q", name)
+		}
+	}
+}
+
+// fixtures returns the contents of the files in testdata, for seeding fuzz
+// targets.
+func fixtures(f *testing.F) [][]byte {
+	f.Helper()
+
+	paths, err := filepath.Glob(filepath.Join("testdata", "*.fgb"))
+	if err != nil || len(paths) == 0 {
+		f.Fatalf("no fixtures: %v", err)
+	}
+	files := make([][]byte, len(paths))
+	for i, path := range paths {
+		if files[i], err = os.ReadFile(path); err != nil {
+			f.Fatalf("ReadFile failed: %v", err)
+		}
+	}
+	return files
+}
+
+// fixtureFeatures returns the raw features of every fixture.
+func fixtureFeatures(f *testing.F) []*flattypes.Feature {
+	f.Helper()
+
+	var features []*flattypes.Feature
+	for _, data := range fixtures(f) {
+		reader, err := NewReaderFromData(data)
+		if err != nil {
+			f.Fatalf("NewReaderFromData failed: %v", err)
+		}
+		offsets, err := reader.fileOffsets()
+		if err != nil {
+			f.Fatalf("fileOffsets failed: %v", err)
+		}
+		for _, offset := range offsets {
+			feature, err := reader.rawFeature(offset)
+			if err != nil {
+				f.Fatalf("rawFeature failed: %v", err)
+			}
+			features = append(features, feature)
+		}
+	}
+	return features
+}
+
+func FuzzNewReaderFromData(f *testing.F) {
+	for _, data := range fixtures(f) {
+		f.Add(data)
+	}
+	for _, index := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := WriteFeatures(&buf, concurrentFeatures(20), &Options{IncludeIndex: index}); err != nil {
+			f.Fatalf("WriteFeatures failed: %v", err)
+		}
+		f.Add(buf.Bytes())
+	}
+
+	world := orb.Bound{Min: orb.Point{-180, -90}, Max: orb.Point{180, 90}}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		valid := Validate(data).Valid()
+
+		reader, err := NewReaderFromData(data)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidData) {
+				t.Fatalf("error does not wrap ErrInvalidData: %v", err)
+			}
+			if valid {
+				t.Fatalf("valid file failed to open: %v", err)
+			}
+			return
+		}
+		defer reader.Close()
+
+		_ = reader.Header()
+		_ = reader.Bounds()
+		if _, err := reader.ReadAll(); err != nil {
+			if !errors.Is(err, ErrInvalidData) {
+				t.Fatalf("ReadAll error does not wrap ErrInvalidData: %v", err)
+			}
+			if valid {
+				t.Fatalf("ReadAll failed on a valid file: %v", err)
+			}
+		}
+		if _, err := reader.Search(world); err != nil && !errors.Is(err, ErrInvalidData) && !errors.Is(err, ErrNoIndex) {
+			t.Fatalf("Search error does not wrap ErrInvalidData: %v", err)
+		}
+	})
+}
+
+func TestReadFixture_Reference(t *testing.T) {
+	// Written by the reference implementation; geometry types are only set in
+	// the header
+	reader, err := NewReader(filepath.Join("testdata", "poly_landmarks.fgb"))
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	result, err := reader.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if len(result.Features) != 85 {
+		t.Errorf("expected 85 features, got %d", len(result.Features))
+	}
+
+	found, err := reader.Search(orb.Bound{
+		Min: orb.Point{-73.976523, 40.715091},
+		Max: orb.Point{-73.971893, 40.727318},
+	})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(found.Features) != 2 {
+		t.Errorf("expected 2 features, got %d", len(found.Features))
+	}
+	for _, f := range found.Features {
+		if _, ok := f.Geometry.(orb.Polygon); !ok {
+			t.Errorf("expected polygon, got %T", f.Geometry)
+		}
+	}
+}
+
+func TestReadFixture_AllTypes(t *testing.T) {
+	// Written with the reference implementation's Go writer package, with the
+	// property buffers laid out from the specification rather than by this
+	// package's encoder. The third feature lists its columns out of order.
+	reader, err := NewReader(filepath.Join("testdata", "alltypes.fgb"))
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	header := reader.Header()
+	if header.CRS == nil || header.CRS.Code != 4326 {
+		t.Errorf("CRS = %+v, want EPSG:4326", header.CRS)
+	}
+	if c := header.Columns[0]; c.Name != "name" || c.Type != "String" || c.Title != "Place name" || c.Width != 40 || !c.Nullable {
+		t.Errorf("unexpected first column %+v", c)
+	}
+
+	result, err := reader.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	want := []geojson.Properties{
+		{
+			"name":       "London",
+			"meta":       map[string]interface{}{"tags": []interface{}{"capital", "port"}, "rank": 1.0},
+			"updated":    "2024-03-01T12:30:00Z",
+			"blob":       []byte{0x00, 0xff, 0x10, 0x00},
+			"population": int32(8866180),
+			"area":       1572.0,
+			"capital":    true,
+		},
+		{
+			"name":       "Île-de-France ☃",
+			"meta":       []interface{}{1.0, 2.5, nil},
+			"updated":    "1999-12-31T23:59:59.999+01:00",
+			"blob":       []byte{},
+			"population": int32(-7),
+			"capital":    false,
+		},
+		{
+			"name": "",
+			"meta": nil,
+			"area": -0.5,
+			"blob": []byte("a\x00b"),
+		},
+	}
+	if len(result.Features) != len(want) {
+		t.Fatalf("expected %d features, got %d", len(want), len(result.Features))
+	}
+	for i, f := range result.Features {
+		if !reflect.DeepEqual(f.Properties, want[i]) {
+			t.Errorf("feature %d: got %#v, want %#v", i, f.Properties, want[i])
+		}
+	}
+
+	// Encoding the decoded values reproduces the buffer of the second feature,
+	// whose columns are in order and whose JSON has no object keys to reorder
+	names := make([]string, len(header.Columns))
+	types := make([]flattypes.ColumnType, len(header.Columns))
+	for i, c := range header.Columns {
+		names[i] = c.Name
+		types[i] = flattypes.EnumValuesColumnType[c.Type]
+	}
+	offsets, err := reader.fileOffsets()
+	if err != nil {
+		t.Fatalf("fileOffsets failed: %v", err)
+	}
+	raw, err := reader.rawFeature(offsets[1])
+	if err != nil {
+		t.Fatalf("rawFeature failed: %v", err)
+	}
+	got := mustEncodeProperties(t, result.Features[1].Properties, names, types)
+	if !bytes.Equal(got, raw.PropertiesBytes()) {
+		t.Errorf("encoded %x, file has %x", got, raw.PropertiesBytes())
+	}
+}
+
+func TestSearchMany(t *testing.T) {
+	reader, err := NewReader(filepath.Join("testdata", "poly_landmarks.fgb"))
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	queries := []orb.Bound{
+		{Min: orb.Point{-73.976523, 40.715091}, Max: orb.Point{-73.971893, 40.727318}},
+		{Min: orb.Point{-74.0, 40.70}, Max: orb.Point{-73.95, 40.75}},
+		{Min: orb.Point{-73.98, 40.71}, Max: orb.Point{-73.96, 40.73}},
+		{Min: orb.Point{0, 0}, Max: orb.Point{1, 1}},
+	}
+
+	results, err := reader.SearchMany(queries)
+	if err != nil {
+		t.Fatalf("SearchMany failed: %v", err)
+	}
+	if len(results) != len(queries) {
+		t.Fatalf("expected %d results, got %d", len(queries), len(results))
+	}
+
+	// Each group matches a separate Search, feature for feature
+	for i, query := range queries {
+		single, err := reader.Search(query)
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if len(results[i].Features) != len(single.Features) {
+			t.Errorf("query %d: expected %d features, got %d", i, len(single.Features), len(results[i].Features))
+			continue
+		}
+		for j := range single.Features {
+			if !orb.Equal(results[i].Features[j].Geometry, single.Features[j].Geometry) {
+				t.Errorf("query %d feature %d differs from Search", i, j)
+			}
+		}
+	}
+	if len(results[3].Features) != 0 {
+		t.Errorf("expected no features outside the data, got %d", len(results[3].Features))
+	}
+
+	// Overlapping queries share decoded features
+	shared := make(map[*geojson.Feature]bool)
+	for _, f := range results[1].Features {
+		shared[f] = true
+	}
+	for _, f := range results[0].Features {
+		if !shared[f] {
+			t.Error("expected features matching several queries to be decoded once")
+		}
+	}
+}
+
+func TestSearchMany_NoIndex(t *testing.T) {
+	fc := geojson.NewFeatureCollection()
+	fc.Append(geojson.NewFeature(orb.Point{1, 2}))
+
+	var buf bytes.Buffer
+	if err := WriteFeatures(&buf, fc, &Options{IncludeIndex: false}); err != nil {
+		t.Fatalf("WriteFeatures failed: %v", err)
+	}
+	reader, err := NewReaderFromData(buf.Bytes())
+	if err != nil {
+		t.Fatalf("NewReaderFromData failed: %v", err)
+	}
+
+	if _, err := reader.SearchMany([]orb.Bound{{}}); !errors.Is(err, ErrNoIndex) {
+		t.Errorf("expected ErrNoIndex, got %v", err)
+	}
+}
+
+func TestSearchIndex(t *testing.T) {
+	reader, err := NewReader(filepath.Join("testdata", "poly_landmarks.fgb"))
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	query := orb.Bound{Min: orb.Point{-74.0, 40.70}, Max: orb.Point{-73.95, 40.75}}
+
+	hits, err := reader.SearchIndex(query)
+	if err != nil {
+		t.Fatalf("SearchIndex failed: %v", err)
+	}
+	fc, err := reader.Search(query)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(hits) == 0 || len(hits) != len(fc.Features) {
+		t.Fatalf("expected %d hits, got %d", len(fc.Features), len(hits))
+	}
+
+	for i, hit := range hits {
+		if !hit.Bound.Intersects(query) {
+			t.Errorf("hit %d: bound %v does not intersect the query", i, hit.Bound)
+		}
+		if hit.FeatureIndex < 0 || hit.FeatureIndex >= 85 {
+			t.Errorf("hit %d: feature index %d out of range", i, hit.FeatureIndex)
+		}
+		if i > 0 && hit.Offset <= hits[i-1].Offset {
+			t.Errorf("hit %d: offsets not increasing", i)
+		}
+
+		// The offset locates the same feature Search decoded
+		feature, err := reader.readFeature(hit.Offset)
+		if err != nil {
+			t.Fatalf("readFeature failed: %v", err)
+		}
+		if !orb.Equal(feature.Geometry, fc.Features[i].Geometry) {
+			t.Errorf("hit %d: offset does not match the searched feature", i)
+		}
+		if feature.Geometry.Bound() != hit.Bound {
+			t.Errorf("hit %d: bound %v differs from geometry bound %v", i, hit.Bound, feature.Geometry.Bound())
+		}
+	}
+
+	count, err := reader.Count(query)
+	if err != nil {
+		t.Fatalf("Count failed: %v", err)
+	}
+	if count != len(hits) {
+		t.Errorf("expected count %d, got %d", len(hits), count)
+	}
+}
+
+func TestSearchIndex_NoIndex(t *testing.T) {
+	fc := geojson.NewFeatureCollection()
+	fc.Append(geojson.NewFeature(orb.Point{1, 2}))
+
+	var buf bytes.Buffer
+	if err := WriteFeatures(&buf, fc, &Options{IncludeIndex: false}); err != nil {
+		t.Fatalf("WriteFeatures failed: %v", err)
+	}
+	reader, err := NewReaderFromData(buf.Bytes())
+	if err != nil {
+		t.Fatalf("NewReaderFromData failed: %v", err)
+	}
+
+	if _, err := reader.SearchIndex(orb.Bound{}); !errors.Is(err, ErrNoIndex) {
+		t.Errorf("expected ErrNoIndex, got %v", err)
+	}
+	if _, err := reader.Count(orb.Bound{}); !errors.Is(err, ErrNoIndex) {
+		t.Errorf("expected ErrNoIndex, got %v", err)
+	}
+}
+
+func TestReadAll_NoIndex(t *testing.T) {
+	reader := newGridReader(t, 5, false)
+	defer reader.Close()
+
+	fc, err := reader.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if len(fc.Features) != 25 {
+		t.Fatalf("expected 25 features, got %d", len(fc.Features))
+	}
+	for i, f := range fc.Features {
+		if id := f.Properties["id"]; id != int32(i) {
+			t.Errorf("feature %d: expected id %d, got %v", i, i, id)
+		}
+	}
+}
+
+func TestReader_Bounds(t *testing.T) {
+	expected := orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{9, 9}}
+	for _, includeIndex := range []bool{false, true} {
+		reader := newGridReader(t, 10, includeIndex)
+		if b := reader.Bounds(); b != expected {
+			t.Errorf("index %v: expected %v, got %v", includeIndex, expected, b)
+		}
+		reader.Close()
+	}
+}
+
+func TestReader_BoundsWithoutEnvelope(t *testing.T) {
+	for _, includeIndex := range []bool{false, true} {
+		reader := newGridReader(t, 10, includeIndex)
+		data := reader.data
+		reader.Close()
+
+		// Rewrite the header without an envelope, as older writers did
+		h := flattypes.GetSizePrefixedRootAsHeader(data, flatbuffers.UOffsetT(len(writer.MagicBytes)))
+		header := indexedHeader(h, int(h.FeaturesCount()), h.IndexNodeSize(), emptyBound)
+		headerEnd := len(writer.MagicBytes) + 4 + int(binary.LittleEndian.Uint32(data[len(writer.MagicBytes):]))
+		rewritten := append(append(append([]byte{}, writer.MagicBytes...), header...), data[headerEnd:]...)
+
+		reader, err := NewReaderFromData(rewritten)
+		if err != nil {
+			t.Fatalf("NewReaderFromData failed: %v", err)
+		}
+		if env := reader.Header().Envelope; env != [4]float64{} {
+			t.Fatalf("expected no envelope, got %v", env)
+		}
+		expected := orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{9, 9}}
+		if b := reader.Bounds(); b != expected {
+			t.Errorf("index %v: expected %v, got %v", includeIndex, expected, b)
+		}
+		reader.Close()
+	}
+}
+
+func TestFeatureAt(t *testing.T) {
+	for _, includeIndex := range []bool{true, false} {
+		reader := newGridReader(t, 10, includeIndex)
+
+		all, err := reader.FeaturesRange(0, 1000)
+		if err != nil {
+			t.Fatalf("FeaturesRange failed: %v", err)
+		}
+		if len(all.Features) != 100 {
+			t.Fatalf("index %v: expected 100 features, got %d", includeIndex, len(all.Features))
+		}
+
+		seen := make(map[interface{}]bool)
+		for i, f := range all.Features {
+			seen[f.Properties["id"]] = true
+
+			single, err := reader.FeatureAt(i)
+			if err != nil {
+				t.Fatalf("FeatureAt(%d) failed: %v", i, err)
+			}
+			if single.Properties["id"] != f.Properties["id"] {
+				t.Errorf("index %v: FeatureAt(%d) differs from FeaturesRange", includeIndex, i)
+			}
+		}
+		if len(seen) != 100 {
+			t.Errorf("index %v: expected 100 distinct features, got %d", includeIndex, len(seen))
+		}
+
+		page, err := reader.FeaturesRange(40, 50)
+		if err != nil {
+			t.Fatalf("FeaturesRange failed: %v", err)
+		}
+		if len(page.Features) != 10 || page.Features[0].Properties["id"] != all.Features[40].Properties["id"] {
+			t.Errorf("index %v: unexpected page %v", includeIndex, page.Features)
+		}
+
+		page, err = reader.FeaturesRange(100, 110)
+		if err != nil {
+			t.Fatalf("FeaturesRange failed: %v", err)
+		}
+		if len(page.Features) != 0 {
+			t.Errorf("index %v: expected an empty page past the end, got %d", includeIndex, len(page.Features))
+		}
+
+		if _, err := reader.FeatureAt(100); !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("index %v: expected ErrOutOfRange, got %v", includeIndex, err)
+		}
+		if _, err := reader.FeatureAt(-1); !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("index %v: expected ErrOutOfRange, got %v", includeIndex, err)
+		}
+		if _, err := reader.FeaturesRange(5, 4); !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("index %v: expected ErrOutOfRange, got %v", includeIndex, err)
+		}
+
+		_ = reader.Close()
+	}
+}
+
+func TestFeatureAt_IndexOrder(t *testing.T) {
+	reader, err := NewReader(filepath.Join("testdata", "poly_landmarks.fgb"))
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	defer reader.Close()
+
+	hits, err := reader.SearchIndex(orb.Bound{Min: orb.Point{-180, -90}, Max: orb.Point{180, 90}})
+	if err != nil {
+		t.Fatalf("SearchIndex failed: %v", err)
+	}
+	if len(hits) != 85 {
+		t.Fatalf("expected 85 hits, got %d", len(hits))
+	}
+
+	// Ordinals are the index leaf positions reported by SearchIndex
+	for _, hit := range hits {
+		f, err := reader.FeatureAt(hit.FeatureIndex)
+		if err != nil {
+			t.Fatalf("FeatureAt failed: %v", err)
+		}
+		if f.Geometry.Bound() != hit.Bound {
+			t.Errorf("feature %d: bound %v differs from index bound %v", hit.FeatureIndex, f.Geometry.Bound(), hit.Bound)
+		}
+	}
+}
+
+func TestFeatureAt_SingleFeature(t *testing.T) {
+	reader := newGridReader(t, 1, true)
+	defer reader.Close()
+
+	f, err := reader.FeatureAt(0)
+	if err != nil {
+		t.Fatalf("FeatureAt failed: %v", err)
+	}
+	if f.Geometry != (orb.Point{0, 0}) {
+		t.Errorf("expected (0, 0), got %v", f.Geometry)
+	}
+}
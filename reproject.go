@@ -0,0 +1,492 @@
+package flatgeobuf
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/flatgeobuf/flatgeobuf/src/go/flattypes"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/project"
+)
+
+// EPSG codes of the coordinate systems Transform supports.
+const (
+	EPSGWGS84         = 4326 // WGS 84 longitude/latitude
+	EPSGWebMercator   = 3857 // WGS 84 / Pseudo-Mercator
+	EPSGLAEAEurope    = 3035 // ETRS89-extended / LAEA Europe
+	epsgUTMNorthFirst = 32601
+	epsgUTMSouthFirst = 32701
+)
+
+// Transform returns the projection of coordinates from the CRS with EPSG code
+// from to the one with code to. Supported codes are 4326 (WGS 84), 3857 (Web
+// Mercator), 32601 to 32660 and 32701 to 32760 (UTM zones, north and south)
+// and 3035 (LAEA Europe); transforms between two projected systems pass
+// through WGS 84. ETRS89 is taken to equal WGS 84, which holds to within a
+// metre or so. Other codes return an error wrapping ErrUnsupportedCRS.
+//
+// UTM coordinates are accurate to about a millimetre within 3000 km of the
+// zone's central meridian.
+func Transform(from, to int) (orb.Projection, error) {
+	toWGS84, err := projectionToWGS84(from)
+	if err != nil {
+		return nil, err
+	}
+	fromWGS84, err := projectionFromWGS84(to)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case from == to:
+		return func(p orb.Point) orb.Point { return p }, nil
+	case from == EPSGWGS84:
+		return fromWGS84, nil
+	case to == EPSGWGS84:
+		return toWGS84, nil
+	}
+	return func(p orb.Point) orb.Point { return fromWGS84(toWGS84(p)) }, nil
+}
+
+// Reproject returns a copy of g transformed from the CRS with EPSG code from
+// to the one with code to, as by Transform. Bounds become polygons.
+func Reproject(g orb.Geometry, from, to int) (orb.Geometry, error) {
+	proj, err := Transform(from, to)
+	if err != nil {
+		return nil, err
+	}
+	return reprojectGeometry(g, proj), nil
+}
+
+// KnownCRS returns the CRS with the given EPSG code, named, or an error
+// wrapping ErrUnsupportedCRS if Transform does not support it.
+func KnownCRS(code int) (*CRS, error) {
+	if _, err := projectionToWGS84(code); err != nil {
+		return nil, err
+	}
+	crs := &CRS{Code: code}
+	switch {
+	case code == EPSGWGS84:
+		crs.Name = "WGS 84"
+	case code == EPSGWebMercator:
+		crs.Name = "WGS 84 / Pseudo-Mercator"
+	case code == EPSGLAEAEurope:
+		crs.Name = "ETRS89-extended / LAEA Europe"
+	case code >= epsgUTMSouthFirst:
+		crs.Name = fmt.Sprintf("WGS 84 / UTM zone %dS", code-epsgUTMSouthFirst+1)
+	default:
+		crs.Name = fmt.Sprintf("WGS 84 / UTM zone %dN", code-epsgUTMNorthFirst+1)
+	}
+	return crs, nil
+}
+
+// utmZone returns the zone of a UTM code and whether it is southern, or a
+// zone of 0 for other codes.
+func utmZone(code int) (zone int, south bool) {
+	switch {
+	case code >= epsgUTMNorthFirst && code < epsgUTMNorthFirst+60:
+		return code - epsgUTMNorthFirst + 1, false
+	case code >= epsgUTMSouthFirst && code < epsgUTMSouthFirst+60:
+		return code - epsgUTMSouthFirst + 1, true
+	}
+	return 0, false
+}
+
+func unsupportedCRS(code int) error {
+	if code == 0 {
+		return fmt.Errorf("%w: no EPSG code to reproject from or to", ErrUnsupportedCRS)
+	}
+	return fmt.Errorf("%w: no transform for EPSG:%d (supported: 4326, 3857, 3035, 32601-32660, 32701-32760)",
+		ErrUnsupportedCRS, code)
+}
+
+func projectionToWGS84(code int) (orb.Projection, error) {
+	switch code {
+	case EPSGWGS84:
+		return func(p orb.Point) orb.Point { return p }, nil
+	case EPSGWebMercator:
+		return project.Mercator.ToWGS84, nil
+	case EPSGLAEAEurope:
+		return laeaEurope.toWGS84, nil
+	}
+	if zone, south := utmZone(code); zone != 0 {
+		return newUTM(zone, south).toWGS84, nil
+	}
+	return nil, unsupportedCRS(code)
+}
+
+func projectionFromWGS84(code int) (orb.Projection, error) {
+	switch code {
+	case EPSGWGS84:
+		return func(p orb.Point) orb.Point { return p }, nil
+	case EPSGWebMercator:
+		return project.WGS84.ToMercator, nil
+	case EPSGLAEAEurope:
+		return laeaEurope.fromWGS84, nil
+	}
+	if zone, south := utmZone(code); zone != 0 {
+		return newUTM(zone, south).fromWGS84, nil
+	}
+	return nil, unsupportedCRS(code)
+}
+
+// reprojectGeometry returns a copy of g transformed by proj. Bounds become
+// polygons, as they are written.
+func reprojectGeometry(g orb.Geometry, proj orb.Projection) orb.Geometry {
+	switch v := g.(type) {
+	case nil:
+		return nil
+	case orb.Bound:
+		return project.Polygon(boundToPolygon(v), proj)
+	}
+	return project.Geometry(orb.Clone(g), proj)
+}
+
+// reprojectBound returns the bound of b transformed by proj. Parallels and
+// meridians curve in transverse Mercator and azimuthal projections, so an
+// edge can reach its extreme between its corners, as where it crosses a
+// central meridian. Each edge is therefore sampled and every extreme refined
+// by ternary search between the samples beside it, and the result is padded
+// against rounding. Points that do not transform to finite coordinates are
+// left out.
+func reprojectBound(b orb.Bound, proj orb.Projection) orb.Bound {
+	if b.IsEmpty() {
+		return b
+	}
+	const steps = 16
+	edges := [...][2]orb.Point{
+		{b.Min, {b.Max[0], b.Min[1]}},
+		{{b.Min[0], b.Max[1]}, b.Max},
+		{b.Min, {b.Min[0], b.Max[1]}},
+		{{b.Max[0], b.Min[1]}, b.Max},
+	}
+	bound := emptyBound
+	for _, edge := range edges {
+		at := func(t float64) orb.Point {
+			return proj(orb.Point{
+				edge[0][0] + t*(edge[1][0]-edge[0][0]),
+				edge[0][1] + t*(edge[1][1]-edge[0][1]),
+			})
+		}
+		var samples [steps + 1]orb.Point
+		for i := range samples {
+			samples[i] = at(float64(i) / steps)
+			if finite(samples[i]) {
+				bound = extendPoint(bound, samples[i])
+			}
+		}
+
+		for axis := 0; axis < 2; axis++ {
+			for _, sign := range [...]float64{-1, 1} {
+				best := -1
+				for i, p := range samples {
+					if finite(p) && (best < 0 || sign*p[axis] > sign*samples[best][axis]) {
+						best = i
+					}
+				}
+				if best <= 0 || best == steps {
+					continue // At a corner or nowhere finite
+				}
+				value := func(t float64) float64 {
+					if p := at(t); finite(p) {
+						return sign * p[axis]
+					}
+					return math.Inf(-1)
+				}
+				lo, hi := float64(best-1)/steps, float64(best+1)/steps
+				for hi-lo > 1e-9 {
+					m1, m2 := lo+(hi-lo)/3, hi-(hi-lo)/3
+					if value(m1) < value(m2) {
+						lo = m1
+					} else {
+						hi = m2
+					}
+				}
+				if p := at((lo + hi) / 2); finite(p) {
+					bound = extendPoint(bound, p)
+				}
+			}
+		}
+	}
+	if bound.IsEmpty() {
+		return bound
+	}
+	size := bound.Max[0] - bound.Min[0] + bound.Max[1] - bound.Min[1]
+	magnitude := math.Max(math.Max(math.Abs(bound.Min[0]), math.Abs(bound.Max[0])),
+		math.Max(math.Abs(bound.Min[1]), math.Abs(bound.Max[1])))
+	return bound.Pad(1e-9*size + 1e-12*magnitude)
+}
+
+// finite reports whether both coordinates of p are finite.
+func finite(p orb.Point) bool {
+	return !math.IsInf(p[0], 0) && !math.IsInf(p[1], 0) && !math.IsNaN(p[0]) && !math.IsNaN(p[1])
+}
+
+// reprojection holds the transforms of a reader with a target CRS.
+type reprojection struct {
+	crs     *CRS           // Target CRS
+	forward orb.Projection // File to target coordinates
+	inverse orb.Projection // Target to file coordinates
+}
+
+// newReprojection returns the transforms from the CRS with EPSG code from to
+// target, or nil if target is nil.
+func newReprojection(from int, target *CRS) (*reprojection, error) {
+	if target == nil {
+		return nil, nil
+	}
+	forward, err := Transform(from, target.Code)
+	if err != nil {
+		return nil, err
+	}
+	inverse, err := Transform(target.Code, from)
+	if err != nil {
+		return nil, err
+	}
+	return &reprojection{crs: targetCRS(target), forward: forward, inverse: inverse}, nil
+}
+
+// apply transforms the geometry of a decoded feature in place.
+func (p *reprojection) apply(f *geojson.Feature) {
+	if f != nil && f.Geometry != nil {
+		f.Geometry = project.Geometry(f.Geometry, p.forward)
+	}
+}
+
+// headerCRSCode returns the EPSG code of the CRS of h, or 0 if it has none.
+func headerCRSCode(h *flattypes.Header) int {
+	var crs flattypes.Crs
+	if h.Crs(&crs) == nil {
+		return 0
+	}
+	return int(crs.Code())
+}
+
+// targetCRS returns target, named after its code if it has no name.
+func targetCRS(target *CRS) *CRS {
+	crs := *target
+	if crs.Name == "" {
+		if known, err := KnownCRS(crs.Code); err == nil {
+			crs.Name = known.Name
+		}
+	}
+	return &crs
+}
+
+// reprojected returns the options to write with once the coordinates have
+// been transformed by the returned projection, which is nil if o has no
+// TargetCRS.
+func (o *Options) reprojected() (*Options, orb.Projection, error) {
+	if o.TargetCRS == nil {
+		return o, nil, nil
+	}
+	from := 0
+	if o.CRS != nil {
+		from = o.CRS.Code
+	}
+	proj, err := Transform(from, o.TargetCRS.Code)
+	if err != nil {
+		return nil, nil, err
+	}
+	reprojected := *o
+	reprojected.CRS = targetCRS(o.TargetCRS)
+	reprojected.TargetCRS = nil
+	return &reprojected, proj, nil
+}
+
+// reprojectFeatures returns copies of features with their geometries
+// transformed by proj, sharing their properties.
+func reprojectFeatures(features []*geojson.Feature, proj orb.Projection) []*geojson.Feature {
+	result := make([]*geojson.Feature, len(features))
+	for i, f := range features {
+		if f == nil {
+			continue
+		}
+		copied := *f
+		copied.Geometry = reprojectGeometry(f.Geometry, proj)
+		copied.BBox = nil
+		result[i] = &copied
+	}
+	return result
+}
+
+// wgs84 holds the parameters of the WGS 84 ellipsoid, also used for GRS 80,
+// from which it differs by less than a millimetre.
+const (
+	wgs84A = 6378137.0
+	wgs84F = 1 / 298.257223563
+)
+
+// utm is a Universal Transverse Mercator zone, computed with Krüger's series
+// to third order in the third flattening.
+type utm struct {
+	lon0     float64 // Central meridian, in radians
+	northing float64 // False northing
+}
+
+const (
+	utmScale    = 0.9996
+	utmEasting  = 500000.0
+	utmSouthing = 10000000.0
+)
+
+// Series coefficients of the transverse Mercator projection.
+var (
+	tmN     = wgs84F / (2 - wgs84F)
+	tmA     = wgs84A / (1 + tmN) * (1 + tmN*tmN/4 + tmN*tmN*tmN*tmN/64)
+	tmAlpha = [3]float64{
+		tmN/2 - 2*tmN*tmN/3 + 5*tmN*tmN*tmN/16,
+		13*tmN*tmN/48 - 3*tmN*tmN*tmN/5,
+		61 * tmN * tmN * tmN / 240,
+	}
+	tmBeta = [3]float64{
+		tmN/2 - 2*tmN*tmN/3 + 37*tmN*tmN*tmN/96,
+		tmN*tmN/48 + tmN*tmN*tmN/15,
+		17 * tmN * tmN * tmN / 480,
+	}
+	tmDelta = [3]float64{
+		2*tmN - 2*tmN*tmN/3 - 2*tmN*tmN*tmN,
+		7*tmN*tmN/3 - 8*tmN*tmN*tmN/5,
+		56 * tmN * tmN * tmN / 15,
+	}
+)
+
+// conformal returns the conformal latitude of geodetic latitude lat on the
+// WGS84 ellipsoid, in radians.
+func conformal(lat float64) float64 {
+	e := 2 * math.Sqrt(tmN) / (1 + tmN)
+	return math.Atan(math.Sinh(math.Atanh(math.Sin(lat)) - e*math.Atanh(e*math.Sin(lat))))
+}
+
+func newUTM(zone int, south bool) utm {
+	u := utm{lon0: float64(6*zone-183) * math.Pi / 180}
+	if south {
+		u.northing = utmSouthing
+	}
+	return u
+}
+
+func (u utm) fromWGS84(p orb.Point) orb.Point {
+	lat := p[1] * math.Pi / 180
+	dlon := p[0]*math.Pi/180 - u.lon0
+
+	t := math.Tan(conformal(lat))
+	xi := math.Atan2(t, math.Cos(dlon))
+	eta := math.Atanh(math.Sin(dlon) / math.Sqrt(1+t*t))
+
+	x, y := eta, xi
+	for j, alpha := range tmAlpha {
+		k := 2 * float64(j+1)
+		x += alpha * math.Cos(k*xi) * math.Sinh(k*eta)
+		y += alpha * math.Sin(k*xi) * math.Cosh(k*eta)
+	}
+	return orb.Point{utmEasting + utmScale*tmA*x, u.northing + utmScale*tmA*y}
+}
+
+func (u utm) toWGS84(p orb.Point) orb.Point {
+	xi := (p[1] - u.northing) / (utmScale * tmA)
+	eta := (p[0] - utmEasting) / (utmScale * tmA)
+
+	xi1, eta1 := xi, eta
+	for j, beta := range tmBeta {
+		k := 2 * float64(j+1)
+		xi1 -= beta * math.Sin(k*xi) * math.Cosh(k*eta)
+		eta1 -= beta * math.Cos(k*xi) * math.Sinh(k*eta)
+	}
+	chi := math.Asin(math.Sin(xi1) / math.Cosh(eta1))
+	lat := chi
+	for j, delta := range tmDelta {
+		lat += delta * math.Sin(2*float64(j+1)*chi)
+	}
+	// The truncated series is good to a few millimetres; the error shrinks by
+	// e² with each correction
+	for i := 0; i < 2; i++ {
+		lat += chi - conformal(lat)
+	}
+	lon := u.lon0 + math.Atan2(math.Sinh(eta1), math.Cos(xi1))
+	return orb.Point{lon * 180 / math.Pi, lat * 180 / math.Pi}
+}
+
+// laea is an ellipsoidal Lambert Azimuthal Equal Area projection, following
+// EPSG Guidance Note 7-2.
+type laea struct {
+	lon0, e, qp, rq, d float64
+	sinB0, cosB0       float64
+	easting, northing  float64
+}
+
+// laeaEurope is EPSG:3035, centred on 52°N 10°E on the GRS 80 ellipsoid.
+var laeaEurope = newLAEA(52, 10, 4321000, 3210000, 6378137, 1/298.257222101)
+
+func newLAEA(lat0, lon0, easting, northing, a, f float64) laea {
+	l := laea{lon0: lon0 * math.Pi / 180, e: math.Sqrt(f * (2 - f)), easting: easting, northing: northing}
+	l.qp = l.q(math.Pi / 2)
+	l.rq = a * math.Sqrt(l.qp/2)
+
+	phi0 := lat0 * math.Pi / 180
+	beta0 := math.Asin(l.q(phi0) / l.qp)
+	l.sinB0, l.cosB0 = math.Sincos(beta0)
+	sinPhi0 := math.Sin(phi0)
+	l.d = a * (math.Cos(phi0) / math.Sqrt(1-l.e*l.e*sinPhi0*sinPhi0)) / (l.rq * l.cosB0)
+	return l
+}
+
+// q is the authalic function of latitude phi.
+func (l laea) q(phi float64) float64 {
+	e := l.e
+	sin := math.Sin(phi)
+	return (1 - e*e) * (sin/(1-e*e*sin*sin) - math.Log((1-e*sin)/(1+e*sin))/(2*e))
+}
+
+func (l laea) fromWGS84(p orb.Point) orb.Point {
+	beta := math.Asin(math.Max(-1, math.Min(1, l.q(p[1]*math.Pi/180)/l.qp)))
+	sinB, cosB := math.Sincos(beta)
+	sinL, cosL := math.Sincos(p[0]*math.Pi/180 - l.lon0)
+
+	b := l.rq * math.Sqrt(2/(1+l.sinB0*sinB+l.cosB0*cosB*cosL))
+	return orb.Point{
+		l.easting + b*l.d*cosB*sinL,
+		l.northing + (b/l.d)*(l.cosB0*sinB-l.sinB0*cosB*cosL),
+	}
+}
+
+func (l laea) toWGS84(p orb.Point) orb.Point {
+	x, y := p[0]-l.easting, p[1]-l.northing
+	rho := math.Hypot(x/l.d, l.d*y)
+	if rho == 0 {
+		return orb.Point{l.lon0 * 180 / math.Pi, l.authalicToGeodetic(math.Asin(l.sinB0)) * 180 / math.Pi}
+	}
+	c := 2 * math.Asin(math.Min(1, rho/(2*l.rq)))
+	sinC, cosC := math.Sincos(c)
+	beta := math.Asin(math.Max(-1, math.Min(1, cosC*l.sinB0+l.d*y*sinC*l.cosB0/rho)))
+	lon := l.lon0 + math.Atan2(x*sinC, l.d*rho*l.cosB0*cosC-l.d*l.d*y*l.sinB0*sinC)
+	return orb.Point{lon * 180 / math.Pi, l.authalicToGeodetic(beta) * 180 / math.Pi}
+}
+
+// authalicToGeodetic returns the geodetic latitude of authalic latitude beta,
+// starting from the series approximation and refining it by Newton's method
+// (Snyder, Map Projections: A Working Manual, equation 3-16).
+func (l laea) authalicToGeodetic(beta float64) float64 {
+	e2 := l.e * l.e
+	e4, e6 := e2*e2, e2*e2*e2
+	phi := beta +
+		(e2/3+31*e4/180+517*e6/5040)*math.Sin(2*beta) +
+		(23*e4/360+251*e6/3780)*math.Sin(4*beta) +
+		(761*e6/45360)*math.Sin(6*beta)
+
+	q := l.qp * math.Sin(beta)
+	for i := 0; i < 5; i++ {
+		sin, cos := math.Sincos(phi)
+		if cos < 1e-12 {
+			break
+		}
+		w := 1 - e2*sin*sin
+		step := w * w / (2 * cos) * (q/(1-e2) - sin/w + math.Log((1-l.e*sin)/(1+l.e*sin))/(2*l.e))
+		phi += step
+		if math.Abs(step) < 1e-15 {
+			break
+		}
+	}
+	return phi
+}
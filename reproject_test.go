@@ -0,0 +1,339 @@
+package flatgeobuf
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+)
+
+func TestTransform_KnownValues(t *testing.T) {
+	tests := []struct {
+		name string
+		to   int
+		in   orb.Point // Longitude, latitude
+		want orb.Point
+	}{
+		{"mercator origin", EPSGWebMercator, orb.Point{0, 0}, orb.Point{0, 0}},
+		{"mercator corner", EPSGWebMercator, orb.Point{180, 85.0511287798066}, orb.Point{20037508.3428, 20037508.3428}},
+		{"UTM central meridian", 32631, orb.Point{3, 0}, orb.Point{500000, 0}},
+		{"UTM 38N", 32638, orb.Point{44.4, 33.3}, orb.Point{444140.54, 3684706.36}},  // GeographicLib GeoConvert
+		{"UTM 38S", 32738, orb.Point{44.4, -33.3}, orb.Point{444140.54, 6315293.64}}, // Mirrored about the equator
+		{"LAEA origin", EPSGLAEAEurope, orb.Point{10, 52}, orb.Point{4321000, 3210000}},
+		{"LAEA", EPSGLAEAEurope, orb.Point{5, 50}, orb.Point{3962799.45, 2999718.85}}, // EPSG Guidance Note 7-2
+	}
+	for _, tt := range tests {
+		proj, err := Transform(EPSGWGS84, tt.to)
+		if err != nil {
+			t.Fatalf("%s: Transform failed: %v", tt.name, err)
+		}
+		got := proj(tt.in)
+		if math.Abs(got[0]-tt.want[0]) > 0.01 || math.Abs(got[1]-tt.want[1]) > 0.01 {
+			t.Errorf("%s: got %.3f, want %.3f", tt.name, got, tt.want)
+		}
+
+		back, _ := Transform(tt.to, EPSGWGS84)
+		if got := back(tt.want); math.Abs(got[0]-tt.in[0]) > 1e-6 || math.Abs(got[1]-tt.in[1]) > 1e-6 {
+			t.Errorf("%s: inverse got %.9f, want %v", tt.name, got, tt.in)
+		}
+	}
+}
+
+func TestTransform_RoundTrip(t *testing.T) {
+	codes := []int{EPSGWGS84, EPSGWebMercator, EPSGLAEAEurope, 32632, 32633}
+	// Within a few degrees of both UTM zones, where the series are accurate
+	points := []orb.Point{{9, 48}, {12.5, 41.9}, {11.3, 44.5}, {13.4, 52.5}, {10.2, 59.9}}
+	for _, from := range codes {
+		for _, to := range codes {
+			forward, err := Transform(from, to)
+			if err != nil {
+				t.Fatalf("Transform(%d, %d) failed: %v", from, to, err)
+			}
+			inverse, _ := Transform(to, from)
+			toFrom, _ := Transform(EPSGWGS84, from)
+			for _, lonLat := range points {
+				p := toFrom(lonLat)
+				got := inverse(forward(p))
+				// A tenth of a millimetre in projected systems, or about that in degrees
+				tolerance := 1e-4
+				if from == EPSGWGS84 {
+					tolerance = 1e-9
+				}
+				if math.Abs(got[0]-p[0]) > tolerance || math.Abs(got[1]-p[1]) > tolerance {
+					t.Errorf("%d -> %d -> %d: %v became %v", from, to, from, p, got)
+				}
+			}
+		}
+	}
+}
+
+func TestTransform_Unsupported(t *testing.T) {
+	for _, pair := range [][2]int{{4326, 2154}, {27700, 4326}, {0, 4326}, {4326, 32661}, {32700, 3857}} {
+		_, err := Transform(pair[0], pair[1])
+		if !errors.Is(err, ErrUnsupportedCRS) {
+			t.Errorf("Transform(%d, %d): expected ErrUnsupportedCRS, got %v", pair[0], pair[1], err)
+		}
+	}
+	if _, err := Transform(4326, 2154); !strings.Contains(err.Error(), "EPSG:2154") {
+		t.Errorf("error %q does not name the CRS", err)
+	}
+
+	names := map[int]string{
+		4326:  "WGS 84",
+		3857:  "WGS 84 / Pseudo-Mercator",
+		3035:  "ETRS89-extended / LAEA Europe",
+		32601: "WGS 84 / UTM zone 1N",
+		32760: "WGS 84 / UTM zone 60S",
+	}
+	for code, name := range names {
+		if crs, err := KnownCRS(code); err != nil || crs.Name != name {
+			t.Errorf("KnownCRS(%d) = %+v, %v, want %q", code, crs, err, name)
+		}
+	}
+}
+
+func TestReproject(t *testing.T) {
+	g := orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1, 1}}
+	got, err := Reproject(g, EPSGWGS84, EPSGWebMercator)
+	if err != nil {
+		t.Fatalf("Reproject failed: %v", err)
+	}
+	poly, ok := got.(orb.Polygon)
+	if !ok || len(poly[0]) != 5 || poly[0][2][0] < 111319 || poly[0][2][0] > 111320 {
+		t.Errorf("got %v, want a polygon in metres", got)
+	}
+
+	line := orb.LineString{{0, 0}, {1, 1}}
+	if _, err := Reproject(line, EPSGWGS84, EPSGWebMercator); err != nil {
+		t.Fatalf("Reproject failed: %v", err)
+	}
+	if !orb.Equal(line, orb.LineString{{0, 0}, {1, 1}}) {
+		t.Error("Reproject modified its input")
+	}
+}
+
+// lonLatFeatures returns a grid of points around Rome with a polygon, in
+// WGS 84.
+func lonLatFeatures() *geojson.FeatureCollection {
+	fc := geojson.NewFeatureCollection()
+	for i := 0; i < 100; i++ {
+		f := geojson.NewFeature(orb.Point{12 + float64(i%10)*0.1, 41.5 + float64(i/10)*0.1})
+		f.Properties["i"] = int64(i)
+		fc.Append(f)
+	}
+	fc.Append(geojson.NewFeature(orb.Polygon{{{12, 41.5}, {13, 41.5}, {13, 42.5}, {12, 42.5}, {12, 41.5}}}))
+	return fc
+}
+
+func TestWriteFeatures_TargetCRS(t *testing.T) {
+	fc := lonLatFeatures()
+	var buf bytes.Buffer
+	opts := &Options{IncludeIndex: true, CRS: WGS84(), TargetCRS: &CRS{Code: 32633}}
+	if err := WriteFeatures(&buf, fc, opts); err != nil {
+		t.Fatalf("WriteFeatures failed: %v", err)
+	}
+	if fc.Features[0].Geometry.(orb.Point) != (orb.Point{12, 41.5}) {
+		t.Error("WriteFeatures modified its input")
+	}
+
+	reader, err := NewReaderFromData(buf.Bytes())
+	if err != nil {
+		t.Fatalf("NewReaderFromData failed: %v", err)
+	}
+	defer reader.Close()
+	header := reader.Header()
+	if header.CRS == nil || header.CRS.Code != 32633 || header.CRS.Name != "WGS 84 / UTM zone 33N" {
+		t.Errorf("CRS = %+v, want UTM zone 33N", header.CRS)
+	}
+	// Rome lies about 250 km west of the zone's central meridian
+	if header.Envelope[0] < 160000 || header.Envelope[2] > 340000 || header.Envelope[1] < 4590000 {
+		t.Errorf("envelope %v is not in UTM metres", header.Envelope)
+	}
+
+	// Other writers reproject alike
+	var viaWrite, viaConvert bytes.Buffer
+	geometries := make([]orb.Geometry, len(fc.Features))
+	for i, f := range fc.Features {
+		geometries[i] = f.Geometry
+	}
+	if err := Write(&viaWrite, geometries, opts); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	input := geoJSONInputs(t, fc)["lines"]
+	if err := GeoJSONToFlatGeobuf(bytes.NewReader(input), &viaConvert, &ConvertOptions{Write: opts}); err != nil {
+		t.Fatalf("GeoJSONToFlatGeobuf failed: %v", err)
+	}
+	for name, data := range map[string][]byte{"Write": viaWrite.Bytes(), "GeoJSONToFlatGeobuf": viaConvert.Bytes()} {
+		r, err := NewReaderFromData(data)
+		if err != nil {
+			t.Fatalf("%s: NewReaderFromData failed: %v", name, err)
+		}
+		if got := r.Header(); got.CRS.Code != 32633 || got.Envelope != header.Envelope {
+			t.Errorf("%s: CRS %d and envelope %v, want 32633 and %v", name, got.CRS.Code, got.Envelope, header.Envelope)
+		}
+		r.Close()
+	}
+
+	// The source CRS must be known
+	for _, crs := range []*CRS{nil, {Code: 2154}} {
+		opts := &Options{CRS: crs, TargetCRS: &CRS{Code: EPSGWebMercator}}
+		if err := WriteFeatures(&bytes.Buffer{}, fc, opts); !errors.Is(err, ErrUnsupportedCRS) {
+			t.Errorf("CRS %+v: expected ErrUnsupportedCRS, got %v", crs, err)
+		}
+	}
+	wkbOpts := &Options{CRS: WGS84(), TargetCRS: &CRS{Code: EPSGWebMercator}}
+	if err := WriteWKB(&bytes.Buffer{}, [][]byte{{1, 1, 0, 0, 0}}, wkbOpts); !errors.Is(err, ErrUnsupportedCRS) {
+		t.Errorf("WriteWKB: expected ErrUnsupportedCRS, got %v", err)
+	}
+}
+
+func TestReader_TargetCRS(t *testing.T) {
+	fc := lonLatFeatures()
+	var buf bytes.Buffer
+	if err := WriteFeatures(&buf, fc, &Options{IncludeIndex: true, CRS: WGS84(), TargetCRS: &CRS{Code: EPSGLAEAEurope}}); err != nil {
+		t.Fatalf("WriteFeatures failed: %v", err)
+	}
+
+	reader, err := NewReaderFromDataWithOptions(buf.Bytes(), &ReaderOptions{TargetCRS: WGS84()})
+	if err != nil {
+		t.Fatalf("NewReaderFromDataWithOptions failed: %v", err)
+	}
+	defer reader.Close()
+
+	header := reader.Header()
+	if header.CRS == nil || header.CRS.Code != EPSGWGS84 {
+		t.Errorf("CRS = %+v, want EPSG:4326", header.CRS)
+	}
+	if !nearBound(reader.Bounds(), orb.Bound{Min: orb.Point{12, 41.5}, Max: orb.Point{13, 42.5}}, 0.05) {
+		t.Errorf("Bounds = %v, want about Rome", reader.Bounds())
+	}
+
+	all, err := reader.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	for _, f := range all.Features {
+		if p, ok := f.Geometry.(orb.Point); ok {
+			i := f.Properties["i"].(int64)
+			want := fc.Features[i].Geometry.(orb.Point)
+			if math.Abs(p[0]-want[0]) > 1e-9 || math.Abs(p[1]-want[1]) > 1e-9 {
+				t.Errorf("feature %d: got %v, want %v", i, p, want)
+			}
+		}
+	}
+
+	// Queries are in the target CRS: a box around four points and the polygon
+	query := orb.Bound{Min: orb.Point{12.05, 41.55}, Max: orb.Point{12.25, 41.75}}
+	found, err := reader.Search(query)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(found.Features) != 5 {
+		t.Errorf("Search found %d features, want 5", len(found.Features))
+	}
+	if n, err := reader.Count(query); err != nil || n != 5 {
+		t.Errorf("Count = %d, %v, want 5", n, err)
+	}
+	hits, err := reader.SearchIndex(query)
+	if err != nil || len(hits) != 5 {
+		t.Fatalf("SearchIndex = %d hits, %v, want 5", len(hits), err)
+	}
+	for _, hit := range hits {
+		if !hit.Bound.Pad(1e-6).Intersects(query) {
+			t.Errorf("hit bound %v is not in WGS 84", hit.Bound)
+		}
+	}
+	// The polygon holds the query point; the closest point follows it
+	neighbors, err := reader.Nearest(orb.Point{12.51, 41.81}, 2, 0)
+	if err != nil || len(neighbors) != 2 || neighbors[1].Feature.Properties["i"] != int64(35) {
+		t.Errorf("Nearest = %v, %v, want the polygon and feature 35", neighbors, err)
+	}
+
+	// Files in other CRSs can be tiled once read as WGS 84
+	data, err := reader.Tile(maptile.At(orb.Point{12.5, 42}, 8), nil)
+	if err != nil {
+		t.Fatalf("Tile failed: %v", err)
+	}
+	if layers, err := mvt.Unmarshal(data); err != nil || len(layers[0].Features) == 0 {
+		t.Errorf("tile has no features (%v)", err)
+	}
+
+	if _, err := reader.ReadWKB(nil); !errors.Is(err, ErrUnsupportedCRS) {
+		t.Errorf("ReadWKB: expected ErrUnsupportedCRS, got %v", err)
+	}
+
+	// The streaming converter reprojects alike
+	var out bytes.Buffer
+	if err := FlatGeobufToGeoJSON(bytes.NewReader(buf.Bytes()), &out, GeoJSONCollection, &ReaderOptions{TargetCRS: WGS84()}); err != nil {
+		t.Fatalf("FlatGeobufToGeoJSON failed: %v", err)
+	}
+	converted, err := geojson.UnmarshalFeatureCollection(out.Bytes())
+	if err != nil {
+		t.Fatalf("UnmarshalFeatureCollection failed: %v", err)
+	}
+	if got := converted.Features[0].Geometry.Bound(); got.Min[0] < 11.9 || got.Max[0] > 13.1 {
+		t.Errorf("converted feature at %v, want about Rome", got)
+	}
+
+	// Files without a supported CRS cannot be reprojected
+	var plain bytes.Buffer
+	if err := WriteFeatures(&plain, fc, nil); err != nil {
+		t.Fatalf("WriteFeatures failed: %v", err)
+	}
+	if _, err := NewReaderFromDataWithOptions(plain.Bytes(), &ReaderOptions{TargetCRS: WGS84()}); !errors.Is(err, ErrUnsupportedCRS) {
+		t.Errorf("expected ErrUnsupportedCRS, got %v", err)
+	}
+}
+
+func nearBound(a, b orb.Bound, tolerance float64) bool {
+	return math.Abs(a.Min[0]-b.Min[0]) < tolerance && math.Abs(a.Min[1]-b.Min[1]) < tolerance &&
+		math.Abs(a.Max[0]-b.Max[0]) < tolerance && math.Abs(a.Max[1]-b.Max[1]) < tolerance
+}
+
+func TestReader_TargetCRSCentralMeridian(t *testing.T) {
+	// Parallels curve away from the pole in transverse Mercator, so the
+	// south edge of a box across the central meridian, 15°E in zone 33, dips
+	// lowest at the meridian
+	fc := geojson.NewFeatureCollection()
+	for _, p := range []orb.Point{{15, 45.000001}, {15.5, 45.5}, {16.5, 45.5}} {
+		fc.Append(geojson.NewFeature(p))
+	}
+	var buf bytes.Buffer
+	if err := WriteFeatures(&buf, fc, &Options{IncludeIndex: true, CRS: WGS84(), TargetCRS: &CRS{Code: 32633}}); err != nil {
+		t.Fatalf("WriteFeatures failed: %v", err)
+	}
+	reader, err := NewReaderFromDataWithOptions(buf.Bytes(), &ReaderOptions{TargetCRS: WGS84()})
+	if err != nil {
+		t.Fatalf("NewReaderFromDataWithOptions failed: %v", err)
+	}
+	defer reader.Close()
+
+	query := orb.Bound{Min: orb.Point{14.3, 45}, Max: orb.Point{16.1, 46}}
+	found, err := reader.Search(query)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(found.Features) != 2 {
+		t.Errorf("Search found %d features, want 2", len(found.Features))
+	}
+	if n, err := reader.Count(query); err != nil || n != 2 {
+		t.Errorf("Count = %d, %v, want 2", n, err)
+	}
+
+	// The reprojected box holds the reprojected edge everywhere
+	proj, _ := Transform(EPSGWGS84, 32633)
+	b := reprojectBound(query, proj)
+	for lon := 14.3; lon <= 16.1; lon += 0.001 {
+		for _, lat := range []float64{45, 46} {
+			if p := proj(orb.Point{lon, lat}); !b.Contains(p) {
+				t.Fatalf("bound %v misses %v, from %v", b, p, orb.Point{lon, lat})
+			}
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package flatgeobuf
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/flatgeobuf/flatgeobuf/src/go/flattypes"
+	"github.com/paulmach/orb/geojson"
+)
+
+// IntegerWidening selects the column type used for integers that do not fit
+// in an Int column.
+type IntegerWidening int
+
+const (
+	// WidenToLong stores wide integers as Long (or ULong).
+	WidenToLong IntegerWidening = iota
+	// WidenToDouble stores wide integers as Double.
+	WidenToDouble
+)
+
+// MixedTypePolicy selects how a column mixing numeric or boolean values with
+// strings is handled.
+type MixedTypePolicy int
+
+const (
+	// MixedAsString stores mixed columns as String.
+	MixedAsString MixedTypePolicy = iota
+	// MixedAsError makes schema inference fail with ErrPropertyMismatch.
+	MixedAsError
+)
+
+// SchemaPolicy configures schema inference.
+//
+// Numbers decoded from GeoJSON are float64, and are inferred as Double unless
+// NarrowIntegers is set. With it, a float64 with no fractional part within
+// ±2^53 is treated as an integer, so it is narrowed and, beyond the Int range,
+// widened as IntegerWidening says; a column with any other number is Double.
+type SchemaPolicy struct {
+	SampleSize      int             // Number of features to inspect (0 = all)
+	IntegerWidening IntegerWidening // Column type for integers wider than Int
+	MixedTypes      MixedTypePolicy // Handling of columns mixing numbers and strings
+	NarrowIntegers  bool            // Use Byte/Short columns when all values fit
+	AllNullable     bool            // Mark every column nullable (DefaultSchemaPolicy: true)
+}
+
+// DefaultSchemaPolicy returns the policy used when writing without an
+// explicit schema.
+func DefaultSchemaPolicy() *SchemaPolicy {
+	return &SchemaPolicy{
+		AllNullable: true,
+	}
+}
+
+// InferSchema infers a column schema from the properties of features.
+// The returned columns can be edited and passed as Options.Columns when
+// writing. Columns are ordered by first occurrence, with names new to a
+// feature taken in sorted order. When AllNullable is false, a column is
+// nullable only if it is missing or null in at least one sampled feature.
+func InferSchema(features []*geojson.Feature, policy *SchemaPolicy) ([]ColumnInfo, error) {
+	if policy == nil {
+		policy = DefaultSchemaPolicy()
+	}
+
+	if policy.SampleSize > 0 && len(features) > policy.SampleSize {
+		features = features[:policy.SampleSize]
+	}
+
+	inf := newSchemaInferrer(policy)
+	for _, f := range features {
+		if f == nil {
+			continue
+		}
+		if err := inf.add(f); err != nil {
+			return nil, err
+		}
+	}
+	return inf.columns(), nil
+}
+
+// schemaInferrer infers a column schema one feature at a time, so features
+// can be streamed rather than held in memory.
+type schemaInferrer struct {
+	policy      *SchemaPolicy
+	columnTypes map[string]flattypes.ColumnType
+	valueCounts map[string]int
+	columnOrder []string
+	sampled     int
+}
+
+func newSchemaInferrer(policy *SchemaPolicy) *schemaInferrer {
+	return &schemaInferrer{
+		policy:      policy,
+		columnTypes: make(map[string]flattypes.ColumnType),
+		valueCounts: make(map[string]int),
+	}
+}
+
+// add merges the properties of f into the schema.
+func (s *schemaInferrer) add(f *geojson.Feature) error {
+	s.sampled++
+
+	for _, name := range sortedKeys(f.Properties) {
+		// Track column order (first occurrence)
+		if _, exists := s.valueCounts[name]; !exists {
+			s.columnOrder = append(s.columnOrder, name)
+			s.valueCounts[name] = 0
+		}
+
+		value := f.Properties[name]
+		if value == nil {
+			continue // Nulls carry no type information
+		}
+		s.valueCounts[name]++
+
+		inferredType := inferColumnTypeWithPolicy(value, s.policy)
+		existingType, exists := s.columnTypes[name]
+		if !exists {
+			s.columnTypes[name] = inferredType
+			continue
+		}
+
+		merged, err := mergeColumnType(existingType, inferredType, s.policy)
+		if err != nil {
+			return fmt.Errorf("%w: column %q mixes %s and %s values",
+				ErrPropertyMismatch, name, existingType, inferredType)
+		}
+		s.columnTypes[name] = merged
+	}
+	return nil
+}
+
+// columns returns the schema of the features added so far.
+func (s *schemaInferrer) columns() []ColumnInfo {
+	columns := make([]ColumnInfo, 0, len(s.columnOrder))
+	for _, name := range s.columnOrder {
+		colType, ok := s.columnTypes[name]
+		if !ok {
+			colType = flattypes.ColumnTypeString // Only nulls seen
+		}
+		if s.policy.IntegerWidening == WidenToDouble &&
+			(colType == flattypes.ColumnTypeLong || colType == flattypes.ColumnTypeULong) {
+			colType = flattypes.ColumnTypeDouble
+		}
+
+		columns = append(columns, ColumnInfo{
+			Name:     name,
+			Type:     colType.String(),
+			Title:    name, // Set title to match name for JS library compatibility
+			Nullable: s.policy.AllNullable || s.valueCounts[name] < s.sampled,
+		})
+	}
+	return columns
+}
+
+// inferColumnTypeWithPolicy determines the column type for a value, narrowing
+// integers to the smallest signed type that holds them if the policy asks for it.
+func inferColumnTypeWithPolicy(value interface{}, policy *SchemaPolicy) flattypes.ColumnType {
+	if policy.NarrowIntegers {
+		if colType, ok := narrowIntegerType(value); ok {
+			return colType
+		}
+	}
+	return inferColumnType(value)
+}
+
+// maxExactFloat is 2^53, beyond which float64 cannot represent every integer.
+const maxExactFloat = 1 << 53
+
+// narrowIntegerType returns the smallest integer column type that can hold an
+// integer value, including a float64 with no fractional part within
+// ±maxExactFloat. It reports false for other values.
+func narrowIntegerType(value interface{}) (flattypes.ColumnType, bool) {
+	var i int64
+	switch v := value.(type) {
+	case int:
+		i = int64(v)
+	case int8:
+		i = int64(v)
+	case int16:
+		i = int64(v)
+	case int32:
+		i = int64(v)
+	case int64:
+		i = v
+	case uint:
+		if uint64(v) > math.MaxInt64 {
+			return flattypes.ColumnTypeULong, true
+		}
+		i = int64(v)
+	case uint8:
+		i = int64(v)
+	case uint16:
+		i = int64(v)
+	case uint32:
+		i = int64(v)
+	case uint64:
+		if v > math.MaxInt64 {
+			return flattypes.ColumnTypeULong, true
+		}
+		i = int64(v)
+	case float64:
+		// GeoJSON numbers decode as float64; those that are exact integers
+		// count as integers
+		if v != math.Trunc(v) || math.Abs(v) > maxExactFloat {
+			return 0, false
+		}
+		i = int64(v)
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			return 0, false
+		}
+		i = n
+	default:
+		return 0, false
+	}
+
+	switch {
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		return flattypes.ColumnTypeByte, true
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		return flattypes.ColumnTypeShort, true
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		return flattypes.ColumnTypeInt, true
+	default:
+		return flattypes.ColumnTypeLong, true
+	}
+}
+
+// mergeColumnType combines two inferred types for the same column according
+// to the policy.
+func mergeColumnType(a, b flattypes.ColumnType, policy *SchemaPolicy) (flattypes.ColumnType, error) {
+	if policy.MixedTypes == MixedAsError && a != b {
+		aString := a == flattypes.ColumnTypeString
+		bString := b == flattypes.ColumnTypeString
+		if (aString && isScalarColumnType(b)) || (bString && isScalarColumnType(a)) {
+			return 0, ErrPropertyMismatch
+		}
+	}
+	return promoteColumnType(a, b), nil
+}
+
+// isScalarColumnType reports whether t is a boolean or numeric column type.
+func isScalarColumnType(t flattypes.ColumnType) bool {
+	return t <= flattypes.ColumnTypeDouble
+}
@@ -0,0 +1,253 @@
+package flatgeobuf
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+func schemaTypes(columns []ColumnInfo) map[string]string {
+	types := make(map[string]string, len(columns))
+	for _, col := range columns {
+		types[col.Name] = col.Type
+	}
+	return types
+}
+
+func TestInferSchema_Default(t *testing.T) {
+	features := []*geojson.Feature{
+		{Geometry: orb.Point{1, 2}, Properties: geojson.Properties{"name": "a", "count": 1, "tag": nil}},
+		{Geometry: orb.Point{3, 4}, Properties: geojson.Properties{"name": "b", "count": 5000000000, "tag": 3}},
+	}
+
+	columns, err := InferSchema(features, nil)
+	if err != nil {
+		t.Fatalf("InferSchema failed: %v", err)
+	}
+
+	types := schemaTypes(columns)
+	expected := map[string]string{"name": "String", "count": "Long", "tag": "Int"}
+	for name, typ := range expected {
+		if types[name] != typ {
+			t.Errorf("column %q: expected %s, got %s", name, typ, types[name])
+		}
+	}
+
+	for _, col := range columns {
+		if !col.Nullable {
+			t.Errorf("column %q: expected nullable with default policy", col.Name)
+		}
+	}
+}
+
+func TestInferSchema_SampleSize(t *testing.T) {
+	features := []*geojson.Feature{
+		{Geometry: orb.Point{1, 2}, Properties: geojson.Properties{"value": 1}},
+		{Geometry: orb.Point{3, 4}, Properties: geojson.Properties{"value": "text", "late": true}},
+	}
+
+	columns, err := InferSchema(features, &SchemaPolicy{SampleSize: 1, AllNullable: true})
+	if err != nil {
+		t.Fatalf("InferSchema failed: %v", err)
+	}
+
+	if len(columns) != 1 || columns[0].Type != "Int" {
+		t.Errorf("expected only an Int column from the sample, got %+v", columns)
+	}
+}
+
+func TestInferSchema_IntegerWidening(t *testing.T) {
+	features := []*geojson.Feature{
+		{Geometry: orb.Point{1, 2}, Properties: geojson.Properties{"big": int64(1) << 40, "small": 7}},
+	}
+
+	columns, err := InferSchema(features, &SchemaPolicy{IntegerWidening: WidenToDouble})
+	if err != nil {
+		t.Fatalf("InferSchema failed: %v", err)
+	}
+
+	types := schemaTypes(columns)
+	if types["big"] != "Double" {
+		t.Errorf("expected big to widen to Double, got %s", types["big"])
+	}
+	if types["small"] != "Int" {
+		t.Errorf("expected small to stay Int, got %s", types["small"])
+	}
+}
+
+func TestInferSchema_MixedTypes(t *testing.T) {
+	features := []*geojson.Feature{
+		{Geometry: orb.Point{1, 2}, Properties: geojson.Properties{"code": 12}},
+		{Geometry: orb.Point{3, 4}, Properties: geojson.Properties{"code": "A12"}},
+	}
+
+	columns, err := InferSchema(features, &SchemaPolicy{MixedTypes: MixedAsString})
+	if err != nil {
+		t.Fatalf("InferSchema failed: %v", err)
+	}
+	if columns[0].Type != "String" {
+		t.Errorf("expected String for mixed column, got %s", columns[0].Type)
+	}
+
+	_, err = InferSchema(features, &SchemaPolicy{MixedTypes: MixedAsError})
+	if !errors.Is(err, ErrPropertyMismatch) {
+		t.Errorf("expected ErrPropertyMismatch, got %v", err)
+	}
+}
+
+func TestInferSchema_NarrowIntegers(t *testing.T) {
+	features := []*geojson.Feature{
+		{Geometry: orb.Point{1, 2}, Properties: geojson.Properties{"b": 5, "s": 100, "i": 40000}},
+		{Geometry: orb.Point{3, 4}, Properties: geojson.Properties{"b": -5, "s": 1000, "i": 1}},
+	}
+
+	columns, err := InferSchema(features, &SchemaPolicy{NarrowIntegers: true})
+	if err != nil {
+		t.Fatalf("InferSchema failed: %v", err)
+	}
+
+	types := schemaTypes(columns)
+	expected := map[string]string{"b": "Byte", "s": "Short", "i": "Int"}
+	for name, typ := range expected {
+		if types[name] != typ {
+			t.Errorf("column %q: expected %s, got %s", name, typ, types[name])
+		}
+	}
+}
+
+func TestInferSchema_Nullable(t *testing.T) {
+	features := []*geojson.Feature{
+		{Geometry: orb.Point{1, 2}, Properties: geojson.Properties{"always": 1, "sometimes": 1, "null": nil}},
+		{Geometry: orb.Point{3, 4}, Properties: geojson.Properties{"always": 2, "null": 2}},
+	}
+
+	columns, err := InferSchema(features, &SchemaPolicy{AllNullable: false})
+	if err != nil {
+		t.Fatalf("InferSchema failed: %v", err)
+	}
+
+	nullable := make(map[string]bool)
+	for _, col := range columns {
+		nullable[col.Name] = col.Nullable
+	}
+
+	if nullable["always"] {
+		t.Error("expected always to be non-nullable")
+	}
+	if !nullable["sometimes"] {
+		t.Error("expected sometimes to be nullable")
+	}
+	if !nullable["null"] {
+		t.Error("expected null to be nullable")
+	}
+}
+
+func TestWriteFeatures_EditedSchema(t *testing.T) {
+	fc := geojson.NewFeatureCollection()
+	f := geojson.NewFeature(orb.Point{1, 2})
+	f.Properties = geojson.Properties{"value": 42, "name": "x"}
+	fc.Append(f)
+
+	columns, err := InferSchema(fc.Features, nil)
+	if err != nil {
+		t.Fatalf("InferSchema failed: %v", err)
+	}
+	for i := range columns {
+		if columns[i].Name == "value" {
+			columns[i].Type = "Double"
+			columns[i].Description = "measured value"
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteFeatures(&buf, fc, &Options{IncludeIndex: true, Columns: columns}); err != nil {
+		t.Fatalf("WriteFeatures failed: %v", err)
+	}
+
+	reader, err := NewReaderFromData(buf.Bytes())
+	if err != nil {
+		t.Fatalf("NewReaderFromData failed: %v", err)
+	}
+
+	types := schemaTypes(reader.Header().Columns)
+	if types["value"] != "Double" {
+		t.Errorf("expected value column to be Double, got %s", types["value"])
+	}
+
+	result, err := reader.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if v := result.Features[0].Properties["value"]; v != 42.0 {
+		t.Errorf("expected 42.0, got %v (%T)", v, v)
+	}
+}
+
+func TestWriteFeatures_InvalidSchema(t *testing.T) {
+	fc := geojson.NewFeatureCollection()
+	fc.Append(geojson.NewFeature(orb.Point{1, 2}))
+
+	tests := []struct {
+		name    string
+		columns []ColumnInfo
+	}{
+		{"unknown type", []ColumnInfo{{Name: "a", Type: "Decimal"}}},
+		{"duplicate name", []ColumnInfo{{Name: "a", Type: "Int"}, {Name: "a", Type: "Long"}}},
+		{"empty name", []ColumnInfo{{Type: "Int"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := WriteFeatures(&bytes.Buffer{}, fc, &Options{Columns: tt.columns})
+			if !errors.Is(err, ErrInvalidColumn) {
+				t.Errorf("expected ErrInvalidColumn, got %v", err)
+			}
+		})
+	}
+}
+
+func TestWriteFeatures_ValueOutsideSampledSchema(t *testing.T) {
+	values := []interface{}{1, 2, 300, 5e9, "x", 2.75}
+	fc := geojson.NewFeatureCollection()
+	for _, v := range values {
+		f := geojson.NewFeature(orb.Point{1, 2})
+		f.Properties = geojson.Properties{"a": v}
+		fc.Append(f)
+	}
+
+	columns, err := InferSchema(fc.Features, &SchemaPolicy{SampleSize: 2, NarrowIntegers: true})
+	if err != nil {
+		t.Fatalf("InferSchema failed: %v", err)
+	}
+	if columns[0].Type != "Byte" {
+		t.Fatalf("expected Byte from the sample, got %s", columns[0].Type)
+	}
+
+	// 300 overflows the Byte column inferred from the first two features
+	err = WriteFeatures(&bytes.Buffer{}, fc, &Options{Columns: columns})
+	if !errors.Is(err, ErrPropertyMismatch) {
+		t.Fatalf("expected ErrPropertyMismatch, got %v", err)
+	}
+	if want := `column "a" in feature 2`; !strings.Contains(err.Error(), want) {
+		t.Errorf("expected error to name %s, got %v", want, err)
+	}
+
+	// Every later value is rejected by an Int column, nullable or not
+	for _, nullable := range []bool{false, true} {
+		for i, v := range values[3:] {
+			f := geojson.NewFeature(orb.Point{1, 2})
+			f.Properties = geojson.Properties{"a": v}
+			fc := &geojson.FeatureCollection{Features: []*geojson.Feature{f}}
+			columns := []ColumnInfo{{Name: "a", Type: "Int", Nullable: nullable}}
+			err := WriteFeatures(&bytes.Buffer{}, fc, &Options{Columns: columns})
+			if !errors.Is(err, ErrPropertyMismatch) {
+				t.Errorf("value %d (%v), nullable %v: expected ErrPropertyMismatch, got %v",
+					i+3, v, nullable, err)
+			}
+		}
+	}
+}
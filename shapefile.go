@@ -0,0 +1,1081 @@
+package flatgeobuf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/flatgeobuf/flatgeobuf/src/go/flattypes"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/planar"
+)
+
+// Shape types of the .shp format. Z and M variants add 10 and 20.
+const (
+	shapeNull       = 0
+	shapePoint      = 1
+	shapePolyLine   = 3
+	shapePolygon    = 5
+	shapeMultiPoint = 8
+	shapeMultiPatch = 31
+)
+
+// shpHeaderSize is the size of the .shp and .shx file headers.
+const shpHeaderSize = 100
+
+// Shapefile is the content of an ESRI Shapefile.
+type Shapefile struct {
+	Features *geojson.FeatureCollection // Shapes with their attributes, in record order
+	Columns  []ColumnInfo               // Attribute schema, from the .dbf fields
+	CRS      *CRS                       // From the .prj file (nil if there is none)
+}
+
+// ShapefileOptions configures WriteShapefile.
+type ShapefileOptions struct {
+	Columns []ColumnInfo // Attribute schema (default: inferred from the features)
+	CRS     *CRS         // Written as the .prj file, if it has WKT or a known code
+}
+
+// ReadShapefile reads the Shapefile at path, the .shp file or its name without
+// an extension, with the .dbf, .shx and .prj files beside it. Only the .shp
+// file is required; the .shx file, when present, locates the records.
+//
+// DBF fields map to columns as follows: C to String, N without decimals to
+// Int or Long by width, other N and F to Double, L to Bool and D to DateTime
+// (as "YYYY-MM-DD" strings), keeping the field width and decimal count as
+// Width and Precision. All columns are nullable. Text is read in the code page
+// named by the .cpg file or the .dbf language driver: UTF-8, Windows-1252 or
+// Latin-1. Without either, text that is not valid UTF-8 is read as Latin-1.
+// Polygon rings are grouped by orientation into Polygons or MultiPolygons; Z
+// and M values are dropped, and null shapes have a nil geometry. The .prj WKT
+// is kept in CRS.WKT, with the EPSG code of common systems.
+//
+// Malformed files return an error wrapping ErrInvalidData.
+func ReadShapefile(path string) (*Shapefile, error) {
+	base := shapefileBase(path)
+	shp, err := os.ReadFile(siblingFile(base, ".shp"))
+	if err != nil {
+		return nil, err
+	}
+	geometries, err := readShapes(shp, readOptionalFile(base, ".shx"))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Shapefile{Features: geojson.NewFeatureCollection()}
+	var records [][]interface{}
+	if dbf := readOptionalFile(base, ".dbf"); dbf != nil {
+		var fields []dbfField
+		decode := dbfDecoder(readOptionalFile(base, ".cpg"), dbf)
+		if fields, records, err = readDBF(dbf, decode); err != nil {
+			return nil, err
+		}
+		if len(records) != len(geometries) {
+			return nil, fmt.Errorf("%w: shapefile has %d shapes but %d attribute records",
+				ErrInvalidData, len(geometries), len(records))
+		}
+		for _, field := range fields {
+			result.Columns = append(result.Columns, field.column())
+		}
+	}
+	if prj := readOptionalFile(base, ".prj"); prj != nil {
+		result.CRS = crsFromWKT(strings.TrimSpace(string(prj)))
+	}
+
+	for i, g := range geometries {
+		f := geojson.NewFeature(g)
+		if records != nil {
+			for j, col := range result.Columns {
+				f.Properties[col.Name] = records[i][j]
+			}
+		}
+		result.Features.Append(f)
+	}
+	return result, nil
+}
+
+// ShapefileToFlatGeobuf converts the Shapefile at path, as read by
+// ReadShapefile, to FlatGeobuf written to w. Options default to
+// DefaultOptions(), which includes an index; opts.Columns and opts.CRS, when
+// nil, are taken from the .dbf fields and the .prj file. Null shapes are
+// skipped, as features without a geometry are by WriteFeatures.
+func ShapefileToFlatGeobuf(path string, w io.Writer, opts *Options) error {
+	shapefile, err := ReadShapefile(path)
+	if err != nil {
+		return err
+	}
+
+	o := DefaultOptions()
+	if opts != nil {
+		o = new(Options)
+		*o = *opts
+	}
+	if o.Columns == nil && len(shapefile.Columns) > 0 {
+		o.Columns = shapefile.Columns
+	}
+	if o.CRS == nil {
+		o.CRS = shapefile.CRS
+	}
+	return WriteFeatures(w, shapefile.Features, o)
+}
+
+// FlatGeobufToShapefile writes the features of r as a Shapefile at path, with
+// the file's columns and CRS, as WriteShapefile does.
+func FlatGeobufToShapefile(r *Reader, path string) error {
+	fc, err := r.ReadAll()
+	if err != nil {
+		return err
+	}
+	header := r.Header()
+	return WriteShapefile(path, fc, &ShapefileOptions{Columns: header.Columns, CRS: header.CRS})
+}
+
+// shapefileBase returns path without a .shp extension.
+func shapefileBase(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".shp") {
+		return path[:len(path)-4]
+	}
+	return path
+}
+
+// siblingFile returns the file of a Shapefile with the given extension,
+// preferring an existing upper-case variant when the lower-case one is absent.
+func siblingFile(base, ext string) string {
+	lower := base + ext
+	if fileExists(lower) {
+		return lower
+	}
+	if upper := base + strings.ToUpper(ext); fileExists(upper) {
+		return upper
+	}
+	return lower
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// readOptionalFile returns the content of a Shapefile's file with the given
+// extension, or nil if it cannot be read.
+func readOptionalFile(base, ext string) []byte {
+	data, err := os.ReadFile(siblingFile(base, ext))
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// readShapes decodes the records of a .shp file, located through the .shx
+// file if one is given.
+func readShapes(shp, shx []byte) ([]orb.Geometry, error) {
+	if len(shp) < shpHeaderSize || binary.BigEndian.Uint32(shp) != 9994 {
+		return nil, fmt.Errorf("%w: not a shapefile", ErrInvalidData)
+	}
+	end := int64(binary.BigEndian.Uint32(shp[24:])) * 2
+	if end > int64(len(shp)) {
+		end = int64(len(shp)) // Tolerate a wrong length, as other readers do
+	}
+
+	var geometries []orb.Geometry
+	read := func(offset int64, i int) error {
+		if offset < shpHeaderSize || offset+8 > end {
+			return fmt.Errorf("%w: shape %d at offset %d is outside the file", ErrInvalidData, i, offset)
+		}
+		size := int64(binary.BigEndian.Uint32(shp[offset+4:])) * 2
+		if size > end-offset-8 {
+			return fmt.Errorf("%w: shape %d exceeds the file size", ErrInvalidData, i)
+		}
+		g, err := parseShape(shp[offset+8 : offset+8+size])
+		if err != nil {
+			return fmt.Errorf("shape %d: %w", i, err)
+		}
+		geometries = append(geometries, g)
+		return nil
+	}
+
+	if len(shx) >= shpHeaderSize {
+		records := shx[shpHeaderSize:]
+		for i := 0; i+8 <= len(records); i += 8 {
+			if err := read(int64(binary.BigEndian.Uint32(records[i:]))*2, i/8); err != nil {
+				return nil, err
+			}
+		}
+		return geometries, nil
+	}
+
+	for offset := int64(shpHeaderSize); offset < end; {
+		if err := read(offset, len(geometries)); err != nil {
+			return nil, err
+		}
+		offset += 8 + int64(binary.BigEndian.Uint32(shp[offset+4:]))*2
+	}
+	return geometries, nil
+}
+
+// parseShape decodes the content of a .shp record.
+func parseShape(data []byte) (orb.Geometry, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("%w: shape is truncated", ErrInvalidData)
+	}
+	typ := int(binary.LittleEndian.Uint32(data))
+	if typ == shapeNull {
+		return nil, nil
+	}
+	if typ == shapeMultiPatch {
+		return nil, fmt.Errorf("%w: MultiPatch shapes", ErrUnsupportedType)
+	}
+	if typ > 30 || typ%10 == 0 {
+		return nil, fmt.Errorf("%w: shape type %d", ErrInvalidData, typ)
+	}
+	data = data[4:]
+
+	switch typ % 10 {
+	case shapePoint:
+		if len(data) < 16 {
+			return nil, fmt.Errorf("%w: point is truncated", ErrInvalidData)
+		}
+		return shpPoint(data, 0), nil
+
+	case shapeMultiPoint:
+		if len(data) < 36 {
+			return nil, fmt.Errorf("%w: multipoint is truncated", ErrInvalidData)
+		}
+		n := uint64(binary.LittleEndian.Uint32(data[32:]))
+		points := data[36:]
+		if n > uint64(len(points)/16) {
+			return nil, fmt.Errorf("%w: multipoint has %d points in %d bytes", ErrInvalidData, n, len(points))
+		}
+		mp := make(orb.MultiPoint, n)
+		for i := range mp {
+			mp[i] = shpPoint(points, i)
+		}
+		return mp, nil
+
+	case shapePolyLine, shapePolygon:
+		parts, err := shpParts(data)
+		if err != nil {
+			return nil, err
+		}
+		if typ%10 == shapePolyLine {
+			if len(parts) == 1 {
+				return orb.LineString(parts[0]), nil
+			}
+			mls := make(orb.MultiLineString, len(parts))
+			for i, part := range parts {
+				mls[i] = orb.LineString(part)
+			}
+			return mls, nil
+		}
+		rings := make([]orb.Ring, len(parts))
+		for i, part := range parts {
+			rings[i] = orb.Ring(part)
+		}
+		return assemblePolygons(rings), nil
+	}
+	return nil, fmt.Errorf("%w: shape type %d", ErrInvalidData, typ)
+}
+
+// shpPoint decodes point i of a run of x, y pairs.
+func shpPoint(data []byte, i int) orb.Point {
+	return orb.Point{
+		math.Float64frombits(binary.LittleEndian.Uint64(data[16*i:])),
+		math.Float64frombits(binary.LittleEndian.Uint64(data[16*i+8:])),
+	}
+}
+
+// shpParts decodes the parts of a polyline or polygon, after its type.
+func shpParts(data []byte) ([][]orb.Point, error) {
+	if len(data) < 40 {
+		return nil, fmt.Errorf("%w: shape is truncated", ErrInvalidData)
+	}
+	numParts := uint64(binary.LittleEndian.Uint32(data[32:]))
+	numPoints := uint64(binary.LittleEndian.Uint32(data[36:]))
+	data = data[40:]
+	if numParts > uint64(len(data)/4) || numPoints > uint64(len(data)-4*int(numParts))/16 {
+		return nil, fmt.Errorf("%w: shape has %d parts and %d points in %d bytes",
+			ErrInvalidData, numParts, numPoints, len(data))
+	}
+
+	points := make([]orb.Point, numPoints)
+	coords := data[4*numParts:]
+	for i := range points {
+		points[i] = shpPoint(coords, i)
+	}
+
+	parts := make([][]orb.Point, numParts)
+	for i := range parts {
+		start := uint64(binary.LittleEndian.Uint32(data[4*i:]))
+		end := numPoints
+		if i+1 < len(parts) {
+			end = uint64(binary.LittleEndian.Uint32(data[4*i+4:]))
+		}
+		if start > end || end > numPoints {
+			return nil, fmt.Errorf("%w: shape part %d spans points %d to %d of %d",
+				ErrInvalidData, i, start, end, numPoints)
+		}
+		parts[i] = points[start:end:end]
+	}
+	return parts, nil
+}
+
+// assemblePolygons groups shapefile rings into polygons: clockwise rings are
+// outer rings, and each counter-clockwise ring is a hole of the first outer
+// ring containing it. Holes outside every outer ring become polygons of their
+// own.
+func assemblePolygons(rings []orb.Ring) orb.Geometry {
+	var polygons orb.MultiPolygon
+	var holes []orb.Ring
+	for _, ring := range rings {
+		if ring.Orientation() == orb.CCW {
+			holes = append(holes, ring)
+		} else {
+			polygons = append(polygons, orb.Polygon{ring})
+		}
+	}
+
+	for _, hole := range holes {
+		owner := -1
+		for i, poly := range polygons {
+			if len(hole) > 0 && planar.RingContains(poly[0], hole[0]) {
+				owner = i
+				break
+			}
+		}
+		if owner < 0 {
+			polygons = append(polygons, orb.Polygon{hole})
+		} else {
+			polygons[owner] = append(polygons[owner], hole)
+		}
+	}
+
+	if len(polygons) == 1 {
+		return polygons[0]
+	}
+	return polygons
+}
+
+// dbfField describes a field of a .dbf file.
+type dbfField struct {
+	name     string
+	typ      byte
+	length   int
+	decimals int
+}
+
+// column returns the FlatGeobuf column a DBF field maps to.
+func (f dbfField) column() ColumnInfo {
+	col := ColumnInfo{Name: f.name, Title: f.name, Nullable: true, Width: f.length}
+	switch f.typ {
+	case 'N', 'F':
+		col.Precision = f.decimals
+		switch {
+		case f.typ == 'F' || f.decimals > 0:
+			col.Type = "Double"
+		case f.length < 10:
+			col.Type = "Int"
+		case f.length < 19:
+			col.Type = "Long"
+		default:
+			col.Type = "Double"
+		}
+	case 'L':
+		col.Type = "Bool"
+	case 'D':
+		col.Type = "DateTime"
+	default:
+		col.Type = "String"
+	}
+	return col
+}
+
+// readDBF decodes the fields and records of a .dbf file. Deleted records are
+// kept, as they still pair with shapes.
+func readDBF(data []byte, decode func([]byte) string) ([]dbfField, [][]interface{}, error) {
+	if len(data) < 32 {
+		return nil, nil, fmt.Errorf("%w: dbf header is truncated", ErrInvalidData)
+	}
+	count := int(binary.LittleEndian.Uint32(data[4:]))
+	headerSize := int(binary.LittleEndian.Uint16(data[8:]))
+	recordSize := int(binary.LittleEndian.Uint16(data[10:]))
+	if headerSize < 33 || headerSize > len(data) {
+		return nil, nil, fmt.Errorf("%w: dbf header size %d", ErrInvalidData, headerSize)
+	}
+
+	var fields []dbfField
+	width := 1 // Deletion flag
+	for pos := 32; pos+32 <= headerSize && data[pos] != 0x0d; pos += 32 {
+		desc := data[pos : pos+32]
+		name := desc[:11]
+		if i := bytes.IndexByte(name, 0); i >= 0 {
+			name = name[:i]
+		}
+		field := dbfField{
+			name:     strings.TrimSpace(decode(name)),
+			typ:      desc[11],
+			length:   int(desc[16]),
+			decimals: int(desc[17]),
+		}
+		if field.typ == 'C' {
+			field.length += int(desc[17]) << 8 // Long character fields use both bytes
+			field.decimals = 0
+		}
+		fields = append(fields, field)
+		width += field.length
+	}
+	if width > recordSize {
+		return nil, nil, fmt.Errorf("%w: dbf fields span %d bytes of a %d byte record", ErrInvalidData, width, recordSize)
+	}
+	if recordSize > 0 && count > (len(data)-headerSize)/recordSize {
+		return nil, nil, fmt.Errorf("%w: dbf declares %d records in %d bytes", ErrInvalidData, count, len(data)-headerSize)
+	}
+
+	records := make([][]interface{}, count)
+	for i := range records {
+		record := data[headerSize+i*recordSize+1:]
+		values := make([]interface{}, len(fields))
+		for j, field := range fields {
+			values[j] = field.value(record[:field.length], decode)
+			record = record[field.length:]
+		}
+		records[i] = values
+	}
+	return fields, records, nil
+}
+
+// value decodes a field value, returning nil for blank values.
+func (f dbfField) value(raw []byte, decode func([]byte) string) interface{} {
+	text := strings.TrimSpace(decode(raw))
+	if text == "" || (f.typ != 'C' && strings.Trim(text, "*?") == "") {
+		return nil
+	}
+
+	switch f.column().Type {
+	case "Int":
+		if v, err := strconv.ParseInt(text, 10, 32); err == nil {
+			return int32(v)
+		}
+	case "Long":
+		if v, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return v
+		}
+	case "Double":
+		if v, err := strconv.ParseFloat(text, 64); err == nil {
+			return v
+		}
+	case "Bool":
+		switch text[0] {
+		case 'T', 't', 'Y', 'y':
+			return true
+		case 'F', 'f', 'N', 'n':
+			return false
+		}
+	case "DateTime":
+		if t, err := time.Parse("20060102", text); err == nil {
+			return t.Format("2006-01-02")
+		}
+		return text
+	default:
+		return strings.TrimRight(decode(raw), " ")
+	}
+	return nil // Unparseable values are treated as null
+}
+
+// dbfDecoder returns the text decoder for the code page named by a .cpg
+// file or, failing that, by the language driver ID of a .dbf header.
+func dbfDecoder(cpg, dbf []byte) func([]byte) string {
+	switch strings.ToUpper(strings.TrimSpace(string(cpg))) {
+	case "UTF-8", "UTF8", "65001":
+		return decodeUTF8
+	case "1252", "CP1252", "WINDOWS-1252", "ANSI 1252":
+		return decodeWindows1252
+	case "ISO-8859-1", "ISO88591", "8859-1", "88591", "LATIN1":
+		return decodeLatin1
+	}
+	if len(dbf) > 29 {
+		switch dbf[29] {
+		case 0x03, 0x57: // Windows ANSI, ESRI ANSI
+			return decodeWindows1252
+		}
+	}
+	return decodeText
+}
+
+// decodeText returns b as a string, reading it as Latin-1 if it is not
+// valid UTF-8.
+func decodeText(b []byte) string {
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	return decodeLatin1(b)
+}
+
+// decodeUTF8 returns b as a string, replacing invalid UTF-8.
+func decodeUTF8(b []byte) string {
+	return strings.ToValidUTF8(string(b), "\uFFFD")
+}
+
+// decodeLatin1 returns b read as ISO 8859-1.
+func decodeLatin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// windows1252 maps bytes 0x80 to 0x9F of Windows-1252, where it departs from
+// Latin-1. Undefined bytes keep their Latin-1 control character.
+var windows1252 = [32]rune{
+	'\u20ac', '\u0081', '\u201a', '\u0192', '\u201e', '\u2026', '\u2020', '\u2021',
+	'\u02c6', '\u2030', '\u0160', '\u2039', '\u0152', '\u008d', '\u017d', '\u008f',
+	'\u0090', '\u2018', '\u2019', '\u201c', '\u201d', '\u2022', '\u2013', '\u2014',
+	'\u02dc', '\u2122', '\u0161', '\u203a', '\u0153', '\u009d', '\u017e', '\u0178',
+}
+
+// decodeWindows1252 returns b read as Windows-1252.
+func decodeWindows1252(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+		if c >= 0x80 && c < 0xa0 {
+			runes[i] = windows1252[c-0x80]
+		}
+	}
+	return string(runes)
+}
+
+// Spatial references of the .prj file, as ESRI software writes them, for CRSs
+// given only by code.
+var prjByCode = map[int]string{
+	4326: `GEOGCS["GCS_WGS_1984",DATUM["D_WGS_1984",SPHEROID["WGS_1984",6378137.0,298.257223563]],` +
+		`PRIMEM["Greenwich",0.0],UNIT["Degree",0.0174532925199433]]`,
+	3857: `PROJCS["WGS_1984_Web_Mercator_Auxiliary_Sphere",GEOGCS["GCS_WGS_1984",DATUM["D_WGS_1984",` +
+		`SPHEROID["WGS_1984",6378137.0,298.257223563]],PRIMEM["Greenwich",0.0],UNIT["Degree",0.0174532925199433]],` +
+		`PROJECTION["Mercator_Auxiliary_Sphere"],PARAMETER["False_Easting",0.0],PARAMETER["False_Northing",0.0],` +
+		`PARAMETER["Central_Meridian",0.0],PARAMETER["Standard_Parallel_1",0.0],` +
+		`PARAMETER["Auxiliary_Sphere_Type",0.0],UNIT["Meter",1.0]]`,
+}
+
+// EPSG codes of common coordinate systems by normalized WKT name, covering
+// ESRI and EPSG spellings.
+var codeByCRSName = map[string]int{
+	"gcs_wgs_1984":                           4326,
+	"wgs_84":                                 4326,
+	"wgs84":                                  4326,
+	"wgs_1984_web_mercator_auxiliary_sphere": 3857,
+	"wgs_1984_web_mercator":                  3857,
+	"wgs_84_/_pseudo_mercator":               3857,
+	"gcs_etrs_1989":                          4258,
+	"etrs89":                                 4258,
+	"etrs_1989_laea":                         3035,
+	"etrs89_/_laea_europe":                   3035,
+	"etrs89_extended_/_laea_europe":          3035,
+}
+
+var (
+	wktNamePattern = regexp.MustCompile(`^\s*(?:PROJCS|GEOGCS|PROJCRS|GEOGCRS)\s*\[\s*"([^"]*)"`)
+	utmNamePattern = regexp.MustCompile(`^wgs_(?:1984|84)_(?:/_)?utm_zone_(\d{1,2})([ns])$`)
+)
+
+// crsFromWKT builds a CRS from WKT, with the name of its root and an EPSG
+// code from its root authority or, failing that, its name.
+func crsFromWKT(wkt string) *CRS {
+	crs := &CRS{WKT: wkt}
+	if m := wktNamePattern.FindStringSubmatch(wkt); m != nil {
+		crs.Name = m[1]
+	}
+	crs.Code = rootAuthorityCode(wkt)
+	if crs.Code == 0 {
+		name := strings.ToLower(strings.ReplaceAll(crs.Name, " ", "_"))
+		crs.Code = codeByCRSName[name]
+		if m := utmNamePattern.FindStringSubmatch(name); m != nil {
+			zone, _ := strconv.Atoi(m[1])
+			if zone >= 1 && zone <= 60 {
+				crs.Code = 32600 + zone
+				if m[2] == "s" {
+					crs.Code = 32700 + zone
+				}
+			}
+		}
+	}
+	return crs
+}
+
+// rootAuthorityCode returns the EPSG code of the AUTHORITY or ID element
+// directly inside the root of wkt, or 0.
+func rootAuthorityCode(wkt string) int {
+	depth := 0
+	quoted := false
+	for i := 0; i < len(wkt); i++ {
+		switch c := wkt[i]; {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '[' || c == '(':
+			depth++
+		case c == ']' || c == ')':
+			depth--
+		case depth == 1:
+			rest := wkt[i:]
+			for _, prefix := range []string{`AUTHORITY["EPSG",`, `ID["EPSG",`} {
+				if end := strings.IndexByte(rest, ']'); end >= 0 && strings.HasPrefix(rest, prefix) {
+					digits := strings.Trim(rest[len(prefix):end], `" `)
+					if code, err := strconv.Atoi(digits); err == nil {
+						return code
+					}
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// prjForCRS returns the .prj content for crs: its WKT, WKT held in its
+// description, or a known spatial reference for its code.
+func prjForCRS(crs *CRS) string {
+	switch {
+	case crs == nil:
+		return ""
+	case crs.WKT != "":
+		return crs.WKT
+	case wktNamePattern.MatchString(crs.Description):
+		return crs.Description
+	}
+	return prjByCode[crs.Code]
+}
+
+// WriteShapefile writes fc as a Shapefile: the .shp, .shx and .dbf files at
+// path (with or without the .shp extension), a .cpg file declaring UTF-8
+// text, and a .prj file when opts.CRS has WKT or is EPSG:4326 or 3857.
+//
+// Every geometry must be of one family: points, multipoints, lines or
+// polygons; features without a geometry are written as null shapes.
+// Collections return ErrUnsupportedType. Columns map to DBF fields as
+// ReadShapefile reads them back, with names truncated to 10 bytes and made
+// unique; Binary columns return ErrInvalidColumn. Text longer than a field is
+// truncated, while numbers that do not fit return ErrPropertyMismatch.
+func WriteShapefile(path string, fc *geojson.FeatureCollection, opts *ShapefileOptions) error {
+	if opts == nil {
+		opts = &ShapefileOptions{}
+	}
+	if fc == nil {
+		fc = geojson.NewFeatureCollection()
+	}
+
+	columns := opts.Columns
+	if columns == nil {
+		var err error
+		if columns, err = InferSchema(fc.Features, nil); err != nil {
+			return err
+		}
+	}
+	fields, err := dbfFields(columns, fc.Features)
+	if err != nil {
+		return err
+	}
+
+	shapeType := shapeNull
+	for i, f := range fc.Features {
+		if f == nil || f.Geometry == nil {
+			continue
+		}
+		typ, err := shapeTypeOf(f.Geometry)
+		if err != nil {
+			return fmt.Errorf("feature %d: %w", i, err)
+		}
+		if shapeType != shapeNull && typ != shapeType {
+			return fmt.Errorf("%w: feature %d is a %s, others are %s",
+				ErrUnsupportedType, i, shapeTypeName(typ), shapeTypeName(shapeType))
+		}
+		shapeType = typ
+	}
+
+	var shp, shx, dbf bytes.Buffer
+	bound := emptyBound
+	shp.Write(make([]byte, shpHeaderSize))
+	shx.Write(make([]byte, shpHeaderSize))
+	for i, f := range fc.Features {
+		var g orb.Geometry
+		if f != nil {
+			g = f.Geometry
+		}
+		content := encodeShape(g, shapeType)
+		if g != nil {
+			bound = extendEnvelope(bound, g)
+		}
+
+		// The .shx record holds the offset and the .shp record the number,
+		// each followed by the content length, in 16-bit words
+		var record [8]byte
+		binary.BigEndian.PutUint32(record[:], uint32(shp.Len()/2))
+		binary.BigEndian.PutUint32(record[4:], uint32(len(content)/2))
+		shx.Write(record[:])
+		binary.BigEndian.PutUint32(record[:], uint32(i+1))
+		shp.Write(record[:])
+		shp.Write(content)
+	}
+	if shp.Len() > math.MaxInt32 {
+		return fmt.Errorf("flatgeobuf: shapefile of %d bytes exceeds the 2 GiB limit", shp.Len())
+	}
+	writeShpHeader(shp.Bytes(), shapeType, bound)
+	writeShpHeader(shx.Bytes(), shapeType, bound)
+
+	if err := writeDBF(&dbf, fields, fc.Features); err != nil {
+		return err
+	}
+
+	base := shapefileBase(path)
+	files := []struct {
+		ext  string
+		data []byte
+	}{
+		{".shp", shp.Bytes()},
+		{".shx", shx.Bytes()},
+		{".dbf", dbf.Bytes()},
+		{".cpg", []byte("UTF-8")},
+	}
+	if prj := prjForCRS(opts.CRS); prj != "" {
+		files = append(files, struct {
+			ext  string
+			data []byte
+		}{".prj", []byte(prj)})
+	}
+	for _, file := range files {
+		if err := os.WriteFile(base+file.ext, file.data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shapeTypeOf returns the shape type that stores g.
+func shapeTypeOf(g orb.Geometry) (int, error) {
+	switch g.(type) {
+	case orb.Point:
+		return shapePoint, nil
+	case orb.MultiPoint:
+		return shapeMultiPoint, nil
+	case orb.LineString, orb.MultiLineString:
+		return shapePolyLine, nil
+	case orb.Ring, orb.Polygon, orb.MultiPolygon, orb.Bound:
+		return shapePolygon, nil
+	}
+	return 0, fmt.Errorf("%w: %T in a shapefile", ErrUnsupportedType, g)
+}
+
+func shapeTypeName(typ int) string {
+	switch typ {
+	case shapePoint:
+		return "point"
+	case shapeMultiPoint:
+		return "multipoint"
+	case shapePolyLine:
+		return "line"
+	case shapePolygon:
+		return "polygon"
+	}
+	return "null shape"
+}
+
+// encodeShape returns the content of the .shp record for g, which is nil or
+// of the given shape type.
+func encodeShape(g orb.Geometry, shapeType int) []byte {
+	var b []byte
+	if g == nil {
+		return binary.LittleEndian.AppendUint32(b, shapeNull)
+	}
+	b = binary.LittleEndian.AppendUint32(b, uint32(shapeType))
+
+	var parts [][]orb.Point
+	switch v := g.(type) {
+	case orb.Point:
+		return appendShpPoints(b, v)
+	case orb.MultiPoint:
+		b = appendShpBox(b, v.Bound())
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(v)))
+		return appendShpPoints(b, v...)
+	case orb.LineString:
+		parts = [][]orb.Point{v}
+	case orb.MultiLineString:
+		for _, ls := range v {
+			parts = append(parts, ls)
+		}
+	case orb.Ring:
+		parts = shpRings(orb.Polygon{v})
+	case orb.Polygon:
+		parts = shpRings(v)
+	case orb.Bound:
+		parts = shpRings(boundToPolygon(v))
+	case orb.MultiPolygon:
+		for _, poly := range v {
+			parts = append(parts, shpRings(poly)...)
+		}
+	}
+
+	b = appendShpBox(b, g.Bound())
+	total := 0
+	for _, part := range parts {
+		total += len(part)
+	}
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(parts)))
+	b = binary.LittleEndian.AppendUint32(b, uint32(total))
+	start := 0
+	for _, part := range parts {
+		b = binary.LittleEndian.AppendUint32(b, uint32(start))
+		start += len(part)
+	}
+	for _, part := range parts {
+		b = appendShpPoints(b, part...)
+	}
+	return b
+}
+
+// shpRings returns the rings of a polygon oriented as shapefiles require:
+// the outer ring clockwise and holes counter-clockwise. Rings are copied
+// before being reversed.
+func shpRings(poly orb.Polygon) [][]orb.Point {
+	rings := make([][]orb.Point, len(poly))
+	for i, ring := range poly {
+		want := orb.CCW
+		if i == 0 {
+			want = orb.CW
+		}
+		if o := ring.Orientation(); o != 0 && o != want {
+			ring = ring.Clone()
+			ring.Reverse()
+		}
+		rings[i] = ring
+	}
+	return rings
+}
+
+func appendShpBox(b []byte, bound orb.Bound) []byte {
+	for _, v := range []float64{bound.Min[0], bound.Min[1], bound.Max[0], bound.Max[1]} {
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(v))
+	}
+	return b
+}
+
+func appendShpPoints(b []byte, points ...orb.Point) []byte {
+	for _, p := range points {
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(p[0]))
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(p[1]))
+	}
+	return b
+}
+
+// writeShpHeader fills the header of a .shp or .shx file.
+func writeShpHeader(b []byte, shapeType int, bound orb.Bound) {
+	binary.BigEndian.PutUint32(b, 9994)
+	binary.BigEndian.PutUint32(b[24:], uint32(len(b)/2))
+	binary.LittleEndian.PutUint32(b[28:], 1000)
+	binary.LittleEndian.PutUint32(b[32:], uint32(shapeType))
+	if bound.IsEmpty() {
+		bound = orb.Bound{}
+	}
+	appendShpBox(b[36:36], bound)
+}
+
+// dbfColumn is a column written as a DBF field.
+type dbfColumn struct {
+	dbfField
+	source  string // Property name
+	colType flattypes.ColumnType
+}
+
+// dbfFields maps columns to DBF fields, sizing text fields to the longest
+// value when the column has no width.
+func dbfFields(columns []ColumnInfo, features []*geojson.Feature) ([]dbfColumn, error) {
+	fields := make([]dbfColumn, 0, len(columns))
+	used := make(map[string]bool, len(columns))
+	for _, col := range columns {
+		colType, ok := flattypes.EnumValuesColumnType[col.Type]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q for column %q", ErrInvalidColumn, col.Type, col.Name)
+		}
+		field := dbfColumn{source: col.Name, colType: colType}
+		field.name = dbfFieldName(col.Name, used)
+
+		switch colType {
+		case flattypes.ColumnTypeBool:
+			field.typ, field.length = 'L', 1
+		case flattypes.ColumnTypeByte, flattypes.ColumnTypeUByte, flattypes.ColumnTypeShort,
+			flattypes.ColumnTypeUShort, flattypes.ColumnTypeInt, flattypes.ColumnTypeUInt:
+			field.typ, field.length = 'N', 11
+		case flattypes.ColumnTypeLong, flattypes.ColumnTypeULong:
+			field.typ, field.length = 'N', 20
+		case flattypes.ColumnTypeFloat, flattypes.ColumnTypeDouble:
+			field.typ, field.length, field.decimals = 'N', 24, 15
+			if col.Width > 0 || col.Precision > 0 {
+				field.decimals = max(col.Precision, 0)
+			}
+		case flattypes.ColumnTypeDateTime:
+			field.typ, field.length = 'D', 8
+		case flattypes.ColumnTypeString, flattypes.ColumnTypeJson:
+			field.typ, field.length = 'C', 1
+			for _, f := range features {
+				if f != nil && f.Properties[col.Name] != nil {
+					if n := len(toString(f.Properties[col.Name])); n > field.length {
+						field.length = n
+					}
+				}
+			}
+		default:
+			return nil, fmt.Errorf("%w: %s column %q cannot be stored in a DBF file", ErrInvalidColumn, col.Type, col.Name)
+		}
+		if col.Width > 0 && field.typ != 'L' && field.typ != 'D' {
+			field.length = col.Width
+		}
+		if field.length > 254 {
+			field.length = 254
+		}
+		if field.decimals > field.length-2 {
+			field.decimals = max(field.length-2, 0)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// dbfFieldName returns name truncated to the 10 bytes DBF allows, replacing
+// its end with a number if the result is already used.
+func dbfFieldName(name string, used map[string]bool) string {
+	candidate := truncateUTF8(name, 10)
+	for i := 1; used[strings.ToUpper(candidate)]; i++ {
+		suffix := "_" + strconv.Itoa(i)
+		candidate = truncateUTF8(name, 10-len(suffix)) + suffix
+	}
+	used[strings.ToUpper(candidate)] = true
+	return candidate
+}
+
+// truncateUTF8 returns the longest prefix of s of at most n bytes that does
+// not split a character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// writeDBF writes the header and records of a .dbf file.
+func writeDBF(w *bytes.Buffer, fields []dbfColumn, features []*geojson.Feature) error {
+	recordSize := 1
+	for _, field := range fields {
+		recordSize += field.length
+	}
+	headerSize := 32 + 32*len(fields) + 1
+	if headerSize > math.MaxUint16 || recordSize > math.MaxUint16 {
+		return fmt.Errorf("%w: too many DBF fields (%d)", ErrInvalidColumn, len(fields))
+	}
+
+	now := time.Now()
+	header := make([]byte, 32)
+	header[0] = 0x03
+	header[1], header[2], header[3] = byte(now.Year()-1900), byte(now.Month()), byte(now.Day())
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(features)))
+	binary.LittleEndian.PutUint16(header[8:], uint16(headerSize))
+	binary.LittleEndian.PutUint16(header[10:], uint16(recordSize))
+	w.Write(header)
+	for _, field := range fields {
+		desc := make([]byte, 32)
+		copy(desc[:10], field.name)
+		desc[11] = field.typ
+		desc[16] = byte(field.length)
+		desc[17] = byte(field.decimals)
+		w.Write(desc)
+	}
+	w.WriteByte(0x0d)
+
+	for i, f := range features {
+		w.WriteByte(' ')
+		for _, field := range fields {
+			var value interface{}
+			if f != nil {
+				value = f.Properties[field.source]
+			}
+			text, err := field.format(value)
+			if err != nil {
+				return fmt.Errorf("feature %d: %w", i, err)
+			}
+			w.WriteString(text)
+		}
+	}
+	w.WriteByte(0x1a)
+	return nil
+}
+
+// format returns value as the text of the field, padded to its length.
+func (f dbfColumn) format(value interface{}) (string, error) {
+	if value == nil {
+		if f.typ == 'L' {
+			return "?", nil
+		}
+		return strings.Repeat(" ", f.length), nil
+	}
+
+	mismatch := func() error {
+		return fmt.Errorf("%w: column %q cannot hold %v in a %d character DBF field",
+			ErrPropertyMismatch, f.source, value, f.length)
+	}
+
+	var text string
+	switch f.typ {
+	case 'L':
+		v, ok := value.(bool)
+		if !ok {
+			return "", mismatch()
+		}
+		if v {
+			return "T", nil
+		}
+		return "F", nil
+
+	case 'D':
+		s := toString(value)
+		t, err := time.Parse("2006-01-02", truncateUTF8(s, 10))
+		if err != nil {
+			return "", mismatch()
+		}
+		return t.Format("20060102"), nil
+
+	case 'N':
+		if f.colType == flattypes.ColumnTypeFloat || f.colType == flattypes.ColumnTypeDouble {
+			// Without decimals a fraction would be rounded away
+			v, ok := toFloat64(value)
+			if !ok || math.IsNaN(v) || math.IsInf(v, 0) || (f.decimals == 0 && v != math.Trunc(v)) {
+				return "", mismatch()
+			}
+			text = strconv.FormatFloat(v, 'f', f.decimals, 64)
+		} else if v, ok := toUint64(value); ok {
+			// Unsigned first, so ULong values above MaxInt64 keep their sign
+			text = strconv.FormatUint(v, 10)
+		} else if v, ok := toInt64(value); ok {
+			text = strconv.FormatInt(v, 10)
+		} else {
+			return "", mismatch()
+		}
+		if len(text) > f.length {
+			return "", mismatch()
+		}
+		return strings.Repeat(" ", f.length-len(text)) + text, nil
+
+	default:
+		text = truncateUTF8(toString(value), f.length)
+		return text + strings.Repeat(" ", f.length-len(text)), nil
+	}
+}
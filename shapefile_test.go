@@ -0,0 +1,456 @@
+package flatgeobuf
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+func shapefileFeatures() *geojson.FeatureCollection {
+	fc := geojson.NewFeatureCollection()
+	geometries := []orb.Geometry{
+		// Counter-clockwise outer ring, clockwise hole: reoriented on write
+		orb.Polygon{{{0, 0}, {10, 0}, {10, 10}, {0, 10}, {0, 0}}, {{2, 2}, {2, 4}, {4, 4}, {4, 2}, {2, 2}}},
+		orb.MultiPolygon{
+			{{{20, 20}, {20, 30}, {30, 30}, {30, 20}, {20, 20}}},
+			{{{40, 40}, {40, 45}, {45, 45}, {45, 40}, {40, 40}}},
+		},
+		nil,
+	}
+	for i, g := range geometries {
+		f := geojson.NewFeature(g)
+		f.Properties["name"] = []string{"café", "b", "c"}[i]
+		f.Properties["count"] = int32(i * 100)
+		f.Properties["total"] = int64(i) * 10000000000
+		f.Properties["ratio"] = float64(i) + 0.25
+		f.Properties["flag"] = i%2 == 0
+		f.Properties["when"] = "2024-03-0" + string(rune('1'+i))
+		fc.Append(f)
+	}
+	fc.Features[1].Properties["name"] = nil
+	fc.Features[2].Properties["flag"] = nil
+	return fc
+}
+
+var shapefileColumns = []ColumnInfo{
+	{Name: "name", Type: "String", Nullable: true},
+	{Name: "count", Type: "Int", Nullable: true},
+	{Name: "total", Type: "Long", Nullable: true},
+	{Name: "ratio", Type: "Double", Nullable: true, Precision: 3},
+	{Name: "flag", Type: "Bool", Nullable: true},
+	{Name: "when", Type: "DateTime", Nullable: true},
+}
+
+func TestShapefile_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "layer.shp")
+	fc := shapefileFeatures()
+	if err := WriteShapefile(path, fc, &ShapefileOptions{Columns: shapefileColumns, CRS: WGS84()}); err != nil {
+		t.Fatalf("WriteShapefile failed: %v", err)
+	}
+
+	got, err := ReadShapefile(path)
+	if err != nil {
+		t.Fatalf("ReadShapefile failed: %v", err)
+	}
+	if got.CRS == nil || got.CRS.Code != 4326 || got.CRS.Name != "GCS_WGS_1984" {
+		t.Errorf("CRS = %+v, want EPSG:4326", got.CRS)
+	}
+
+	wantColumns := []ColumnInfo{
+		{Name: "name", Title: "name", Type: "String", Nullable: true, Width: 5}, // "café" is 5 bytes
+		{Name: "count", Title: "count", Type: "Long", Nullable: true, Width: 11},
+		{Name: "total", Title: "total", Type: "Double", Nullable: true, Width: 20},
+		{Name: "ratio", Title: "ratio", Type: "Double", Nullable: true, Width: 24, Precision: 3},
+		{Name: "flag", Title: "flag", Type: "Bool", Nullable: true, Width: 1},
+		{Name: "when", Title: "when", Type: "DateTime", Nullable: true, Width: 8},
+	}
+	if !reflect.DeepEqual(got.Columns, wantColumns) {
+		t.Errorf("columns:\ngot  %+v\nwant %+v", got.Columns, wantColumns)
+	}
+
+	if len(got.Features.Features) != len(fc.Features) {
+		t.Fatalf("got %d features, want %d", len(got.Features.Features), len(fc.Features))
+	}
+	for i, f := range got.Features.Features {
+		want := fc.Features[i]
+		if want.Geometry == nil {
+			if f.Geometry != nil {
+				t.Errorf("feature %d: got %v, want no geometry", i, f.Geometry)
+			}
+		} else if f.Geometry.GeoJSONType() != want.Geometry.GeoJSONType() ||
+			f.Geometry.Bound() != want.Geometry.Bound() {
+			t.Errorf("feature %d: got %v, want %v", i, f.Geometry, want.Geometry)
+		}
+
+		wantProps := geojson.Properties{
+			"name":  want.Properties["name"],
+			"count": int64(want.Properties["count"].(int32)),
+			"total": float64(want.Properties["total"].(int64)),
+			"ratio": want.Properties["ratio"],
+			"flag":  want.Properties["flag"],
+			"when":  want.Properties["when"],
+		}
+		if !reflect.DeepEqual(f.Properties, wantProps) {
+			t.Errorf("feature %d properties:\ngot  %v\nwant %v", i, f.Properties, wantProps)
+		}
+	}
+
+	// Rings keep their roles, and the input is not reoriented in place
+	poly := got.Features.Features[0].Geometry.(orb.Polygon)
+	if len(poly) != 2 || poly[0].Orientation() != orb.CW || poly[1].Orientation() != orb.CCW {
+		t.Errorf("unexpected polygon %v", poly)
+	}
+	if fc.Features[0].Geometry.(orb.Polygon)[0].Orientation() != orb.CCW {
+		t.Error("WriteShapefile modified its input")
+	}
+}
+
+func TestShapefile_Types(t *testing.T) {
+	tests := []orb.Geometry{
+		orb.Point{1, 2},
+		orb.MultiPoint{{1, 2}, {3, 4}},
+		orb.LineString{{0, 0}, {1, 1}},
+		orb.MultiLineString{{{0, 0}, {1, 1}}, {{2, 2}, {3, 3}}},
+	}
+	for _, g := range tests {
+		path := filepath.Join(t.TempDir(), "layer")
+		fc := geojson.NewFeatureCollection()
+		fc.Append(geojson.NewFeature(g))
+		if err := WriteShapefile(path, fc, nil); err != nil {
+			t.Fatalf("%T: WriteShapefile failed: %v", g, err)
+		}
+		got, err := ReadShapefile(path)
+		if err != nil {
+			t.Fatalf("%T: ReadShapefile failed: %v", g, err)
+		}
+		if !orb.Equal(got.Features.Features[0].Geometry, g) {
+			t.Errorf("got %v, want %v", got.Features.Features[0].Geometry, g)
+		}
+		if got.CRS != nil {
+			t.Errorf("%T: unexpected CRS %+v", g, got.CRS)
+		}
+	}
+
+	// One shape family per file
+	fc := geojson.NewFeatureCollection()
+	fc.Append(geojson.NewFeature(orb.Point{1, 2}))
+	fc.Append(geojson.NewFeature(orb.LineString{{0, 0}, {1, 1}}))
+	if err := WriteShapefile(filepath.Join(t.TempDir(), "mixed"), fc, nil); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("mixed shapes: expected ErrUnsupportedType, got %v", err)
+	}
+	fc.Features = fc.Features[:1]
+	fc.Features[0].Geometry = orb.Collection{orb.Point{1, 2}}
+	if err := WriteShapefile(filepath.Join(t.TempDir(), "collection"), fc, nil); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("collection: expected ErrUnsupportedType, got %v", err)
+	}
+}
+
+func TestShapefile_Fields(t *testing.T) {
+	fc := geojson.NewFeatureCollection()
+	f := geojson.NewFeature(orb.Point{1, 2})
+	f.Properties["a_very_long_name"] = "x"
+	f.Properties["a_very_long_other"] = "y"
+	fc.Append(f)
+
+	path := filepath.Join(t.TempDir(), "layer")
+	if err := WriteShapefile(path, fc, nil); err != nil {
+		t.Fatalf("WriteShapefile failed: %v", err)
+	}
+	got, err := ReadShapefile(path)
+	if err != nil {
+		t.Fatalf("ReadShapefile failed: %v", err)
+	}
+	want := geojson.Properties{"a_very_lon": "x", "a_very_l_1": "y"}
+	if !reflect.DeepEqual(got.Features.Features[0].Properties, want) {
+		t.Errorf("got %v, want %v", got.Features.Features[0].Properties, want)
+	}
+
+	// Numbers must fit their field, while text is truncated
+	columns := []ColumnInfo{{Name: "n", Type: "Int", Width: 3}}
+	f.Properties = geojson.Properties{"n": int32(12345)}
+	if err := WriteShapefile(path, fc, &ShapefileOptions{Columns: columns}); !errors.Is(err, ErrPropertyMismatch) {
+		t.Errorf("expected ErrPropertyMismatch, got %v", err)
+	}
+	columns = []ColumnInfo{{Name: "s", Type: "String", Width: 3}}
+	f.Properties = geojson.Properties{"s": "héllo"}
+	if err := WriteShapefile(path, fc, &ShapefileOptions{Columns: columns}); err != nil {
+		t.Fatalf("WriteShapefile failed: %v", err)
+	}
+	if got, _ := ReadShapefile(path); got.Features.Features[0].Properties["s"] != "hé" {
+		t.Errorf("got %q, want %q", got.Features.Features[0].Properties["s"], "hé")
+	}
+
+	columns = []ColumnInfo{{Name: "b", Type: "Binary"}}
+	if err := WriteShapefile(path, fc, &ShapefileOptions{Columns: columns}); !errors.Is(err, ErrInvalidColumn) {
+		t.Errorf("expected ErrInvalidColumn, got %v", err)
+	}
+}
+
+func TestShapefile_PRJ(t *testing.T) {
+	tests := []struct {
+		wkt  string
+		name string
+		code int
+	}{
+		{prjByCode[3857], "WGS_1984_Web_Mercator_Auxiliary_Sphere", 3857},
+		{`PROJCS["WGS_1984_UTM_Zone_33N",GEOGCS["GCS_WGS_1984"]]`, "WGS_1984_UTM_Zone_33N", 32633},
+		{`PROJCS["WGS 84 / UTM zone 18S",GEOGCS["WGS 84"]]`, "WGS 84 / UTM zone 18S", 32718},
+		{`PROJCS["ETRS89 / LAEA Europe",GEOGCS["ETRS89",AUTHORITY["EPSG","4258"]],AUTHORITY["EPSG","3035"]]`, "ETRS89 / LAEA Europe", 3035},
+		{`PROJCS["Custom",GEOGCS["GCS_WGS_1984",AUTHORITY["EPSG","4326"]]]`, "Custom", 0},
+		{`LOCAL_CS["Unknown"]`, "", 0},
+	}
+	for _, tt := range tests {
+		crs := crsFromWKT(tt.wkt)
+		if crs.Name != tt.name || crs.Code != tt.code || crs.WKT != tt.wkt {
+			t.Errorf("%s: got %+v, want name %q and code %d", tt.wkt, crs, tt.name, tt.code)
+		}
+	}
+
+	if prjForCRS(&CRS{Code: 3857}) != prjByCode[3857] {
+		t.Error("expected the ESRI WKT for EPSG:3857")
+	}
+	if prjForCRS(&CRS{Code: 2154}) != "" {
+		t.Error("expected no .prj for an unknown code without WKT")
+	}
+}
+
+func TestShapefileToFlatGeobuf(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "layer.shp")
+	fc := shapefileFeatures()
+	if err := WriteShapefile(path, fc, &ShapefileOptions{Columns: shapefileColumns, CRS: WGS84()}); err != nil {
+		t.Fatalf("WriteShapefile failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := ShapefileToFlatGeobuf(path, &buf, nil); err != nil {
+		t.Fatalf("ShapefileToFlatGeobuf failed: %v", err)
+	}
+	if report := Validate(buf.Bytes()); !report.Valid() {
+		t.Fatalf("invalid output: %v", report.Issues)
+	}
+	reader, err := NewReaderFromData(buf.Bytes())
+	if err != nil {
+		t.Fatalf("NewReaderFromData failed: %v", err)
+	}
+	defer reader.Close()
+
+	header := reader.Header()
+	if !header.HasIndex || header.FeaturesCount != 2 {
+		t.Errorf("HasIndex = %v, FeaturesCount = %d, want true, 2", header.HasIndex, header.FeaturesCount)
+	}
+	// The writer keeps the .prj WKT as the CRS description
+	if header.CRS == nil || header.CRS.Code != 4326 || header.CRS.Description != prjByCode[4326] {
+		t.Errorf("CRS = %+v, want EPSG:4326 with the .prj WKT", header.CRS)
+	}
+	if got := header.Columns[3]; got.Width != 24 || got.Precision != 3 {
+		t.Errorf("ratio column width %d, precision %d, want 24, 3", got.Width, got.Precision)
+	}
+
+	// And back, keeping the file's columns
+	out := filepath.Join(t.TempDir(), "out")
+	if err := FlatGeobufToShapefile(reader, out); err != nil {
+		t.Fatalf("FlatGeobufToShapefile failed: %v", err)
+	}
+	back, err := ReadShapefile(out)
+	if err != nil {
+		t.Fatalf("ReadShapefile failed: %v", err)
+	}
+	if len(back.Features.Features) != 2 || !reflect.DeepEqual(back.Columns, header.Columns) {
+		t.Errorf("got %d features with columns %+v", len(back.Features.Features), back.Columns)
+	}
+	if back.CRS == nil || back.CRS.Code != 4326 {
+		t.Errorf("CRS = %+v, want EPSG:4326", back.CRS)
+	}
+}
+
+func TestFlatGeobufToShapefile_Numbers(t *testing.T) {
+	columns := []ColumnInfo{
+		{Name: "big", Type: "ULong", Nullable: true},
+		{Name: "d", Type: "Double", Width: 10, Nullable: true},
+	}
+	toShapefile := func(props geojson.Properties) (string, error) {
+		fc := geojson.NewFeatureCollection()
+		f := geojson.NewFeature(orb.Point{1, 2})
+		f.Properties = props
+		fc.Append(f)
+
+		var buf bytes.Buffer
+		if err := WriteFeatures(&buf, fc, &Options{Columns: columns}); err != nil {
+			t.Fatalf("WriteFeatures failed: %v", err)
+		}
+		reader, err := NewReaderFromData(buf.Bytes())
+		if err != nil {
+			t.Fatalf("NewReaderFromData failed: %v", err)
+		}
+		defer reader.Close()
+
+		path := filepath.Join(t.TempDir(), "layer")
+		return path, FlatGeobufToShapefile(reader, path)
+	}
+
+	// A ULong above MaxInt64 keeps its value, and a whole number fits a
+	// Double field without decimals
+	path, err := toShapefile(geojson.Properties{"big": uint64(math.MaxUint64), "d": 2.0})
+	if err != nil {
+		t.Fatalf("FlatGeobufToShapefile failed: %v", err)
+	}
+	dbf, err := os.ReadFile(path + ".dbf")
+	if err != nil {
+		t.Fatalf("reading the DBF failed: %v", err)
+	}
+	if !bytes.Contains(dbf, []byte(" 18446744073709551615         2")) {
+		t.Errorf("expected the unsigned value and 2 in the record, got %q", dbf)
+	}
+
+	// A fraction would be lost without decimals
+	if _, err := toShapefile(geojson.Properties{"d": 2.75}); !errors.Is(err, ErrPropertyMismatch) {
+		t.Errorf("expected ErrPropertyMismatch, got %v", err)
+	}
+}
+
+func TestReadShapefile_Fixture(t *testing.T) {
+	// Built byte by byte to the ESRI and dBASE specifications, with what GDAL
+	// and ESRI software write: PolygonZ shapes with M values, F fields, "?"
+	// logicals, overflowed numbers, Windows-1252 text named by the .cpg file
+	// and the language driver, and an OGC .prj with AUTHORITY nodes.
+	path := filepath.Join("testdata", "parcels.shp")
+	shapefile, err := ReadShapefile(path)
+	if err != nil {
+		t.Fatalf("ReadShapefile failed: %v", err)
+	}
+
+	wantColumns := []ColumnInfo{
+		{Name: "NAME", Type: "String", Title: "NAME", Nullable: true, Width: 24},
+		{Name: "AREA_HA", Type: "Double", Title: "AREA_HA", Nullable: true, Width: 13, Precision: 3},
+		{Name: "PARCEL_ID", Type: "Int", Title: "PARCEL_ID", Nullable: true, Width: 9},
+		{Name: "OWNER_ID", Type: "Long", Title: "OWNER_ID", Nullable: true, Width: 15},
+		{Name: "PRICE", Type: "Double", Title: "PRICE", Nullable: true, Width: 12, Precision: 2},
+		{Name: "ACTIVE", Type: "Bool", Title: "ACTIVE", Nullable: true, Width: 1},
+		{Name: "SURVEYED", Type: "DateTime", Title: "SURVEYED", Nullable: true, Width: 8},
+	}
+	if !reflect.DeepEqual(shapefile.Columns, wantColumns) {
+		t.Errorf("got columns %+v, want %+v", shapefile.Columns, wantColumns)
+	}
+
+	wantValues := []geojson.Properties{
+		{
+			"NAME": "Müller & Söhne – €5", "AREA_HA": 1.0, "PARCEL_ID": int32(123456789),
+			"OWNER_ID": int64(900000000001), "PRICE": 1234.5, "ACTIVE": true, "SURVEYED": "2023-04-15",
+		},
+		{
+			"NAME": "Café Noël", "AREA_HA": 2.0, "PARCEL_ID": int32(-42),
+			"OWNER_ID": nil, "PRICE": nil, "ACTIVE": nil, "SURVEYED": nil,
+		},
+		{
+			"NAME": nil, "AREA_HA": nil, "PARCEL_ID": nil,
+			"OWNER_ID": nil, "PRICE": nil, "ACTIVE": false, "SURVEYED": "1999-12-31",
+		},
+	}
+	features := shapefile.Features.Features
+	if len(features) != len(wantValues) {
+		t.Fatalf("got %d features, want %d", len(features), len(wantValues))
+	}
+	for i, f := range features {
+		if !reflect.DeepEqual(f.Properties, wantValues[i]) {
+			t.Errorf("feature %d: got %#v, want %#v", i, f.Properties, wantValues[i])
+		}
+	}
+
+	// Z and M values are dropped; the hole stays in its polygon
+	if poly, ok := features[0].Geometry.(orb.Polygon); !ok || len(poly) != 2 ||
+		poly.Bound() != (orb.Bound{Min: orb.Point{500000, 5000000}, Max: orb.Point{500100, 5000100}}) {
+		t.Errorf("feature 0: got %v, want a polygon with a hole", features[0].Geometry)
+	}
+	if mp, ok := features[1].Geometry.(orb.MultiPolygon); !ok || len(mp) != 2 {
+		t.Errorf("feature 1: got %v, want two polygons", features[1].Geometry)
+	}
+	if features[2].Geometry != nil {
+		t.Errorf("feature 2: got %v, want a null shape", features[2].Geometry)
+	}
+
+	if shapefile.CRS == nil || shapefile.CRS.Code != 32633 || shapefile.CRS.Name != "WGS 84 / UTM zone 33N" {
+		t.Errorf("CRS = %+v, want EPSG:32633", shapefile.CRS)
+	}
+
+	// Converted, the UTM coordinates read back as longitude and latitude
+	var buf bytes.Buffer
+	if err := ShapefileToFlatGeobuf(path, &buf, nil); err != nil {
+		t.Fatalf("ShapefileToFlatGeobuf failed: %v", err)
+	}
+	reader, err := NewReaderFromDataWithOptions(buf.Bytes(), &ReaderOptions{TargetCRS: WGS84()})
+	if err != nil {
+		t.Fatalf("NewReaderFromDataWithOptions failed: %v", err)
+	}
+	defer reader.Close()
+	if b := reader.Bounds(); b.Min[0] < 14.99 || b.Min[0] > 15.01 || b.Min[1] < 45 || b.Max[1] > 45.2 {
+		t.Errorf("Bounds = %v, want near 15°E 45°N", b)
+	}
+}
+
+func TestDBFDecoder(t *testing.T) {
+	text := []byte("\x80 caf\xe9 \x96")
+	header := make([]byte, 32)
+	tests := []struct {
+		cpg  string
+		ldid byte
+		want string
+	}{
+		{"", 0, "\u0080 café \u0096"},              // Undeclared and not UTF-8: Latin-1
+		{"", 0x57, "€ café –"},                     // ESRI ANSI language driver
+		{"ISO-8859-1", 0x57, "\u0080 café \u0096"}, // The .cpg file wins
+		{" cp1252\r\n", 0, "€ café –"},
+		{"UTF-8", 0, "\ufffd caf\ufffd \ufffd"},
+	}
+	for _, tt := range tests {
+		header[29] = tt.ldid
+		if got := dbfDecoder([]byte(tt.cpg), header)(text); got != tt.want {
+			t.Errorf("cpg %q, language driver %#x: got %q, want %q", tt.cpg, tt.ldid, got, tt.want)
+		}
+	}
+}
+
+func TestReadShapefile_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "layer")
+	if err := WriteShapefile(src, shapefileFeatures(), &ShapefileOptions{Columns: shapefileColumns}); err != nil {
+		t.Fatalf("WriteShapefile failed: %v", err)
+	}
+	files := map[string][]byte{}
+	for _, ext := range []string{".shp", ".shx", ".dbf"} {
+		data, err := os.ReadFile(src + ext)
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+		files[ext] = data
+	}
+
+	for _, ext := range []string{".shp", ".shx", ".dbf"} {
+		for n := 0; n < len(files[ext]); n++ {
+			if ext == ".shx" && n < shpHeaderSize {
+				continue // Records are then read sequentially
+			}
+			if ext == ".dbf" && n == len(files[ext])-1 {
+				continue // Only the end-of-file marker is missing
+			}
+			path := filepath.Join(dir, "truncated")
+			for other, data := range files {
+				if other == ext {
+					data = data[:n]
+				}
+				if err := os.WriteFile(path+other, data, 0o644); err != nil {
+					t.Fatalf("WriteFile failed: %v", err)
+				}
+			}
+			if _, err := ReadShapefile(path); !errors.Is(err, ErrInvalidData) {
+				t.Fatalf("%s truncated to %d bytes: expected ErrInvalidData, got %v", ext, n, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package flatgeobuf
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/orb/simplify"
+)
+
+// Defaults for TileOptions.
+const (
+	DefaultTileBuffer    = 64  // Extent units around the tile
+	DefaultTileTolerance = 1.0 // Extent units
+	defaultTileLayer     = "features"
+)
+
+// TileOptions configures Mapbox Vector Tile generation.
+type TileOptions struct {
+	Layer         string                   // Layer name (default: the header name, or "features")
+	Extent        uint32                   // Tile coordinate extent (default: 4096)
+	Buffer        int                      // Area kept around the tile, in extent units (default: 64; negative: none)
+	Tolerance     float64                  // Douglas-Peucker tolerance in extent units (default: 1; negative: none)
+	ZoomTolerance map[maptile.Zoom]float64 // Tolerances for given zooms, overriding Tolerance
+	Properties    []string                 // Properties to keep (nil: all; empty: none)
+	Gzip          bool                     // Gzip the encoded tile
+}
+
+// tolerance returns the simplification tolerance at zoom z, or 0 for none.
+func (o *TileOptions) tolerance(z maptile.Zoom) float64 {
+	tolerance, ok := o.ZoomTolerance[z]
+	if !ok {
+		tolerance = o.Tolerance
+		if tolerance == 0 {
+			tolerance = DefaultTileTolerance
+		}
+	}
+	return max(tolerance, 0)
+}
+
+// Tile returns the Mapbox Vector Tile for tile t, with a single layer built
+// as by TileLayer.
+func (r *Reader) Tile(t maptile.Tile, opts *TileOptions) ([]byte, error) {
+	layer, err := r.TileLayer(t, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts != nil && opts.Gzip {
+		return mvt.MarshalGzipped(mvt.Layers{layer})
+	}
+	return mvt.Marshal(mvt.Layers{layer})
+}
+
+// TileLayer returns the features of tile t as a vector tile layer, for
+// combining with other layers. Features are found with Search over the tile
+// bounds grown by the buffer, so the file must have an index. Geometries are
+// projected to Web Mercator tile coordinates, clipped to the buffered tile and
+// simplified, and those reduced to nothing are dropped.
+//
+// Coordinates must be WGS84 longitude/latitude: a file with another CRS
+// returns ErrUnsupportedCRS unless it is read with a TargetCRS of EPSG:4326.
+// MVT has no null values, so nil properties are left out; JSON values are
+// encoded as JSON text and Binary values as base64.
+func (r *Reader) TileLayer(t maptile.Tile, opts *TileOptions) (*mvt.Layer, error) {
+	if opts == nil {
+		opts = &TileOptions{}
+	}
+	if !t.Valid() {
+		return nil, fmt.Errorf("flatgeobuf: invalid tile %d/%d/%d", t.Z, t.X, t.Y)
+	}
+	header := r.Header()
+	if header == nil {
+		return nil, ErrClosed
+	}
+	if header.CRS != nil && header.CRS.Code != 0 && header.CRS.Code != 4326 {
+		return nil, fmt.Errorf("%w: tiles need EPSG:4326 coordinates, file has EPSG:%d", ErrUnsupportedCRS, header.CRS.Code)
+	}
+
+	extent := opts.Extent
+	if extent == 0 {
+		extent = mvt.DefaultExtent
+	}
+	buffer := float64(opts.Buffer)
+	if opts.Buffer == 0 {
+		buffer = DefaultTileBuffer
+	}
+	buffer = max(buffer, 0)
+
+	fc, err := r.Search(t.Bound(buffer / float64(extent)))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fc.Features {
+		f.Properties = tileProperties(f.Properties, opts.Properties)
+	}
+
+	name := opts.Layer
+	if name == "" {
+		name = header.Name
+	}
+	if name == "" {
+		name = defaultTileLayer
+	}
+	layer := mvt.NewLayer(name, fc)
+	layer.Extent = extent
+	layer.ProjectToTile(t)
+	layer.Clip(orb.Bound{
+		Min: orb.Point{-buffer, -buffer},
+		Max: orb.Point{float64(extent) + buffer, float64(extent) + buffer},
+	})
+	if tolerance := opts.tolerance(t.Z); tolerance > 0 {
+		layer.Simplify(simplify.DouglasPeucker(tolerance))
+		layer.RemoveEmpty(tolerance, tolerance*tolerance)
+	}
+	return layer, nil
+}
+
+// tileProperties returns the properties encodable in a vector tile, limited
+// to keep unless it is nil.
+func tileProperties(props geojson.Properties, keep []string) geojson.Properties {
+	if keep != nil {
+		selected := make(geojson.Properties, len(keep))
+		for _, name := range keep {
+			if v, ok := props[name]; ok {
+				selected[name] = v
+			}
+		}
+		props = selected
+	}
+
+	for name, v := range props {
+		switch v := v.(type) {
+		case nil:
+			delete(props, name)
+		case string, bool, float32, float64, int, int8, int16, int32, int64,
+			uint, uint8, uint16, uint32, uint64:
+		case []byte:
+			props[name] = base64.StdEncoding.EncodeToString(v)
+		default:
+			props[name] = toString(v)
+		}
+	}
+	return props
+}
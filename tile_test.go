@@ -0,0 +1,201 @@
+package flatgeobuf
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+)
+
+// newTileReader returns a reader over a point per degree of longitude along
+// the equator, a wavy line across the world and a polygon around Europe.
+func newTileReader(t *testing.T, opts *Options) *Reader {
+	t.Helper()
+
+	fc := geojson.NewFeatureCollection()
+	for lon := -179.5; lon < 180; lon++ {
+		f := geojson.NewFeature(orb.Point{lon, 0})
+		f.Properties["name"] = "point"
+		f.Properties["lon"] = lon
+		f.Properties["note"] = nil
+		fc.Append(f)
+	}
+	var line orb.LineString
+	for lon := -170.0; lon <= 170; lon += 0.1 {
+		line = append(line, orb.Point{lon, 20 + 0.01*math.Sin(lon*10)})
+	}
+	f := geojson.NewFeature(line)
+	f.Properties["name"] = "line"
+	f.Properties["tags"] = map[string]interface{}{"kind": "wave"}
+	fc.Append(f)
+	f = geojson.NewFeature(orb.Polygon{{{-10, 35}, {30, 35}, {30, 60}, {-10, 60}, {-10, 35}}})
+	f.Properties["name"] = "europe"
+	fc.Append(f)
+
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	var buf bytes.Buffer
+	if err := WriteFeatures(&buf, fc, opts); err != nil {
+		t.Fatalf("WriteFeatures failed: %v", err)
+	}
+	reader, err := NewReaderFromData(buf.Bytes())
+	if err != nil {
+		t.Fatalf("NewReaderFromData failed: %v", err)
+	}
+	t.Cleanup(func() { reader.Close() })
+	return reader
+}
+
+// decodeTile returns the single layer of an encoded tile.
+func decodeTile(t *testing.T, data []byte, gzipped bool) *mvt.Layer {
+	t.Helper()
+
+	unmarshal := mvt.Unmarshal
+	if gzipped {
+		unmarshal = mvt.UnmarshalGzipped
+	}
+	layers, err := unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if len(layers) != 1 {
+		t.Fatalf("got %d layers, want 1", len(layers))
+	}
+	return layers[0]
+}
+
+// countByName counts the features of a layer by their name property.
+func countByName(layer *mvt.Layer) map[string]int {
+	counts := map[string]int{}
+	for _, f := range layer.Features {
+		counts[f.Properties.MustString("name", "")]++
+	}
+	return counts
+}
+
+func TestTile(t *testing.T) {
+	reader := newTileReader(t, &Options{Name: "base", IncludeIndex: true})
+
+	data, err := reader.Tile(maptile.New(0, 0, 0), nil)
+	if err != nil {
+		t.Fatalf("Tile failed: %v", err)
+	}
+	layer := decodeTile(t, data, false)
+	if layer.Name != "base" || layer.Extent != mvt.DefaultExtent {
+		t.Errorf("layer %q with extent %d, want base with %d", layer.Name, layer.Extent, mvt.DefaultExtent)
+	}
+	if got, want := countByName(layer), map[string]int{"point": 360, "line": 1, "europe": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got features %v, want %v", got, want)
+	}
+
+	for _, f := range layer.Features {
+		switch f.Properties["name"] {
+		case "point":
+			if _, ok := f.Properties["note"]; ok {
+				t.Error("nil property was encoded")
+			}
+			if _, ok := f.Properties["lon"].(float64); !ok {
+				t.Errorf("lon = %#v, want a float64", f.Properties["lon"])
+			}
+		case "line":
+			if f.Properties["tags"] != `{"kind":"wave"}` {
+				t.Errorf("tags = %#v, want JSON text", f.Properties["tags"])
+			}
+			// The wave is far below a pixel at zoom 0
+			if n := len(f.Geometry.(orb.LineString)); n > 3 {
+				t.Errorf("line has %d points, want it simplified", n)
+			}
+		}
+	}
+
+	// Europe at zoom 3: the tile holds only the polygon
+	tile := maptile.At(orb.Point{10, 50}, 3)
+	data, err = reader.Tile(tile, &TileOptions{Layer: "europe", Gzip: true, Properties: []string{}})
+	if err != nil {
+		t.Fatalf("Tile failed: %v", err)
+	}
+	layer = decodeTile(t, data, true)
+	if layer.Name != "europe" || len(layer.Features) != 1 {
+		t.Fatalf("layer %q with %d features, want europe with 1", layer.Name, len(layer.Features))
+	}
+	if len(layer.Features[0].Properties) != 0 {
+		t.Errorf("got properties %v, want none", layer.Features[0].Properties)
+	}
+	// Clipped to the tile and its buffer, in tile coordinates
+	const buffer = DefaultTileBuffer
+	bound := layer.Features[0].Geometry.Bound()
+	if bound.Min[0] < -buffer || bound.Min[1] < -buffer ||
+		bound.Max[0] > mvt.DefaultExtent+buffer || bound.Max[1] > mvt.DefaultExtent+buffer {
+		t.Errorf("geometry bound %v exceeds the buffered tile", bound)
+	}
+}
+
+func TestTile_Options(t *testing.T) {
+	reader := newTileReader(t, nil)
+	tile := maptile.At(orb.Point{0, 20}, 4)
+
+	points := func(opts *TileOptions) int {
+		layer, err := reader.TileLayer(tile, opts)
+		if err != nil {
+			t.Fatalf("TileLayer failed: %v", err)
+		}
+		for _, f := range layer.Features {
+			if ls, ok := f.Geometry.(orb.LineString); ok {
+				return len(ls)
+			}
+		}
+		t.Fatal("no line in tile")
+		return 0
+	}
+
+	// Per-zoom tolerances override the default, and negative ones disable simplification
+	simplified := points(nil)
+	if coarse := points(&TileOptions{ZoomTolerance: map[maptile.Zoom]float64{4: 50}}); coarse >= simplified {
+		t.Errorf("tolerance 50 kept %d points, default kept %d", coarse, simplified)
+	}
+	if other := points(&TileOptions{ZoomTolerance: map[maptile.Zoom]float64{5: 50}}); other != simplified {
+		t.Errorf("tolerance for another zoom kept %d points, want %d", other, simplified)
+	}
+	if all := points(&TileOptions{Tolerance: -1}); all <= simplified {
+		t.Errorf("unsimplified line has %d points, simplified %d", all, simplified)
+	}
+
+	// The tile north of the equator holds no point, but a buffer of a whole
+	// tile reaches four
+	edge := maptile.At(orb.Point{0.7, 2}, 8)
+	for _, tt := range []struct {
+		buffer int
+		want   int
+	}{{-1, 0}, {0, 0}, {4096, 4}} {
+		layer, err := reader.TileLayer(edge, &TileOptions{Buffer: tt.buffer, Properties: []string{"name"}})
+		if err != nil {
+			t.Fatalf("TileLayer failed: %v", err)
+		}
+		if got := countByName(layer)["point"]; got != tt.want {
+			t.Errorf("buffer %d: got %d points, want %d", tt.buffer, got, tt.want)
+		}
+	}
+}
+
+func TestTile_Errors(t *testing.T) {
+	unindexed := newTileReader(t, &Options{})
+	if _, err := unindexed.Tile(maptile.New(0, 0, 0), nil); !errors.Is(err, ErrNoIndex) {
+		t.Errorf("expected ErrNoIndex, got %v", err)
+	}
+
+	mercator := newTileReader(t, &Options{IncludeIndex: true, CRS: &CRS{Code: 3857}})
+	if _, err := mercator.Tile(maptile.New(0, 0, 0), nil); !errors.Is(err, ErrUnsupportedCRS) {
+		t.Errorf("expected ErrUnsupportedCRS, got %v", err)
+	}
+
+	if _, err := unindexed.Tile(maptile.New(2, 0, 1), nil); err == nil {
+		t.Error("expected an error for an invalid tile")
+	}
+}
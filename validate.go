@@ -0,0 +1,730 @@
+package flatgeobuf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/flatgeobuf/flatgeobuf/src/go/flattypes"
+	"github.com/flatgeobuf/flatgeobuf/src/go/writer"
+	flatbuffers "github.com/google/flatbuffers/go"
+
+	"github.com/tingold/orb-flatgeobuf/packedrtree"
+)
+
+const (
+	// supportedMajorVersion is the FlatGeobuf major version in byte 3 of the
+	// magic bytes.
+	supportedMajorVersion = 3
+	// maxHeaderSize bounds the header, as in the reference implementations.
+	maxHeaderSize = 10 << 20
+	// maxValidationIssues is the number of issues recorded in a report;
+	// further issues are only counted.
+	maxValidationIssues = 100
+	// maxGeometryDepth bounds the nesting of geometry parts.
+	maxGeometryDepth = 32
+)
+
+// Sections of a file reported in a ValidationIssue.
+const (
+	SectionMagic    = "magic"
+	SectionHeader   = "header"
+	SectionIndex    = "index"
+	SectionFeatures = "features"
+)
+
+// ValidationIssue is a structural problem found by Validate.
+type ValidationIssue struct {
+	Section string // SectionMagic, SectionHeader, SectionIndex or SectionFeatures
+	Offset  int64  // Byte offset in the file where the problem was found (-1 if unknown)
+	Message string // Description of the problem
+}
+
+func (i ValidationIssue) String() string {
+	if i.Offset < 0 {
+		return fmt.Sprintf("%s: %s", i.Section, i.Message)
+	}
+	return fmt.Sprintf("%s at offset %d: %s", i.Section, i.Offset, i.Message)
+}
+
+// ValidationReport describes the layout of a file and the problems found in
+// it. Layout fields that could not be determined are left at zero.
+type ValidationReport struct {
+	MajorVersion   uint8  // Major version from the magic bytes
+	PatchVersion   uint8  // Patch version from the magic bytes
+	HeaderSize     int    // Size of the header table in bytes
+	FeaturesCount  uint64 // Number of features declared by the header (0: unknown)
+	IndexNodeSize  uint16 // Children per index node (0: no index)
+	IndexOffset    int    // Byte offset of the spatial index
+	IndexSize      int    // Size of the spatial index in bytes
+	FeaturesOffset int    // Byte offset of the first feature
+	FeaturesFound  int    // Number of size-prefixed features found
+
+	Issues  []ValidationIssue // Problems found, in file order
+	Omitted int               // Problems found beyond the recorded Issues
+}
+
+// Valid reports whether no problems were found.
+func (r *ValidationReport) Valid() bool {
+	return len(r.Issues) == 0
+}
+
+// Err returns a *ValidationError for a report with problems, or nil.
+func (r *ValidationReport) Err() error {
+	if r.Valid() {
+		return nil
+	}
+	return &ValidationError{Report: r}
+}
+
+func (r *ValidationReport) addIssue(section string, offset int, format string, args ...interface{}) {
+	if len(r.Issues) >= maxValidationIssues {
+		r.Omitted++
+		return
+	}
+	r.Issues = append(r.Issues, ValidationIssue{
+		Section: section,
+		Offset:  int64(offset),
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// ValidationError is returned when a file fails validation. It wraps
+// ErrInvalidData.
+type ValidationError struct {
+	Report *ValidationReport
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v: %v", ErrInvalidData, e.Report.Issues[0])
+	if more := len(e.Report.Issues) - 1 + e.Report.Omitted; more > 0 {
+		fmt.Fprintf(&b, " (and %d more)", more)
+	}
+	return b.String()
+}
+
+// Unwrap returns ErrInvalidData.
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidData
+}
+
+// Validate checks the structure of a FlatGeobuf file: the magic bytes and
+// version, the header size and table, the size and node offsets of the
+// spatial index, and the size prefix, table, geometry and properties of every
+// feature. It never panics on malformed input.
+//
+// Properties are checked against the spec encoding, so files with the legacy
+// NUL-terminated strings read with ReaderOptions.LegacyStrings are reported
+// as invalid.
+func Validate(data []byte) *ValidationReport {
+	return validate(data, DefaultReaderOptions())
+}
+
+// validate implements Validate, decoding properties as opts selects.
+func validate(data []byte, opts *ReaderOptions) *ValidationReport {
+	v := &validator{data: data, opts: opts, report: &ValidationReport{}}
+	v.validate()
+	return v.report
+}
+
+// ValidateFile validates the file at path. Errors opening the file are
+// returned; problems with its contents are recorded in the report.
+func ValidateFile(path string) (*ValidationReport, error) {
+	data, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer unmapFile(data)
+	return Validate(data), nil
+}
+
+// validator holds the state of one Validate pass.
+type validator struct {
+	data   []byte
+	opts   *ReaderOptions
+	report *ValidationReport
+	header *flattypes.Header
+}
+
+func (v *validator) validate() {
+	if !v.validateMagic() {
+		return
+	}
+	offset, ok := v.validateHeader()
+	if !ok {
+		return
+	}
+
+	r := v.report
+	r.IndexOffset = offset
+	index, ok := v.validateIndex(offset)
+	if !ok {
+		return
+	}
+
+	r.FeaturesOffset = offset + r.IndexSize
+	offsets := v.validateFeatures(r.FeaturesOffset)
+	if index != nil {
+		v.validateLeaves(index, offsets)
+	}
+}
+
+// validateMagic checks the magic bytes and major version.
+func (v *validator) validateMagic() bool {
+	r := v.report
+	if len(v.data) < len(writer.MagicBytes) {
+		r.addIssue(SectionMagic, 0, "file of %d bytes is too short", len(v.data))
+		return false
+	}
+	if !validMagic(v.data) {
+		r.addIssue(SectionMagic, 0, "not a FlatGeobuf file")
+		return false
+	}
+	r.MajorVersion, r.PatchVersion = v.data[3], v.data[7]
+	if r.MajorVersion != supportedMajorVersion {
+		r.addIssue(SectionMagic, 3, "unsupported major version %d", r.MajorVersion)
+		return false
+	}
+	return true
+}
+
+// validateHeader checks the header size and table, returning the offset just
+// past the header.
+func (v *validator) validateHeader() (int, bool) {
+	r := v.report
+	offset := len(writer.MagicBytes)
+	if len(v.data)-offset < 4 {
+		r.addIssue(SectionHeader, offset, "file too short for header size")
+		return 0, false
+	}
+	size := binary.LittleEndian.Uint32(v.data[offset:])
+	switch {
+	case size < 8:
+		r.addIssue(SectionHeader, offset, "header size %d is too small", size)
+		return 0, false
+	case size > maxHeaderSize:
+		r.addIssue(SectionHeader, offset, "header size %d exceeds the maximum of %d", size, maxHeaderSize)
+		return 0, false
+	case int64(size) > int64(len(v.data)-offset-4):
+		r.addIssue(SectionHeader, offset, "header size %d exceeds file size", size)
+		return 0, false
+	}
+	r.HeaderSize = int(size)
+
+	// The header table is verified within its own buffer, so references
+	// cannot reach into the index or features
+	buf := v.data[offset+4 : offset+4+int(size)]
+	if err := verifyHeader(buf); err != nil {
+		r.addIssue(SectionHeader, offset+4, "%v", err)
+		return 0, false
+	}
+	h := flattypes.GetRootAsHeader(buf, 0)
+	v.header = h
+	r.FeaturesCount = h.FeaturesCount()
+	r.IndexNodeSize = h.IndexNodeSize()
+
+	if t := h.GeometryType(); t > flattypes.GeometryTypeTriangle {
+		r.addIssue(SectionHeader, offset+4, "unknown geometry type %d", t)
+	}
+	if n := h.EnvelopeLength(); n != 0 && (n < 4 || n%2 != 0) {
+		r.addIssue(SectionHeader, offset+4, "envelope has %d values", n)
+	}
+	var col flattypes.Column
+	for i := 0; i < h.ColumnsLength(); i++ {
+		h.Columns(&col, i)
+		if t := col.Type(); t > flattypes.ColumnTypeBinary {
+			r.addIssue(SectionHeader, offset+4, "column %d has unknown type %d", i, t)
+		}
+	}
+	if r.IndexNodeSize == 1 {
+		r.addIssue(SectionHeader, offset+4, "index node size 1")
+	}
+	return offset + 4 + int(size), true
+}
+
+// validateIndex checks that the index declared by the header fits in the
+// file and that every node points into the level below it.
+func (v *validator) validateIndex(offset int) (*packedrtree.Tree, bool) {
+	r := v.report
+	if r.IndexNodeSize == 0 || r.FeaturesCount == 0 {
+		return nil, true
+	}
+	if r.IndexNodeSize < 2 {
+		// Already reported with the header; the index cannot be located
+		return nil, false
+	}
+
+	// Each leaf needs a node and each feature at least its size prefix
+	count := r.FeaturesCount
+	if count > uint64(len(v.data)-offset)/(packedrtree.NodeItemSize+4) {
+		r.addIssue(SectionIndex, offset, "header declares %d features, too many for the file size", count)
+		return nil, false
+	}
+	size, err := packedrtree.Size(int(count), r.IndexNodeSize)
+	if err != nil {
+		r.addIssue(SectionIndex, offset, "%v", err)
+		return nil, false
+	}
+	r.IndexSize = size
+	tree, err := packedrtree.Read(v.data[offset:], int(count), r.IndexNodeSize)
+	if err != nil {
+		r.addIssue(SectionIndex, offset, "%v", err)
+		return nil, false
+	}
+
+	levels, _ := packedrtree.Levels(int(count), r.IndexNodeSize)
+	for lvl := len(levels) - 1; lvl > 0; lvl-- {
+		below := levels[lvl-1]
+		for pos := levels[lvl].Start; pos < levels[lvl].End; pos++ {
+			child := tree.Node(pos).Offset
+			if child < uint64(below.Start) || child >= uint64(below.End) {
+				r.addIssue(SectionIndex, offset+pos*packedrtree.NodeItemSize,
+					"node %d points to %d outside level %d", pos, child, lvl-1)
+			}
+		}
+	}
+	return tree, true
+}
+
+// validateLeaves checks that every leaf of the index references a feature.
+func (v *validator) validateLeaves(tree *packedrtree.Tree, offsets []uint64) {
+	leafStart := v.report.IndexOffset + (tree.NumNodes()-tree.NumItems())*packedrtree.NodeItemSize
+	for i := 0; i < tree.NumItems(); i++ {
+		offset := tree.Leaf(i).Offset
+		j := sort.Search(len(offsets), func(j int) bool { return offsets[j] >= offset })
+		if j == len(offsets) || offsets[j] != offset {
+			v.report.addIssue(SectionIndex, leafStart+i*packedrtree.NodeItemSize,
+				"leaf %d references %d, which is not the start of a feature", i, offset)
+		}
+	}
+}
+
+// validateFeatures walks the size-prefixed features from offset to the end
+// of the file, verifying each, and returns their offsets relative to the
+// start of the feature data.
+func (v *validator) validateFeatures(offset int) []uint64 {
+	r := v.report
+	props := newPropertyDecoder(v.header, v.opts)
+
+	var offsets []uint64
+	pos := offset
+	for pos < len(v.data) {
+		if len(v.data)-pos < 4 {
+			r.addIssue(SectionFeatures, pos, "truncated feature size")
+			break
+		}
+		size := binary.LittleEndian.Uint32(v.data[pos:])
+		if int64(size) > int64(len(v.data)-pos-4) {
+			r.addIssue(SectionFeatures, pos, "feature of %d bytes exceeds file size", size)
+			break
+		}
+		offsets = append(offsets, uint64(pos-offset))
+		v.validateFeature(pos, v.data[pos+4:pos+4+int(size)], props)
+		pos += 4 + int(size)
+	}
+	r.FeaturesFound = len(offsets)
+
+	if r.FeaturesCount > 0 && uint64(len(offsets)) != r.FeaturesCount {
+		r.addIssue(SectionFeatures, offset, "header declares %d features, found %d",
+			r.FeaturesCount, len(offsets))
+	}
+	return offsets
+}
+
+// validateFeature verifies the feature table in buf, which starts at pos in
+// the file, then checks its geometry and decodes its properties.
+func (v *validator) validateFeature(pos int, buf []byte, props *propertyDecoder) {
+	r := v.report
+	if err := verifyFeature(buf); err != nil {
+		r.addIssue(SectionFeatures, pos, "%v", err)
+		return
+	}
+	f := flattypes.GetRootAsFeature(buf, 0)
+
+	var geom flattypes.Geometry
+	if f.Geometry(&geom) != nil {
+		if err := checkGeometry(&geom, 0); err != nil {
+			r.addIssue(SectionFeatures, pos, "%v", err)
+		}
+	}
+	if _, err := props.decode(f.PropertiesBytes()); err != nil {
+		var propErr *PropertyError
+		if errors.As(err, &propErr) {
+			r.addIssue(SectionFeatures, pos, "properties, column %d: %s", propErr.Column, propErr.Reason)
+		} else {
+			r.addIssue(SectionFeatures, pos, "properties: %v", err)
+		}
+	}
+}
+
+// checkGeometry checks the vector lengths of a verified geometry and its
+// parts.
+func checkGeometry(g *flattypes.Geometry, depth int) error {
+	if depth > maxGeometryDepth {
+		return fmt.Errorf("geometry parts nested deeper than %d", maxGeometryDepth)
+	}
+
+	if typ := g.Type(); typ > flattypes.GeometryTypeTriangle {
+		return fmt.Errorf("unknown geometry type %d", typ)
+	}
+
+	xy := g.XyLength()
+	if xy%2 != 0 {
+		return fmt.Errorf("geometry has an odd number (%d) of xy values", xy)
+	}
+	points := xy / 2
+	dims := []struct {
+		name string
+		n    int
+	}{{"z", g.ZLength()}, {"m", g.MLength()}, {"t", g.TLength()}, {"tm", g.TmLength()}}
+	for _, dim := range dims {
+		if dim.n != 0 && dim.n != points {
+			return fmt.Errorf("geometry has %d %s values for %d points", dim.n, dim.name, points)
+		}
+	}
+
+	prev := uint32(0)
+	for i := 0; i < g.EndsLength(); i++ {
+		end := g.Ends(i)
+		if end < prev || int64(end) > int64(points) {
+			return fmt.Errorf("geometry end %d (%d) is out of order or past %d points", i, end, points)
+		}
+		prev = end
+	}
+
+	var part flattypes.Geometry
+	for i := 0; i < g.PartsLength(); i++ {
+		g.Parts(&part, i)
+		if err := checkGeometry(&part, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Vtable slots of the FlatGeobuf tables, from the schema.
+const (
+	slotHeaderName          = 4
+	slotHeaderEnvelope      = 6
+	slotHeaderGeometryType  = 8
+	slotHeaderHasZ          = 10
+	slotHeaderHasM          = 12
+	slotHeaderHasT          = 14
+	slotHeaderHasTM         = 16
+	slotHeaderColumns       = 18
+	slotHeaderFeaturesCount = 20
+	slotHeaderIndexNodeSize = 22
+	slotHeaderCrs           = 24
+	slotHeaderTitle         = 26
+	slotHeaderDescription   = 28
+	slotHeaderMetadata      = 30
+
+	slotColumnName        = 4
+	slotColumnType        = 6
+	slotColumnTitle       = 8
+	slotColumnDescription = 10
+	slotColumnWidth       = 12
+	slotColumnPrecision   = 14
+	slotColumnScale       = 16
+	slotColumnNullable    = 18
+	slotColumnUnique      = 20
+	slotColumnPrimaryKey  = 22
+	slotColumnMetadata    = 24
+
+	slotCrsOrg         = 4
+	slotCrsCode        = 6
+	slotCrsName        = 8
+	slotCrsDescription = 10
+	slotCrsWkt         = 12
+	slotCrsCodeString  = 14
+
+	slotFeatureGeometry   = 4
+	slotFeatureProperties = 6
+	slotFeatureColumns    = 8
+
+	slotGeometryZ     = 8
+	slotGeometryM     = 10
+	slotGeometryT     = 12
+	slotGeometryTM    = 14
+	slotGeometryType  = 16
+	slotGeometryParts = 18
+)
+
+// verifyHeader verifies the header table at the root of buf.
+func verifyHeader(buf []byte) error {
+	budget := tableBudget(buf)
+	t, err := verifyRoot(buf, &budget)
+	if err != nil {
+		return err
+	}
+	return firstError(
+		t.string(slotHeaderName),
+		t.vector(slotHeaderEnvelope, 8),
+		t.scalar(slotHeaderGeometryType, 1),
+		t.scalar(slotHeaderHasZ, 1),
+		t.scalar(slotHeaderHasM, 1),
+		t.scalar(slotHeaderHasT, 1),
+		t.scalar(slotHeaderHasTM, 1),
+		t.tables(slotHeaderColumns, columnTable),
+		t.scalar(slotHeaderFeaturesCount, 8),
+		t.scalar(slotHeaderIndexNodeSize, 2),
+		t.table(slotHeaderCrs, crsTable),
+		t.string(slotHeaderTitle),
+		t.string(slotHeaderDescription),
+		t.string(slotHeaderMetadata),
+	)
+}
+
+func verifyColumn(t fbTable) error {
+	if t.fieldOffset(slotColumnName) == 0 {
+		return fmt.Errorf("column table at %d has no name", t.pos)
+	}
+	return firstError(
+		t.string(slotColumnName),
+		t.scalar(slotColumnType, 1),
+		t.string(slotColumnTitle),
+		t.string(slotColumnDescription),
+		t.scalar(slotColumnWidth, 4),
+		t.scalar(slotColumnPrecision, 4),
+		t.scalar(slotColumnScale, 4),
+		t.scalar(slotColumnNullable, 1),
+		t.scalar(slotColumnUnique, 1),
+		t.scalar(slotColumnPrimaryKey, 1),
+		t.string(slotColumnMetadata),
+	)
+}
+
+func verifyCrs(t fbTable) error {
+	return firstError(
+		t.string(slotCrsOrg),
+		t.scalar(slotCrsCode, 4),
+		t.string(slotCrsName),
+		t.string(slotCrsDescription),
+		t.string(slotCrsWkt),
+		t.string(slotCrsCodeString),
+	)
+}
+
+// verifyFeature verifies the feature table at the root of buf.
+func verifyFeature(buf []byte) error {
+	budget := tableBudget(buf)
+	t, err := verifyRoot(buf, &budget)
+	if err != nil {
+		return err
+	}
+	return firstError(
+		t.table(slotFeatureGeometry, geometryTable),
+		t.vector(slotFeatureProperties, 1),
+		t.tables(slotFeatureColumns, columnTable),
+	)
+}
+
+func verifyGeometry(t fbTable) error {
+	if t.depth > maxGeometryDepth {
+		return fmt.Errorf("geometry parts nested deeper than %d", maxGeometryDepth)
+	}
+	return firstError(
+		t.vector(geometryEndsField, 4),
+		t.vector(geometryXYField, 8),
+		t.vector(slotGeometryZ, 8),
+		t.vector(slotGeometryM, 8),
+		t.vector(slotGeometryT, 8),
+		t.vector(slotGeometryTM, 8),
+		t.scalar(slotGeometryType, 1),
+		t.tables(slotGeometryParts, geometryTable),
+	)
+}
+
+// tableKind selects the verification of a nested table. A switch rather than
+// a function value keeps the verifier state on the stack.
+type tableKind uint8
+
+const (
+	columnTable tableKind = iota
+	crsTable
+	geometryTable
+)
+
+func (t fbTable) verifyAs(kind tableKind) error {
+	switch kind {
+	case columnTable:
+		return verifyColumn(t)
+	case crsTable:
+		return verifyCrs(t)
+	default:
+		return verifyGeometry(t)
+	}
+}
+
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fbTable is a FlatBuffers table whose vtable and inline data lie within buf.
+// Its methods check that fields, and the data they reference, do too.
+type fbTable struct {
+	buf    []byte
+	pos    int  // Start of the table
+	vtable int  // Start of the vtable
+	vtSize int  // Size of the vtable in bytes
+	size   int  // Size of the inline table data in bytes
+	depth  int  // Nesting below the root table
+	budget *int // Tables left to verify in buf
+}
+
+// tableBudget returns the number of tables buf can hold. Every table takes
+// at least 4 bytes, so more tables than that can only come from references
+// to the same table, which would otherwise let a small buffer describe
+// exponentially many geometry parts.
+func tableBudget(buf []byte) int {
+	return len(buf) / 4
+}
+
+// verifyRoot verifies the root table of buf, counting the tables it
+// references against budget.
+func verifyRoot(buf []byte, budget *int) (fbTable, error) {
+	if len(buf) < 4 {
+		return fbTable{}, fmt.Errorf("buffer of %d bytes has no root table", len(buf))
+	}
+	return verifyTable(buf, int64(binary.LittleEndian.Uint32(buf)), 0, budget)
+}
+
+// verifyTable checks the table at pos in buf and its vtable.
+func verifyTable(buf []byte, pos int64, depth int, budget *int) (fbTable, error) {
+	if *budget <= 0 {
+		return fbTable{}, fmt.Errorf("buffer references more tables than it can hold")
+	}
+	*budget--
+	if pos < 0 || pos > int64(len(buf)-4) {
+		return fbTable{}, fmt.Errorf("table at %d is out of bounds", pos)
+	}
+	vtable := pos - int64(int32(binary.LittleEndian.Uint32(buf[pos:])))
+	if vtable < 0 || vtable > int64(len(buf)-4) {
+		return fbTable{}, fmt.Errorf("vtable of table at %d is out of bounds", pos)
+	}
+	vtSize := int(binary.LittleEndian.Uint16(buf[vtable:]))
+	size := int(binary.LittleEndian.Uint16(buf[vtable+2:]))
+	if vtSize < 4 || vtSize%2 != 0 || int64(vtSize) > int64(len(buf))-vtable {
+		return fbTable{}, fmt.Errorf("vtable of table at %d has invalid size %d", pos, vtSize)
+	}
+	if size < 4 || int64(size) > int64(len(buf))-pos {
+		return fbTable{}, fmt.Errorf("table at %d has invalid size %d", pos, size)
+	}
+	return fbTable{buf: buf, pos: int(pos), vtable: int(vtable), vtSize: vtSize, size: size, depth: depth, budget: budget}, nil
+}
+
+// fieldOffset returns the offset of a field within the table, or 0 if the
+// field is absent.
+func (t fbTable) fieldOffset(slot flatbuffers.VOffsetT) int {
+	if int(slot)+2 > t.vtSize {
+		return 0
+	}
+	return int(binary.LittleEndian.Uint16(t.buf[t.vtable+int(slot):]))
+}
+
+// scalar checks that an inline field of size bytes lies within the table.
+func (t fbTable) scalar(slot flatbuffers.VOffsetT, size int) error {
+	if off := t.fieldOffset(slot); off != 0 && off+size > t.size {
+		return fmt.Errorf("field %d of table at %d is out of bounds", slot, t.pos)
+	}
+	return nil
+}
+
+// ref resolves a field holding an offset to a vector, string or table. It
+// returns -1 if the field is absent.
+func (t fbTable) ref(slot flatbuffers.VOffsetT) (int64, error) {
+	off := t.fieldOffset(slot)
+	if off == 0 {
+		return -1, nil
+	}
+	if err := t.scalar(slot, 4); err != nil {
+		return 0, err
+	}
+	at := t.pos + off
+	target := int64(at) + int64(binary.LittleEndian.Uint32(t.buf[at:]))
+	if target > int64(len(t.buf)-4) {
+		return 0, fmt.Errorf("field %d of table at %d points out of bounds", slot, t.pos)
+	}
+	return target, nil
+}
+
+// vectorAt checks a vector of n elements of elemSize bytes at pos, returning
+// the start of its elements and its length.
+func (t fbTable) vectorAt(slot flatbuffers.VOffsetT, pos int64, elemSize int) (int, int, error) {
+	n := int64(binary.LittleEndian.Uint32(t.buf[pos:]))
+	if n > (int64(len(t.buf))-pos-4)/int64(elemSize) {
+		return 0, 0, fmt.Errorf("vector in field %d of table at %d has %d elements, exceeding the buffer",
+			slot, t.pos, n)
+	}
+	return int(pos) + 4, int(n), nil
+}
+
+// vector checks a vector field of elements of elemSize bytes.
+func (t fbTable) vector(slot flatbuffers.VOffsetT, elemSize int) error {
+	pos, err := t.ref(slot)
+	if err != nil || pos < 0 {
+		return err
+	}
+	_, _, err = t.vectorAt(slot, pos, elemSize)
+	return err
+}
+
+// string checks a string field, including its NUL terminator.
+func (t fbTable) string(slot flatbuffers.VOffsetT) error {
+	pos, err := t.ref(slot)
+	if err != nil || pos < 0 {
+		return err
+	}
+	start, n, err := t.vectorAt(slot, pos, 1)
+	if err != nil {
+		return err
+	}
+	if start+n >= len(t.buf) || t.buf[start+n] != 0 {
+		return fmt.Errorf("string in field %d of table at %d is not terminated", slot, t.pos)
+	}
+	return nil
+}
+
+// table checks a table field of the given kind.
+func (t fbTable) table(slot flatbuffers.VOffsetT, kind tableKind) error {
+	pos, err := t.ref(slot)
+	if err != nil || pos < 0 {
+		return err
+	}
+	sub, err := verifyTable(t.buf, pos, t.depth+1, t.budget)
+	if err != nil {
+		return err
+	}
+	return sub.verifyAs(kind)
+}
+
+// tables checks a vector of tables of the given kind.
+func (t fbTable) tables(slot flatbuffers.VOffsetT, kind tableKind) error {
+	pos, err := t.ref(slot)
+	if err != nil || pos < 0 {
+		return err
+	}
+	start, n, err := t.vectorAt(slot, pos, 4)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		at := start + 4*i
+		sub, err := verifyTable(t.buf, int64(at)+int64(binary.LittleEndian.Uint32(t.buf[at:])), t.depth+1, t.budget)
+		if err != nil {
+			return err
+		}
+		if err := sub.verifyAs(kind); err != nil {
+			return err
+		}
+	}
+	return nil
+}
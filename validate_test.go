@@ -0,0 +1,341 @@
+package flatgeobuf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flatgeobuf/flatgeobuf/src/go/flattypes"
+	flatbuffers "github.com/google/flatbuffers/go"
+
+	"github.com/tingold/orb-flatgeobuf/packedrtree"
+)
+
+// validFile writes a small file with or without an index.
+func validFile(t *testing.T, index bool) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := WriteFeatures(&buf, concurrentFeatures(50), &Options{IncludeIndex: index}); err != nil {
+		t.Fatalf("WriteFeatures failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestValidate_Valid(t *testing.T) {
+	for _, index := range []bool{false, true} {
+		data := validFile(t, index)
+		report := Validate(data)
+		if !report.Valid() {
+			t.Fatalf("index=%v: unexpected issues: %v", index, report.Issues)
+		}
+		if report.Err() != nil {
+			t.Errorf("index=%v: Err() = %v, want nil", index, report.Err())
+		}
+		if report.MajorVersion != 3 {
+			t.Errorf("index=%v: MajorVersion = %d, want 3", index, report.MajorVersion)
+		}
+		// The feature without a geometry is not written
+		if report.FeaturesFound != 49 || report.FeaturesCount != 49 {
+			t.Errorf("index=%v: found %d of %d features, want 49", index, report.FeaturesFound, report.FeaturesCount)
+		}
+
+		wantIndex := 0
+		if index {
+			wantIndex, _ = packedrtree.Size(49, packedrtree.DefaultNodeSize)
+		}
+		if report.IndexSize != wantIndex {
+			t.Errorf("index=%v: IndexSize = %d, want %d", index, report.IndexSize, wantIndex)
+		}
+		if want := 12 + report.HeaderSize; report.IndexOffset != want {
+			t.Errorf("index=%v: IndexOffset = %d, want %d", index, report.IndexOffset, want)
+		}
+		if want := report.IndexOffset + report.IndexSize; report.FeaturesOffset != want {
+			t.Errorf("index=%v: FeaturesOffset = %d, want %d", index, report.FeaturesOffset, want)
+		}
+	}
+}
+
+func TestValidate_Fixtures(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "*.fgb"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no fixtures: %v", err)
+	}
+	for _, path := range paths {
+		report, err := ValidateFile(path)
+		if err != nil {
+			t.Fatalf("%s: ValidateFile failed: %v", path, err)
+		}
+		// NUL-terminated strings are not valid under the spec encoding
+		legacy := filepath.Base(path) == "legacy_strings.fgb"
+		if report.Valid() == legacy {
+			t.Errorf("%s: Valid() = %v, issues: %v", path, report.Valid(), report.Issues)
+		}
+	}
+
+	// Readers opened for legacy strings validate them in that encoding
+	path := filepath.Join("testdata", "legacy_strings.fgb")
+	for _, legacy := range []bool{false, true} {
+		reader, err := NewReaderWithOptions(path, &ReaderOptions{Validate: true, LegacyStrings: legacy})
+		if legacy != (err == nil) {
+			t.Errorf("LegacyStrings %v: NewReaderWithOptions returned %v", legacy, err)
+		}
+		if reader != nil {
+			reader.Close()
+		}
+	}
+}
+
+func TestValidate_Corrupt(t *testing.T) {
+	base := validFile(t, true)
+	layout := Validate(base)
+	leaves := layout.IndexOffset + layout.IndexSize - int(layout.FeaturesCount)*packedrtree.NodeItemSize
+
+	tests := []struct {
+		name    string
+		corrupt func([]byte) []byte
+		section string
+		message string
+	}{
+		{
+			name:    "empty",
+			corrupt: func(b []byte) []byte { return nil },
+			section: SectionMagic,
+			message: "too short",
+		},
+		{
+			name:    "bad magic",
+			corrupt: func(b []byte) []byte { b[0] = 'x'; return b },
+			section: SectionMagic,
+			message: "not a FlatGeobuf file",
+		},
+		{
+			name:    "major version",
+			corrupt: func(b []byte) []byte { b[3] = 4; return b },
+			section: SectionMagic,
+			message: "unsupported major version 4",
+		},
+		{
+			name: "header size too large",
+			corrupt: func(b []byte) []byte {
+				binary.LittleEndian.PutUint32(b[8:], maxHeaderSize+1)
+				return b
+			},
+			section: SectionHeader,
+			message: "exceeds the maximum",
+		},
+		{
+			name:    "truncated header",
+			corrupt: func(b []byte) []byte { return b[:20] },
+			section: SectionHeader,
+			message: "exceeds file size",
+		},
+		{
+			name: "header root out of bounds",
+			corrupt: func(b []byte) []byte {
+				binary.LittleEndian.PutUint32(b[12:], 1<<30)
+				return b
+			},
+			section: SectionHeader,
+			message: "out of bounds",
+		},
+		{
+			name: "feature count too large",
+			corrupt: func(b []byte) []byte {
+				return b[:layout.IndexOffset+layout.IndexSize/2]
+			},
+			section: SectionIndex,
+			message: "too many for the file size",
+		},
+		{
+			name: "node outside level",
+			corrupt: func(b []byte) []byte {
+				binary.LittleEndian.PutUint64(b[layout.IndexOffset+32:], 0)
+				return b
+			},
+			section: SectionIndex,
+			message: "outside level",
+		},
+		{
+			name: "leaf not at a feature",
+			corrupt: func(b []byte) []byte {
+				binary.LittleEndian.PutUint64(b[leaves+32:], 1)
+				return b
+			},
+			section: SectionIndex,
+			message: "not the start of a feature",
+		},
+		{
+			name: "feature size",
+			corrupt: func(b []byte) []byte {
+				binary.LittleEndian.PutUint32(b[layout.FeaturesOffset:], 1<<30)
+				return b
+			},
+			section: SectionFeatures,
+			message: "exceeds file size",
+		},
+		{
+			name: "feature root out of bounds",
+			corrupt: func(b []byte) []byte {
+				binary.LittleEndian.PutUint32(b[layout.FeaturesOffset+4:], 1<<20)
+				return b
+			},
+			section: SectionFeatures,
+			message: "out of bounds",
+		},
+		{
+			name:    "truncated features",
+			corrupt: func(b []byte) []byte { return b[:len(b)-3] },
+			section: SectionFeatures,
+			message: "exceeds file size",
+		},
+		{
+			name:    "missing features",
+			corrupt: func(b []byte) []byte { return b[:layout.FeaturesOffset] },
+			section: SectionFeatures,
+			message: "found 0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.corrupt(bytes.Clone(base))
+			report := Validate(data)
+			if report.Valid() {
+				t.Fatal("expected issues, got none")
+			}
+
+			found := false
+			for _, issue := range report.Issues {
+				if issue.Section == tt.section && strings.Contains(issue.Message, tt.message) {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("no %s issue containing %q in %v", tt.section, tt.message, report.Issues)
+			}
+
+			err := report.Err()
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) || !errors.Is(err, ErrInvalidData) {
+				t.Errorf("Err() = %v, want a *ValidationError wrapping ErrInvalidData", err)
+			}
+		})
+	}
+}
+
+func TestCheckGeometry(t *testing.T) {
+	tests := []struct {
+		name    string
+		xy      []float64
+		ends    []uint32
+		wantErr bool
+	}{
+		{"consistent", []float64{0, 0, 1, 0, 1, 1, 0, 0}, []uint32{4}, false},
+		{"odd xy", []float64{0, 0, 1}, nil, true},
+		{"end past points", []float64{0, 0, 1, 0, 1, 1}, []uint32{2, 10}, true},
+		{"decreasing ends", []float64{0, 0, 1, 0, 1, 1}, []uint32{3, 1}, true},
+	}
+	for _, tt := range tests {
+		err := checkGeometry(buildGeometry(tt.xy, tt.ends), 0)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: checkGeometry() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestVerifyFeature_SharedParts(t *testing.T) {
+	// Each collection lists the one below it twice, describing 2^30 leaf
+	// geometries in a few kilobytes
+	builder := flatbuffers.NewBuilder(1024)
+	flattypes.GeometryStart(builder)
+	flattypes.GeometryAddType(builder, flattypes.GeometryTypePoint)
+	geom := flattypes.GeometryEnd(builder)
+	for i := 0; i < 30; i++ {
+		flattypes.GeometryStartPartsVector(builder, 2)
+		builder.PrependUOffsetT(geom)
+		builder.PrependUOffsetT(geom)
+		parts := builder.EndVector(2)
+		flattypes.GeometryStart(builder)
+		flattypes.GeometryAddType(builder, flattypes.GeometryTypeGeometryCollection)
+		flattypes.GeometryAddParts(builder, parts)
+		geom = flattypes.GeometryEnd(builder)
+	}
+	flattypes.FeatureStart(builder)
+	flattypes.FeatureAddGeometry(builder, geom)
+	builder.Finish(flattypes.FeatureEnd(builder))
+
+	err := verifyFeature(builder.FinishedBytes())
+	if err == nil || !strings.Contains(err.Error(), "more tables") {
+		t.Errorf("expected too many tables, got %v", err)
+	}
+}
+
+// TestValidate_NoPanic corrupts every byte of a file in turn. Validate must
+// not panic, and files that pass it must read without panicking.
+func TestValidate_NoPanic(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteFeatures(&buf, concurrentFeatures(4), &Options{IncludeIndex: true}); err != nil {
+		t.Fatalf("WriteFeatures failed: %v", err)
+	}
+	base := buf.Bytes()
+
+	check := func(data []byte) {
+		reader, err := NewReaderFromDataWithOptions(data, &ReaderOptions{Validate: true})
+		if err != nil {
+			return
+		}
+		_, _ = reader.ReadAll()
+		_ = reader.Bounds()
+		_ = reader.Header()
+	}
+
+	for n := 0; n < len(base); n++ {
+		check(base[:n])
+	}
+	for i := range base {
+		for _, v := range []byte{0x01, 0x80, 0xff} {
+			data := bytes.Clone(base)
+			data[i] ^= v
+			check(data)
+		}
+	}
+}
+
+func TestNewReader_Validate(t *testing.T) {
+	data := validFile(t, true)
+	path := filepath.Join(t.TempDir(), "data.fgb")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	reader, err := NewReaderWithOptions(path, &ReaderOptions{Validate: true})
+	if err != nil {
+		t.Fatalf("NewReaderWithOptions failed: %v", err)
+	}
+	reader.Close()
+
+	// A leaf pointing between features passes the default checks on open
+	layout := Validate(data)
+	leaves := layout.IndexOffset + layout.IndexSize - int(layout.FeaturesCount)*packedrtree.NodeItemSize
+	binary.LittleEndian.PutUint64(data[leaves+32:], 1)
+
+	reader, err = NewReaderFromData(data)
+	if err != nil {
+		t.Fatalf("NewReaderFromData failed: %v", err)
+	}
+	reader.Close()
+
+	_, err = NewReaderFromDataWithOptions(data, &ReaderOptions{Validate: true})
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected *ValidationError, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "index at offset") {
+		t.Errorf("error %q does not locate the problem", err)
+	}
+}
@@ -0,0 +1,678 @@
+package flatgeobuf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/flatgeobuf/flatgeobuf/src/go/flattypes"
+	"github.com/flatgeobuf/flatgeobuf/src/go/writer"
+	flatbuffers "github.com/google/flatbuffers/go"
+)
+
+// Type flags of PostGIS extended WKB.
+const (
+	ewkbZ    = 0x80000000
+	ewkbM    = 0x40000000
+	ewkbSRID = 0x20000000
+)
+
+// WKBOptions configures GeometryToWKB and Reader.ReadWKB.
+type WKBOptions struct {
+	BigEndian bool // Write big-endian (XDR) rather than little-endian (NDR) values
+	Extended  bool // Write PostGIS EWKB type flags rather than ISO WKB type codes
+	SRID      int  // SRID stored in EWKB output (0: none)
+}
+
+// WKBInfo describes a geometry decoded by GeometryFromWKB.
+type WKBInfo struct {
+	Type flattypes.GeometryType // Type of the outermost geometry
+	HasZ bool                   // Whether coordinates have Z ordinates
+	HasM bool                   // Whether coordinates have M ordinates
+	SRID int                    // SRID of EWKB input (0: none)
+}
+
+// GeometryToWKB encodes a FlatGeobuf geometry as ISO WKB, or as EWKB with
+// opts.Extended, without converting it to an orb.Geometry. Z and M ordinates
+// are kept. geomType is the header geometry type, used when g does not
+// declare its own.
+//
+// g must come from a verified feature, as the Reader returns them. Point,
+// LineString, Polygon, their Multi variants and GeometryCollection are
+// supported; other types return ErrUnsupportedType.
+func GeometryToWKB(g *flattypes.Geometry, geomType flattypes.GeometryType, opts *WKBOptions) ([]byte, error) {
+	if opts == nil {
+		opts = &WKBOptions{}
+	}
+	if err := checkGeometry(g, 0); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidData, err)
+	}
+
+	e := wkbEncoder{order: binary.LittleEndian, extended: opts.Extended}
+	if opts.BigEndian {
+		e.order = binary.BigEndian
+	}
+	e.hasZ, e.hasM = geometryDims(g)
+
+	srid := 0
+	if opts.Extended {
+		srid = opts.SRID
+	}
+	if err := e.geometry(g, geomType, srid); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+// geometryDims reports whether g or any of its parts has Z or M ordinates.
+func geometryDims(g *flattypes.Geometry) (hasZ, hasM bool) {
+	hasZ, hasM = g.ZLength() > 0, g.MLength() > 0
+	var part flattypes.Geometry
+	for i := 0; i < g.PartsLength(); i++ {
+		g.Parts(&part, i)
+		z, m := geometryDims(&part)
+		hasZ, hasM = hasZ || z, hasM || m
+	}
+	return hasZ, hasM
+}
+
+// wkbEncoder appends a geometry to buf as WKB.
+type wkbEncoder struct {
+	buf        []byte
+	order      binary.AppendByteOrder
+	extended   bool
+	hasZ, hasM bool
+}
+
+// geometry appends g, interpreted as typ unless it declares its own type.
+// The SRID, if not 0, is written in the EWKB header.
+func (e *wkbEncoder) geometry(g *flattypes.Geometry, typ flattypes.GeometryType, srid int) error {
+	if t := g.Type(); t != flattypes.GeometryTypeUnknown {
+		typ = t
+	}
+
+	xy := geometryXY(g)
+	z := vectorBytes(g.Table(), slotGeometryZ, 8)
+	m := vectorBytes(g.Table(), slotGeometryM, 8)
+	n := len(xy) / 16
+	if n > 0 && (e.hasZ != (len(z) > 0) || e.hasM != (len(m) > 0)) {
+		return fmt.Errorf("%w: geometry mixes coordinate dimensions", ErrInvalidData)
+	}
+	c := wkbCoords{xy: xy, z: z, m: m}
+
+	switch typ {
+	case flattypes.GeometryTypePoint:
+		e.header(typ, srid)
+		if n == 0 {
+			e.emptyPoint()
+		} else {
+			e.points(c, 0, 1)
+		}
+
+	case flattypes.GeometryTypeLineString:
+		e.header(typ, srid)
+		e.uint32(n)
+		e.points(c, 0, n)
+
+	case flattypes.GeometryTypeMultiPoint:
+		e.header(typ, srid)
+		e.uint32(n)
+		for i := 0; i < n; i++ {
+			e.header(flattypes.GeometryTypePoint, 0)
+			e.points(c, i, i+1)
+		}
+
+	case flattypes.GeometryTypePolygon:
+		e.header(typ, srid)
+		e.polygon(c, geometryRanges(g, n))
+
+	case flattypes.GeometryTypeMultiLineString:
+		e.header(typ, srid)
+		lines := geometryRanges(g, n)
+		e.uint32(len(lines))
+		for _, r := range lines {
+			e.header(flattypes.GeometryTypeLineString, 0)
+			e.uint32(r[1] - r[0])
+			e.points(c, r[0], r[1])
+		}
+
+	case flattypes.GeometryTypeMultiPolygon:
+		e.header(typ, srid)
+		if g.PartsLength() == 0 {
+			// A single polygon may be stored in the geometry itself
+			if n == 0 {
+				e.uint32(0)
+				break
+			}
+			e.uint32(1)
+			e.header(flattypes.GeometryTypePolygon, 0)
+			e.polygon(c, geometryRanges(g, n))
+			break
+		}
+		e.uint32(g.PartsLength())
+		var part flattypes.Geometry
+		for i := 0; i < g.PartsLength(); i++ {
+			g.Parts(&part, i)
+			if t := part.Type(); t != flattypes.GeometryTypeUnknown && t != flattypes.GeometryTypePolygon {
+				return fmt.Errorf("%w: MultiPolygon part of type %s", ErrInvalidData, t)
+			}
+			if err := e.geometry(&part, flattypes.GeometryTypePolygon, 0); err != nil {
+				return err
+			}
+		}
+
+	case flattypes.GeometryTypeGeometryCollection:
+		e.header(typ, srid)
+		e.uint32(g.PartsLength())
+		var part flattypes.Geometry
+		for i := 0; i < g.PartsLength(); i++ {
+			g.Parts(&part, i)
+			if part.Type() == flattypes.GeometryTypeUnknown {
+				return fmt.Errorf("%w: GeometryCollection part without a type", ErrInvalidData)
+			}
+			if err := e.geometry(&part, flattypes.GeometryTypeUnknown, 0); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedType, typ)
+	}
+	return nil
+}
+
+// wkbCoords holds the raw coordinate vectors of a geometry.
+type wkbCoords struct {
+	xy, z, m []byte
+}
+
+// geometryRanges returns the point ranges of the parts of g, which has n
+// points: one per end, or a single part without ends.
+func geometryRanges(g *flattypes.Geometry, n int) [][2]int {
+	ends := geometryEnds(g)
+	if len(ends) == 0 {
+		if n == 0 {
+			return nil
+		}
+		return [][2]int{{0, n}}
+	}
+
+	ranges := make([][2]int, len(ends)/4)
+	start := 0
+	for i := range ranges {
+		end := int(binary.LittleEndian.Uint32(ends[4*i:]))
+		ranges[i] = [2]int{start, end}
+		start = end
+	}
+	return ranges
+}
+
+func (e *wkbEncoder) header(typ flattypes.GeometryType, srid int) {
+	if e.order == binary.BigEndian {
+		e.buf = append(e.buf, 0)
+	} else {
+		e.buf = append(e.buf, 1)
+	}
+
+	code := uint32(typ)
+	if e.extended {
+		if e.hasZ {
+			code |= ewkbZ
+		}
+		if e.hasM {
+			code |= ewkbM
+		}
+		if srid != 0 {
+			code |= ewkbSRID
+		}
+		e.buf = e.order.AppendUint32(e.buf, code)
+		if srid != 0 {
+			e.buf = e.order.AppendUint32(e.buf, uint32(int32(srid)))
+		}
+		return
+	}
+
+	if e.hasZ {
+		code += 1000
+	}
+	if e.hasM {
+		code += 2000
+	}
+	e.buf = e.order.AppendUint32(e.buf, code)
+}
+
+func (e *wkbEncoder) uint32(n int) {
+	e.buf = e.order.AppendUint32(e.buf, uint32(n))
+}
+
+func (e *wkbEncoder) float(bits uint64) {
+	e.buf = e.order.AppendUint64(e.buf, bits)
+}
+
+// points appends points [start, end) of c.
+func (e *wkbEncoder) points(c wkbCoords, start, end int) {
+	for i := start; i < end; i++ {
+		e.float(binary.LittleEndian.Uint64(c.xy[16*i:]))
+		e.float(binary.LittleEndian.Uint64(c.xy[16*i+8:]))
+		if e.hasZ {
+			e.float(binary.LittleEndian.Uint64(c.z[8*i:]))
+		}
+		if e.hasM {
+			e.float(binary.LittleEndian.Uint64(c.m[8*i:]))
+		}
+	}
+}
+
+// emptyPoint appends the coordinates of an empty point, which WKB represents
+// as NaN ordinates.
+func (e *wkbEncoder) emptyPoint() {
+	dims := 2
+	if e.hasZ {
+		dims++
+	}
+	if e.hasM {
+		dims++
+	}
+	for i := 0; i < dims; i++ {
+		e.float(math.Float64bits(math.NaN()))
+	}
+}
+
+// polygon appends the rings of a polygon.
+func (e *wkbEncoder) polygon(c wkbCoords, rings [][2]int) {
+	e.uint32(len(rings))
+	for _, r := range rings {
+		e.uint32(r[1] - r[0])
+		e.points(c, r[0], r[1])
+	}
+}
+
+// GeometryFromWKB decodes ISO WKB or EWKB into a FlatGeobuf geometry built
+// with builder, without converting it to an orb.Geometry. Z and M ordinates
+// are kept, and the SRID of EWKB input is returned in the WKBInfo.
+//
+// Nested geometries must have the dimensions of the outermost one. Malformed
+// input returns an error wrapping ErrInvalidData, and types other than Point,
+// LineString, Polygon, their Multi variants and GeometryCollection return
+// ErrUnsupportedType.
+func GeometryFromWKB(builder *flatbuffers.Builder, data []byte) (*writer.Geometry, *WKBInfo, error) {
+	d := wkbDecoder{data: data, builder: builder}
+	info := &WKBInfo{}
+	g, _, err := d.geometry(0, info)
+	if err != nil {
+		return nil, nil, err
+	}
+	if d.pos != len(d.data) {
+		return nil, nil, fmt.Errorf("%w: %d bytes after WKB geometry", ErrInvalidData, len(d.data)-d.pos)
+	}
+	return g, info, nil
+}
+
+// wkbDecoder reads a WKB geometry from data.
+type wkbDecoder struct {
+	data    []byte
+	pos     int
+	order   binary.ByteOrder // Byte order of the current geometry
+	dims    int              // Ordinates per point
+	builder *flatbuffers.Builder
+}
+
+// errWKBTruncated reports input that ends inside a geometry.
+var errWKBTruncated = fmt.Errorf("%w: WKB is truncated", ErrInvalidData)
+
+// header reads a geometry header. The outermost header fills info; nested
+// ones must match its dimensions.
+func (d *wkbDecoder) header(depth int, info *WKBInfo) (flattypes.GeometryType, error) {
+	if len(d.data)-d.pos < 5 {
+		return 0, errWKBTruncated
+	}
+	switch d.data[d.pos] {
+	case 0:
+		d.order = binary.BigEndian
+	case 1:
+		d.order = binary.LittleEndian
+	default:
+		return 0, fmt.Errorf("%w: WKB byte order %d", ErrInvalidData, d.data[d.pos])
+	}
+	d.pos++
+	code := d.order.Uint32(d.data[d.pos:])
+	d.pos += 4
+
+	hasZ, hasM := code&ewkbZ != 0, code&ewkbM != 0
+	hasSRID := code&ewkbSRID != 0
+	code &^= ewkbZ | ewkbM | ewkbSRID
+	switch code / 1000 {
+	case 0:
+	case 1:
+		hasZ = true
+	case 2:
+		hasM = true
+	case 3:
+		hasZ, hasM = true, true
+	default:
+		return 0, fmt.Errorf("%w: WKB geometry type %d", ErrUnsupportedType, code)
+	}
+	typ := flattypes.GeometryType(code % 1000)
+	if typ < flattypes.GeometryTypePoint || typ > flattypes.GeometryTypeGeometryCollection {
+		return 0, fmt.Errorf("%w: WKB geometry type %d", ErrUnsupportedType, code)
+	}
+
+	var srid int
+	if hasSRID {
+		if len(d.data)-d.pos < 4 {
+			return 0, errWKBTruncated
+		}
+		srid = int(int32(d.order.Uint32(d.data[d.pos:])))
+		d.pos += 4
+	}
+
+	if depth == 0 {
+		*info = WKBInfo{Type: typ, HasZ: hasZ, HasM: hasM, SRID: srid}
+		d.dims = 2
+		if hasZ {
+			d.dims++
+		}
+		if hasM {
+			d.dims++
+		}
+	} else if hasZ != info.HasZ || hasM != info.HasM {
+		return 0, fmt.Errorf("%w: WKB %s mixes coordinate dimensions", ErrInvalidData, info.Type)
+	}
+	return typ, nil
+}
+
+// count reads the number of items that follow, each at least size bytes.
+func (d *wkbDecoder) count(size int) (int, error) {
+	if len(d.data)-d.pos < 4 {
+		return 0, errWKBTruncated
+	}
+	n := d.order.Uint32(d.data[d.pos:])
+	d.pos += 4
+	if uint64(n)*uint64(size) > uint64(len(d.data)-d.pos) {
+		return 0, errWKBTruncated
+	}
+	return int(n), nil
+}
+
+// points reads n points, appending them to the vectors of c.
+func (d *wkbDecoder) points(c *wkbValues, n int, info *WKBInfo) error {
+	if n*d.dims*8 > len(d.data)-d.pos {
+		return errWKBTruncated
+	}
+	for i := 0; i < n; i++ {
+		c.xy = append(c.xy, d.float(), d.float())
+		if info.HasZ {
+			c.z = append(c.z, d.float())
+		}
+		if info.HasM {
+			c.m = append(c.m, d.float())
+		}
+	}
+	return nil
+}
+
+func (d *wkbDecoder) float() float64 {
+	v := math.Float64frombits(d.order.Uint64(d.data[d.pos:]))
+	d.pos += 8
+	return v
+}
+
+// wkbValues accumulates the coordinates of a decoded geometry.
+type wkbValues struct {
+	xy, z, m []float64
+	ends     []uint32
+}
+
+// geometry reads a geometry and its parts, returning its type.
+func (d *wkbDecoder) geometry(depth int, info *WKBInfo) (*writer.Geometry, flattypes.GeometryType, error) {
+	if depth > maxGeometryDepth {
+		return nil, 0, fmt.Errorf("%w: WKB geometries nested deeper than %d", ErrInvalidData, maxGeometryDepth)
+	}
+	typ, err := d.header(depth, info)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	g := writer.NewGeometry(d.builder)
+	g.SetType(typ)
+	var c wkbValues
+	point := d.dims * 8
+
+	switch typ {
+	case flattypes.GeometryTypePoint:
+		err = d.points(&c, 1, info)
+
+	case flattypes.GeometryTypeLineString:
+		var n int
+		if n, err = d.count(point); err == nil {
+			err = d.points(&c, n, info)
+		}
+
+	case flattypes.GeometryTypePolygon:
+		err = d.rings(&c, info)
+
+	case flattypes.GeometryTypeMultiPoint, flattypes.GeometryTypeMultiLineString:
+		member := flattypes.GeometryTypePoint
+		if typ == flattypes.GeometryTypeMultiLineString {
+			member = flattypes.GeometryTypeLineString
+		}
+		var n int
+		if n, err = d.count(5); err != nil {
+			break
+		}
+		for i := 0; i < n && err == nil; i++ {
+			err = d.member(&c, member, depth, info)
+		}
+
+	case flattypes.GeometryTypeMultiPolygon, flattypes.GeometryTypeGeometryCollection:
+		var n int
+		if n, err = d.count(5); err != nil {
+			break
+		}
+		parts := make([]writer.Geometry, 0, n)
+		for i := 0; i < n; i++ {
+			part, partType, err := d.geometry(depth+1, info)
+			if err != nil {
+				return nil, 0, err
+			}
+			if typ == flattypes.GeometryTypeMultiPolygon && partType != flattypes.GeometryTypePolygon {
+				return nil, 0, fmt.Errorf("%w: WKB MultiPolygon member of type %s", ErrInvalidData, partType)
+			}
+			parts = append(parts, *part)
+		}
+		g.SetParts(parts)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	g.SetXY(c.xy)
+	g.SetEnds(c.ends)
+	g.SetZ(c.z)
+	g.SetM(c.m)
+	return g, typ, nil
+}
+
+// member reads a Point or LineString of a MultiPoint or MultiLineString into
+// the coordinates of its parent.
+func (d *wkbDecoder) member(c *wkbValues, want flattypes.GeometryType, depth int, info *WKBInfo) error {
+	typ, err := d.header(depth+1, info)
+	if err != nil {
+		return err
+	}
+	if typ != want {
+		return fmt.Errorf("%w: WKB %s member of type %s", ErrInvalidData, info.Type, typ)
+	}
+	if typ == flattypes.GeometryTypePoint {
+		return d.points(c, 1, info)
+	}
+	n, err := d.count(d.dims * 8)
+	if err != nil {
+		return err
+	}
+	if err := d.points(c, n, info); err != nil {
+		return err
+	}
+	c.ends = append(c.ends, uint32(len(c.xy)/2))
+	return nil
+}
+
+// rings reads the rings of a polygon.
+func (d *wkbDecoder) rings(c *wkbValues, info *WKBInfo) error {
+	rings, err := d.count(4)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < rings; i++ {
+		n, err := d.count(d.dims * 8)
+		if err != nil {
+			return err
+		}
+		if err := d.points(c, n, info); err != nil {
+			return err
+		}
+		c.ends = append(c.ends, uint32(len(c.xy)/2))
+	}
+	return nil
+}
+
+// WriteWKB writes geometries given as WKB or EWKB to FlatGeobuf format without
+// converting them to orb types. Z and M ordinates are kept and the header's
+// HasZ and HasM set, so every geometry must have the same dimensions. When
+// opts.CRS is nil, the SRID of EWKB input, which must then agree across
+// geometries, sets an EPSG CRS. Empty entries are skipped, as nil geometries
+// are by Write. With opts.IncludeIndex the features are indexed with
+// BuildIndex; opts.Concurrency is ignored. Geometries are written as given,
+// so opts.TargetCRS returns ErrUnsupportedCRS.
+func WriteWKB(w io.Writer, geometries [][]byte, opts *Options) error {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	if len(geometries) == 0 {
+		return ErrNilGeometry
+	}
+	if opts.TargetCRS != nil {
+		return fmt.Errorf("%w: WriteWKB writes coordinates as given and does not reproject", ErrUnsupportedCRS)
+	}
+
+	var (
+		features bytes.Buffer
+		first    *WKBInfo
+		geomType flattypes.GeometryType
+		srid     int
+		count    int
+	)
+	envelope := emptyBound
+	builder := flatbuffers.NewBuilder(1024)
+	for i, data := range geometries {
+		if len(data) == 0 {
+			continue
+		}
+
+		builder.Reset()
+		g, info, err := GeometryFromWKB(builder, data)
+		if err != nil {
+			return fmt.Errorf("geometry %d: %w", i, err)
+		}
+		if first == nil {
+			first, geomType = info, info.Type
+		} else {
+			if info.Type != geomType {
+				geomType = flattypes.GeometryTypeUnknown
+			}
+			if info.HasZ != first.HasZ || info.HasM != first.HasM {
+				return fmt.Errorf("%w: geometry %d has different dimensions from the first", ErrInvalidData, i)
+			}
+		}
+		if info.SRID != 0 && opts.CRS == nil {
+			if srid != 0 && info.SRID != srid {
+				return fmt.Errorf("%w: geometry %d has SRID %d, not %d", ErrInvalidData, i, info.SRID, srid)
+			}
+			srid = info.SRID
+		}
+
+		feature := writer.NewFeature(builder)
+		feature.SetGeometry(g)
+		builder.FinishSizePrefixed(feature.Build())
+		encoded := builder.FinishedBytes()
+		envelope = envelope.Union(featureBound(flattypes.GetSizePrefixedRootAsFeature(encoded, 0)))
+		features.Write(encoded)
+		count++
+	}
+
+	headerOpts := *opts
+	if srid != 0 {
+		headerOpts.CRS = &CRS{Code: srid}
+	}
+	header, _, err := newHeader(geomType, nil, &headerOpts)
+	if err != nil {
+		return err
+	}
+	if first != nil {
+		header.SetHasZ(first.HasZ)
+		header.SetHasM(first.HasM)
+	}
+	header.SetEnvelope(envelopeSlice(envelope))
+	header.SetFeaturesCount(uint64(count))
+
+	write := func(w io.Writer) error {
+		if err := writeHeader(w, header); err != nil {
+			return err
+		}
+		_, err := w.Write(features.Bytes())
+		return err
+	}
+	if opts.IncludeIndex {
+		return pipeToIndex(w, "", write)
+	}
+	return write(w)
+}
+
+// ReadWKB returns the geometry of every feature as WKB, or EWKB with
+// opts.Extended, in file order like ReadAll, without converting them to orb
+// types. Features without a geometry give a nil entry. EWKB output takes the
+// SRID of the header's CRS when opts.SRID is 0. Geometries are returned as
+// stored, so readers with ReaderOptions.TargetCRS return ErrUnsupportedCRS.
+func (r *Reader) ReadWKB(opts *WKBOptions) ([][]byte, error) {
+	if err := r.acquire(); err != nil {
+		return nil, err
+	}
+	defer r.release()
+
+	if r.reproject != nil {
+		return nil, fmt.Errorf("%w: ReadWKB returns stored coordinates and does not reproject", ErrUnsupportedCRS)
+	}
+	offsets, err := r.fileOffsets()
+	if err != nil {
+		return nil, err
+	}
+
+	var wkbOpts WKBOptions
+	if opts != nil {
+		wkbOpts = *opts
+	}
+	if wkbOpts.Extended && wkbOpts.SRID == 0 {
+		var crs flattypes.Crs
+		if r.header.Crs(&crs) != nil {
+			wkbOpts.SRID = int(crs.Code())
+		}
+	}
+
+	result := make([][]byte, len(offsets))
+	var geom flattypes.Geometry
+	for i, offset := range offsets {
+		feature, err := r.rawFeature(offset)
+		if err != nil {
+			return nil, err
+		}
+		if feature.Geometry(&geom) == nil {
+			continue
+		}
+		if result[i], err = GeometryToWKB(&geom, r.header.GeometryType(), &wkbOpts); err != nil {
+			return nil, fmt.Errorf("geometry of feature at offset %d: %w", offset, err)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,270 @@
+package flatgeobuf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/flatgeobuf/flatgeobuf/src/go/flattypes"
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/wkb"
+)
+
+var wkbGeometries = []orb.Geometry{
+	orb.Point{1, 2},
+	orb.MultiPoint{{1, 2}, {3, 4}},
+	orb.LineString{{0, 0}, {1, 1}, {2, 0}},
+	orb.MultiLineString{{{0, 0}, {1, 1}}, {{2, 2}, {3, 3}, {4, 4}}},
+	orb.Polygon{{{0, 0}, {4, 0}, {4, 4}, {0, 0}}, {{1, 1}, {2, 1}, {2, 2}, {1, 1}}},
+	orb.MultiPolygon{{{{0, 0}, {1, 0}, {1, 1}, {0, 0}}}, {{{5, 5}, {6, 5}, {6, 6}, {5, 5}}}},
+	orb.Collection{orb.Point{1, 2}, orb.LineString{{0, 0}, {1, 1}}, orb.Collection{orb.Point{3, 4}}},
+	orb.MultiPoint{},
+}
+
+// wkbRoundTrip decodes data into a FlatGeobuf geometry and encodes it again.
+func wkbRoundTrip(t *testing.T, data []byte, opts *WKBOptions) ([]byte, *WKBInfo) {
+	t.Helper()
+
+	builder := flatbuffers.NewBuilder(256)
+	g, info, err := GeometryFromWKB(builder, data)
+	if err != nil {
+		t.Fatalf("GeometryFromWKB failed: %v", err)
+	}
+	builder.Finish(g.Build())
+	out, err := GeometryToWKB(flattypes.GetRootAsGeometry(builder.FinishedBytes(), 0), flattypes.GeometryTypeUnknown, opts)
+	if err != nil {
+		t.Fatalf("GeometryToWKB failed: %v", err)
+	}
+	return out, info
+}
+
+func TestWKB_RoundTrip(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		for _, g := range wkbGeometries {
+			data := wkb.MustMarshal(g, order)
+			got, info := wkbRoundTrip(t, data, &WKBOptions{BigEndian: order == binary.BigEndian})
+			if !bytes.Equal(got, data) {
+				t.Errorf("%T (%v): got %x, want %x", g, order, got, data)
+			}
+			if info.Type != orbToFGBGeometryType(g) || info.HasZ || info.HasM || info.SRID != 0 {
+				t.Errorf("%T: unexpected info %+v", g, info)
+			}
+		}
+	}
+}
+
+func TestWKB_ZMAndSRID(t *testing.T) {
+	coords := "000000000000F03F" + "0000000000000040" + "0000000000000840" + "0000000000001040"
+	tests := []struct {
+		name string
+		ewkb string // SRID=4326, as PostGIS writes it
+		iso  string
+		hasZ bool
+		hasM bool
+	}{
+		{"PointZM", "01010000E0E6100000" + coords, "01B90B0000" + coords, true, true},
+		{"PointZ", "01010000A0E6100000" + coords[:48], "01E9030000" + coords[:48], true, false},
+		{"PointM", "0101000060E6100000" + coords[:48], "01D1070000" + coords[:48], false, true},
+		{
+			"LineStringZ",
+			"01020000A0E610000002000000" + coords[:48] + coords[16:64],
+			"01EA03000002000000" + coords[:48] + coords[16:64],
+			true, false,
+		},
+	}
+	for _, tt := range tests {
+		ewkb, _ := hex.DecodeString(tt.ewkb)
+		iso, _ := hex.DecodeString(tt.iso)
+
+		got, info := wkbRoundTrip(t, ewkb, &WKBOptions{Extended: true, SRID: 4326})
+		if !bytes.Equal(got, ewkb) {
+			t.Errorf("%s: EWKB got %x, want %s", tt.name, got, tt.ewkb)
+		}
+		if info.HasZ != tt.hasZ || info.HasM != tt.hasM || info.SRID != 4326 {
+			t.Errorf("%s: unexpected info %+v", tt.name, info)
+		}
+
+		got, _ = wkbRoundTrip(t, ewkb, nil)
+		if !bytes.Equal(got, iso) {
+			t.Errorf("%s: ISO got %x, want %s", tt.name, got, tt.iso)
+		}
+		got, info = wkbRoundTrip(t, iso, &WKBOptions{Extended: true, SRID: 4326})
+		if !bytes.Equal(got, ewkb) || info.SRID != 0 {
+			t.Errorf("%s: EWKB from ISO got %x (SRID %d), want %s", tt.name, got, info.SRID, tt.ewkb)
+		}
+	}
+}
+
+func TestWKB_Invalid(t *testing.T) {
+	point, _ := hex.DecodeString("0101000000000000000000F03F0000000000000040")
+	pointZ, _ := hex.DecodeString("01E9030000000000000000F03F00000000000000400000000000000840")
+
+	multi := []byte{1, 4, 0, 0, 0, 2, 0, 0, 0} // MultiPoint of a 2D and a 3D point
+	multi = append(append(multi, point...), pointZ...)
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"byte order", append([]byte{2}, point[1:]...), ErrInvalidData},
+		{"trailing bytes", append(bytes.Clone(point), 0), ErrInvalidData},
+		{"curve", []byte{1, 8, 0, 0, 0, 0, 0, 0, 0}, ErrUnsupportedType},
+		{"dimension code", []byte{1, 0xa1, 0x0f, 0, 0}, ErrUnsupportedType},
+		{"huge count", []byte{1, 2, 0, 0, 0, 0xff, 0xff, 0xff, 0xff}, ErrInvalidData},
+		{"mixed dimensions", multi, ErrInvalidData},
+		{"member type", []byte{1, 5, 0, 0, 0, 1, 0, 0, 0, 1, 1, 0, 0, 0}, ErrInvalidData},
+	}
+	for _, tt := range tests {
+		_, _, err := GeometryFromWKB(flatbuffers.NewBuilder(64), tt.data)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+
+	for _, g := range wkbGeometries {
+		data := wkb.MustMarshal(g)
+		for n := 0; n < len(data); n++ {
+			if _, _, err := GeometryFromWKB(flatbuffers.NewBuilder(64), data[:n]); !errors.Is(err, ErrInvalidData) {
+				t.Fatalf("%T truncated to %d bytes: expected ErrInvalidData, got %v", g, n, err)
+			}
+		}
+	}
+}
+
+func TestWriteWKB(t *testing.T) {
+	geometries := make([][]byte, 0, len(wkbGeometries)+1)
+	for _, g := range wkbGeometries {
+		geometries = append(geometries, wkb.MustMarshal(g))
+	}
+	geometries = append(geometries, nil) // Skipped
+
+	for _, index := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := WriteWKB(&buf, geometries, &Options{IncludeIndex: index}); err != nil {
+			t.Fatalf("index=%v: WriteWKB failed: %v", index, err)
+		}
+		if report := Validate(buf.Bytes()); !report.Valid() {
+			t.Fatalf("index=%v: invalid output: %v", index, report.Issues)
+		}
+
+		// The same file as written from orb geometries
+		var want bytes.Buffer
+		if err := Write(&want, wkbGeometries, &Options{IncludeIndex: index}); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		if !index && !bytes.Equal(buf.Bytes(), want.Bytes()) {
+			t.Error("output differs from Write")
+		}
+
+		reader, err := NewReaderFromData(buf.Bytes())
+		if err != nil {
+			t.Fatalf("NewReaderFromData failed: %v", err)
+		}
+		got, err := reader.ReadWKB(nil)
+		reader.Close()
+		if err != nil {
+			t.Fatalf("ReadWKB failed: %v", err)
+		}
+		if index {
+			continue // Hilbert order
+		}
+		if !reflect.DeepEqual(got, geometries[:len(wkbGeometries)]) {
+			t.Errorf("ReadWKB returned different geometries")
+		}
+	}
+}
+
+func TestWriteWKB_ZAndSRID(t *testing.T) {
+	line, _ := hex.DecodeString("01020000A0E610000002000000" +
+		"000000000000F03F00000000000000400000000000000840" +
+		"0000000000000040000000000000084000000000000010C0")
+
+	var buf bytes.Buffer
+	if err := WriteWKB(&buf, [][]byte{line, line}, nil); err != nil {
+		t.Fatalf("WriteWKB failed: %v", err)
+	}
+	reader, err := NewReaderFromData(buf.Bytes())
+	if err != nil {
+		t.Fatalf("NewReaderFromData failed: %v", err)
+	}
+	defer reader.Close()
+
+	header := reader.Header()
+	if header.CRS == nil || header.CRS.Code != 4326 {
+		t.Errorf("CRS = %+v, want EPSG:4326", header.CRS)
+	}
+	if !reader.header.HasZ() || reader.header.HasM() {
+		t.Errorf("HasZ = %v, HasM = %v, want true, false", reader.header.HasZ(), reader.header.HasM())
+	}
+	if want := [4]float64{1, 2, 2, 3}; header.Envelope != want {
+		t.Errorf("Envelope = %v, want %v", header.Envelope, want)
+	}
+
+	got, err := reader.ReadWKB(&WKBOptions{Extended: true})
+	if err != nil {
+		t.Fatalf("ReadWKB failed: %v", err)
+	}
+	for i := range got {
+		if !bytes.Equal(got[i], line) {
+			t.Errorf("feature %d: got %x, want %x", i, got[i], line)
+		}
+	}
+
+	// Coordinates read as orb geometries are 2D
+	fc, err := reader.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if want := (orb.LineString{{1, 2}, {2, 3}}); !orb.Equal(fc.Features[0].Geometry, want) {
+		t.Errorf("got %v, want %v", fc.Features[0].Geometry, want)
+	}
+
+	// Mixed dimensions and SRIDs are rejected
+	point := wkb.MustMarshal(orb.Point{1, 2})
+	if err := WriteWKB(&bytes.Buffer{}, [][]byte{line, point}, nil); !errors.Is(err, ErrInvalidData) {
+		t.Errorf("mixed dimensions: expected ErrInvalidData, got %v", err)
+	}
+	other := bytes.Clone(line)
+	other[5] = 0x11 // SRID 4369
+	if err := WriteWKB(&bytes.Buffer{}, [][]byte{line, other}, nil); !errors.Is(err, ErrInvalidData) {
+		t.Errorf("mixed SRIDs: expected ErrInvalidData, got %v", err)
+	}
+	if err := WriteWKB(&bytes.Buffer{}, [][]byte{line, other}, &Options{CRS: WGS84()}); err != nil {
+		t.Errorf("SRIDs with an explicit CRS: %v", err)
+	}
+}
+
+func FuzzGeometryFromWKB(f *testing.F) {
+	for _, g := range wkbGeometries {
+		f.Add(wkb.MustMarshal(g))
+		f.Add(wkb.MustMarshal(g, binary.BigEndian))
+	}
+	pointZM, _ := hex.DecodeString("01010000E0E6100000000000000000F03F000000000000004000000000000008400000000000001040")
+	f.Add(pointZM)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		builder := flatbuffers.NewBuilder(256)
+		g, _, err := GeometryFromWKB(builder, data)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidData) && !errors.Is(err, ErrUnsupportedType) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			return
+		}
+
+		// Encoding is stable once the input has been normalized
+		builder.Finish(g.Build())
+		first, err := GeometryToWKB(flattypes.GetRootAsGeometry(builder.FinishedBytes(), 0), 0, nil)
+		if err != nil {
+			t.Fatalf("GeometryToWKB failed: %v", err)
+		}
+		if second, _ := wkbRoundTrip(t, first, nil); !bytes.Equal(first, second) {
+			t.Fatalf("round trip changed %x to %x", first, second)
+		}
+	})
+}
@@ -1,13 +1,19 @@
 package flatgeobuf
 
 import (
+	"bytes"
+	"fmt"
 	"io"
+	"os"
+	"runtime"
+	"sync"
 
 	"github.com/flatgeobuf/flatgeobuf/src/go/flattypes"
 	"github.com/flatgeobuf/flatgeobuf/src/go/writer"
 	flatbuffers "github.com/google/flatbuffers/go"
 	"github.com/paulmach/orb"
 	"github.com/paulmach/orb/geojson"
+	"github.com/tingold/orb-flatgeobuf/packedrtree"
 )
 
 // Write writes geometries to FlatGeobuf format.
@@ -20,6 +26,17 @@ func Write(w io.Writer, geometries []orb.Geometry, opts *Options) error {
 	if len(geometries) == 0 {
 		return ErrNilGeometry
 	}
+	opts, proj, err := opts.reprojected()
+	if err != nil {
+		return err
+	}
+	if proj != nil {
+		reprojected := make([]orb.Geometry, len(geometries))
+		for i, g := range geometries {
+			reprojected[i] = reprojectGeometry(g, proj)
+		}
+		geometries = reprojected
+	}
 
 	// Determine geometry type from first geometry
 	geomType := orbToFGBGeometryType(geometries[0])
@@ -38,8 +55,16 @@ func Write(w io.Writer, geometries []orb.Geometry, opts *Options) error {
 		index:      0,
 	}
 
+	// Skipped geometries do not count towards the header
+	count := 0
+	for _, g := range geometries {
+		if writable(g) {
+			count++
+		}
+	}
+
 	// Build and write (no features/columns for geometry-only write)
-	return writeWithGenerator(w, gen, geomType, nil, nil, opts)
+	return writeWithGenerator(w, gen, geomType, nil, nil, Envelope(geometries...), count, opts)
 }
 
 // WriteFeatures writes a FeatureCollection to FlatGeobuf format.
@@ -51,6 +76,13 @@ func WriteFeatures(w io.Writer, fc *geojson.FeatureCollection, opts *Options) er
 	if fc == nil || len(fc.Features) == 0 {
 		return ErrNilGeometry
 	}
+	opts, proj, err := opts.reprojected()
+	if err != nil {
+		return err
+	}
+	if proj != nil {
+		fc = &geojson.FeatureCollection{Features: reprojectFeatures(fc.Features, proj)}
+	}
 
 	// Determine geometry type
 	geomType := flattypes.GeometryTypeUnknown
@@ -69,14 +101,22 @@ func WriteFeatures(w io.Writer, fc *geojson.FeatureCollection, opts *Options) er
 	// Get column names for property encoding
 	columnNames := getColumnNames(fc.Features)
 
+	envelope := emptyBound
+	count := 0
+	for _, f := range fc.Features {
+		if f != nil && writable(f.Geometry) {
+			envelope = extendEnvelope(envelope, f.Geometry)
+			count++
+		}
+	}
+
 	// Create feature generator (columns will be inferred inside writeWithGenerator)
 	gen := &featureCollectionGenerator{
-		features:    fc.Features,
-		columnNames: columnNames,
-		index:       0,
+		features: fc.Features,
+		index:    0,
 	}
 
-	return writeWithGenerator(w, gen, geomType, fc.Features, columnNames, opts)
+	return writeWithGenerator(w, gen, geomType, fc.Features, columnNames, envelope, count, opts)
 }
 
 // WriteFeature writes a single feature to FlatGeobuf format.
@@ -92,18 +132,82 @@ func WriteFeature(w io.Writer, f *geojson.Feature, opts *Options) error {
 	return WriteFeatures(w, fc, opts)
 }
 
-// writeWithGenerator handles the common writing logic.
+// writable reports whether a geometry is written rather than skipped by the
+// feature generators.
+func writable(g orb.Geometry) bool {
+	return g != nil && orbToFGBGeometryType(g) != flattypes.GeometryTypeUnknown
+}
+
+// writeWithGenerator handles the common writing logic. The envelope and count
+// cover the features gen will generate.
 func writeWithGenerator(
 	w io.Writer,
-	gen writer.FeatureGenerator,
+	gen featureSource,
 	geomType flattypes.GeometryType,
 	features []*geojson.Feature,
 	columnNames []string,
+	envelope orb.Bound,
+	count int,
 	opts *Options,
 ) error {
+	// Use the given schema, or infer one if we have features with properties
+	var infos []ColumnInfo
+	if len(features) > 0 {
+		if opts.Columns != nil {
+			infos = append(infos, opts.Columns...)
+		} else if len(columnNames) > 0 {
+			infos = inferColumns(features)
+		}
+	}
+
+	header, columnTypes, err := newHeader(geomType, infos, opts)
+	if err != nil {
+		return err
+	}
+	if err := checkColumns(features, infos, columnTypes, opts.BinaryEncoding); err != nil {
+		return err
+	}
+
+	// Update the generator with column info if it's a feature collection generator
+	if fcGen, ok := gen.(*featureCollectionGenerator); ok {
+		fcGen.columnNames = columnInfoNames(infos)
+		fcGen.columnTypes = columnTypes
+		fcGen.binaryEncoding = opts.BinaryEncoding
+	}
+
+	if workers := opts.concurrency(); workers > 1 && gen.len() > encodeBatchSize {
+		return writeParallel(w, header, gen, envelope, count, opts.IncludeIndex, workers)
+	}
+
+	// Without an index the header is written before any feature, so set the
+	// envelope and count up front. With one, the writer replaces the envelope
+	// with its own, which does not skip empty geometries or NaN coordinates.
+	var updater writer.HeaderUpdater
+	if opts.IncludeIndex {
+		updater = envelopeUpdater(envelopeSlice(envelope))
+	} else {
+		header.SetEnvelope(envelopeSlice(envelope))
+		header.SetFeaturesCount(uint64(count))
+	}
+
+	// Create writer with or without index
+	fgbWriter := writer.NewWriter(header, opts.IncludeIndex, gen, updater)
+
+	// Write to destination
+	if _, err := fgbWriter.Write(w); err != nil {
+		return err
+	}
+	if fcGen, ok := gen.(*featureCollectionGenerator); ok {
+		return fcGen.err
+	}
+	return nil
+}
+
+// newHeader builds a header for the options and schema, returning the type of
+// each column.
+func newHeader(geomType flattypes.GeometryType, infos []ColumnInfo, opts *Options) (*writer.Header, []flattypes.ColumnType, error) {
 	builder := flatbuffers.NewBuilder(4096)
 
-	// Create header
 	header := writer.NewHeader(builder)
 	header.SetGeometryType(geomType)
 
@@ -114,21 +218,19 @@ func writeWithGenerator(
 		header.SetDescription(opts.Description)
 	}
 
-	// Infer and set columns if we have features with properties
-	var columns []*writer.Column
-	var columnMap map[string]int
-	if len(features) > 0 && len(columnNames) > 0 {
-		columns = inferColumns(features, builder)
-		columnMap = buildColumnMap(columns, columnNames)
+	var columnTypes []flattypes.ColumnType
+	if len(infos) > 0 {
+		if opts.SortColumns {
+			sortColumns(infos)
+		}
+		columns, types, err := buildColumns(infos, builder)
+		if err != nil {
+			return nil, nil, err
+		}
+		columnTypes = types
 		header.SetColumns(columns)
 	}
 
-	// Update the generator with column info if it's a feature collection generator
-	if fcGen, ok := gen.(*featureCollectionGenerator); ok {
-		fcGen.columns = columns
-		fcGen.columnMap = columnMap
-	}
-
 	// Set CRS if provided
 	if opts.CRS != nil {
 		crs := writer.NewCrs(builder)
@@ -148,82 +250,402 @@ func writeWithGenerator(
 		}
 		header.SetCrs(crs)
 	}
+	return header, columnTypes, nil
+}
 
-	// Create writer with or without index
-	fgbWriter := writer.NewWriter(header, opts.IncludeIndex, gen, nil)
+// concurrency returns the number of encoding goroutines to use.
+func (o *Options) concurrency() int {
+	if o.Concurrency < 0 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return o.Concurrency
+}
 
-	// Write to destination
-	_, err := fgbWriter.Write(w)
-	return err
+// envelopeUpdater sets the header envelope once all features are written.
+type envelopeUpdater []float64
+
+func (e envelopeUpdater) Update(header *writer.Header) {
+	header.SetEnvelope(e)
+}
+
+// featureSource is a FeatureGenerator over a slice of inputs that can also
+// encode any input on its own, so features can be built in parallel.
+type featureSource interface {
+	writer.FeatureGenerator
+
+	// len returns the number of inputs.
+	len() int
+	// feature encodes input i with enc, returning nil if it is skipped.
+	feature(i int, enc *featureEncoder) (*writer.Feature, error)
+	// geometry returns the geometry of input i.
+	geometry(i int) orb.Geometry
+}
+
+// featureEncoder holds a builder and scratch buffers for encoding features.
+// Everything it hands out stays valid until the next reset, so one encoder
+// serves a stream of features without allocating them afresh.
+type featureEncoder struct {
+	builder *flatbuffers.Builder
+	coords  coordBuffer
+	props   bytes.Buffer
+}
+
+// encoderPool holds featureEncoders shared by all writes.
+var encoderPool = sync.Pool{
+	New: func() interface{} {
+		return &featureEncoder{builder: flatbuffers.NewBuilder(1024)}
+	},
+}
+
+// reset prepares the encoder for the next feature.
+func (e *featureEncoder) reset() {
+	e.builder.Reset()
+	e.coords.reset()
+	e.props.Reset()
+}
+
+// sequentialEncoder serves the Generate methods. The upstream writer has
+// written out a feature, and is done with it, by the time it asks for the
+// next one, so a single encoder is reset between features. It returns to the
+// pool once the generator is exhausted.
+type sequentialEncoder struct {
+	enc *featureEncoder
+}
+
+// next returns the encoder, reset for another feature.
+func (s *sequentialEncoder) next() *featureEncoder {
+	if s.enc == nil {
+		s.enc = encoderPool.Get().(*featureEncoder)
+	}
+	s.enc.reset()
+	return s.enc
+}
+
+// release returns the encoder to the pool.
+func (s *sequentialEncoder) release() {
+	if s.enc != nil {
+		encoderPool.Put(s.enc)
+		s.enc = nil
+	}
 }
 
 // geometryFeatureGenerator generates features from raw geometries.
 type geometryFeatureGenerator struct {
 	geometries []orb.Geometry
 	index      int
+	encoder    sequentialEncoder
 }
 
 func (g *geometryFeatureGenerator) Generate() *writer.Feature {
-	if g.index >= len(g.geometries) {
-		return nil
+	for ; g.index < len(g.geometries); g.index++ {
+		if feature, _ := g.feature(g.index, g.encoder.next()); feature != nil {
+			g.index++
+			return feature
+		}
 	}
+	g.encoder.release()
+	return nil
+}
+
+func (g *geometryFeatureGenerator) len() int {
+	return len(g.geometries)
+}
 
-	geom := g.geometries[g.index]
-	g.index++
+func (g *geometryFeatureGenerator) geometry(i int) orb.Geometry {
+	return g.geometries[i]
+}
 
+func (g *geometryFeatureGenerator) feature(i int, enc *featureEncoder) (*writer.Feature, error) {
+	geom := g.geometries[i]
 	if geom == nil {
-		return g.Generate() // Skip nil geometries
+		return nil, nil // Skip nil geometries
 	}
 
-	builder := flatbuffers.NewBuilder(1024)
-	fgbGeom := geometryToFGB(geom, builder)
+	fgbGeom := geometryToFGB(geom, enc.builder, &enc.coords)
 	if fgbGeom == nil {
-		return g.Generate() // Skip unsupported geometries
+		return nil, nil // Skip unsupported geometries
 	}
 
-	feature := writer.NewFeature(builder)
+	feature := writer.NewFeature(enc.builder)
 	feature.SetGeometry(fgbGeom)
 
-	return feature
+	return feature, nil
 }
 
 // featureCollectionGenerator generates features from a FeatureCollection.
 type featureCollectionGenerator struct {
-	features    []*geojson.Feature
-	columns     []*writer.Column
-	columnMap   map[string]int
-	columnNames []string
-	index       int
+	features       []*geojson.Feature
+	columnTypes    []flattypes.ColumnType
+	columnNames    []string
+	binaryEncoding BinaryEncoding
+	index          int
+	encoder        sequentialEncoder
+	err            error // First encoding error, which ends the features
 }
 
 func (g *featureCollectionGenerator) Generate() *writer.Feature {
-	if g.index >= len(g.features) {
+	for ; g.err == nil && g.index < len(g.features); g.index++ {
+		feature, err := g.feature(g.index, g.encoder.next())
+		if err != nil {
+			g.err = err
+			break
+		}
+		if feature != nil {
+			g.index++
+			return feature
+		}
+	}
+	g.encoder.release()
+	return nil
+}
+
+func (g *featureCollectionGenerator) len() int {
+	return len(g.features)
+}
+
+func (g *featureCollectionGenerator) geometry(i int) orb.Geometry {
+	if g.features[i] == nil {
 		return nil
 	}
+	return g.features[i].Geometry
+}
 
-	f := g.features[g.index]
-	g.index++
+func (g *featureCollectionGenerator) feature(i int, enc *featureEncoder) (*writer.Feature, error) {
+	feature, err := encodeFeature(g.features[i], enc, g.columnNames, g.columnTypes, g.binaryEncoding)
+	if err != nil {
+		return nil, fmt.Errorf("feature %d: %w", i, err)
+	}
+	return feature, nil
+}
 
+// encodeFeature encodes f with enc, storing the properties named by the
+// columns. It returns nil for features that are not written, and fails if a
+// property cannot be stored in its column's type.
+func encodeFeature(f *geojson.Feature, enc *featureEncoder, names []string, types []flattypes.ColumnType, binaryEncoding BinaryEncoding) (*writer.Feature, error) {
 	if f == nil || f.Geometry == nil {
-		return g.Generate() // Skip nil features/geometries
+		return nil, nil // Skip nil features/geometries
 	}
 
-	builder := flatbuffers.NewBuilder(1024)
-	fgbGeom := geometryToFGB(f.Geometry, builder)
+	fgbGeom := geometryToFGB(f.Geometry, enc.builder, &enc.coords)
 	if fgbGeom == nil {
-		return g.Generate() // Skip unsupported geometries
+		return nil, nil // Skip unsupported geometries
 	}
 
-	feature := writer.NewFeature(builder)
+	feature := writer.NewFeature(enc.builder)
 	feature.SetGeometry(fgbGeom)
 
-	// Encode properties if present
-	if f.Properties != nil && len(g.columns) > 0 {
-		propBytes := encodeProperties(f.Properties, g.columns, g.columnMap)
-		if len(propBytes) > 0 {
-			feature.SetProperties(propBytes)
+	// Encode properties if present. The builder copies them when the
+	// feature is built.
+	if f.Properties != nil && len(types) > 0 {
+		if err := appendProperties(&enc.props, f.Properties, names, types, binaryEncoding); err != nil {
+			return nil, err
+		}
+		if enc.props.Len() > 0 {
+			feature.SetProperties(enc.props.Bytes())
+		}
+	}
+
+	return feature, nil
+}
+
+// encodeBatchSize is the number of features an encoding goroutine takes at a
+// time, large enough to amortize the coordination.
+const encodeBatchSize = 256
+
+// batchPool holds buffers reused for the encoded features of a batch once
+// they have been written.
+var batchPool = sync.Pool{
+	New: func() interface{} { return new([]byte) },
+}
+
+// encodedBatch is a run of consecutive inputs encoded by one goroutine.
+type encodedBatch struct {
+	start, end int
+	data       []byte      // Size-prefixed features, back to back
+	sizes      []int       // Size of each feature in data
+	bounds     []orb.Bound // Bound of each feature in data
+	err        error       // Encoding error, which ends the batch
+	done       chan struct{}
+}
+
+// encode encodes the batch's inputs, skipping those gen does not write.
+func (b *encodedBatch) encode(gen featureSource) {
+	b.data = *batchPool.Get().(*[]byte)
+	b.sizes = make([]int, 0, b.end-b.start)
+	b.bounds = make([]orb.Bound, 0, b.end-b.start)
+
+	enc := encoderPool.Get().(*featureEncoder)
+	for i := b.start; i < b.end; i++ {
+		enc.reset()
+		feature, err := gen.feature(i, enc)
+		if err != nil {
+			b.err = err
+			break
+		}
+		if feature == nil {
+			continue
+		}
+		enc.builder.FinishSizePrefixed(feature.Build())
+		encoded := enc.builder.FinishedBytes()
+		b.data = append(b.data, encoded...)
+		b.sizes = append(b.sizes, len(encoded))
+		b.bounds = append(b.bounds, Envelope(gen.geometry(i)))
+	}
+	encoderPool.Put(enc)
+}
+
+// writeParallel writes the file like the upstream writer, but encodes
+// batches of features on workers goroutines. Batches are written in input
+// order as they complete, with a bounded number in flight, so the output
+// matches a sequential write. With an index, features are spooled to a
+// temporary file until the index over them has been written.
+func writeParallel(
+	w io.Writer,
+	header *writer.Header,
+	gen featureSource,
+	envelope orb.Bound,
+	count int,
+	includeIndex bool,
+	workers int,
+) error {
+	batches := (gen.len() + encodeBatchSize - 1) / encodeBatchSize
+	if workers > batches {
+		workers = batches
+	}
+
+	out := w
+	if includeIndex {
+		spool, err := os.CreateTemp("", "flatgeobuf_features_")
+		if err != nil {
+			return err
 		}
+		defer os.Remove(spool.Name())
+		defer spool.Close()
+		out = spool
+	} else {
+		header.SetEnvelope(envelopeSlice(envelope))
+		header.SetFeaturesCount(uint64(count))
+		if err := writeHeader(w, header); err != nil {
+			return err
+		}
+	}
+
+	jobs := make(chan *encodedBatch, workers)
+	pending := make(chan *encodedBatch, 2*workers) // Batches in input order
+	quit := make(chan struct{})
+	var wg sync.WaitGroup
+
+	go func() {
+		defer close(jobs)
+		defer close(pending)
+		for start := 0; start < gen.len(); start += encodeBatchSize {
+			end := start + encodeBatchSize
+			if end > gen.len() {
+				end = gen.len()
+			}
+			b := &encodedBatch{start: start, end: end, done: make(chan struct{})}
+			select {
+			case pending <- b:
+			case <-quit:
+				return
+			}
+			jobs <- b
+		}
+	}()
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range jobs {
+				select {
+				case <-quit:
+				default:
+					b.encode(gen)
+				}
+				close(b.done)
+			}
+		}()
+	}
+
+	// Collect the index items while writing batches in order
+	var items []packedrtree.Item
+	if includeIndex {
+		items = make([]packedrtree.Item, 0, count)
+	}
+	var offset uint64
+	var err error
+	for b := range pending {
+		<-b.done
+		if err = b.err; err != nil {
+			close(quit)
+			break
+		}
+		if _, err = out.Write(b.data); err != nil {
+			close(quit)
+			break
+		}
+		if includeIndex {
+			for i, size := range b.sizes {
+				items = append(items, packedrtree.Item{Bound: b.bounds[i], Offset: offset})
+				offset += uint64(size)
+			}
+		}
+		data := b.data[:0]
+		batchPool.Put(&data)
+	}
+	if err != nil {
+		// Let the dispatcher and workers wind down
+		for range pending {
+		}
+		wg.Wait()
+		return err
+	}
+	wg.Wait()
+
+	if !includeIndex {
+		return nil
+	}
+	return writeIndexed(w, header, out.(*os.File), items, envelope)
+}
+
+// writeIndexed writes the header and an index over items, then copies the
+// spooled features after them.
+func writeIndexed(w io.Writer, header *writer.Header, spool *os.File, items []packedrtree.Item, envelope orb.Bound) error {
+	header.SetEnvelope(envelopeSlice(envelope))
+	header.SetFeaturesCount(uint64(len(items)))
+	if len(items) == 0 {
+		header.SetIndexNodeSize(0)
+		return writeHeader(w, header)
+	}
+	header.SetIndexNodeSize(packedrtree.DefaultNodeSize)
+
+	packedrtree.HilbertSort(items)
+	tree, err := packedrtree.Build(items, packedrtree.DefaultNodeSize)
+	if err != nil {
+		return err
 	}
 
-	return feature
+	if err := writeHeader(w, header); err != nil {
+		return err
+	}
+	if _, err := tree.WriteTo(w); err != nil {
+		return err
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, spool)
+	return err
+}
+
+// writeHeader writes the magic bytes and the size-prefixed header.
+func writeHeader(w io.Writer, header *writer.Header) error {
+	if _, err := w.Write(writer.MagicBytes); err != nil {
+		return err
+	}
+	builder := header.Builder()
+	builder.FinishSizePrefixed(header.Build())
+	_, err := w.Write(builder.FinishedBytes())
+	return err
 }
@@ -2,8 +2,16 @@ package flatgeobuf
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/flatgeobuf/flatgeobuf/src/go/flattypes"
+	flatbuffers "github.com/google/flatbuffers/go"
 	"github.com/paulmach/orb"
 	"github.com/paulmach/orb/geojson"
 )
@@ -138,6 +146,56 @@ func TestWrite_NoIndex(t *testing.T) {
 	}
 }
 
+func TestWrite_Envelope(t *testing.T) {
+	nan := math.NaN()
+	fc := geojson.NewFeatureCollection()
+	fc.Append(geojson.NewFeature(orb.LineString{{1, 2}, {nan, 50}, {3, -4}}))
+	fc.Append(geojson.NewFeature(orb.LineString{}))
+	fc.Append(geojson.NewFeature(orb.Point{-6, 7}))
+	fc.Append(&geojson.Feature{Properties: geojson.Properties{}}) // Skipped
+
+	expected := [4]float64{-6, -4, 3, 7}
+	for _, includeIndex := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := WriteFeatures(&buf, fc, &Options{IncludeIndex: includeIndex}); err != nil {
+			t.Fatalf("WriteFeatures failed: %v", err)
+		}
+
+		reader, err := NewReaderFromData(buf.Bytes())
+		if err != nil {
+			t.Fatalf("NewReaderFromData failed: %v", err)
+		}
+		header := reader.Header()
+		if header.Envelope != expected {
+			t.Errorf("index %v: expected envelope %v, got %v", includeIndex, expected, header.Envelope)
+		}
+		if header.FeaturesCount != 3 {
+			t.Errorf("index %v: expected 3 features, got %d", includeIndex, header.FeaturesCount)
+		}
+		reader.Close()
+	}
+}
+
+func TestWrite_EnvelopeEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	err := Write(&buf, []orb.Geometry{orb.MultiPoint{}, orb.Point{math.NaN(), 1}}, &Options{})
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	reader, err := NewReaderFromData(buf.Bytes())
+	if err != nil {
+		t.Fatalf("NewReaderFromData failed: %v", err)
+	}
+	defer reader.Close()
+	if env := reader.Header().Envelope; env != [4]float64{} {
+		t.Errorf("expected no envelope, got %v", env)
+	}
+	if b := reader.Bounds(); !b.IsEmpty() {
+		t.Errorf("expected empty bounds, got %v", b)
+	}
+}
+
 func TestWriteFeatures_Simple(t *testing.T) {
 	fc := geojson.NewFeatureCollection()
 	fc.Append(geojson.NewFeature(orb.Point{1, 2}))
@@ -253,6 +311,322 @@ func TestWriteFeatures_ComplexGeometries(t *testing.T) {
 	}
 }
 
+func TestWriteFeatures_Deterministic(t *testing.T) {
+	fc := geojson.NewFeatureCollection()
+	for i := 0; i < 20; i++ {
+		f := geojson.NewFeature(orb.Point{float64(i), float64(i % 7)})
+		f.Properties = geojson.Properties{
+			"id":     i,
+			"name":   "feature",
+			"score":  float64(i) / 3,
+			"active": i%2 == 0,
+		}
+		if i%3 == 0 {
+			f.Properties["extra"] = "only some"
+			f.Properties["zeta"] = i * 10
+		}
+		fc.Append(f)
+	}
+
+	for _, includeIndex := range []bool{true, false} {
+		var first []byte
+		for run := 0; run < 10; run++ {
+			var buf bytes.Buffer
+			if err := WriteFeatures(&buf, fc, &Options{IncludeIndex: includeIndex}); err != nil {
+				t.Fatalf("WriteFeatures failed: %v", err)
+			}
+			if run == 0 {
+				first = buf.Bytes()
+				continue
+			}
+			if !bytes.Equal(first, buf.Bytes()) {
+				t.Fatalf("run %d (index=%v) produced different output", run, includeIndex)
+			}
+		}
+	}
+}
+
+func TestWriteFeatures_SortColumns(t *testing.T) {
+	fc := geojson.NewFeatureCollection()
+	f1 := geojson.NewFeature(orb.Point{1, 2})
+	f1.Properties = geojson.Properties{"zulu": 1, "mike": 2}
+	fc.Append(f1)
+	f2 := geojson.NewFeature(orb.Point{3, 4})
+	f2.Properties = geojson.Properties{"alpha": 3, "mike": 4}
+	fc.Append(f2)
+
+	tests := []struct {
+		sort     bool
+		expected []string
+	}{
+		{false, []string{"mike", "zulu", "alpha"}},
+		{true, []string{"alpha", "mike", "zulu"}},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		opts := &Options{IncludeIndex: true, SortColumns: tt.sort}
+		if err := WriteFeatures(&buf, fc, opts); err != nil {
+			t.Fatalf("WriteFeatures failed: %v", err)
+		}
+
+		reader, err := NewReaderFromData(buf.Bytes())
+		if err != nil {
+			t.Fatalf("NewReaderFromData failed: %v", err)
+		}
+
+		columns := reader.Header().Columns
+		if len(columns) != len(tt.expected) {
+			t.Fatalf("expected %d columns, got %d", len(tt.expected), len(columns))
+		}
+		for i, name := range tt.expected {
+			if columns[i].Name != name {
+				t.Errorf("sort=%v: column %d: expected %q, got %q", tt.sort, i, name, columns[i].Name)
+			}
+		}
+
+		// Values must still be associated with the right columns
+		result, err := reader.ReadAll()
+		if err != nil {
+			t.Fatalf("ReadAll failed: %v", err)
+		}
+		for _, f := range result.Features {
+			if v, ok := f.Properties["mike"]; !ok || (v != int32(2) && v != int32(4)) {
+				t.Errorf("sort=%v: unexpected mike value %v", tt.sort, v)
+			}
+		}
+	}
+}
+
+func TestWriteFeatures_NonNullableColumns(t *testing.T) {
+	columns := []ColumnInfo{
+		{Name: "id", Type: "Int", Nullable: false},
+		{Name: "note", Type: "String", Nullable: true},
+	}
+
+	tests := []struct {
+		name     string
+		props    geojson.Properties
+		expected error
+	}{
+		{"valid", geojson.Properties{"id": 1}, nil},
+		{"missing", geojson.Properties{"note": "no id"}, ErrNullValue},
+		{"nil", geojson.Properties{"id": nil}, ErrNullValue},
+		{"wrong type", geojson.Properties{"id": "one"}, ErrPropertyMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fc := geojson.NewFeatureCollection()
+			f := geojson.NewFeature(orb.Point{1, 2})
+			f.Properties = tt.props
+			fc.Append(f)
+
+			err := WriteFeatures(&bytes.Buffer{}, fc, &Options{Columns: columns})
+			if tt.expected == nil && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+			if tt.expected != nil && !errors.Is(err, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+// concurrentFeatures returns n features of mixed geometry types with
+// properties, including ones the writer skips.
+func concurrentFeatures(n int) *geojson.FeatureCollection {
+	fc := geojson.NewFeatureCollection()
+	for i := 0; i < n; i++ {
+		x, y := float64(i%360-180), float64(i%170-85)
+		var g orb.Geometry = orb.Point{x, y}
+		switch {
+		case i%97 == 0:
+			g = nil
+		case i%3 == 1:
+			g = orb.LineString{{x, y}, {x + 1, y + 0.5}}
+		case i%3 == 2:
+			g = orb.Polygon{{{x, y}, {x + 1, y}, {x + 1, y + 1}, {x, y}}}
+		}
+		f := geojson.NewFeature(g)
+		f.Properties = geojson.Properties{"id": i, "name": fmt.Sprintf("feature-%d", i)}
+		fc.Append(f)
+	}
+	return fc
+}
+
+func TestWriteFeatures_Concurrent(t *testing.T) {
+	fc := concurrentFeatures(3000)
+
+	write := func(concurrency int, index bool) []byte {
+		t.Helper()
+		var buf bytes.Buffer
+		opts := &Options{Name: "concurrent", IncludeIndex: index, Concurrency: concurrency}
+		if err := WriteFeatures(&buf, fc, opts); err != nil {
+			t.Fatalf("WriteFeatures failed: %v", err)
+		}
+		return buf.Bytes()
+	}
+
+	// Without an index the output is identical
+	sequential := write(0, false)
+	for _, c := range []int{2, 7, -1} {
+		if !bytes.Equal(write(c, false), sequential) {
+			t.Errorf("concurrency %d: output differs from a sequential write", c)
+		}
+	}
+
+	// With one, features and query results are identical
+	expected := readAllFeatures(t, write(0, true))
+	query := orb.Bound{Min: orb.Point{-50, -20}, Max: orb.Point{10, 30}}
+	expectedHits := searchFeatures(t, write(0, true), query)
+	for _, c := range []int{2, 7, -1} {
+		data := write(c, true)
+		if got := readAllFeatures(t, data); !reflect.DeepEqual(got, expected) {
+			t.Errorf("concurrency %d: features differ from a sequential write", c)
+		}
+		if got := searchFeatures(t, data, query); !reflect.DeepEqual(got, expectedHits) {
+			t.Errorf("concurrency %d: expected %d search results, got %d", c, len(expectedHits), len(got))
+		}
+	}
+}
+
+func TestWrite_Concurrent(t *testing.T) {
+	geometries := make([]orb.Geometry, 1000)
+	for i := range geometries {
+		geometries[i] = orb.Point{float64(i), float64(-i)}
+	}
+	geometries[10] = nil
+
+	var sequential, concurrent bytes.Buffer
+	if err := Write(&sequential, geometries, &Options{}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := Write(&concurrent, geometries, &Options{Concurrency: 4}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if !bytes.Equal(concurrent.Bytes(), sequential.Bytes()) {
+		t.Error("output differs from a sequential write")
+	}
+}
+
+// limitWriter fails once n bytes have been written.
+type limitWriter struct {
+	n int
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		return 0, io.ErrShortWrite
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestWriteFeatures_ConcurrentWriteError(t *testing.T) {
+	fc := concurrentFeatures(5000)
+	for _, index := range []bool{false, true} {
+		opts := &Options{IncludeIndex: index, Concurrency: 3}
+		err := WriteFeatures(&limitWriter{n: 10000}, fc, opts)
+		if !errors.Is(err, io.ErrShortWrite) {
+			t.Errorf("index %v: expected io.ErrShortWrite, got %v", index, err)
+		}
+	}
+}
+
+func TestFeatureEncoder_Allocs(t *testing.T) {
+	f := geojson.NewFeature(orb.Polygon{
+		{{0, 0}, {4, 0}, {4, 4}, {0, 0}},
+		{{1, 1}, {2, 1}, {2, 2}, {1, 1}},
+	})
+	f.Properties = geojson.Properties{"name": "a", "value": 1.5}
+	gen := &featureCollectionGenerator{
+		features:    []*geojson.Feature{f},
+		columnNames: []string{"name", "value"},
+		columnTypes: []flattypes.ColumnType{flattypes.ColumnTypeString, flattypes.ColumnTypeDouble},
+	}
+
+	// Once warmed up, an encoder only allocates the upstream geometry and
+	// feature wrappers
+	enc := &featureEncoder{builder: flatbuffers.NewBuilder(0)}
+	n := testing.AllocsPerRun(100, func() {
+		enc.reset()
+		feature, _ := gen.feature(0, enc)
+		enc.builder.Finish(feature.Build())
+	})
+	if n > 2 {
+		t.Errorf("encoding a feature made %v allocations, want at most 2", n)
+	}
+}
+
+func TestFeatureCollectionGenerator_EncodeError(t *testing.T) {
+	// WriteFeatures checks values up front; the generators must still stop
+	// on a value that does not fit rather than writing it as a null
+	newGen := func() *featureCollectionGenerator {
+		features := make([]*geojson.Feature, 3*encodeBatchSize)
+		for i := range features {
+			features[i] = geojson.NewFeature(orb.Point{float64(i), 0})
+			features[i].Properties = geojson.Properties{"value": float64(i)}
+		}
+		features[300].Properties["value"] = "x"
+		return &featureCollectionGenerator{
+			features:    features,
+			columnNames: []string{"value"},
+			columnTypes: []flattypes.ColumnType{flattypes.ColumnTypeDouble},
+		}
+	}
+
+	gen := newGen()
+	n := 0
+	for gen.Generate() != nil {
+		n++
+	}
+	if n != 300 || !errors.Is(gen.err, ErrPropertyMismatch) {
+		t.Errorf("expected 300 features then ErrPropertyMismatch, got %d and %v", n, gen.err)
+	}
+
+	header, _, err := newHeader(flattypes.GeometryTypePoint, []ColumnInfo{{Name: "value", Type: "Double", Nullable: true}}, DefaultOptions())
+	if err != nil {
+		t.Fatalf("newHeader failed: %v", err)
+	}
+	gen = newGen()
+	err = writeParallel(&bytes.Buffer{}, header, gen, orb.Bound{}, len(gen.features), false, 4)
+	if !errors.Is(err, ErrPropertyMismatch) || !strings.Contains(err.Error(), "feature 300") {
+		t.Errorf("expected ErrPropertyMismatch in feature 300, got %v", err)
+	}
+}
+
+// readAllFeatures returns every feature of a file.
+func readAllFeatures(t *testing.T, data []byte) []*geojson.Feature {
+	t.Helper()
+	reader, err := NewReaderFromData(data)
+	if err != nil {
+		t.Fatalf("NewReaderFromData failed: %v", err)
+	}
+	defer reader.Close()
+	fc, err := reader.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	return fc.Features
+}
+
+// searchFeatures returns the JSON encoding of the features matching query,
+// keyed by id.
+func searchFeatures(t *testing.T, data []byte, query orb.Bound) map[string]string {
+	t.Helper()
+	reader, err := NewReaderFromData(data)
+	if err != nil {
+		t.Fatalf("NewReaderFromData failed: %v", err)
+	}
+	defer reader.Close()
+	fc, err := reader.Search(query)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	return featuresByID(t, fc)
+}
+
 func TestDefaultOptions(t *testing.T) {
 	opts := DefaultOptions()
 